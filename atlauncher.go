@@ -0,0 +1,335 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	ATLAUNCHER_API string = "https://api.atlauncher.com/v1"
+	ATLAUNCHER_CDN string = "https://download.nodecdn.net/containers/atl"
+)
+
+// The directories of the game the types of the mods of ATLauncher packs go into. Types that are missing, like mods
+// that are merged into the jar of the game, are not supported.
+var atLauncherModDirs = map[string]string{
+	"mods":         "mods",
+	"coremods":     "coremods",
+	"resourcepack": "resourcepacks",
+	"texturepack":  "texturepacks",
+	"shaderpack":   "shaderpacks",
+	"plugins":      "plugins",
+	"ic2lib":       "lib",
+	"denlib":       "lib",
+}
+
+// The envelope every answer of the ATLauncher API comes in.
+type AtLauncherResponse struct {
+	Error   bool            `json:"error"`
+	Message *string         `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// A pack on ATLauncher with its versions, the newest first.
+type AtLauncherPack struct {
+	Name     string `json:"name"`
+	SafeName string `json:"safeName"`
+	Versions []struct {
+		Version   string `json:"version"`
+		Minecraft string `json:"minecraft"`
+	} `json:"versions"`
+}
+
+// What a share code points at, a version of a pack and which of its optional mods were selected.
+type AtLauncherShareCode struct {
+	Pack    string `json:"pack"`
+	Version string `json:"version"`
+	Mods    struct {
+		Optional []struct {
+			Name     string `json:"name"`
+			Selected bool   `json:"selected"`
+		} `json:"optional"`
+	} `json:"mods"`
+}
+
+// The Configs.json of a version of an ATLauncher pack. The memory is the recommended heap in MiB.
+type AtLauncherVersion struct {
+	Version   string `json:"version"`
+	Minecraft string `json:"minecraft"`
+	NoConfigs bool   `json:"noConfigs"`
+	Memory    int    `json:"memory"`
+	Loader    *struct {
+		ClassName string         `json:"className"`
+		Metadata  map[string]any `json:"metadata"`
+	} `json:"loader"`
+	Mods []AtLauncherMod `json:"mods"`
+}
+
+type AtLauncherMod struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+	File string `json:"file"`
+	// Where the file comes from: "server" for the CDN of ATLauncher, "direct" for anywhere else and "browser" for files
+	// that have to be downloaded by hand.
+	Download string `json:"download"`
+	Md5      string `json:"md5"`
+	Type     string `json:"type"`
+	// Mods are for the client unless they say otherwise.
+	Client   *bool `json:"client"`
+	Optional bool  `json:"optional"`
+	Selected bool  `json:"selected"`
+}
+
+// Returns where a mod is downloaded from, empty when it has to be downloaded by hand.
+func (this *AtLauncherMod) downloadUrl() string {
+	switch this.Download {
+	case "server":
+		{
+			return ATLAUNCHER_CDN + "/" + strings.TrimPrefix(this.Url, "/")
+		}
+	case "direct":
+		{
+			return this.Url
+		}
+	default:
+		{
+			return ""
+		}
+	}
+}
+
+// Finds the mod loader of a pack version from the class ATLauncher installs it with, like
+// com.atlauncher.data.minecraft.loaders.fabric.FabricLoader.
+func (this *AtLauncherVersion) loader() *InstanceLoader {
+	if this.Loader == nil {
+		return nil
+	}
+	parts := strings.Split(this.Loader.ClassName, ".")
+	if len(parts) < 2 {
+		return nil
+	}
+	version := ""
+	keys := []string{"loader", "version"}
+	for i := range keys {
+		value, ok := this.Loader.Metadata[keys[i]].(string)
+		if ok && value != "" {
+			version = value
+			break
+		}
+	}
+	return foreignLoader(parts[len(parts)-2], version)
+}
+
+// Downloads an answer of the ATLauncher API and deserializes the data of it.
+func downloadAtLauncher(path string, structure any) error {
+	var response AtLauncherResponse
+	err := downloadJsonRaw(ATLAUNCHER_API+path, nil, &response)
+	if err != nil {
+		return err
+	}
+	if response.Error || len(response.Data) == 0 || string(response.Data) == "null" {
+		message := "no data"
+		if response.Message != nil {
+			message = *response.Message
+		}
+		return errors.New("ATLauncher answered " + message)
+	}
+	return json.Unmarshal(response.Data, structure)
+}
+
+// Creates an instance from a version of an ATLauncher pack: downloads the mods that are selected into the game
+// directory and extracts the configs of the pack on top. The selection is a map of the names of the optional mods,
+// optional mods that are not in it use their default.
+func installAtLauncherPack(base string, pack string, definition *AtLauncherVersion, selection map[string]bool, name string) error {
+	if definition.Minecraft == "" {
+		return errors.New("the pack does not say which version of the game it needs")
+	}
+	if name == "" {
+		name = sanitizeInstanceName(pack)
+	}
+	err := validateInstanceName(name)
+	if err != nil {
+		return err
+	}
+	if fileExists(instanceDir(base, name) + "/instance.json") {
+		return errors.New("instance " + name + " already exists")
+	}
+
+	instance := &Instance{
+		Name:       name,
+		Version:    definition.Minecraft,
+		Loader:     definition.loader(),
+		PackSource: "atlauncher:" + pack + "@" + definition.Version,
+	}
+	if definition.Memory > 0 {
+		instance.MaxHeap = fmt.Sprintf("%dM", definition.Memory)
+	}
+	gameDir := instance.gameDir(base)
+
+	provenance.setPack(pack + " " + definition.Version)
+	defer provenance.setPack("")
+	var manual []string
+	batch := downloadPool.batch("Pack")
+	for i := range definition.Mods {
+		mod := &definition.Mods[i]
+		if mod.Client != nil && !*mod.Client {
+			continue
+		}
+		if mod.Optional {
+			selected, ok := selection[mod.Name]
+			if !ok {
+				selected = mod.Selected
+			}
+			if !selected {
+				continue
+			}
+		}
+		dir, ok := atLauncherModDirs[mod.Type]
+		if !ok {
+			fmt.Printf("Skipping %s, mods of type %s are not supported\n", mod.Name, mod.Type)
+			continue
+		}
+		source := mod.downloadUrl()
+		if source == "" {
+			manual = append(manual, mod.Name+" from "+mod.Url)
+			continue
+		}
+		target, err := resolvePackPath(gameDir, dir+"/"+mod.File)
+		if err != nil {
+			_ = batch.wait()
+			return err
+		}
+		var hash *string
+		if mod.Md5 != "" {
+			hash = md5Hash(mod.Md5)
+		}
+		batch.submit(func() error {
+			return downloadFileRaw(target, source, hash, 0, batch.progress)
+		})
+	}
+	err = batch.wait()
+	if err != nil {
+		return errors.Join(errors.New("failed to download the mods of "+pack), err)
+	}
+
+	if !definition.NoConfigs {
+		err = extractAtLauncherConfigs(base, pack, definition.Version, gameDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = commitInstance(base, instance)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %s %s as instance %s (%s)\n", pack, definition.Version, name, definition.Minecraft)
+	warnLoaderNotInstalled(instance)
+	if len(manual) > 0 {
+		fmt.Printf("These mods have to be downloaded by hand into %s:\n", gameDir)
+		for i := range manual {
+			fmt.Printf("  %s\n", manual[i])
+		}
+	}
+	return nil
+}
+
+// Downloads the zip with the configs of a version of a pack and extracts it into the game directory.
+func extractAtLauncherConfigs(base string, pack string, version string, gameDir string) error {
+	file, err := os.CreateTemp(base, "atlauncher-configs-*.zip")
+	if err != nil {
+		return errors.Join(errors.New("failed to create a file for the configs of "+pack), err)
+	}
+	path := file.Name()
+	_ = file.Close()
+	defer func() {
+		_ = os.Remove(path)
+	}()
+
+	err = downloadFileRaw(path, ATLAUNCHER_CDN+"/packs/"+url.PathEscape(pack)+"/versions/"+url.PathEscape(version)+"/Configs.zip", nil, 0, nil)
+	if err != nil {
+		return errors.Join(errors.New("failed to download the configs of "+pack), err)
+	}
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return errors.Join(errors.New("failed to open the configs of "+pack), err)
+	}
+	defer func() {
+		_ = archive.Close()
+	}()
+	return extractPackOverrides(&archive.Reader, "", gameDir)
+}
+
+func packAtLauncherCommand(base string, args []string) error {
+	set := flag.NewFlagSet("pack atlauncher", flag.ContinueOnError)
+	name := set.String("name", "", "the name of the new instance, defaults to the name of the pack")
+	version := set.String("version", "", "the version of the pack, defaults to the newest one")
+	shareCode := set.String("share-code", "", "a share code of ATLauncher, selects the pack, its version and its optional mods")
+	definitionFile := set.String("definition", "", "a Configs.json to use instead of the one of the version of the pack")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+
+	pack := ""
+	selection := map[string]bool{}
+	if *shareCode != "" {
+		if len(positional) != 0 {
+			return errors.New("a share code already selects the pack")
+		}
+		var code AtLauncherShareCode
+		err = downloadAtLauncher("/share-code/"+url.PathEscape(*shareCode), &code)
+		if err != nil {
+			return errors.Join(errors.New("failed to look up share code "+*shareCode), err)
+		}
+		pack = code.Pack
+		*version = code.Version
+		for i := range code.Mods.Optional {
+			selection[code.Mods.Optional[i].Name] = code.Mods.Optional[i].Selected
+		}
+	} else {
+		if len(positional) != 1 {
+			return errors.New("expected exactly one pack or a share code")
+		}
+		pack = positional[0]
+	}
+
+	var info AtLauncherPack
+	err = downloadAtLauncher("/pack/"+url.PathEscape(pack), &info)
+	if err != nil {
+		return errors.Join(errors.New("failed to look up ATLauncher pack "+pack), err)
+	}
+	if *version == "" {
+		if len(info.Versions) == 0 {
+			return errors.New("ATLauncher pack " + pack + " has no versions")
+		}
+		*version = info.Versions[0].Version
+	}
+
+	var definition AtLauncherVersion
+	if *definitionFile != "" {
+		err = readJson(*definitionFile, &definition)
+		if err != nil {
+			return errors.Join(errors.New("failed to read "+*definitionFile), err)
+		}
+	} else {
+		err = downloadJsonRaw(ATLAUNCHER_CDN+"/packs/"+url.PathEscape(info.SafeName)+"/versions/"+url.PathEscape(*version)+"/Configs.json", nil, &definition)
+		if err != nil {
+			return errors.Join(errors.New("failed to download version "+*version+" of "+pack), err)
+		}
+	}
+	if definition.Version == "" {
+		definition.Version = *version
+	}
+	if *name == "" {
+		*name = sanitizeInstanceName(info.Name)
+	}
+	return installAtLauncherPack(base, info.SafeName, &definition, selection, *name)
+}
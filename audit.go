@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// A category of URLs the launcher may contact. Some of them are not configured in the launcher but come from the
+// manifests it downloads, those can only be listed by example.
+type Endpoint struct {
+	Category     string
+	Url          string
+	FromManifest bool
+}
+
+// Returns every category of URLs the launcher may contact.
+func endpoints() []Endpoint {
+	return []Endpoint{
+		{
+			Category: "Version manifest",
+			Url:      URL_VERSION_MANIFEST,
+		},
+		{
+			Category:     "Version details and client jars",
+			Url:          "https://piston-data.mojang.com/",
+			FromManifest: true,
+		},
+		{
+			Category:     "Libraries",
+			Url:          "https://libraries.minecraft.net/",
+			FromManifest: true,
+		},
+		{
+			Category: "Assets",
+			Url:      URL_RESOURCES,
+		},
+		{
+			Category: "Java runtime releases",
+			Url:      URL_ADOPTIUM_API,
+		},
+		{
+			Category:     "Java runtime archives",
+			Url:          "https://github.com/adoptium/",
+			FromManifest: true,
+		},
+	}
+}
+
+// What was transferred from a single host.
+type HostAudit struct {
+	Requests uint64 `json:"requests"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+var hostAudits = map[string]*HostAudit{}
+var hostAuditsLock sync.Mutex
+
+func recordTransfer(host string, requests uint64, bytes uint64) {
+	hostAuditsLock.Lock()
+	defer hostAuditsLock.Unlock()
+
+	audit, ok := hostAudits[host]
+	if !ok {
+		audit = &HostAudit{}
+		hostAudits[host] = audit
+	}
+	audit.Requests += requests
+	audit.Bytes += bytes
+}
+
+// Counts the bytes read from the body of a response.
+type auditReader struct {
+	reader io.ReadCloser
+	host   string
+}
+
+func (this *auditReader) Read(buffer []byte) (int, error) {
+	read, err := this.reader.Read(buffer)
+	recordTransfer(this.host, 0, uint64(read))
+	return read, err
+}
+
+func (this *auditReader) Close() error {
+	return this.reader.Close()
+}
+
+// Saves the hosts contacted during this run so "audit endpoints" can show them later. Nothing is saved when no host
+// was contacted.
+func saveHostAudit(base string) error {
+	hostAuditsLock.Lock()
+	defer hostAuditsLock.Unlock()
+
+	if len(hostAudits) == 0 {
+		return nil
+	}
+
+	err := writeJson(base+"/audit.json", hostAudits)
+	if err != nil {
+		return errors.Join(errors.New("failed to save contacted hosts"), err)
+	}
+	return nil
+}
+
+var auditCommands = []Command{
+	{
+		Name:        "endpoints",
+		Usage:       "",
+		Description: "Lists every kind of URL the launcher may contact and the hosts contacted during the last run",
+		Run:         auditEndpointsCommand,
+	},
+}
+
+func auditCommand(base string, args []string) error {
+	return runCommand(auditCommands, base, args)
+}
+
+func auditEndpointsCommand(base string, args []string) error {
+	if len(args) != 0 {
+		return errors.New("expected no arguments")
+	}
+
+	fmt.Println("Endpoints:")
+	list := endpoints()
+	for i := range list {
+		endpoint := list[i]
+		if endpoint.FromManifest {
+			fmt.Printf("  %-32s %s (from manifests)\n", endpoint.Category, rewriteUrl(endpoint.Url))
+		} else {
+			fmt.Printf("  %-32s %s\n", endpoint.Category, rewriteUrl(endpoint.Url))
+		}
+
+		candidates := candidateUrls(endpoint.Url)
+		for o := 0; o < len(candidates)-1; o++ {
+			fmt.Printf("  %-32s %s (mirror, tried first)\n", "", rewriteUrl(candidates[o]))
+		}
+	}
+
+	if config.Network.Proxy != "" {
+		fmt.Printf("All requests go through the proxy %s\n", config.Network.Proxy)
+	}
+
+	path := base + "/audit.json"
+	if !fileExists(path) {
+		fmt.Println("No hosts have been contacted yet")
+		return nil
+	}
+
+	var audits map[string]HostAudit
+	err := readJson(path, &audits)
+	if err != nil {
+		return err
+	}
+
+	hosts := make([]string, 0, len(audits))
+	for host := range audits {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	fmt.Println("Hosts contacted during the last run:")
+	for i := range hosts {
+		audit := audits[hosts[i]]
+		fmt.Printf("  %-32s %d requests, %d bytes\n", hosts[i], audit.Requests, audit.Bytes)
+	}
+	return nil
+}
@@ -0,0 +1,832 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Every backup is a zip of the whole world.
+	BACKUP_MODE_ARCHIVE string = "archive"
+	// Worlds are split into chunks by their content and only chunks that are not stored yet are written, so backups of
+	// large worlds that change a little cost little.
+	BACKUP_MODE_CHUNKED string = "chunked"
+
+	BACKUPS_DIR         string = "backups"
+	BACKUP_CHUNKS_DIR   string = "backup-chunks"
+	BACKUP_TIME_FORMAT  string = "20060102-150405"
+	BACKUP_ARCHIVE_EXT  string = ".zip"
+	BACKUP_SNAPSHOT_EXT string = ".json"
+
+	// The sizes of chunks, boundaries are found where the bits of the rolling hash in BACKUP_CHUNK_MASK are all zero so
+	// chunks are about 64 KiB on average.
+	BACKUP_CHUNK_MIN  int    = 16 * 1024
+	BACKUP_CHUNK_MAX  int    = 256 * 1024
+	BACKUP_CHUNK_MASK uint64 = 0xffff << 48
+)
+
+// How worlds are backed up.
+type BackupConfig struct {
+	// BACKUP_MODE_ARCHIVE or BACKUP_MODE_CHUNKED, archives when empty.
+	Mode string `json:"mode"`
+	// Where backups are pushed to, nothing is pushed when it has no URL.
+	Remote BackupRemote `json:"remote"`
+}
+
+// A file of a world in a chunked backup.
+type BackupFile struct {
+	Path    string      `json:"path"`
+	Mode    fs.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"modTime"`
+	// The SHA-256 hashes of the chunks of the file in order.
+	Chunks []string `json:"chunks"`
+}
+
+// A chunked backup of a world, the chunks are shared by every backup in BACKUP_CHUNKS_DIR.
+type BackupSnapshot struct {
+	World string       `json:"world"`
+	Time  time.Time    `json:"time"`
+	Files []BackupFile `json:"files"`
+	// The bytes of chunks that were new when the backup was made.
+	Added uint64 `json:"added"`
+}
+
+// A backup of a world, either an archive or a snapshot.
+type Backup struct {
+	Name string
+	Path string
+	Size uint64
+}
+
+// A table of random numbers for the rolling hash, derived from SHA-256 so every launcher chunks the same way.
+var backupGear = func() [256]uint64 {
+	var gear [256]uint64
+	for i := range gear {
+		digest := sha256.Sum256([]byte{byte(i)})
+		gear[i] = binary.BigEndian.Uint64(digest[:8])
+	}
+	return gear
+}()
+
+// Returns the directory the backups of a world are kept in.
+func backupDir(base string, instance *Instance, world string) string {
+	return base + "/" + BACKUPS_DIR + "/" + instance.Name + "/" + world
+}
+
+// Returns where a chunk with a hash is stored.
+func backupChunkPath(base string, hash string) string {
+	return base + "/" + BACKUP_CHUNKS_DIR + "/" + hash[:2] + "/" + hash
+}
+
+// Returns the directory of a world of an instance, it has to exist.
+func worldDir(base string, instance *Instance, world string) (string, error) {
+	dir, err := resolvePackPath(instance.gameDir(base)+"/saves", world)
+	if err != nil || strings.Contains(world, "/") || !fileExists(dir+"/level.dat") {
+		return "", errors.New("instance " + instance.Name + " has no world " + world)
+	}
+	return dir, nil
+}
+
+// Lists the files of a world, the lock the game holds while it runs is left out.
+func listWorldFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || entry.Name() == "session.lock" {
+			return nil
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relative))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// Backs up a world of an instance in the configured mode. Returns the backup that was made.
+func backupWorld(base string, instance *Instance, world string) (*Backup, error) {
+	dir, err := worldDir(base, instance, world)
+	if err != nil {
+		return nil, err
+	}
+	files, err := listWorldFiles(dir)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to list the files of "+world), err)
+	}
+
+	target := backupDir(base, instance, world)
+	err = createParents(target)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to create "+target), err)
+	}
+	now := time.Now()
+	name := now.Format(BACKUP_TIME_FORMAT)
+	if fileExists(target+"/"+name+BACKUP_SNAPSHOT_EXT) || fileExists(target+"/"+name+BACKUP_ARCHIVE_EXT) {
+		return nil, errors.New(world + " was backed up less than a second ago")
+	}
+
+	if config.Backups.Mode == BACKUP_MODE_CHUNKED {
+		snapshot := &BackupSnapshot{
+			World: world,
+			Time:  now,
+		}
+		for i := range files {
+			err = checkInterrupted()
+			if err != nil {
+				return nil, err
+			}
+			file, added, err := storeBackupFile(base, dir, files[i])
+			if err != nil {
+				return nil, errors.Join(errors.New("failed to back up "+files[i]), err)
+			}
+			snapshot.Files = append(snapshot.Files, *file)
+			snapshot.Added += added
+		}
+		path := target + "/" + name + BACKUP_SNAPSHOT_EXT
+		err = writeJson(path, snapshot)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to write "+path), err)
+		}
+		return &Backup{
+			Name: name,
+			Path: path,
+			Size: snapshot.Added,
+		}, nil
+	}
+
+	path := target + "/" + name + BACKUP_ARCHIVE_EXT
+	err = writeWorldArchive(dir, files, path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Backup{
+		Name: name,
+		Path: path,
+		Size: uint64(info.Size()),
+	}, nil
+}
+
+// Writes a zip of the files of a world.
+func writeWorldArchive(dir string, files []string, output string) error {
+	file, err := createFile(output + ".part")
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+output), err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(output + ".part")
+	}()
+
+	writer := zip.NewWriter(file)
+	for i := range files {
+		err = checkInterrupted()
+		if err != nil {
+			return err
+		}
+		err = func() error {
+			in, err := openFile(dir + "/" + files[i])
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = in.Close()
+			}()
+			out, err := writer.CreateHeader(&zip.FileHeader{
+				Name:   files[i],
+				Method: zip.Deflate,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, in)
+			return err
+		}()
+		if err != nil {
+			return errors.Join(errors.New("failed to add "+files[i]+" to "+output), err)
+		}
+	}
+
+	err = writer.Close()
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+output), err)
+	}
+	return renameFile(output+".part", output)
+}
+
+// Reads the next chunk of a file. Boundaries depend on the content only, so data that moves within a file still ends up
+// in the same chunks.
+func nextBackupChunk(reader *bufio.Reader, buffer []byte) ([]byte, error) {
+	chunk := buffer[:0]
+	var hash uint64
+	for len(chunk) < BACKUP_CHUNK_MAX {
+		value, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunk = append(chunk, value)
+		hash = hash<<1 + backupGear[value]
+		if len(chunk) >= BACKUP_CHUNK_MIN && hash&BACKUP_CHUNK_MASK == 0 {
+			break
+		}
+	}
+	return chunk, nil
+}
+
+// Splits a file into chunks and stores the ones that are not stored yet. Returns the file and the bytes of new chunks.
+func storeBackupFile(base string, dir string, name string) (*BackupFile, uint64, error) {
+	path := dir + "/" + name
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	in, err := openFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	file := &BackupFile{
+		Path:    name,
+		Mode:    info.Mode().Perm(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	var added uint64
+	reader := bufio.NewReader(in)
+	buffer := make([]byte, 0, BACKUP_CHUNK_MAX)
+	for {
+		chunk, err := nextBackupChunk(reader, buffer)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+
+		digest := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(digest[:])
+		file.Chunks = append(file.Chunks, hash)
+		stored, err := writeBackupChunk(base, hash, chunk)
+		if err != nil {
+			return nil, 0, err
+		}
+		if stored {
+			added += uint64(len(chunk))
+		}
+	}
+	return file, added, nil
+}
+
+// Stores a chunk compressed with gzip unless it is stored already. Returns whether it was stored.
+func writeBackupChunk(base string, hash string, chunk []byte) (bool, error) {
+	path := backupChunkPath(base, hash)
+	if fileExists(path) {
+		return false, nil
+	}
+	err := createParents(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+
+	out, err := createFile(path + ".part")
+	if err != nil {
+		return false, err
+	}
+	stream := gzip.NewWriter(out)
+	_, err = stream.Write(chunk)
+	if err == nil {
+		err = stream.Close()
+	}
+	_ = out.Close()
+	if err == nil {
+		err = renameFile(path+".part", path)
+	}
+	if err != nil {
+		_ = os.Remove(path + ".part")
+		return false, err
+	}
+	return true, nil
+}
+
+// Copies a stored chunk into a file, checking its hash on the way.
+func readBackupChunk(base string, hash string, out io.Writer) error {
+	in, err := openFile(backupChunkPath(base, hash))
+	if err != nil {
+		return errors.Join(errors.New("the backup store is missing the chunk "+hash), err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	stream, err := gzip.NewReader(in)
+	if err != nil {
+		return errors.Join(errors.New("the chunk "+hash+" is corrupt"), err)
+	}
+
+	digest := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, digest), stream)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(digest.Sum(nil)) != hash {
+		return errors.New("the chunk " + hash + " is corrupt")
+	}
+	return nil
+}
+
+// Lists the backups of a world, oldest first.
+func listBackups(base string, instance *Instance, world string) ([]Backup, error) {
+	dir := backupDir(base, instance, world)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Join(errors.New("failed to list the backups of "+world), err)
+	}
+
+	var backups []Backup
+	for i := range entries {
+		name := entries[i].Name()
+		if !strings.HasSuffix(name, BACKUP_ARCHIVE_EXT) && !strings.HasSuffix(name, BACKUP_SNAPSHOT_EXT) {
+			continue
+		}
+		backup := Backup{
+			Name: strings.TrimSuffix(strings.TrimSuffix(name, BACKUP_ARCHIVE_EXT), BACKUP_SNAPSHOT_EXT),
+			Path: dir + "/" + name,
+		}
+		if strings.HasSuffix(name, BACKUP_SNAPSHOT_EXT) {
+			var snapshot BackupSnapshot
+			err = readJson(backup.Path, &snapshot)
+			if err != nil {
+				return nil, err
+			}
+			backup.Size = snapshot.Added
+		} else {
+			info, err := entries[i].Info()
+			if err != nil {
+				return nil, err
+			}
+			backup.Size = uint64(info.Size())
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(a int, b int) bool {
+		return backups[a].Name < backups[b].Name
+	})
+	return backups, nil
+}
+
+// Restores a backup into a directory that must not exist yet. The world is put together next to it first, so a failed
+// restore leaves nothing behind.
+func restoreBackup(base string, backup *Backup, target string) error {
+	if fileExists(target) {
+		return errors.New(target + " already exists")
+	}
+	temporary := target + ".part"
+	err := removeAll(temporary)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = removeAll(temporary)
+	}()
+
+	if strings.HasSuffix(backup.Path, BACKUP_SNAPSHOT_EXT) {
+		err = restoreSnapshot(base, backup.Path, temporary)
+	} else {
+		err = restoreArchive(backup.Path, temporary)
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to restore "+backup.Name), err)
+	}
+	return renameFile(temporary, target)
+}
+
+func restoreSnapshot(base string, path string, target string) error {
+	var snapshot BackupSnapshot
+	err := readJson(path, &snapshot)
+	if err != nil {
+		return err
+	}
+
+	for i := range snapshot.Files {
+		err = checkInterrupted()
+		if err != nil {
+			return err
+		}
+		file := &snapshot.Files[i]
+		destination, err := resolvePackPath(target, file.Path)
+		if err != nil {
+			return err
+		}
+		err = createParents(filepath.Dir(destination))
+		if err != nil {
+			return err
+		}
+		err = func() error {
+			out, err := createFileWithPerms(destination, file.Mode)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = out.Close()
+			}()
+			for o := range file.Chunks {
+				err = readBackupChunk(base, file.Chunks[o], out)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			return errors.Join(errors.New("failed to restore "+file.Path), err)
+		}
+		_ = os.Chtimes(destination, file.ModTime, file.ModTime)
+	}
+	return nil
+}
+
+func restoreArchive(path string, target string) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	for i := range reader.File {
+		err = checkInterrupted()
+		if err != nil {
+			return err
+		}
+		file := reader.File[i]
+		destination, err := resolvePackPath(target, file.Name)
+		if err != nil {
+			return err
+		}
+		err = createParents(filepath.Dir(destination))
+		if err == nil {
+			err = extractZipFile(file, destination)
+		}
+		if err != nil {
+			return errors.Join(errors.New("failed to restore "+file.Name), err)
+		}
+	}
+	return nil
+}
+
+// Deletes the chunks no snapshot of any instance uses anymore. Returns how many bytes were freed.
+func collectBackupChunks(base string) (uint64, error) {
+	used := map[string]bool{}
+	err := filepath.WalkDir(base+"/"+BACKUPS_DIR, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(path, BACKUP_SNAPSHOT_EXT) {
+			return nil
+		}
+		var snapshot BackupSnapshot
+		err = readJson(path, &snapshot)
+		if err != nil {
+			return err
+		}
+		for i := range snapshot.Files {
+			for o := range snapshot.Files[i].Chunks {
+				used[snapshot.Files[i].Chunks[o]] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to find the chunks that are in use"), err)
+	}
+
+	var freed uint64
+	err = filepath.WalkDir(base+"/"+BACKUP_CHUNKS_DIR, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || used[entry.Name()] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+		freed += uint64(info.Size())
+		return nil
+	})
+	return freed, err
+}
+
+var backupCommands = []Command{
+	{
+		Name:        "create",
+		Usage:       "<instance> <world>",
+		Description: "Backs up a world of an instance",
+		Run:         backupCreateCommand,
+	},
+	{
+		Name:        "list",
+		Usage:       "<instance> <world> [--remote]",
+		Description: "Lists the backups of a world, or the ones pushed to the remote",
+		Run:         backupListCommand,
+	},
+	{
+		Name:        "restore",
+		Usage:       "<instance> <world> [backup] [--as <world>] [--from remote]",
+		Description: "Restores the newest or the named backup of a world next to the world, pulling it from the remote first with --from remote",
+		Run:         backupRestoreCommand,
+	},
+	{
+		Name:        "push",
+		Usage:       "<instance> <world> [backup]",
+		Description: "Encrypts the newest or the named backup of a world and pushes it to the remote",
+		Run:         backupPushCommand,
+	},
+	{
+		Name:        "keygen",
+		Usage:       "<file>",
+		Description: "Creates a key for encrypting pushed backups, it is needed on every machine that restores them",
+		Run:         backupKeygenCommand,
+	},
+	{
+		Name:        "prune",
+		Usage:       "<instance> <world> [--keep <n>]",
+		Description: "Deletes all but the newest backups of a world",
+		Run:         backupPruneCommand,
+	},
+}
+
+func backupCommand(base string, args []string) error {
+	err := unlockConfigSection("backups")
+	if err != nil {
+		return err
+	}
+	return runCommand(backupCommands, base, args)
+}
+
+func backupCreateCommand(base string, args []string) error {
+	if len(args) != 2 {
+		return errors.New("expected an instance and a world")
+	}
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	backup, err := backupWorld(base, instance, args[1])
+	if err != nil {
+		return err
+	}
+	if config.Backups.Mode == BACKUP_MODE_CHUNKED {
+		fmt.Printf("Backed up %s as %s, %s of new data\n", args[1], backup.Name, formatBytes(float64(backup.Size)))
+	} else {
+		fmt.Printf("Backed up %s as %s, %s\n", args[1], backup.Name, formatBytes(float64(backup.Size)))
+	}
+
+	if config.Backups.Remote.Url != "" && config.Backups.Remote.Push {
+		err = pushBackup(base, instance, args[1], backup)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pushed %s to %s\n", backup.Name, config.Backups.Remote.Url)
+	}
+	return nil
+}
+
+func backupListCommand(base string, args []string) error {
+	set := flag.NewFlagSet("backup list", flag.ContinueOnError)
+	remote := set.Bool("remote", false, "list the backups pushed to the remote instead")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("expected an instance and a world")
+	}
+	instance, err := loadInstance(base, positional[0])
+	if err != nil {
+		return err
+	}
+
+	var backups []Backup
+	if *remote {
+		backups, err = listRemoteBackups(instance, positional[1])
+	} else {
+		backups, err = listBackups(base, instance, positional[1])
+	}
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Printf("%s has no backups\n", positional[1])
+		return nil
+	}
+	for i := range backups {
+		mode := BACKUP_MODE_ARCHIVE
+		if strings.HasSuffix(backups[i].Path, BACKUP_SNAPSHOT_EXT) {
+			mode = BACKUP_MODE_CHUNKED
+		} else if *remote {
+			mode = "pushed"
+		}
+		fmt.Printf("%s  %-8s %s\n", backups[i].Name, mode, formatBytes(float64(backups[i].Size)))
+	}
+	return nil
+}
+
+func backupRestoreCommand(base string, args []string) error {
+	set := flag.NewFlagSet("backup restore", flag.ContinueOnError)
+	as := set.String("as", "", "the name of the restored world, defaults to the world with the backup appended")
+	from := set.String("from", "local", "where the backup is, local or remote")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 && len(positional) != 3 {
+		return errors.New("expected an instance, a world and optionally a backup")
+	}
+	if *from != "local" && *from != "remote" {
+		return errors.New("--from must be local or remote")
+	}
+	instance, err := loadInstance(base, positional[0])
+	if err != nil {
+		return err
+	}
+	world := positional[1]
+
+	var backups []Backup
+	if *from == "remote" {
+		backups, err = listRemoteBackups(instance, world)
+	} else {
+		backups, err = listBackups(base, instance, world)
+	}
+	if err != nil {
+		return err
+	}
+	backup, err := findBackup(backups, world, positional[2:])
+	if err != nil {
+		return err
+	}
+	if *from == "remote" {
+		backup, err = pullBackup(base, instance, world, backup)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *as == "" {
+		*as = world + " " + backup.Name
+	}
+	target, err := resolvePackPath(instance.gameDir(base)+"/saves", *as)
+	if err != nil || strings.Contains(*as, "/") {
+		return errors.New("invalid world name " + *as)
+	}
+	err = restoreBackup(base, backup, target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s of %s as %s\n", backup.Name, world, *as)
+	return nil
+}
+
+// Picks the named backup, or the newest one when there is no name.
+func findBackup(backups []Backup, world string, name []string) (*Backup, error) {
+	if len(backups) == 0 {
+		return nil, errors.New(world + " has no backups")
+	}
+	if len(name) == 0 {
+		return &backups[len(backups)-1], nil
+	}
+	for i := range backups {
+		if backups[i].Name == name[0] {
+			return &backups[i], nil
+		}
+	}
+	return nil, errors.New(world + " has no backup " + name[0])
+}
+
+func backupPushCommand(base string, args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return errors.New("expected an instance, a world and optionally a backup")
+	}
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+	backups, err := listBackups(base, instance, args[1])
+	if err != nil {
+		return err
+	}
+	backup, err := findBackup(backups, args[1], args[2:])
+	if err != nil {
+		return err
+	}
+
+	err = pushBackup(base, instance, args[1], backup)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Pushed %s of %s to %s\n", backup.Name, args[1], config.Backups.Remote.Url)
+	return nil
+}
+
+func backupKeygenCommand(_ string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a file")
+	}
+	err := createBackupKey(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created %s, keep a copy somewhere safe, pushed backups can not be restored without it\n", args[0])
+	return nil
+}
+
+func backupPruneCommand(base string, args []string) error {
+	set := flag.NewFlagSet("backup prune", flag.ContinueOnError)
+	keep := set.Int("keep", 5, "how many of the newest backups to keep")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("expected an instance and a world")
+	}
+	if *keep < 1 {
+		return errors.New("--keep must be at least 1")
+	}
+	instance, err := loadInstance(base, positional[0])
+	if err != nil {
+		return err
+	}
+
+	backups, err := listBackups(base, instance, positional[1])
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for i := 0; i < len(backups)-*keep; i++ {
+		err = os.Remove(backups[i].Path)
+		if err != nil {
+			return errors.Join(errors.New("failed to delete "+backups[i].Path), err)
+		}
+		deleted++
+	}
+
+	freed, err := collectBackupChunks(base)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d backups of %s", deleted, positional[1])
+	if freed > 0 {
+		fmt.Printf(", freed %s of chunks", formatBytes(float64(freed)))
+	}
+	fmt.Println()
+	return nil
+}
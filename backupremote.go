@@ -0,0 +1,750 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	BACKUP_REMOTE_S3     string = "s3"
+	BACKUP_REMOTE_WEBDAV string = "webdav"
+
+	// Pushed backups are encrypted zips of the world, named after the backup with this appended.
+	BACKUP_REMOTE_EXT string = ".zip.enc"
+	// Every encrypted backup starts with this, followed by the random prefix of its nonces.
+	BACKUP_CRYPT_MAGIC string = "go-launcher backup 1\n"
+	// Backups are encrypted in segments so they never have to fit in memory. The counter of the last segment has its
+	// top bit set, so a backup that was cut short does not decrypt.
+	BACKUP_CRYPT_SEGMENT int    = 64 * 1024
+	BACKUP_CRYPT_LAST    uint32 = 1 << 31
+	BACKUP_KEY_SIZE      int    = 32
+
+	BACKUP_REMOTE_LIST_MAX_SIZE int64 = 16 * 1024 * 1024
+)
+
+// Returned when a backup does not decrypt, downloading it again does not help.
+var errBackupUndecryptable = errors.New("the backup can not be decrypted, the key is wrong or the backup was changed")
+
+// Where backups are pushed to. Backups are encrypted before they leave the machine, the remote never sees a world.
+type BackupRemote struct {
+	// BACKUP_REMOTE_S3 or BACKUP_REMOTE_WEBDAV.
+	Type string `json:"type"`
+	// For S3 the endpoint with the bucket as the path, like https://s3.eu-central-1.amazonaws.com/my-backups. For WebDAV
+	// the collection backups are stored in.
+	Url string `json:"url"`
+	// The region of the bucket for S3, us-east-1 when empty.
+	Region string `json:"region"`
+	// The access key and secret for S3, the user and password for WebDAV.
+	User     string `json:"user"`
+	Password string `json:"password"`
+	// A file with the key backups are encrypted with, created by "backup keygen". Without the key the backups can not be
+	// restored, it has to be copied to every machine that restores them.
+	KeyFile string `json:"keyFile"`
+	// Whether "backup create" pushes every backup right after making it.
+	Push bool `json:"push"`
+}
+
+// Checks the remote backup settings.
+func (this *BackupRemote) validate() error {
+	if this.Url == "" {
+		return nil
+	}
+	var err error
+	switch this.Type {
+	case BACKUP_REMOTE_S3, BACKUP_REMOTE_WEBDAV:
+	default:
+		{
+			err = errors.Join(err, errors.New("unknown backups.remote.type "+this.Type))
+		}
+	}
+	parsed, urlErr := url.Parse(this.Url)
+	if urlErr != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		err = errors.Join(err, errors.New("backups.remote.url must be an http or https URL"))
+	}
+	if this.KeyFile == "" {
+		err = errors.Join(err, errors.New("backups.remote.keyFile is required, backups are never pushed unencrypted"))
+	}
+	return err
+}
+
+// Returns the name of a pushed backup on the remote.
+func remoteBackupName(instance *Instance, world string, name string) string {
+	return instance.Name + "/" + world + "/" + name + BACKUP_REMOTE_EXT
+}
+
+// Creates a new random key for encrypting backups. The file must not exist yet, overwriting a key would make every
+// backup pushed with it useless.
+func createBackupKey(path string) error {
+	if fileExists(path) {
+		return errors.New(path + " already exists")
+	}
+	key := make([]byte, BACKUP_KEY_SIZE)
+	_, err := rand.Read(key)
+	if err != nil {
+		return err
+	}
+	file, err := createFileWithPerms(path, 0600)
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+path), err)
+	}
+	_, err = file.WriteString(hex.EncodeToString(key) + "\n")
+	closeErr := file.Close()
+	if err != nil || closeErr != nil {
+		return errors.Join(errors.New("failed to write "+path), err, closeErr)
+	}
+	return nil
+}
+
+// Reads a key created by createBackupKey.
+func loadBackupKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read the backup key "+path), err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != BACKUP_KEY_SIZE {
+		return nil, errors.New(path + " is not a backup key, create one with \"backup keygen\"")
+	}
+	return key, nil
+}
+
+// Returns the nonce of a segment, the random prefix of the backup followed by the counter of the segment.
+func backupNonce(prefix []byte, counter uint32, last bool) []byte {
+	if last {
+		counter |= BACKUP_CRYPT_LAST
+	}
+	return binary.BigEndian.AppendUint32(append([]byte{}, prefix...), counter)
+}
+
+func newBackupCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypts a backup with AES-256-GCM, segment by segment. The header is authenticated with every segment.
+func encryptBackup(key []byte, in io.Reader, out io.Writer) error {
+	aead, err := newBackupCipher(key)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, aead.NonceSize()-4)
+	_, err = rand.Read(prefix)
+	if err != nil {
+		return err
+	}
+	header := append([]byte(BACKUP_CRYPT_MAGIC), prefix...)
+	_, err = out.Write(header)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(in, BACKUP_CRYPT_SEGMENT)
+	buffer := make([]byte, BACKUP_CRYPT_SEGMENT)
+	sealed := make([]byte, 0, BACKUP_CRYPT_SEGMENT+aead.Overhead())
+	for counter := uint32(0); counter < BACKUP_CRYPT_LAST; counter++ {
+		read, err := io.ReadFull(reader, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		if !last {
+			_, err = reader.Peek(1)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			last = err == io.EOF
+		}
+
+		sealed = aead.Seal(sealed[:0], backupNonce(prefix, counter, last), buffer[:read], header)
+		_, err = out.Write(sealed)
+		if err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+	return errors.New("the backup is too large to encrypt")
+}
+
+// Decrypts a backup encrypted by encryptBackup. Fails when the key is wrong or the backup was changed or cut short.
+func decryptBackup(key []byte, in io.Reader, out io.Writer) error {
+	aead, err := newBackupCipher(key)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, len(BACKUP_CRYPT_MAGIC)+aead.NonceSize()-4)
+	_, err = io.ReadFull(in, header)
+	if err != nil {
+		return err
+	}
+	if string(header[:len(BACKUP_CRYPT_MAGIC)]) != BACKUP_CRYPT_MAGIC {
+		return errBackupUndecryptable
+	}
+	prefix := header[len(BACKUP_CRYPT_MAGIC):]
+
+	reader := bufio.NewReaderSize(in, BACKUP_CRYPT_SEGMENT+aead.Overhead())
+	buffer := make([]byte, BACKUP_CRYPT_SEGMENT+aead.Overhead())
+	opened := make([]byte, 0, BACKUP_CRYPT_SEGMENT)
+	for counter := uint32(0); counter < BACKUP_CRYPT_LAST; counter++ {
+		read, err := io.ReadFull(reader, buffer)
+		if err == io.EOF {
+			return errors.New("the backup was cut short")
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		if !last {
+			_, err = reader.Peek(1)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			last = err == io.EOF
+		}
+
+		opened, err = aead.Open(opened[:0], backupNonce(prefix, counter, last), buffer[:read], header)
+		if err != nil {
+			return errBackupUndecryptable
+		}
+		_, err = out.Write(opened)
+		if err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+	return errors.New("the backup is too large to decrypt")
+}
+
+// Writes a zip of a chunked backup, so a snapshot can be pushed without its chunks.
+func writeSnapshotArchive(base string, snapshotPath string, out io.Writer) error {
+	var snapshot BackupSnapshot
+	err := readJson(snapshotPath, &snapshot)
+	if err != nil {
+		return err
+	}
+
+	writer := zip.NewWriter(out)
+	for i := range snapshot.Files {
+		err = checkInterrupted()
+		if err != nil {
+			return err
+		}
+		file := &snapshot.Files[i]
+		header := &zip.FileHeader{
+			Name:     file.Path,
+			Method:   zip.Deflate,
+			Modified: file.ModTime,
+		}
+		header.SetMode(file.Mode)
+		entry, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		for o := range file.Chunks {
+			err = readBackupChunk(base, file.Chunks[o], entry)
+			if err != nil {
+				return errors.Join(errors.New("failed to add "+file.Path), err)
+			}
+		}
+	}
+	return writer.Close()
+}
+
+// Escapes a string the way AWS signatures expect, everything but unreserved characters is escaped.
+func awsEscape(value string, keepSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		unreserved := char >= 'A' && char <= 'Z' || char >= 'a' && char <= 'z' || char >= '0' && char <= '9' ||
+			char == '-' || char == '_' || char == '.' || char == '~' || (keepSlash && char == '/')
+		if unreserved {
+			builder.WriteByte(char)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", char))
+		}
+	}
+	return builder.String()
+}
+
+// Encodes a query sorted and escaped by awsEscape, the only form the signature of a query matches.
+func awsQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parameters := make([]string, 0, len(keys))
+	for i := range keys {
+		parameters = append(parameters, awsEscape(keys[i], false)+"="+awsEscape(query.Get(keys[i]), false))
+	}
+	return strings.Join(parameters, "&")
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	digest := hmac.New(sha256.New, key)
+	digest.Write([]byte(data))
+	return digest.Sum(nil)
+}
+
+// Signs a request to S3 with AWS signature version 4, its query has to be encoded by awsQuery. The body is not part of
+// the signature, it is protected by the encryption already.
+func (this *BackupRemote) signS3(request *http.Request, now time.Time) {
+	region := this.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	timestamp := now.UTC().Format("20060102T150405Z")
+	scope := timestamp[:8] + "/" + region + "/s3/aws4_request"
+	request.Header.Set("X-Amz-Date", timestamp)
+	request.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD",
+		"x-amz-date:" + timestamp,
+		"",
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	canonicalDigest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalDigest[:])
+
+	key := hmacSha256([]byte("AWS4"+this.Password), timestamp[:8])
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, toSign))
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+this.User+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// Sends a request for a name on the remote. The body is a file so it can be sent again by retries. Responses that are
+// not successful are turned into a StatusError, the body of the returned response has to be closed.
+func (this *BackupRemote) send(method string, name string, query url.Values, headers map[string]string, body *os.File) (*http.Response, error) {
+	if httpClient == nil {
+		setupNetwork()
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(this.Url, "/"))
+	if err != nil {
+		return nil, err
+	}
+	target := *base
+	target.Path = base.Path + "/" + name
+	target.RawPath = base.EscapedPath() + "/" + awsEscape(name, true)
+	target.RawQuery = awsQuery(query)
+
+	ctx, cancel := context.WithCancel(launcherContext)
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if body != nil {
+		_, err = body.Seek(0, io.SeekStart)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		info, err := body.Stat()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		request.Body = io.NopCloser(body)
+		request.ContentLength = info.Size()
+	}
+	applyHeaders(request)
+	for header := range headers {
+		request.Header.Set(header, headers[header])
+	}
+	if this.Type == BACKUP_REMOTE_S3 {
+		this.signS3(request, time.Now())
+	} else if this.User != "" {
+		request.SetBasicAuth(this.User, this.Password)
+	}
+
+	err = waitForHost(request.URL.Host)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	recordTransfer(request.URL.Host, 1, 0)
+	if response.StatusCode/100 != 2 {
+		_ = response.Body.Close()
+		cancel()
+		return nil, &StatusError{
+			Url:        target.String(),
+			Status:     response.Status,
+			Code:       response.StatusCode,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+
+	timeout := time.Duration(config.Network.ReadTimeout)
+	response.Body = &timeoutReader{
+		reader: &auditReader{
+			reader: response.Body,
+			host:   request.URL.Host,
+		},
+		timer:   time.AfterFunc(timeout, cancel),
+		timeout: timeout,
+		cancel:  cancel,
+	}
+	return response, nil
+}
+
+// Like send, but retries transient failures and closes the response.
+func (this *BackupRemote) sendWithRetries(method string, name string, body *os.File) error {
+	return retry(this.Url+"/"+name, func() error {
+		response, err := this.send(method, name, nil, nil, body)
+		if err != nil {
+			return err
+		}
+		return response.Body.Close()
+	})
+}
+
+// Creates the collections of a WebDAV remote a name is stored in, collections that exist already are fine.
+func (this *BackupRemote) createCollections(name string) error {
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		err := this.sendWithRetries("MKCOL", strings.Join(parts[:i], "/")+"/", nil)
+		var status *StatusError
+		if errors.As(err, &status) && status.Code == http.StatusMethodNotAllowed {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Uploads a file to the remote.
+func (this *BackupRemote) upload(name string, file *os.File) error {
+	if this.Type == BACKUP_REMOTE_WEBDAV {
+		err := this.createCollections(name)
+		if err != nil {
+			return err
+		}
+	}
+	return this.sendWithRetries(http.MethodPut, name, file)
+}
+
+// Downloads a file from the remote into a writer. The writer is truncated before every attempt.
+func (this *BackupRemote) download(name string, out *os.File, consume func(in io.Reader, out io.Writer) error) error {
+	return retry(this.Url+"/"+name, func() error {
+		err := out.Truncate(0)
+		if err == nil {
+			_, err = out.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return &PermanentError{
+				Err: err,
+			}
+		}
+		response, err := this.send(http.MethodGet, name, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		return consume(response.Body, out)
+	})
+}
+
+// Keeps failed reads of a response apart from its end. A response that was cut short fails with io.ErrUnexpectedEOF,
+// which decryptBackup would take for the end of a backup.
+type responseReader struct {
+	reader io.Reader
+}
+
+func (this *responseReader) Read(buffer []byte) (int, error) {
+	read, err := this.reader.Read(buffer)
+	if err != nil && err != io.EOF {
+		err = errors.Join(errors.New("failed to read the response"), err)
+	}
+	return read, err
+}
+
+// A listing of an S3 bucket, only what listing backups needs.
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// A WebDAV multi status response to PROPFIND, only what listing backups needs.
+type webdavMultiStatus struct {
+	Responses []struct {
+		Href string `xml:"DAV: href"`
+		Size string `xml:"DAV: propstat>prop>getcontentlength"`
+	} `xml:"DAV: response"`
+}
+
+// Reads an XML response of the remote.
+func (this *BackupRemote) readXml(method string, name string, query url.Values, headers map[string]string, structure any) error {
+	return retry(this.Url+"/"+name, func() error {
+		response, err := this.send(method, name, query, headers, nil)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		data, err := io.ReadAll(io.LimitReader(response.Body, BACKUP_REMOTE_LIST_MAX_SIZE))
+		if err != nil {
+			return err
+		}
+		err = xml.Unmarshal(data, structure)
+		if err != nil {
+			return &PermanentError{
+				Err: errors.Join(errors.New("failed to parse the response of "+this.Url), err),
+			}
+		}
+		return nil
+	})
+}
+
+// Lists the files of the remote in a directory, mapped to their size.
+func (this *BackupRemote) list(dir string) (map[string]int64, error) {
+	files := map[string]int64{}
+	if this.Type == BACKUP_REMOTE_S3 {
+		token := ""
+		for {
+			query := url.Values{
+				"list-type": {"2"},
+				"prefix":    {dir + "/"},
+			}
+			if token != "" {
+				query.Set("continuation-token", token)
+			}
+			var result s3ListResult
+			err := this.readXml(http.MethodGet, "", query, nil, &result)
+			if err != nil {
+				return nil, err
+			}
+			for i := range result.Contents {
+				name, ok := strings.CutPrefix(result.Contents[i].Key, dir+"/")
+				if ok && !strings.Contains(name, "/") {
+					files[name] = result.Contents[i].Size
+				}
+			}
+			if !result.IsTruncated || result.NextContinuationToken == "" {
+				return files, nil
+			}
+			token = result.NextContinuationToken
+		}
+	}
+
+	var result webdavMultiStatus
+	err := this.readXml("PROPFIND", dir+"/", nil, map[string]string{"Depth": "1"}, &result)
+	var status *StatusError
+	if errors.As(err, &status) && status.Code == http.StatusNotFound {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Responses {
+		href, err := url.PathUnescape(result.Responses[i].Href)
+		if err != nil || strings.HasSuffix(href, "/") {
+			continue
+		}
+		size, _ := strconv.ParseInt(result.Responses[i].Size, 10, 64)
+		files[path.Base(href)] = size
+	}
+	return files, nil
+}
+
+// Returns the remote backups are pushed to, failing when there is none.
+func backupRemote() (*BackupRemote, error) {
+	remote := &config.Backups.Remote
+	if remote.Url == "" {
+		return nil, errors.New("no backups.remote is configured")
+	}
+	return remote, nil
+}
+
+// Encrypts a backup and pushes it to the remote. Chunked backups are pushed as an archive.
+func pushBackup(base string, instance *Instance, world string, backup *Backup) error {
+	remote, err := backupRemote()
+	if err != nil {
+		return err
+	}
+	key, err := loadBackupKey(remote.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	temporary := backupDir(base, instance, world) + "/" + backup.Name + BACKUP_REMOTE_EXT + ".part"
+	file, err := createFile(temporary)
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+temporary), err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(temporary)
+	}()
+
+	if strings.HasSuffix(backup.Path, BACKUP_SNAPSHOT_EXT) {
+		reader, writer := io.Pipe()
+		go func() {
+			_ = writer.CloseWithError(writeSnapshotArchive(base, backup.Path, writer))
+		}()
+		err = encryptBackup(key, reader, file)
+		_ = reader.CloseWithError(err)
+	} else {
+		var in *os.File
+		in, err = openFile(backup.Path)
+		if err == nil {
+			err = encryptBackup(key, in, file)
+			_ = in.Close()
+		}
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to encrypt "+backup.Name), err)
+	}
+
+	err = remote.upload(remoteBackupName(instance, world, backup.Name), file)
+	if err != nil {
+		return errors.Join(errors.New("failed to push "+backup.Name), err)
+	}
+	return nil
+}
+
+// Lists the backups of a world that were pushed to the remote, oldest first. The path of every backup is its name on
+// the remote.
+func listRemoteBackups(instance *Instance, world string) ([]Backup, error) {
+	remote, err := backupRemote()
+	if err != nil {
+		return nil, err
+	}
+	files, err := remote.list(instance.Name + "/" + world)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to list the pushed backups of "+world), err)
+	}
+
+	var backups []Backup
+	for file := range files {
+		name, ok := strings.CutSuffix(file, BACKUP_REMOTE_EXT)
+		if !ok {
+			continue
+		}
+		backups = append(backups, Backup{
+			Name: name,
+			Path: remoteBackupName(instance, world, name),
+			Size: uint64(max(files[file], 0)),
+		})
+	}
+	sort.Slice(backups, func(a int, b int) bool {
+		return backups[a].Name < backups[b].Name
+	})
+	return backups, nil
+}
+
+// Pulls a pushed backup into the local backups of the world as an archive. Returns the local backup, a backup that is
+// there already is not pulled again.
+func pullBackup(base string, instance *Instance, world string, backup *Backup) (*Backup, error) {
+	remote, err := backupRemote()
+	if err != nil {
+		return nil, err
+	}
+	local, err := listBackups(base, instance, world)
+	if err != nil {
+		return nil, err
+	}
+	for i := range local {
+		if local[i].Name == backup.Name {
+			return &local[i], nil
+		}
+	}
+	key, err := loadBackupKey(remote.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := backupDir(base, instance, world)
+	err = createParents(dir)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to create "+dir), err)
+	}
+	target := dir + "/" + backup.Name + BACKUP_ARCHIVE_EXT
+	file, err := createFile(target + ".part")
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to create "+target), err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(target + ".part")
+	}()
+
+	err = remote.download(backup.Path, file, func(in io.Reader, out io.Writer) error {
+		err := decryptBackup(key, &responseReader{reader: in}, out)
+		if errors.Is(err, errBackupUndecryptable) {
+			return &PermanentError{
+				Err: err,
+			}
+		}
+		return err
+	})
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to pull "+backup.Name), err)
+	}
+	err = renameFile(target+".part", target)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Backup{
+		Name: backup.Name,
+		Path: target,
+		Size: uint64(info.Size()),
+	}, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Launches an instance with only some of its mods enabled and reports if the problem happened. Mods not in the enabled
+// set are disabled for the run.
+type BisectTest func(enabled map[string]bool) (bool, error)
+
+// Performs a binary search over the candidates to find the single mod whose presence causes the problem. Every test
+// enables all other mods and one half of the remaining candidates, the half that still shows the problem is kept.
+func bisectMods(candidates []string, others []string, test BisectTest) (string, error) {
+	for step := 1; len(candidates) > 1; step++ {
+		half := candidates[:len(candidates)/2]
+		rest := candidates[len(candidates)/2:]
+
+		enabled := map[string]bool{}
+		for i := range others {
+			enabled[others[i]] = true
+		}
+		for i := range half {
+			enabled[half[i]] = true
+		}
+
+		fmt.Printf("Step %d: testing with %d of %d remaining candidates\n", step, len(half), len(candidates))
+		problem, err := test(enabled)
+		if err != nil {
+			return "", err
+		}
+
+		if problem {
+			candidates = half
+		} else {
+			candidates = rest
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", errors.New("no mods to bisect")
+	}
+	return candidates[0], nil
+}
+
+// Asks a yes or no question on the console.
+func askYesNo(reader *bufio.Reader, question string) (bool, error) {
+	for {
+		fmt.Printf("%s [y/n] ", question)
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return false, errors.Join(errors.New("failed to read answer"), err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			{
+				return true, nil
+			}
+		case "n", "no":
+			{
+				return false, nil
+			}
+		}
+	}
+}
+
+func modsBisectCommand(base string, args []string) error {
+	var keep []string
+	set := flag.NewFlagSet("mods bisect", flag.ContinueOnError)
+	ask := set.Bool("ask", false, "ask after every run if the problem happened instead of watching for a crash")
+	set.Func("keep", "a mod that always stays enabled, like a library other mods need, may be repeated", func(value string) error {
+		keep = append(keep, value)
+		return nil
+	})
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, positional[0])
+	if err != nil {
+		return err
+	}
+	err = checkUnlocked(instance)
+	if err != nil {
+		return err
+	}
+
+	mods, err := listMods(base, instance)
+	if err != nil {
+		return err
+	}
+
+	var others []string
+	var candidates []string
+	originallyEnabled := map[string]bool{}
+	for i := range mods {
+		if !mods[i].Enabled {
+			continue
+		}
+		name := trimModExtension(mods[i].File)
+		originallyEnabled[name] = true
+
+		kept := false
+		for o := range keep {
+			if findMod(mods[i:i+1], keep[o]) != nil {
+				kept = true
+			}
+		}
+		if kept {
+			others = append(others, name)
+		} else {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) < 2 {
+		return errors.New("there need to be at least two enabled mods that are not kept to bisect")
+	}
+
+	// Whatever happens, put the mods back the way they were
+	defer func() {
+		err := applyEnabledMods(base, instance, originallyEnabled)
+		if err != nil {
+			fmt.Printf("Failed to restore the mods of %s: %s\n", instance.Name, err)
+		}
+	}()
+
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("Bisecting %d mods, this assumes the problem happens when all of them are enabled\n", len(candidates))
+	if !*ask {
+		fmt.Println("Close the game normally once it finished loading when the problem does not happen")
+	}
+
+	culprit, err := bisectMods(candidates, others, func(enabled map[string]bool) (bool, error) {
+		err := applyEnabledMods(base, instance, enabled)
+		if err != nil {
+			return false, err
+		}
+
+		exitCode, err := launch(base, instance, &LaunchOptions{})
+		if err != nil {
+			return false, err
+		}
+		if *ask {
+			return askYesNo(reader, "Did the problem happen?")
+		}
+		return exitCode != 0, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("The problem is caused by %s\n", culprit)
+	return nil
+}
+
+// Enables exactly the named mods of an instance and disables all others.
+func applyEnabledMods(base string, instance *Instance, enabled map[string]bool) error {
+	mods, err := listMods(base, instance)
+	if err != nil {
+		return err
+	}
+
+	for i := range mods {
+		err = setModEnabled(base, instance, &mods[i], enabled[trimModExtension(mods[i].File)])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A mod that might have caused a crash. The score is higher the more the logs point at the mod.
+type Suspect struct {
+	Mod     *ModInfo
+	Score   int
+	Reasons map[string]int
+}
+
+func (this *Suspect) blame(reason string, score int) {
+	this.Score += score
+	this.Reasons[reason]++
+}
+
+var stackFramePattern = regexp.MustCompile(`^\s*at ([\w$.]+)\.[\w$<>]+\(`)
+var suspectedModPattern = regexp.MustCompile(`\(([a-z0-9_\-]+)\)`)
+
+// Returns the newest crash report in a game directory, or an empty string if there is none.
+func newestCrashReport(gameDir string) string {
+	dir := gameDir + "/crash-reports"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	newest := ""
+	var newestTime int64
+	for i := range entries {
+		info, err := entries[i].Info()
+		if err != nil || !strings.HasSuffix(entries[i].Name(), ".txt") {
+			continue
+		}
+		if info.ModTime().UnixNano() > newestTime {
+			newest = dir + "/" + entries[i].Name()
+			newestTime = info.ModTime().UnixNano()
+		}
+	}
+	return newest
+}
+
+func readLines(path string) ([]string, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n"), nil
+}
+
+// Ranks mods by how much the lines of a log point at them: mods the loader suspects itself, mixins of the mod that
+// failed, frames of stack traces in the packages of the mod and errors naming the mod. Only mods with a score are
+// returned, the most suspicious one first.
+func blameMods(mods []ModInfo, lines []string) []Suspect {
+	suspects := make([]Suspect, len(mods))
+	owners := map[string]int{}
+	for i := range mods {
+		suspects[i] = Suspect{
+			Mod:     &mods[i],
+			Reasons: map[string]int{},
+		}
+		for o := range mods[i].Packages {
+			owners[mods[i].Packages[o]]++
+		}
+	}
+
+	idPatterns := make([]*regexp.Regexp, len(mods))
+	for i := range mods {
+		var ids []string
+		for o := range mods[i].Ids {
+			// Short ids like "c" would match everywhere
+			if len(mods[i].Ids[o]) >= 4 {
+				ids = append(ids, regexp.QuoteMeta(mods[i].Ids[o]))
+			}
+		}
+		if len(ids) > 0 {
+			idPatterns[i] = regexp.MustCompile(`\b(` + strings.Join(ids, "|") + `)\b`)
+		}
+	}
+
+	suspectedSection := false
+	frame := 0
+	for i := range lines {
+		line := lines[i]
+		lower := strings.ToLower(line)
+
+		if strings.Contains(line, "Suspected Mod") {
+			suspectedSection = true
+		} else if strings.TrimSpace(line) == "" {
+			suspectedSection = false
+		}
+		if suspectedSection {
+			matches := suspectedModPattern.FindAllStringSubmatch(line, -1)
+			for o := range matches {
+				for m := range suspects {
+					if findMod(mods[m:m+1], matches[o][1]) != nil {
+						suspects[m].blame("suspected by the mod loader", 10)
+					}
+				}
+			}
+		}
+
+		match := stackFramePattern.FindStringSubmatch(line)
+		if match == nil {
+			frame = 0
+		} else {
+			frame++
+			class := match[1]
+			for m := range suspects {
+				packages := suspects[m].Mod.Packages
+				for o := range packages {
+					if owners[packages[o]] == 1 && strings.HasPrefix(class, packages[o]+".") {
+						if frame <= 3 {
+							suspects[m].blame("near the top of a stack trace", 3)
+						} else {
+							suspects[m].blame("in a stack trace", 1)
+						}
+						break
+					}
+				}
+			}
+			continue
+		}
+
+		if strings.Contains(lower, "mixin") {
+			for m := range suspects {
+				mixins := suspects[m].Mod.Mixins
+				for o := range mixins {
+					if strings.Contains(line, mixins[o]) {
+						suspects[m].blame("named by a mixin error", 5)
+						break
+					}
+				}
+			}
+		}
+
+		if strings.Contains(lower, "error") || strings.Contains(lower, "exception") {
+			for m := range suspects {
+				if idPatterns[m] != nil && idPatterns[m].MatchString(line) {
+					suspects[m].blame("named in an error", 1)
+				}
+			}
+		}
+	}
+
+	var ranked []Suspect
+	for i := range suspects {
+		if suspects[i].Score > 0 {
+			ranked = append(ranked, suspects[i])
+		}
+	}
+	sort.SliceStable(ranked, func(a int, b int) bool {
+		return ranked[a].Score > ranked[b].Score
+	})
+	return ranked
+}
+
+func modsBlameCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	mods, err := listMods(base, instance)
+	if err != nil {
+		return err
+	}
+	if len(mods) == 0 {
+		return errors.New("instance " + instance.Name + " has no mods")
+	}
+
+	gameDir := instance.gameDir(base)
+	var lines []string
+	sources := []string{gameDir + "/logs/latest.log", newestCrashReport(gameDir)}
+	for i := range sources {
+		if sources[i] == "" || !fileExists(sources[i]) {
+			continue
+		}
+		read, err := readLines(sources[i])
+		if err != nil {
+			return errors.Join(errors.New("failed to read "+sources[i]), err)
+		}
+		fmt.Printf("Analyzing %s\n", sources[i])
+		lines = append(lines, read...)
+	}
+	if len(lines) == 0 {
+		return errors.New("instance " + instance.Name + " has no logs or crash reports")
+	}
+
+	suspects := blameMods(mods, lines)
+	if len(suspects) == 0 {
+		fmt.Println("The logs don't point at any mod")
+		return nil
+	}
+
+	for i := range suspects {
+		suspect := suspects[i]
+		var reasons []string
+		for reason := range suspect.Reasons {
+			reasons = append(reasons, fmt.Sprintf("%s %dx", reason, suspect.Reasons[reason]))
+		}
+		sort.Strings(reasons)
+		fmt.Printf("%d. %s (%s), score %d: %s\n", i+1, suspect.Mod.name(), suspect.Mod.File, suspect.Score, strings.Join(reasons, ", "))
+	}
+
+	name := trimModExtension(suspects[0].Mod.File)
+	fmt.Printf("To retest without the top suspect run: mods disable %s %s\n", instance.Name, name)
+	fmt.Printf("Enable it again with: mods enable %s %s\n", instance.Name, name)
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Files younger than this are never offered for cleanup, except heap dumps.
+	BUDGET_CLEANUP_AGE time.Duration = 30 * 24 * time.Hour
+)
+
+// A number of bytes, written like "2GiB" or "500MB" in JSON and on the command line. 0 means no limit.
+type ByteSize uint64
+
+func parseByteSize(raw string) (ByteSize, error) {
+	rate, err := parseRate(raw)
+	if err != nil || strings.HasSuffix(strings.TrimSpace(raw), "/s") {
+		return 0, errors.New("invalid size " + raw + ", expected something like 2GiB")
+	}
+	return ByteSize(rate), nil
+}
+
+func (this *ByteSize) UnmarshalJSON(bytes []byte) error {
+	var raw string
+	err := json.Unmarshal(bytes, &raw)
+	if err != nil {
+		return err
+	}
+
+	*this, err = parseByteSize(raw)
+	return err
+}
+
+func (this ByteSize) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatUint(uint64(this), 10) + "B")
+}
+
+// What an instance stores in one of its directories. Only the files the launcher may delete during guided cleanup are
+// listed, the size covers everything.
+type DiskUsage struct {
+	Name      string
+	Size      uint64
+	Cleanable []LogFile
+}
+
+// Lists the files of a directory that are older than BUDGET_CLEANUP_AGE and match the filter, oldest first.
+func oldFiles(dir string, filter func(name string) bool) []LogFile {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []LogFile
+	for i := range entries {
+		info, err := entries[i].Info()
+		if err != nil || !info.Mode().IsRegular() || !filter(info.Name()) {
+			continue
+		}
+		if time.Since(info.ModTime()) < BUDGET_CLEANUP_AGE {
+			continue
+		}
+		files = append(files, LogFile{
+			Path:    dir + "/" + info.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	sort.Slice(files, func(a int, b int) bool {
+		return files[a].ModTime.Before(files[b].ModTime)
+	})
+	return files
+}
+
+// Measures what the directories of an instance use. Worlds are never cleaned up by the launcher, they only count
+// towards the budget.
+func measureDiskUsage(base string, instance *Instance) []DiskUsage {
+	gameDir := instance.gameDir(base)
+	all := func(_ string) bool {
+		return true
+	}
+
+	var dumps []LogFile
+	infos, _ := listHeapDumps(base, instance)
+	// The newest dump is the one someone may still want to look at
+	for i := 1; i < len(infos); i++ {
+		dumps = append(dumps, LogFile{
+			Path:    heapDumpDir(base, instance) + "/" + infos[i].Name(),
+			Size:    infos[i].Size(),
+			ModTime: infos[i].ModTime(),
+		})
+	}
+
+	// In the order cleanup asks about them, the ones least likely to be missed first
+	return []DiskUsage{
+		{
+			Name: "Worlds",
+			Size: directorySize(gameDir + "/saves"),
+		},
+		{
+			Name:      "Heap dumps",
+			Size:      directorySize(heapDumpDir(base, instance)),
+			Cleanable: dumps,
+		},
+		{
+			Name: "Logs",
+			Size: directorySize(logsDir(gameDir)),
+			Cleanable: oldFiles(logsDir(gameDir), func(name string) bool {
+				return strings.HasSuffix(name, ".gz")
+			}),
+		},
+		{
+			Name:      "Crash reports",
+			Size:      directorySize(gameDir + "/crash-reports"),
+			Cleanable: oldFiles(gameDir+"/crash-reports", all),
+		},
+		{
+			Name:      "Screenshots",
+			Size:      directorySize(gameDir + "/screenshots"),
+			Cleanable: oldFiles(gameDir+"/screenshots", all),
+		},
+	}
+}
+
+// Returns the total size of some files.
+func totalSize(files []LogFile) uint64 {
+	var total uint64
+	for i := range files {
+		total += uint64(files[i].Size)
+	}
+	return total
+}
+
+// Warns when an instance uses more than its disk budget. When someone is at the terminal they are asked, category by
+// category, if old files should be deleted until the instance fits again.
+func checkDiskBudget(base string, instance *Instance) error {
+	if instance.DiskBudget == 0 {
+		return nil
+	}
+
+	usage := measureDiskUsage(base, instance)
+	var total uint64
+	for i := range usage {
+		total += usage[i].Size
+	}
+	if total <= uint64(instance.DiskBudget) {
+		return nil
+	}
+
+	fmt.Printf("Instance %s uses %s, more than its budget of %s\n", instance.Name, formatBytes(float64(total)), formatBytes(float64(instance.DiskBudget)))
+	for i := range usage {
+		fmt.Printf("  %-14s %s\n", usage[i].Name, formatBytes(float64(usage[i].Size)))
+	}
+	if !isInteractive() {
+		return nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for i := range usage {
+		if total <= uint64(instance.DiskBudget) {
+			break
+		}
+		category := &usage[i]
+		if len(category.Cleanable) == 0 {
+			continue
+		}
+
+		question := fmt.Sprintf("Delete %d old %s (%s)?", len(category.Cleanable), strings.ToLower(category.Name), formatBytes(float64(totalSize(category.Cleanable))))
+		confirmed, err := askYesNo(reader, question)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			continue
+		}
+		for o := range category.Cleanable {
+			file := &category.Cleanable[o]
+			err = os.Remove(file.Path)
+			if err != nil {
+				return errors.Join(errors.New("failed to delete "+file.Path), err)
+			}
+			total -= uint64(file.Size)
+		}
+	}
+
+	if total > uint64(instance.DiskBudget) {
+		fmt.Printf("Instance %s still uses %s, the rest has to be cleaned up by hand\n", instance.Name, formatBytes(float64(total)))
+	}
+	return nil
+}
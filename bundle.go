@@ -0,0 +1,382 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	BUNDLE_INDEX      string = "bundle.json"
+	BUNDLE_FILES_DIR  string = "files/"
+	BUNDLE_TEMPORARY  string = ".bundle-"
+	BUNDLE_EXTENSION  string = ".zip"
+	BUNDLE_COMPRESSED string = ".json"
+)
+
+// Describes the contents of an offline bundle. Every artifact is stored below BUNDLE_FILES_DIR at its path relative to
+// the base directory. The archive of the JVM is one of the artifacts, the JVM says which one to extract.
+type BundleIndex struct {
+	Manifest  VersionInfo      `json:"manifest"`
+	Artifacts []LockedArtifact `json:"artifacts"`
+	Jdk       *LockedJdk       `json:"jdk,omitempty"`
+}
+
+// Installs a version, including the JVM it needs, while recording every file that is needed to install it again.
+func recordVersion(base string, version *VersionInfo) (*BundleIndex, error) {
+	// A throwaway instance that is locked to the version, so nothing is resolved twice
+	instance := &Instance{
+		Name:    BUNDLE_TEMPORARY + strconv.Itoa(os.Getpid()),
+		Version: version.Id,
+	}
+	defer func() {
+		_ = removeAll(instanceDir(base, instance.Name))
+	}()
+	err := createParents(instanceDir(base, instance.Name))
+	if err == nil {
+		err = writeJson(lockfilePath(base, instance), &Lockfile{
+			Manifest: *version,
+		})
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to prepare the export"), err)
+	}
+
+	artifactRecorder = &ArtifactRecorder{
+		base:      base,
+		artifacts: map[string]LockedArtifact{},
+	}
+	defer func() {
+		artifactRecorder = nil
+	}()
+	_, err = launch(base, instance, &LaunchOptions{
+		PrepareOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Whatever runtime provider launched the game, the bundle has to bring its own JVM
+	var manifest Manifest
+	err = loadVersionJson(base, version, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	_, err = downloadJdk(base, manifest.javaVersion())
+	if err != nil {
+		fmt.Printf("The bundle will not contain Java %d: %s\n", manifest.javaVersion(), err)
+	}
+
+	index := &BundleIndex{
+		Manifest: *version,
+		Jdk:      artifactRecorder.jdk,
+	}
+	for path := range artifactRecorder.artifacts {
+		artifact := artifactRecorder.artifacts[path]
+		if !filepath.IsAbs(artifact.Path) {
+			index.Artifacts = append(index.Artifacts, artifact)
+		}
+	}
+	sort.Slice(index.Artifacts, func(a int, b int) bool {
+		return index.Artifacts[a].Path < index.Artifacts[b].Path
+	})
+	return index, nil
+}
+
+// Copies a file into a zip. Only JSON is compressed, everything else the game needs is compressed already.
+func addZipFile(writer *zip.Writer, name string, path string) error {
+	in, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	method := zip.Store
+	if strings.HasSuffix(name, BUNDLE_COMPRESSED) {
+		method = zip.Deflate
+	}
+	out, err := writer.CreateHeader(&zip.FileHeader{
+		Name:   name,
+		Method: method,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// Writes an offline bundle containing everything a version needs.
+func writeBundle(base string, output string, index *BundleIndex) error {
+	file, err := createFile(output + ".part")
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+output), err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(output + ".part")
+	}()
+
+	writer := zip.NewWriter(file)
+	content, err := writer.Create(BUNDLE_INDEX)
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+output), err)
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return errors.Join(errors.New("failed to serialize "+BUNDLE_INDEX), err)
+	}
+	_, err = content.Write(data)
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+output), err)
+	}
+
+	for i := range index.Artifacts {
+		err = checkInterrupted()
+		if err != nil {
+			return err
+		}
+		artifact := &index.Artifacts[i]
+		err = addZipFile(writer, BUNDLE_FILES_DIR+artifact.Path, artifact.resolve(base))
+		if err != nil {
+			return errors.Join(errors.New("failed to add "+artifact.Path+" to "+output), err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+output), err)
+	}
+	err = file.Close()
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+output), err)
+	}
+	return renameFile(output+".part", output)
+}
+
+// Extracts the files of an offline bundle into the store and installs its JVM. Every file has to have the hash the
+// index says, files that are already installed are skipped.
+func installBundle(base string, reader *zip.Reader, index *BundleIndex) error {
+	for i := range index.Artifacts {
+		err := checkInterrupted()
+		if err != nil {
+			return err
+		}
+
+		artifact := &index.Artifacts[i]
+		target, err := resolvePackPath(base, artifact.Path)
+		if err != nil {
+			return err
+		}
+		valid, err := validateHash(target, artifact.Sha1)
+		if err != nil {
+			return err
+		}
+		if valid {
+			continue
+		}
+
+		file := findZipFile(reader, BUNDLE_FILES_DIR+artifact.Path)
+		if file == nil {
+			return errors.New("the bundle is missing " + artifact.Path)
+		}
+		err = createParents(filepath.Dir(target))
+		if err != nil {
+			return errors.Join(errors.New("failed to create parents of "+target), err)
+		}
+		err = extractZipFile(file, target+".part")
+		if err != nil {
+			return errors.Join(errors.New("failed to extract "+artifact.Path), err)
+		}
+		valid, err = hashFile(target+".part", artifact.Sha1)
+		if err != nil || !valid {
+			_ = os.Remove(target + ".part")
+			return errors.Join(errors.New("the bundle contains a corrupted "+artifact.Path), err)
+		}
+		err = renameFile(target+".part", target)
+		if err != nil {
+			return errors.Join(errors.New("failed to move "+artifact.Path+" into place"), err)
+		}
+		hashCache.remember(target, artifact.Sha1)
+	}
+
+	// The archive is in the store now, installing it does not need Adoptium
+	if index.Jdk == nil {
+		return nil
+	}
+	if !index.Jdk.runsHere(index.Jdk.Major) {
+		fmt.Printf("The Java %d of the bundle is for %s/%s, it was not installed\n", index.Jdk.Major, index.Jdk.Os, index.Jdk.Arch)
+		return nil
+	}
+	_, err := installLockedJdk(base, index.Jdk, "")
+	if err != nil {
+		return errors.Join(errors.New("failed to install the Java of the bundle"), err)
+	}
+	return nil
+}
+
+// Copies a single file out of a zip.
+func extractZipFile(file *zip.File, target string) error {
+	in, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	out, err := createFile(target)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+var bundleCommands = []Command{
+	{
+		Name:        "export",
+		Usage:       "<version> [--output <file>]",
+		Description: "Packs everything a version needs, including the JVM, into a zip for machines without internet",
+		Run:         bundleExportCommand,
+	},
+	{
+		Name:        "import",
+		Usage:       "<file> [--instance <name>]",
+		Description: "Installs a bundle created by \"bundle export\" and creates an instance locked to its version",
+		Run:         bundleImportCommand,
+	},
+}
+
+func bundleCommand(base string, args []string) error {
+	return runCommand(bundleCommands, base, args)
+}
+
+func bundleExportCommand(base string, args []string) error {
+	set := flag.NewFlagSet("bundle export", flag.ContinueOnError)
+	output := set.String("output", "", "where to write the bundle, defaults to <version>.zip")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one version")
+	}
+	if config.VanillaDirectory != "" {
+		return errors.New("the store is shared with the official launcher, its files can not be bundled")
+	}
+
+	var versionManifest VersionManifest
+	err = downloadVersionManifest(&versionManifest)
+	if err != nil {
+		return errors.Join(errors.New("failed to download version manifest"), err)
+	}
+	version, err := findVersion(&versionManifest, resolveVersion(&versionManifest, positional[0]))
+	if err != nil {
+		return err
+	}
+
+	index, err := recordVersion(base, version)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		*output = version.Id + BUNDLE_EXTENSION
+	}
+	err = writeBundle(base, *output, index)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s with %d files\n", *output, len(index.Artifacts))
+	return nil
+}
+
+func bundleImportCommand(base string, args []string) error {
+	set := flag.NewFlagSet("bundle import", flag.ContinueOnError)
+	name := set.String("instance", "", "the instance to create, defaults to the version of the bundle")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one bundle")
+	}
+	if config.VanillaDirectory != "" {
+		return errors.New("the store is shared with the official launcher, bundles can not be installed into it")
+	}
+
+	reader, err := zip.OpenReader(positional[0])
+	if err != nil {
+		return errors.Join(errors.New("failed to open "+positional[0]), err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	file := findZipFile(&reader.Reader, BUNDLE_INDEX)
+	if file == nil {
+		return errors.New(positional[0] + " is not a bundle")
+	}
+	var index BundleIndex
+	err = readZipJson(file, &index)
+	if err != nil {
+		return errors.Join(errors.New("failed to read "+BUNDLE_INDEX), err)
+	}
+
+	err = installBundle(base, &reader.Reader, &index)
+	if err != nil {
+		return err
+	}
+	err = hashCache.save()
+	if err != nil {
+		fmt.Printf("%s\n", err)
+	}
+	fmt.Printf("Installed %s with %d files\n", index.Manifest.Id, len(index.Artifacts))
+
+	if *name == "" {
+		*name = sanitizeInstanceName(index.Manifest.Id)
+	}
+	if fileExists(instanceDir(base, *name) + "/instance.json") {
+		fmt.Printf("Instance %s already exists, it was left as it is\n", *name)
+		return nil
+	}
+	err = validateInstanceName(*name)
+	if err != nil {
+		return err
+	}
+
+	instance := &Instance{
+		Name:    *name,
+		Version: index.Manifest.Id,
+	}
+	err = commitInstance(base, instance)
+	if err != nil {
+		return err
+	}
+	err = writeJson(lockfilePath(base, instance), &Lockfile{
+		Manifest:  index.Manifest,
+		Artifacts: index.Artifacts,
+		Jdk:       index.Jdk,
+	})
+	if err != nil {
+		return errors.Join(errors.New("failed to write lockfile of "+instance.Name), err)
+	}
+	fmt.Printf("Created instance %s locked to %s\n", instance.Name, index.Manifest.Id)
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Writes the archive of a JVM with only a java executable in it, like the ones of Adoptium are laid out.
+func writeFakeJdkArchive(t *testing.T, path string) []byte {
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(compressed)
+	files := []struct {
+		name string
+		mode int64
+		data string
+		dir  bool
+	}{
+		{name: "jdk-17.0.9+9-jre/", mode: 0755, dir: true},
+		{name: "jdk-17.0.9+9-jre/bin/", mode: 0755, dir: true},
+		{name: "jdk-17.0.9+9-jre/bin/java", mode: 0755, data: "#!/bin/sh\n"},
+	}
+	for i := range files {
+		header := &tar.Header{
+			Name:     files[i].name,
+			Mode:     files[i].mode,
+			Size:     int64(len(files[i].data)),
+			Typeflag: tar.TypeReg,
+		}
+		if files[i].dir {
+			header.Typeflag = tar.TypeDir
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(files[i].data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := compressed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createParents(path[:strings.LastIndex(path, "/")]); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// A bundle exported on one machine has to install its JVM on another one without asking Adoptium, the URL of the JVM
+// can not be reached.
+func TestBundleInstallsJdkOffline(t *testing.T) {
+	exported := t.TempDir()
+	imported := t.TempDir()
+
+	osName, arch := adoptiumPlatform()
+	jdk := &LockedJdk{
+		Major:  17,
+		Semver: "17.0.9+9",
+		Image:  ADOPTIUM_IMAGE_JRE,
+		Os:     osName,
+		Arch:   arch,
+		Name:   "OpenJDK17U-jre_x64_linux_hotspot_17.0.9_9.tar.gz",
+		Url:    "http://127.0.0.1:1/unreachable.tar.gz",
+	}
+	data := writeFakeJdkArchive(t, jdk.archive(exported))
+	digest := sha256.Sum256(data)
+	jdk.Sha256 = hex.EncodeToString(digest[:])
+	jdk.Size = uint64(len(data))
+
+	index := &BundleIndex{
+		Manifest: VersionInfo{
+			Id: "1.20.4",
+		},
+		Artifacts: []LockedArtifact{
+			{
+				Path: strings.TrimPrefix(jdk.archive(exported), exported+"/"),
+				Url:  jdk.Url,
+				Size: jdk.Size,
+				Sha1: jdk.Sha256,
+			},
+		},
+		Jdk: jdk,
+	}
+	output := exported + "/bundle.zip"
+	err := writeBundle(exported, output, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	var read BundleIndex
+	err = readZipJson(findZipFile(&reader.Reader, BUNDLE_INDEX), &read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = installBundle(imported, &reader.Reader, &read)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home, err := findInstalledJdk(imported, 17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(home + "/bin/java") {
+		t.Fatalf("%s has no bin/java", home)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Returns the java executable of a runtime.
+func javaExecutable(javaHome string) string {
+	return javaHome + "/bin/java" + EXECUTABLE_SUFFIX
+}
+
+// Joins the entries of a classpath the way Java expects them on this operating system, with its path separators.
+func joinClasspath(entries []string) string {
+	paths := make([]string, len(entries))
+	for i := range entries {
+		paths[i] = filepath.FromSlash(entries[i])
+	}
+	return strings.Join(paths, string(os.PathListSeparator))
+}
+
+// Checks if a command line is short enough to be started on this operating system, see COMMAND_LINE_LIMIT and
+// ARGUMENT_LIMIT.
+func fitsCommandLine(executable string, args []string) bool {
+	total := len(executable) + ARGUMENT_OVERHEAD
+	for i := range args {
+		if len(args[i]) > ARGUMENT_LIMIT {
+			return false
+		}
+		total += len(args[i]) + ARGUMENT_OVERHEAD
+	}
+	return total <= COMMAND_LINE_LIMIT
+}
+
+// Makes sure the arguments of the game can be passed to Java. When they are too long for the operating system the
+// classpath is moved into an argument file, then every argument if that is not enough. Argument files need Java 9 or
+// newer, older versions get the classpath in a pathing jar instead. Instances that always want a pathing jar get one
+// right away. Returns the arguments to start Java with.
+func fitJavaArguments(base string, instance *Instance, java string, javaVersion uint32, args []string, classpath string) ([]string, error) {
+	dir := instanceDir(base, instance.Name)
+	if instance.PathingJar {
+		return usePathingJar(dir+"/classpath.jar", java, args, classpath)
+	}
+	if fitsCommandLine(java, args) {
+		return args, nil
+	}
+
+	if javaVersion >= 9 {
+		// Moving only the classpath is usually enough and keeps the rest of the command line readable
+		shortened, err := useClasspathFile(dir+"/classpath.args", args, classpath)
+		if err != nil {
+			return nil, err
+		}
+		if shortened != nil && fitsCommandLine(java, shortened) {
+			fmt.Println("The classpath is too long for the command line, passing it in " + dir + "/classpath.args")
+			return shortened, nil
+		}
+
+		path := dir + "/launch.args"
+		err = writeArgumentFile(path, args)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("The command line is too long, passing the arguments in " + path)
+		return []string{"@" + filepath.FromSlash(path)}, nil
+	}
+
+	fmt.Println("The command line is too long, passing the classpath in a pathing jar")
+	return usePathingJar(dir+"/classpath.jar", java, args, classpath)
+}
+
+// Writes the classpath into an argument file at the path and replaces the classpath in the arguments with "@path",
+// Java expands it anywhere before the main class. Returns nil when the arguments do not contain the classpath.
+func useClasspathFile(path string, args []string, classpath string) ([]string, error) {
+	if !slices.Contains(args, classpath) {
+		return nil, nil
+	}
+	err := writeArgumentFile(path, []string{classpath})
+	if err != nil {
+		return nil, err
+	}
+
+	shortened := make([]string, len(args))
+	for i := range args {
+		if args[i] == classpath {
+			shortened[i] = "@" + filepath.FromSlash(path)
+		} else {
+			shortened[i] = args[i]
+		}
+	}
+	return shortened, nil
+}
+
+// Writes the classpath into a pathing jar at the path and replaces the classpath in the arguments with it.
+func usePathingJar(path string, java string, args []string, classpath string) ([]string, error) {
+	err := writePathingJar(path, strings.Split(classpath, string(os.PathListSeparator)))
+	if err != nil {
+		return nil, err
+	}
+
+	shortened := make([]string, len(args))
+	for i := range args {
+		if args[i] == classpath {
+			shortened[i] = path
+		} else {
+			shortened[i] = args[i]
+		}
+	}
+	if !fitsCommandLine(java, shortened) {
+		return nil, errors.New("the command line is too long even without the classpath")
+	}
+	return shortened, nil
+}
+
+// Writes the arguments into a file Java reads with "java @file". Every argument is quoted, inside of quotes Java
+// treats backslashes as escapes.
+func writeArgumentFile(path string, args []string) error {
+	var builder strings.Builder
+	for i := range args {
+		escaped := strings.ReplaceAll(args[i], "\\", "\\\\")
+		escaped = strings.ReplaceAll(escaped, "\"", "\\\"")
+		builder.WriteString("\"" + escaped + "\"\n")
+	}
+
+	file, err := createFile(path)
+	if err != nil {
+		return errors.Join(errors.New("failed to create argument file "+path), err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_, err = file.WriteString(builder.String())
+	if err != nil {
+		return errors.Join(errors.New("failed to write argument file "+path), err)
+	}
+	return nil
+}
+
+// Writes an empty jar whose manifest puts the entries of a classpath on the classpath of whatever loads it, using it
+// as the classpath keeps the command line short no matter how many libraries there are.
+func writePathingJar(path string, classpath []string) error {
+	var entries []string
+	for i := range classpath {
+		absolute, err := filepath.Abs(classpath[i])
+		if err != nil {
+			return errors.Join(errors.New("failed to resolve "+classpath[i]), err)
+		}
+		absolute = filepath.ToSlash(absolute)
+		if !strings.HasPrefix(absolute, "/") {
+			// Windows drive letters
+			absolute = "/" + absolute
+		}
+
+		entry := url.URL{
+			Scheme: "file",
+			Path:   absolute,
+		}
+		entries = append(entries, entry.String())
+	}
+
+	file, err := createFile(path)
+	if err != nil {
+		return errors.Join(errors.New("failed to create pathing jar "+path), err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	writer := zip.NewWriter(file)
+	manifest, err := writer.Create("META-INF/MANIFEST.MF")
+	if err != nil {
+		return errors.Join(errors.New("failed to write pathing jar "+path), err)
+	}
+	_, err = manifest.Write([]byte(manifestAttribute("Manifest-Version", "1.0") +
+		manifestAttribute("Created-By", LAUNCHER_NAME) +
+		manifestAttribute("Class-Path", strings.Join(entries, " ")) +
+		"\r\n"))
+	if err != nil {
+		return errors.Join(errors.New("failed to write pathing jar "+path), err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return errors.Join(errors.New("failed to write pathing jar "+path), err)
+	}
+	return nil
+}
+
+// Formats a jar manifest attribute. Lines of a manifest may only be 72 bytes long, longer ones continue on the next
+// line after a space.
+func manifestAttribute(name string, value string) string {
+	line := name + ": " + value
+	var builder strings.Builder
+	limit := 72
+	for len(line) > limit {
+		builder.WriteString(line[:limit] + "\r\n ")
+		line = line[limit:]
+		limit = 71
+	}
+	builder.WriteString(line + "\r\n")
+	return builder.String()
+}
+
+// Replaces the directories of the launcher in a command line with placeholders, so command lines of different machines
+// and launcher versions can be compared. The most specific directory wins, a library is "${library_directory}/..."
+// and not "${base_directory}/library/...". Separators are turned into slashes.
+func normalizeCommand(base string, javaHome string, gameDir string, command []string) []string {
+	placeholders := map[string]string{
+		javaHome:         "${java_home}",
+		gameDir:          "${game_directory}",
+		assetsDir(base):  "${assets_root}",
+		libraryDir(base): "${library_directory}",
+		base:             "${base_directory}",
+	}
+	if config.VanillaDirectory != "" {
+		placeholders[config.VanillaDirectory] = "${vanilla_directory}"
+	}
+	dirs := make([]string, 0, len(placeholders))
+	for dir := range placeholders {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(a int, b int) bool {
+		return len(dirs[a]) > len(dirs[b])
+	})
+
+	normalized := make([]string, len(command))
+	for i := range command {
+		argument := filepath.ToSlash(command[i])
+		for o := range dirs {
+			argument = strings.ReplaceAll(argument, filepath.ToSlash(dirs[o]), placeholders[dirs[o]])
+		}
+		normalized[i] = argument
+	}
+	return normalized
+}
+
+// Prints everything the game would be started with by a dry run: its version, the working directory, which is the game
+// directory, the variables added to the environment of the launcher and the command line. Paths are replaced like
+// normalizeCommand does when normalize is set.
+func printDryRun(base string, javaHome string, gameDir string, manifest *Manifest, command []string, environment map[string]string, normalize bool) {
+	workingDir := gameDir
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	variables := make([]string, len(names))
+	for i := range names {
+		variables[i] = names[i] + "=" + environment[names[i]]
+	}
+	if normalize {
+		workingDir = normalizeCommand(base, javaHome, gameDir, []string{workingDir})[0]
+		variables = normalizeCommand(base, javaHome, gameDir, variables)
+		command = normalizeCommand(base, javaHome, gameDir, command)
+	}
+
+	fmt.Printf("Version:           %s\n", manifest.Id)
+	fmt.Printf("Main class:        %s\n", manifest.MainClass)
+	fmt.Printf("Working directory: %s\n", workingDir)
+	if len(variables) == 0 {
+		fmt.Println("Environment:       inherited from the launcher")
+	} else {
+		fmt.Println("Environment:       inherited from the launcher, with")
+		for i := range variables {
+			fmt.Printf("    %s\n", variables[i])
+		}
+	}
+	fmt.Println("Command:")
+	for i := range command {
+		fmt.Printf("    %s\n", command[i])
+	}
+}
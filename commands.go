@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// A sub-command of the launcher, selected by the first remaining argument on the command line.
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(base string, args []string) error
+}
+
+// Finds the command named by the first argument and runs it with the remaining arguments. A panic of the command is
+// returned as a PanicError.
+func runCommand(commands []Command, base string, args []string) (err error) {
+	defer recoverPanic(&err)
+	if len(args) == 0 {
+		printCommands(commands)
+		return errors.New("no command given")
+	}
+
+	for i := range commands {
+		command := commands[i]
+		if command.Name == args[0] {
+			return command.Run(base, args[1:])
+		}
+	}
+
+	printCommands(commands)
+	return errors.New("unknown command " + args[0])
+}
+
+// Prints the usage of every command in a list.
+func printCommands(commands []Command) {
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for i := range commands {
+		command := commands[i]
+		fmt.Fprintf(os.Stderr, "  %s %s\n        %s\n", command.Name, command.Usage, command.Description)
+	}
+}
+
+// Parses the flags of a command while allowing them to be mixed with positional arguments, the flag package stops at
+// the first positional argument on its own. Everything after a "--" is treated as positional. Returns the positional
+// arguments.
+func parseFlags(set *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		err := set.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := set.Args()
+		consumed := len(args) - len(remaining)
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, remaining...), nil
+		}
+		if len(remaining) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, remaining[0])
+		args = remaining[1:]
+	}
+}
+
+// Splits arguments at the first "--". Returns the arguments before it and the ones after it, which are meant to be
+// passed on as they are instead of being parsed by parseFlags.
+func splitPassThrough(args []string) ([]string, []string) {
+	for i := range args {
+		if args[i] == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Changes to launches that only apply on machines where a condition holds, so a single instance shared between machines
+// can adapt to each of them. Conditions are expressions like `os == "linux" && ram >= 16384 && gpu != "intel"`, see
+// conditionFacts for what they can ask about.
+type ConditionalChange struct {
+	When string `json:"when"`
+	// The instances the change applies to, all of them when empty.
+	Instances []string `json:"instances"`
+	JvmArgs   []string `json:"jvmArgs"`
+	GameArgs  []string `json:"gameArgs"`
+	// Mods that are disabled for the launch, by file name or id. They are enabled again once the game exited.
+	DisableMods []string `json:"disableMods"`
+	// Plugins that are not run, by file name.
+	DisablePlugins []string `json:"disablePlugins"`
+}
+
+// What conditions know about the machine, everything but the operating system and architecture is only looked up when
+// a condition asks for it. Values that can not be found out are empty or 0.
+type MachineFacts struct {
+	hostname *string
+	ram      *float64
+	gpu      *string
+}
+
+// The facts a condition can ask about, with what they hold.
+var conditionFacts = map[string]string{
+	"os":       "the operating system as Go names it, like \"linux\", \"windows\" or \"darwin\"",
+	"arch":     "the architecture as Go names it, like \"amd64\" or \"arm64\"",
+	"hostname": "the name of the machine",
+	"ram":      "the total memory of the machine in MiB",
+	"gpu":      "the vendor of the GPU the game most likely runs on, \"nvidia\", \"amd\", \"intel\" or \"apple\"",
+}
+
+func (this *MachineFacts) lookup(name string) any {
+	switch name {
+	case "os":
+		{
+			return runtime.GOOS
+		}
+	case "arch":
+		{
+			return runtime.GOARCH
+		}
+	case "hostname":
+		{
+			if this.hostname == nil {
+				hostname, _ := os.Hostname()
+				this.hostname = &hostname
+			}
+			return *this.hostname
+		}
+	case "ram":
+		{
+			if this.ram == nil {
+				ram := float64(totalMemory() / 1024 / 1024)
+				this.ram = &ram
+			}
+			return *this.ram
+		}
+	case "gpu":
+		{
+			if this.gpu == nil {
+				gpu := gpuVendor()
+				this.gpu = &gpu
+			}
+			return *this.gpu
+		}
+	}
+	return nil
+}
+
+// Returns the vendor of a GPU from its name or PCI vendor id.
+func gpuVendorOf(name string) string {
+	name = strings.ToLower(name)
+	vendors := []struct {
+		vendor string
+		names  []string
+	}{
+		{"nvidia", []string{"nvidia", "geforce", "quadro", "0x10de"}},
+		{"amd", []string{"amd", "radeon", "ati ", "0x1002"}},
+		{"intel", []string{"intel", "0x8086"}},
+		{"apple", []string{"apple"}},
+	}
+	for i := range vendors {
+		for o := range vendors[i].names {
+			if strings.Contains(name, vendors[i].names[o]) {
+				return vendors[i].vendor
+			}
+		}
+	}
+	return ""
+}
+
+// Picks the GPU the game most likely runs on, dedicated GPUs win over integrated ones.
+func preferredGpuVendor(vendors []string) string {
+	preferred := ""
+	for i := range vendors {
+		switch vendors[i] {
+		case "nvidia", "amd":
+			{
+				return vendors[i]
+			}
+		case "":
+			{
+				continue
+			}
+		}
+		if preferred == "" {
+			preferred = vendors[i]
+		}
+	}
+	return preferred
+}
+
+// A parsed condition, evaluates to a string, number or bool.
+type Condition func(facts *MachineFacts) (any, error)
+
+type conditionParser struct {
+	tokens []string
+	next   int
+}
+
+// Splits a condition into identifiers, numbers, quoted strings and operators.
+func tokenizeCondition(expression string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		char := runes[i]
+		switch {
+		case unicode.IsSpace(char):
+			{
+				i++
+			}
+		case char == '"':
+			{
+				end := i + 1
+				for end < len(runes) && runes[end] != '"' {
+					if runes[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(runes) {
+					return nil, errors.New("unterminated string")
+				}
+				tokens = append(tokens, string(runes[i:end+1]))
+				i = end + 1
+			}
+		case unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_' || char == '.':
+			{
+				end := i
+				for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '.') {
+					end++
+				}
+				tokens = append(tokens, string(runes[i:end]))
+				i = end
+			}
+		default:
+			{
+				operators := []string{"==", "!=", "<=", ">=", "=~", "&&", "||", "<", ">", "!", "(", ")"}
+				found := ""
+				for o := range operators {
+					if strings.HasPrefix(string(runes[i:]), operators[o]) {
+						found = operators[o]
+						break
+					}
+				}
+				if found == "" {
+					return nil, errors.New("unexpected " + strconv.QuoteRune(char))
+				}
+				tokens = append(tokens, found)
+				i += len(found)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// Parses a condition. Conditions compare facts of the machine with == != < <= > >= and regular expressions with =~,
+// and combine the comparisons with && || ! and parentheses.
+func parseCondition(expression string) (Condition, error) {
+	tokens, err := tokenizeCondition(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty condition")
+	}
+
+	parser := &conditionParser{
+		tokens: tokens,
+	}
+	condition, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.next != len(tokens) {
+		return nil, errors.New("unexpected " + tokens[parser.next])
+	}
+	return condition, nil
+}
+
+func (this *conditionParser) peek() string {
+	if this.next >= len(this.tokens) {
+		return ""
+	}
+	return this.tokens[this.next]
+}
+
+func (this *conditionParser) parseOr() (Condition, error) {
+	left, err := this.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for this.peek() == "||" {
+		this.next++
+		right, err := this.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalCondition(left, right, true)
+	}
+	return left, nil
+}
+
+func (this *conditionParser) parseAnd() (Condition, error) {
+	left, err := this.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for this.peek() == "&&" {
+		this.next++
+		right, err := this.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalCondition(left, right, false)
+	}
+	return left, nil
+}
+
+// Combines two conditions with || or &&, the right one is only evaluated when it matters.
+func logicalCondition(left Condition, right Condition, or bool) Condition {
+	return func(facts *MachineFacts) (any, error) {
+		value, err := evaluateBool(left, facts)
+		if err != nil || value == or {
+			return value, err
+		}
+		return evaluateBool(right, facts)
+	}
+}
+
+func (this *conditionParser) parseNot() (Condition, error) {
+	if this.peek() != "!" {
+		return this.parseComparison()
+	}
+	this.next++
+	operand, err := this.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return func(facts *MachineFacts) (any, error) {
+		value, err := evaluateBool(operand, facts)
+		return !value, err
+	}, nil
+}
+
+func (this *conditionParser) parseComparison() (Condition, error) {
+	left, err := this.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	operator := this.peek()
+	switch operator {
+	case "==", "!=", "<", "<=", ">", ">=":
+		{
+			this.next++
+			right, err := this.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return compareCondition(left, right, operator), nil
+		}
+	case "=~":
+		{
+			this.next++
+			pattern := this.peek()
+			if !strings.HasPrefix(pattern, "\"") {
+				return nil, errors.New("=~ needs a quoted regular expression")
+			}
+			this.next++
+			unquoted, err := strconv.Unquote(pattern)
+			if err != nil {
+				return nil, errors.Join(errors.New("invalid string "+pattern), err)
+			}
+			expression, err := regexp.Compile(unquoted)
+			if err != nil {
+				return nil, err
+			}
+			return func(facts *MachineFacts) (any, error) {
+				value, err := left(facts)
+				if err != nil {
+					return nil, err
+				}
+				text, ok := value.(string)
+				if !ok {
+					return nil, errors.New("=~ only matches strings")
+				}
+				return expression.MatchString(text), nil
+			}, nil
+		}
+	}
+	return left, nil
+}
+
+// Compares two values of the same type, strings and bools only know == and !=.
+func compareCondition(left Condition, right Condition, operator string) Condition {
+	return func(facts *MachineFacts) (any, error) {
+		a, err := left(facts)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(facts)
+		if err != nil {
+			return nil, err
+		}
+
+		if operator == "==" || operator == "!=" {
+			if fmt.Sprintf("%T", a) != fmt.Sprintf("%T", b) {
+				return nil, errors.New(fmt.Sprintf("can not compare %v with %v", a, b))
+			}
+			return (a == b) == (operator == "=="), nil
+		}
+
+		x, ok := a.(float64)
+		y, otherOk := b.(float64)
+		if !ok || !otherOk {
+			return nil, errors.New(operator + " only compares numbers")
+		}
+		switch operator {
+		case "<":
+			{
+				return x < y, nil
+			}
+		case "<=":
+			{
+				return x <= y, nil
+			}
+		case ">":
+			{
+				return x > y, nil
+			}
+		default:
+			{
+				return x >= y, nil
+			}
+		}
+	}
+}
+
+func (this *conditionParser) parseOperand() (Condition, error) {
+	token := this.peek()
+	if token == "" {
+		return nil, errors.New("unexpected end of condition")
+	}
+	this.next++
+
+	switch {
+	case token == "(":
+		{
+			inner, err := this.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if this.peek() != ")" {
+				return nil, errors.New("missing )")
+			}
+			this.next++
+			return inner, nil
+		}
+	case strings.HasPrefix(token, "\""):
+		{
+			value, err := strconv.Unquote(token)
+			if err != nil {
+				return nil, errors.Join(errors.New("invalid string "+token), err)
+			}
+			return constantCondition(value), nil
+		}
+	case token == "true" || token == "false":
+		{
+			return constantCondition(token == "true"), nil
+		}
+	case unicode.IsDigit(rune(token[0])):
+		{
+			value, err := strconv.ParseFloat(token, 64)
+			if err != nil {
+				return nil, errors.New("invalid number " + token)
+			}
+			return constantCondition(value), nil
+		}
+	}
+
+	_, known := conditionFacts[token]
+	if !known {
+		return nil, errors.New("unknown fact " + token)
+	}
+	return func(facts *MachineFacts) (any, error) {
+		return facts.lookup(token), nil
+	}, nil
+}
+
+func constantCondition(value any) Condition {
+	return func(_ *MachineFacts) (any, error) {
+		return value, nil
+	}
+}
+
+func evaluateBool(condition Condition, facts *MachineFacts) (bool, error) {
+	value, err := condition(facts)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, errors.New(fmt.Sprintf("%v is not a condition", value))
+	}
+	return result, nil
+}
+
+// Collects the changes of every conditional change of the config that applies to an instance on this machine.
+func applicableChanges(instance *Instance) (*ConditionalChange, error) {
+	facts := &MachineFacts{}
+	collected := &ConditionalChange{}
+	for i := range config.Conditions {
+		change := &config.Conditions[i]
+		if len(change.Instances) > 0 && !slices.Contains(change.Instances, instance.Name) {
+			continue
+		}
+
+		condition, err := parseCondition(change.When)
+		if err != nil {
+			return nil, errors.Join(errors.New("invalid condition \""+change.When+"\""), err)
+		}
+		applies, err := evaluateBool(condition, facts)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to evaluate \""+change.When+"\""), err)
+		}
+		if !applies {
+			continue
+		}
+
+		collected.JvmArgs = append(collected.JvmArgs, change.JvmArgs...)
+		collected.GameArgs = append(collected.GameArgs, change.GameArgs...)
+		collected.DisableMods = append(collected.DisableMods, change.DisableMods...)
+		collected.DisablePlugins = append(collected.DisablePlugins, change.DisablePlugins...)
+	}
+	return collected, nil
+}
+
+// Disables the mods a conditional change asks for in the game directory the game runs in, the session of a locked or
+// sharing instance. Returns the names of the mods that were disabled, so they can be enabled again after the launch.
+func disableConditionalMods(gameDir string, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	mods, err := listModsIn(gameDir + "/mods")
+	if err != nil {
+		return nil, err
+	}
+
+	var disabled []string
+	for i := range names {
+		mod := findMod(mods, names[i])
+		if mod == nil || !mod.Enabled {
+			continue
+		}
+		err = setModEnabledIn(gameDir+"/mods", mod, false)
+		if err != nil {
+			return disabled, err
+		}
+		disabled = append(disabled, mod.File)
+	}
+	return disabled, nil
+}
+
+// Enables the mods disableConditionalMods disabled again.
+func restoreConditionalMods(gameDir string, disabled []string) error {
+	if len(disabled) == 0 {
+		return nil
+	}
+	mods, err := listModsIn(gameDir + "/mods")
+	if err != nil {
+		return err
+	}
+	for i := range disabled {
+		mod := findMod(mods, disabled[i])
+		if mod == nil {
+			continue
+		}
+		err = setModEnabledIn(gameDir+"/mods", mod, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
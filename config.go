@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// A time.Duration that is written as a string like "1m30s" in JSON.
+type Duration time.Duration
+
+func (this *Duration) UnmarshalJSON(bytes []byte) error {
+	var raw string
+	err := json.Unmarshal(bytes, &raw)
+	if err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*this = Duration(duration)
+	return nil
+}
+
+func (this Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(this).String())
+}
+
+type NetworkConfig struct {
+	// How long establishing a connection may take.
+	ConnectTimeout Duration `json:"connectTimeout"`
+	// How long a response may go without sending any data.
+	ReadTimeout Duration `json:"readTimeout"`
+	// How often a failed request is retried.
+	Retries int `json:"retries"`
+	// How long to wait before retrying a failed request, doubled for every further attempt.
+	Backoff Duration `json:"backoff"`
+	// The longest time to wait between two attempts.
+	MaxBackoff Duration `json:"maxBackoff"`
+	// The longest time a rate limited host may ask us to wait before retrying, requests fail if it asks for more.
+	MaxRetryAfter Duration `json:"maxRetryAfter"`
+	// How many connections may be open to a single host at once, 0 for no limit. Only used by the default performance
+	// profile.
+	PerHostConcurrency int `json:"perHostConcurrency"`
+	// How many files are downloaded at once. Only used by the default performance profile.
+	DownloadConcurrency int `json:"downloadConcurrency"`
+	// How long the addresses of a host name are cached, 0 disables the cache.
+	DnsCacheTtl Duration `json:"dnsCacheTtl"`
+	// How long it is cached that a host name does not exist, 0 does not remember it.
+	DnsNegativeTtl Duration `json:"dnsNegativeTtl"`
+	// The proxy every request goes through, like "http://proxy:3128" or "socks5://proxy:1080". When empty the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used.
+	Proxy string `json:"proxy"`
+	// The most bytes per second all downloads together may use, 0 for no limit.
+	RateLimit Rate `json:"rateLimit"`
+	// Identifies the launcher to servers, APIs like the ones of Adoptium and Modrinth ask for an identifying one.
+	UserAgent string `json:"userAgent"`
+	// Extra headers sent to a host, keyed by the host name. Useful for API keys, like the one CurseForge requires.
+	// They are never sent to other hosts, not even when a request is redirected.
+	Headers map[string]map[string]string `json:"headers"`
+}
+
+// How the launcher introduces itself to the game, it shows up in crash reports and the debug screen.
+type BrandingConfig struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// How long compressed logs of the game are kept, across all instances.
+type LogConfig struct {
+	// Logs older than this are deleted, 0 to keep them forever.
+	MaxAge Duration `json:"maxAge"`
+	// The most bytes of logs to keep, the oldest are deleted first. 0 for no limit.
+	MaxSize uint64 `json:"maxSize"`
+}
+
+// Sends every request through a single reverse proxy. Requests are mapped to paths below the base URL by the host they
+// were meant for, "https://libraries.minecraft.net/a/b.jar" becomes "<base>/libraries.minecraft.net/a/b.jar" unless
+// the host has a different path in the upstreams.
+type SingleHostConfig struct {
+	Base      string            `json:"base"`
+	Upstreams map[string]string `json:"upstreams"`
+}
+
+// The launcher configuration, read from config.json in the base directory. Every field is optional.
+type Config struct {
+	// A local directory that takes priority over every other artifact source, see findOverride.
+	OverrideRepository string `json:"overrideRepository"`
+	// The names of the runtime providers to try in order, see runtimeProviders.
+	RuntimeProviders []string `json:"runtimeProviders"`
+	// A file with the public key Adoptium signs its releases with, exported with "gpg --export", used instead of the one
+	// built into the launcher. The key has to have the fingerprint ADOPTIUM_KEY_FINGERPRINT. When set a JVM downloaded
+	// from Adoptium without a signature is refused.
+	AdoptiumKey string `json:"adoptiumKey"`
+	// The modules the runtimes of the "jlink" provider are built with, see defaultJlinkModules.
+	JlinkModules []string `json:"jlinkModules"`
+	// The .minecraft directory of the official launcher. When set libraries, assets and client jars are shared with it
+	// and instances are mirrored into its launcher_profiles.json.
+	VanillaDirectory string           `json:"vanillaDirectory"`
+	Network          NetworkConfig    `json:"network"`
+	SingleHost       SingleHostConfig `json:"singleHost"`
+	// Base URLs of mirrors to try before the official host, keyed by the official host. A mirror of
+	// "libraries.minecraft.net" at "https://mirror.example/maven" is asked for "https://mirror.example/maven/a/b.jar"
+	// instead of "https://libraries.minecraft.net/a/b.jar".
+	Mirrors map[string][]string `json:"mirrors"`
+	// Memory and extra arguments for the JVM of every instance, instances and launches can override them.
+	Jvm JvmConfig `json:"jvm"`
+	// The game window of every launch, launches can override it.
+	Window WindowConfig `json:"window"`
+	// Extra arguments for the game of every client, like "--disableMultiplayer". They come after the ones of the
+	// version, launches can add more with "--".
+	GameArgs []string `json:"gameArgs"`
+	// A command java is run through for every instance that has none, like ["gamemoderun"] or ["nice", "-n", "10"].
+	Wrapper []string `json:"wrapper"`
+	// Restarts games that crash for every instance that has no policy of its own, see launchWithRestarts.
+	Restart RestartPolicy `json:"restart"`
+	// Sections of the config encrypted with "config encrypt", keyed by the name of the section. They are decrypted with
+	// a passphrase that is asked for when they are used, see unlockConfigSection.
+	Encrypted map[string]string `json:"encrypted"`
+	// How the backup command stores the backups of worlds.
+	Backups BackupConfig `json:"backups"`
+	// How long the game may log nothing while it starts before it is considered hung and stopped, see watchStartup. 0
+	// never stops it.
+	StartupTimeout Duration `json:"startupTimeout"`
+	// How many bytes of heap dumps are kept per instance, older dumps are deleted first.
+	HeapDumpLimit uint64 `json:"heapDumpLimit"`
+	// Replaces the name and version of the launcher the game is told about.
+	Branding BrandingConfig `json:"branding"`
+	Logs     LogConfig      `json:"logs"`
+	// Maven repositories searched in order for libraries that are only named by their maven coordinate, after the one
+	// the library names itself and before the one of Mojang.
+	MavenRepositories []MavenRepository `json:"mavenRepositories"`
+	// Extra arguments, disabled mods and disabled plugins that only apply on machines matching a condition.
+	Conditions []ConditionalChange `json:"conditions"`
+	// A config served for a whole fleet of machines that is applied on top of this one, see loadRemoteConfig.
+	Remote RemoteConfig `json:"remote"`
+	// Instances that are created when they don't exist yet, meant for remote configs to hand out instances.
+	Instances []Instance `json:"instances"`
+	// How manifests of Mojang with fields and rule features the launcher does not know are handled, SCHEMA_LENIENT when
+	// empty.
+	Schema string `json:"schema"`
+	// One of the performance profiles deciding how many workers, how large buffers and how much overlap between the
+	// phases of a launch are used, PERFORMANCE_DEFAULT when empty.
+	Performance string `json:"performance"`
+}
+
+var config = Config{
+	HeapDumpLimit: 8 * 1024 * 1024 * 1024,
+	Logs: LogConfig{
+		MaxAge:  Duration(90 * 24 * time.Hour),
+		MaxSize: 1024 * 1024 * 1024,
+	},
+	Branding: BrandingConfig{
+		Name:    LAUNCHER_NAME,
+		Version: LAUNCHER_VERSION,
+	},
+	Network: NetworkConfig{
+		ConnectTimeout:      Duration(30 * time.Second),
+		ReadTimeout:         Duration(60 * time.Second),
+		Retries:             3,
+		Backoff:             Duration(time.Second),
+		MaxBackoff:          Duration(30 * time.Second),
+		MaxRetryAfter:       Duration(5 * time.Minute),
+		PerHostConcurrency:  16,
+		DownloadConcurrency: 16,
+		DnsCacheTtl:         Duration(time.Minute),
+		DnsNegativeTtl:      Duration(10 * time.Second),
+		UserAgent:           LAUNCHER_NAME + "/" + LAUNCHER_VERSION + " (+" + LAUNCHER_URL + ")",
+	},
+}
+
+// Reads the configuration if there is one, otherwise the defaults are kept.
+func loadConfig(base string) error {
+	path := base + "/config.json"
+	if !fileExists(path) {
+		return nil
+	}
+
+	err := readJson(path, &config)
+	if err != nil {
+		return errors.Join(errors.New("failed to load config"), err)
+	}
+
+	err = config.validate()
+	if err != nil {
+		return errors.Join(errors.New("invalid config "+path), err)
+	}
+	return nil
+}
+
+// Checks the configuration for values that make no sense, returning all problems at once.
+func (this *Config) validate() error {
+	var err error
+	network := &this.Network
+	if network.ConnectTimeout <= 0 {
+		err = errors.Join(err, errors.New("network.connectTimeout must be positive"))
+	}
+	if network.ReadTimeout <= 0 {
+		err = errors.Join(err, errors.New("network.readTimeout must be positive"))
+	}
+	if network.Retries < 0 || network.Retries > 100 {
+		err = errors.Join(err, errors.New(fmt.Sprintf("network.retries must be between 0 and 100, got %d", network.Retries)))
+	}
+	if network.Backoff < 0 {
+		err = errors.Join(err, errors.New("network.backoff must not be negative"))
+	}
+	if network.MaxBackoff < network.Backoff {
+		err = errors.Join(err, errors.New("network.maxBackoff must not be shorter than network.backoff"))
+	}
+	if network.MaxRetryAfter < 0 {
+		err = errors.Join(err, errors.New("network.maxRetryAfter must not be negative"))
+	}
+	if network.DnsCacheTtl < 0 {
+		err = errors.Join(err, errors.New("network.dnsCacheTtl must not be negative"))
+	}
+	if network.DnsNegativeTtl < 0 {
+		err = errors.Join(err, errors.New("network.dnsNegativeTtl must not be negative"))
+	}
+	if network.PerHostConcurrency < 0 {
+		err = errors.Join(err, errors.New("network.perHostConcurrency must not be negative"))
+	}
+	if network.DownloadConcurrency < 1 {
+		err = errors.Join(err, errors.New("network.downloadConcurrency must be at least 1"))
+	}
+	if network.RateLimit < 0 {
+		err = errors.Join(err, errors.New("network.rateLimit must not be negative"))
+	}
+	if network.UserAgent == "" {
+		err = errors.Join(err, errors.New("network.userAgent must not be empty"))
+	}
+	if network.Proxy != "" {
+		parsed, parseErr := url.Parse(network.Proxy)
+		if parseErr != nil || parsed.Host == "" {
+			err = errors.Join(err, errors.New("network.proxy must be a URL like http://proxy:3128"))
+		} else if parsed.Scheme != "http" && parsed.Scheme != "https" && parsed.Scheme != "socks5" && parsed.Scheme != "socks5h" {
+			err = errors.Join(err, errors.New("network.proxy must use http, https, socks5 or socks5h, not "+parsed.Scheme))
+		}
+	}
+	for host := range this.Mirrors {
+		mirrors := this.Mirrors[host]
+		for i := range mirrors {
+			parsed, parseErr := url.Parse(mirrors[i])
+			if parseErr != nil || parsed.Scheme == "" || parsed.Host == "" {
+				err = errors.Join(err, errors.New("mirror "+mirrors[i]+" of "+host+" must be an absolute URL"))
+			}
+		}
+	}
+	for i := range this.MavenRepositories {
+		repository := &this.MavenRepositories[i]
+		parsed, parseErr := url.Parse(repository.Url)
+		if parseErr != nil || parsed.Scheme == "" || parsed.Host == "" {
+			err = errors.Join(err, errors.New("maven repository "+repository.Url+" must be an absolute URL"))
+		}
+		switch repository.Checksums {
+		case "", MAVEN_CHECKSUMS_REQUIRE, MAVEN_CHECKSUMS_VERIFY, MAVEN_CHECKSUMS_IGNORE:
+		default:
+			{
+				err = errors.Join(err, errors.New("unknown checksum policy "+repository.Checksums+" of maven repository "+repository.Url))
+			}
+		}
+	}
+	if this.Jvm.MaxHeap != "" {
+		heapErr := validateMaxHeapSize(this.Jvm.MaxHeap)
+		if heapErr != nil {
+			err = errors.Join(err, errors.New("jvm.maxHeap: "+heapErr.Error()))
+		}
+	}
+	if this.Jvm.MinHeap != "" {
+		_, heapErr := parseHeapSize(this.Jvm.MinHeap)
+		if heapErr != nil {
+			err = errors.Join(err, errors.New("jvm.minHeap: "+heapErr.Error()))
+		}
+	}
+	if this.StartupTimeout < 0 {
+		err = errors.Join(err, errors.New("startupTimeout must not be negative"))
+	}
+	restartErr := this.Restart.validate()
+	if restartErr != nil {
+		err = errors.Join(err, errors.New("restart: "+restartErr.Error()))
+	}
+	windowErr := this.Window.validate()
+	if windowErr != nil {
+		err = errors.Join(err, errors.New("window: "+windowErr.Error()))
+	}
+	presetErr := validateGcPreset(this.Jvm.GcPreset)
+	if presetErr != nil {
+		err = errors.Join(err, errors.New("jvm.gcPreset: "+presetErr.Error()))
+	}
+	switch this.Backups.Mode {
+	case "", BACKUP_MODE_ARCHIVE, BACKUP_MODE_CHUNKED:
+	default:
+		{
+			err = errors.Join(err, errors.New("unknown backups.mode "+this.Backups.Mode))
+		}
+	}
+	performanceErr := validatePerformanceProfile(this.Performance)
+	if performanceErr != nil {
+		err = errors.Join(err, errors.New("performance: "+performanceErr.Error()))
+	}
+	switch this.Schema {
+	case "", SCHEMA_LENIENT, SCHEMA_STRICT:
+	default:
+		{
+			err = errors.Join(err, errors.New("unknown schema "+this.Schema+", expected "+SCHEMA_LENIENT+" or "+SCHEMA_STRICT))
+		}
+	}
+	backupRemoteErr := this.Backups.Remote.validate()
+	if backupRemoteErr != nil {
+		err = errors.Join(err, backupRemoteErr)
+	}
+	remoteErr := this.Remote.validate()
+	if remoteErr != nil {
+		err = errors.Join(err, remoteErr)
+	}
+	for i := range this.Instances {
+		nameErr := validateInstanceName(this.Instances[i].Name)
+		if nameErr != nil {
+			err = errors.Join(err, nameErr)
+		}
+	}
+	for i := range this.Conditions {
+		_, parseErr := parseCondition(this.Conditions[i].When)
+		if parseErr != nil {
+			err = errors.Join(err, errors.New("invalid condition \""+this.Conditions[i].When+"\": "+parseErr.Error()))
+		}
+	}
+	if this.Logs.MaxAge < 0 {
+		err = errors.Join(err, errors.New("logs.maxAge must not be negative"))
+	}
+	if this.Branding.Name == "" || this.Branding.Version == "" {
+		err = errors.Join(err, errors.New("branding.name and branding.version must not be empty"))
+	}
+	if this.SingleHost.Base != "" {
+		parsed, parseErr := url.Parse(this.SingleHost.Base)
+		if parseErr != nil || parsed.Scheme == "" || parsed.Host == "" {
+			err = errors.Join(err, errors.New("singleHost.base must be an absolute URL"))
+		}
+	}
+	return err
+}
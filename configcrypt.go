@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Encrypted sections are written as "<CONFIG_CRYPT_SCHEME>:<iterations>:<base64 of salt, nonce and ciphertext>".
+	CONFIG_CRYPT_SCHEME     string = "pbkdf2-sha256"
+	CONFIG_CRYPT_ITERATIONS int    = 600000
+	CONFIG_CRYPT_SALT_SIZE  int    = 16
+	// Iteration counts read from a file have to be between CONFIG_CRYPT_ITERATIONS and this, a corrupt or hostile file
+	// must not weaken the key or keep the launcher busy deriving it.
+	CONFIG_CRYPT_MAX_ITERATIONS int = 10 * CONFIG_CRYPT_ITERATIONS
+)
+
+// The sections that can be encrypted. Each is unlocked by the commands that use it, so the passphrase is only asked for
+// when one of them runs. Sections read by every command can not be encrypted.
+var encryptableConfigSections = []string{
+	"backups",
+}
+
+// Sections of config.json that can only be changed with the passphrase of the config. They stay in plain text so they
+// apply without it, and are signed with a key derived from the passphrase. The launcher refuses to run when a restricted
+// section was changed or removed, so deleting parts of config.json does not lift a restriction. Restrictions only hold
+// when the users they restrict can not write restrictions.json.
+type ConfigRestrictions struct {
+	// The restricted sections in the order they are signed.
+	Sections   []string `json:"sections"`
+	Iterations int      `json:"iterations"`
+	Salt       []byte   `json:"salt"`
+	// The public key derived from the passphrase, the signature is checked with it without asking for the passphrase.
+	Key       []byte `json:"key"`
+	Signature []byte `json:"signature"`
+}
+
+// The passphrase of the config once it was entered, it is only asked for once per run.
+var configPassphrase []byte
+
+// The encrypted sections that were unlocked during this run.
+var unlockedConfigSections = map[string]bool{}
+
+// Checks that an iteration count read from a file is one the key may be derived with, see CONFIG_CRYPT_MAX_ITERATIONS.
+func validConfigIterations(iterations int) bool {
+	return iterations >= CONFIG_CRYPT_ITERATIONS && iterations <= CONFIG_CRYPT_MAX_ITERATIONS
+}
+
+// Derives a key from a passphrase with PBKDF2 and HMAC-SHA256, as described by RFC 8018.
+func pbkdf2Sha256(passphrase []byte, salt []byte, iterations int, length int) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	var key []byte
+	for block := uint32(1); len(key) < length; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		previous := prf.Sum(nil)
+		sum := append([]byte{}, previous...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(previous)
+			previous = prf.Sum(previous[:0])
+			for o := range sum {
+				sum[o] ^= previous[o]
+			}
+		}
+		key = append(key, sum...)
+	}
+	return key[:length]
+}
+
+// Encrypts a config section with AES-256-GCM under a key derived from the passphrase. The name of the section is
+// authenticated too, so an encrypted section can not be moved to another one.
+func encryptConfigSection(name string, section []byte, passphrase []byte) (string, error) {
+	salt := make([]byte, CONFIG_CRYPT_SALT_SIZE)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newBackupCipher(pbkdf2Sha256(passphrase, salt, CONFIG_CRYPT_ITERATIONS, BACKUP_KEY_SIZE))
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(append(salt, nonce...), nonce, section, []byte(name))
+	return fmt.Sprintf("%s:%d:%s", CONFIG_CRYPT_SCHEME, CONFIG_CRYPT_ITERATIONS, base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// Decrypts a section encrypted by encryptConfigSection.
+func decryptConfigSection(name string, encrypted string, passphrase []byte) ([]byte, error) {
+	parts := strings.SplitN(encrypted, ":", 3)
+	if len(parts) != 3 || parts[0] != CONFIG_CRYPT_SCHEME {
+		return nil, errors.New("config section " + name + " is not encrypted in a known way")
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || !validConfigIterations(iterations) {
+		return nil, errors.New("config section " + name + " has an invalid iteration count")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(sealed) < CONFIG_CRYPT_SALT_SIZE {
+		return nil, errors.New("config section " + name + " is corrupt")
+	}
+
+	salt := sealed[:CONFIG_CRYPT_SALT_SIZE]
+	aead, err := newBackupCipher(pbkdf2Sha256(passphrase, salt, iterations, BACKUP_KEY_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[CONFIG_CRYPT_SALT_SIZE:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("config section " + name + " is corrupt")
+	}
+	section, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, errors.New("wrong passphrase for config section " + name)
+	}
+	return section, nil
+}
+
+// Reads a line from the terminal without showing it. Terminals of systems with stty stop echoing while it is typed.
+func readPassphrase(prompt string) ([]byte, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, errors.New("there is no terminal to ask for the passphrase of the config")
+	}
+
+	fmt.Print(prompt)
+	restore := disableEcho()
+	if restore != nil {
+		defer func() {
+			restore()
+			fmt.Println()
+		}()
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read the passphrase"), err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// Decrypts a section of the config and applies it, asking for the passphrase the first time. Sections that are not
+// encrypted or were unlocked already are left alone.
+func unlockConfigSection(name string) error {
+	encrypted, ok := config.Encrypted[name]
+	if !ok || unlockedConfigSections[name] {
+		return nil
+	}
+
+	if configPassphrase == nil {
+		passphrase, err := readPassphrase("Passphrase of the config: ")
+		if err != nil {
+			return errors.Join(errors.New("config section "+name+" is encrypted"), err)
+		}
+		configPassphrase = passphrase
+	}
+	section, err := decryptConfigSection(name, encrypted, configPassphrase)
+	if err != nil {
+		configPassphrase = nil
+		return err
+	}
+
+	wrapper, err := json.Marshal(map[string]json.RawMessage{
+		name: section,
+	})
+	if err == nil {
+		err = json.Unmarshal(wrapper, &config)
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to parse config section "+name), err)
+	}
+	err = config.validate()
+	if err != nil {
+		return errors.Join(errors.New("invalid config section "+name), err)
+	}
+	unlockedConfigSections[name] = true
+	return nil
+}
+
+// Checks the encrypted and restricted sections of the config before a command runs. Nothing is decrypted, encrypted
+// sections are unlocked by the commands that use them.
+func checkConfigSections(base string) error {
+	names := make([]string, 0, len(config.Encrypted))
+	for name := range config.Encrypted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i := range names {
+		if !slices.Contains(encryptableConfigSections, names[i]) {
+			return errors.New(fmt.Sprintf("config section %s is encrypted but is read by every command, write it back in plain text with \"config decrypt %s\"", names[i], names[i]))
+		}
+	}
+
+	raw, err := readRawConfig(base)
+	if err != nil {
+		return err
+	}
+	restrictions, err := loadConfigRestrictions(base)
+	if err != nil || restrictions == nil {
+		return err
+	}
+	err = restrictions.verify(raw)
+	if err != nil {
+		return errors.Join(err, errors.New("restore config.json or lift the restriction with \"config unrestrict\""))
+	}
+	return nil
+}
+
+func configRestrictionsPath(base string) string {
+	return base + "/restrictions.json"
+}
+
+// Reads restrictions.json, returns nothing when no section is restricted.
+func loadConfigRestrictions(base string) (*ConfigRestrictions, error) {
+	path := configRestrictionsPath(base)
+	if !fileExists(path) {
+		return nil, nil
+	}
+	var restrictions ConfigRestrictions
+	err := readJson(path, &restrictions)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read "+path), err)
+	}
+	if !validConfigIterations(restrictions.Iterations) {
+		return nil, errors.New(path + " has an invalid iteration count")
+	}
+	return &restrictions, nil
+}
+
+// Builds what the signature covers from config.json as it is on disk: the name and compact JSON of every restricted
+// section. A restricted section that is missing is an error, not an empty section.
+func (this *ConfigRestrictions) message(raw map[string]json.RawMessage) ([]byte, error) {
+	var message bytes.Buffer
+	for i := range this.Sections {
+		name := this.Sections[i]
+		section, ok := raw[name]
+		if !ok {
+			return nil, errors.New("restricted config section " + name + " was removed")
+		}
+		message.WriteString(name)
+		message.WriteByte(0)
+		err := json.Compact(&message, section)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to parse restricted config section "+name), err)
+		}
+		message.WriteByte(0)
+	}
+	return message.Bytes(), nil
+}
+
+// Checks that the restricted sections are the ones that were signed.
+func (this *ConfigRestrictions) verify(raw map[string]json.RawMessage) error {
+	message, err := this.message(raw)
+	if err != nil {
+		return err
+	}
+	if len(this.Key) != ed25519.PublicKeySize || !ed25519.Verify(this.Key, message, this.Signature) {
+		return errors.New("restricted config sections were changed without the passphrase")
+	}
+	return nil
+}
+
+// Derives the signing key from a passphrase, returns nothing when it is not the passphrase of the restrictions.
+func (this *ConfigRestrictions) privateKey(passphrase []byte) ed25519.PrivateKey {
+	private := ed25519.NewKeyFromSeed(pbkdf2Sha256(passphrase, this.Salt, this.Iterations, ed25519.SeedSize))
+	if !bytes.Equal(private.Public().(ed25519.PublicKey), this.Key) {
+		return nil
+	}
+	return private
+}
+
+// Signs the restricted sections as they are now with the passphrase of the config.
+func (this *ConfigRestrictions) sign(raw map[string]json.RawMessage) error {
+	private := this.privateKey(configPassphrase)
+	if private == nil {
+		return errors.New("wrong passphrase for the restricted config sections")
+	}
+	message, err := this.message(raw)
+	if err != nil {
+		return err
+	}
+	this.Signature = ed25519.Sign(private, message)
+	return nil
+}
+
+// Asks for the passphrase every encrypted and restricted section shares and checks it against them, a passphrase that
+// was entered before is checked as well. A new one is asked for when no section uses one yet.
+func askConfigPassphrase(encrypted map[string]string, restrictions *ConfigRestrictions) error {
+	if restrictions == nil && len(encrypted) == 0 {
+		if configPassphrase != nil {
+			return nil
+		}
+		passphrase, err := readPassphrase("New passphrase of the config: ")
+		if err != nil {
+			return err
+		}
+		repeated, err := readPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return err
+		}
+		if string(passphrase) != string(repeated) {
+			return errors.New("the passphrases do not match")
+		}
+		if len(passphrase) == 0 {
+			return errors.New("the passphrase must not be empty")
+		}
+		configPassphrase = passphrase
+		return nil
+	}
+
+	passphrase := configPassphrase
+	if passphrase == nil {
+		var err error
+		passphrase, err = readPassphrase("Passphrase of the config: ")
+		if err != nil {
+			return err
+		}
+	}
+	if restrictions != nil {
+		if restrictions.privateKey(passphrase) == nil {
+			configPassphrase = nil
+			return errors.New("wrong passphrase for the restricted config sections")
+		}
+	} else {
+		for name := range encrypted {
+			_, err := decryptConfigSection(name, encrypted[name], passphrase)
+			if err != nil {
+				configPassphrase = nil
+				return err
+			}
+			break
+		}
+	}
+	configPassphrase = passphrase
+	return nil
+}
+
+// Reads config.json as it is on disk, section by section.
+func readRawConfig(base string) (map[string]json.RawMessage, error) {
+	raw := map[string]json.RawMessage{}
+	path := base + "/config.json"
+	if !fileExists(path) {
+		return raw, nil
+	}
+	err := readJson(path, &raw)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read "+path), err)
+	}
+	if raw == nil {
+		raw = map[string]json.RawMessage{}
+	}
+	return raw, nil
+}
+
+// Returns the encrypted sections of config.json as it is on disk.
+func rawEncryptedSections(raw map[string]json.RawMessage) (map[string]string, error) {
+	encrypted := map[string]string{}
+	if raw["encrypted"] != nil {
+		err := json.Unmarshal(raw["encrypted"], &encrypted)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to parse the encrypted sections of the config"), err)
+		}
+		if encrypted == nil {
+			encrypted = map[string]string{}
+		}
+	}
+	return encrypted, nil
+}
+
+// Writes config.json with the sections formatted the way the launcher writes JSON.
+func writeRawConfig(base string, raw map[string]json.RawMessage, encrypted map[string]string) error {
+	if len(encrypted) == 0 {
+		delete(raw, "encrypted")
+	} else {
+		data, err := json.Marshal(encrypted)
+		if err != nil {
+			return err
+		}
+		raw["encrypted"] = data
+	}
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(base+"/config.json", append(data, '\n'))
+}
+
+var configCommands = []Command{
+	{
+		Name:        "encrypt",
+		Usage:       "<section>",
+		Description: "Encrypts a section of config.json with a passphrase that is asked for when the section is used",
+		Run:         configEncryptCommand,
+	},
+	{
+		Name:        "decrypt",
+		Usage:       "<section>",
+		Description: "Writes an encrypted section of config.json back in plain text",
+		Run:         configDecryptCommand,
+	},
+	{
+		Name:        "restrict",
+		Usage:       "<section>",
+		Description: "Makes a section of config.json unchangeable without the passphrase of the config",
+		Run:         configRestrictCommand,
+	},
+	{
+		Name:        "unrestrict",
+		Usage:       "<section>",
+		Description: "Lets a restricted section of config.json be changed again",
+		Run:         configUnrestrictCommand,
+	},
+}
+
+func configCommand(base string, args []string) error {
+	return runCommand(configCommands, base, args)
+}
+
+func configEncryptCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a section")
+	}
+	name := args[0]
+	if !slices.Contains(encryptableConfigSections, name) {
+		return errors.New(fmt.Sprintf("config section %s is read by every command, only %s can be encrypted", name, strings.Join(encryptableConfigSections, ", ")))
+	}
+	raw, err := readRawConfig(base)
+	if err != nil {
+		return err
+	}
+	encrypted, err := rawEncryptedSections(raw)
+	if err != nil {
+		return err
+	}
+	if _, ok := encrypted[name]; ok {
+		return errors.New("config section " + name + " is encrypted already")
+	}
+	section, ok := raw[name]
+	if !ok {
+		return errors.New("config.json has no section " + name)
+	}
+	restrictions, err := loadConfigRestrictions(base)
+	if err != nil {
+		return err
+	}
+	if restrictions != nil && slices.Contains(restrictions.Sections, name) {
+		return errors.New("config section " + name + " is restricted, restricted sections have to apply without the passphrase")
+	}
+
+	// Every section shares one passphrase, so it has to match the ones that use it already
+	err = askConfigPassphrase(encrypted, restrictions)
+	if err != nil {
+		return err
+	}
+
+	encrypted[name], err = encryptConfigSection(name, section, configPassphrase)
+	if err != nil {
+		return errors.Join(errors.New("failed to encrypt config section "+name), err)
+	}
+	delete(raw, name)
+	err = writeRawConfig(base, raw, encrypted)
+	if err != nil {
+		return errors.Join(errors.New("failed to write config.json"), err)
+	}
+	fmt.Printf("Encrypted config section %s\n", name)
+	return nil
+}
+
+func configDecryptCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a section")
+	}
+	name := args[0]
+	raw, err := readRawConfig(base)
+	if err != nil {
+		return err
+	}
+	encrypted, err := rawEncryptedSections(raw)
+	if err != nil {
+		return err
+	}
+	if _, ok := encrypted[name]; !ok {
+		return errors.New("config section " + name + " is not encrypted")
+	}
+
+	if configPassphrase == nil {
+		configPassphrase, err = readPassphrase("Passphrase of the config: ")
+		if err != nil {
+			return err
+		}
+	}
+	section, err := decryptConfigSection(name, encrypted[name], configPassphrase)
+	if err != nil {
+		return err
+	}
+	raw[name] = section
+	delete(encrypted, name)
+	err = writeRawConfig(base, raw, encrypted)
+	if err != nil {
+		return errors.Join(errors.New("failed to write config.json"), err)
+	}
+	fmt.Printf("Decrypted config section %s\n", name)
+	return nil
+}
+
+func configRestrictCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a section")
+	}
+	name := args[0]
+	raw, err := readRawConfig(base)
+	if err != nil {
+		return err
+	}
+	encrypted, err := rawEncryptedSections(raw)
+	if err != nil {
+		return err
+	}
+	if _, ok := encrypted[name]; ok || name == "encrypted" {
+		return errors.New("config section " + name + " is encrypted, restricted sections have to apply without the passphrase")
+	}
+	if _, ok := raw[name]; !ok {
+		return errors.New("config.json has no section " + name)
+	}
+	restrictions, err := loadConfigRestrictions(base)
+	if err != nil {
+		return err
+	}
+	if restrictions != nil && slices.Contains(restrictions.Sections, name) {
+		return errors.New("config section " + name + " is restricted already")
+	}
+
+	err = askConfigPassphrase(encrypted, restrictions)
+	if err != nil {
+		return err
+	}
+	if restrictions == nil {
+		restrictions = &ConfigRestrictions{
+			Iterations: CONFIG_CRYPT_ITERATIONS,
+			Salt:       make([]byte, CONFIG_CRYPT_SALT_SIZE),
+		}
+		_, err = rand.Read(restrictions.Salt)
+		if err != nil {
+			return err
+		}
+		private := ed25519.NewKeyFromSeed(pbkdf2Sha256(configPassphrase, restrictions.Salt, restrictions.Iterations, ed25519.SeedSize))
+		restrictions.Key = private.Public().(ed25519.PublicKey)
+	} else {
+		// Changes made without the passphrase must not be signed along with the new section
+		err = restrictions.verify(raw)
+		if err != nil {
+			return err
+		}
+	}
+	restrictions.Sections = append(restrictions.Sections, name)
+	sort.Strings(restrictions.Sections)
+	err = restrictions.sign(raw)
+	if err != nil {
+		return err
+	}
+	err = writeJson(configRestrictionsPath(base), restrictions)
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+configRestrictionsPath(base)), err)
+	}
+	fmt.Printf("Restricted config section %s\n", name)
+	return nil
+}
+
+func configUnrestrictCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a section")
+	}
+	name := args[0]
+	restrictions, err := loadConfigRestrictions(base)
+	if err != nil {
+		return err
+	}
+	if restrictions == nil || !slices.Contains(restrictions.Sections, name) {
+		return errors.New("config section " + name + " is not restricted")
+	}
+	raw, err := readRawConfig(base)
+	if err != nil {
+		return err
+	}
+	encrypted, err := rawEncryptedSections(raw)
+	if err != nil {
+		return err
+	}
+
+	err = askConfigPassphrase(encrypted, restrictions)
+	if err != nil {
+		return err
+	}
+	restrictions.Sections = slices.DeleteFunc(restrictions.Sections, func(section string) bool {
+		return section == name
+	})
+	if len(restrictions.Sections) == 0 {
+		err = os.Remove(configRestrictionsPath(base))
+	} else {
+		err = restrictions.sign(raw)
+		if err == nil {
+			err = writeJson(configRestrictionsPath(base), restrictions)
+		}
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+configRestrictionsPath(base)), err)
+	}
+	fmt.Printf("Lifted the restriction of config section %s\n", name)
+	return nil
+}
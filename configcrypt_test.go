@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The PBKDF2-HMAC-SHA256 test vectors of RFC 7914 section 11.
+func TestPbkdf2Sha256(t *testing.T) {
+	tests := []struct {
+		passphrase string
+		salt       string
+		iterations int
+		expected   string
+	}{
+		{
+			passphrase: "passwd",
+			salt:       "salt",
+			iterations: 1,
+			expected: "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+				"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+		{
+			passphrase: "Password",
+			salt:       "NaCl",
+			iterations: 80000,
+			expected: "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+				"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d",
+		},
+	}
+	for i := range tests {
+		test := tests[i]
+		key := pbkdf2Sha256([]byte(test.passphrase), []byte(test.salt), test.iterations, 64)
+		if hex.EncodeToString(key) != test.expected {
+			t.Errorf("%s with %d iterations: expected %s, got %x", test.passphrase, test.iterations, test.expected, key)
+		}
+	}
+}
+
+func TestConfigSectionEncryption(t *testing.T) {
+	section := []byte(`{"mode":"chunked"}`)
+	encrypted, err := encryptConfigSection("backups", section, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := decryptConfigSection("backups", encrypted, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != string(section) {
+		t.Fatalf("expected %s, got %s", section, decrypted)
+	}
+	_, err = decryptConfigSection("backups", encrypted, []byte("wrong"))
+	if err == nil {
+		t.Fatal("expected the wrong passphrase to fail")
+	}
+	_, err = decryptConfigSection("network", encrypted, []byte("secret"))
+	if err == nil {
+		t.Fatal("expected the section to be bound to its name")
+	}
+}
+
+// An iteration count outside of the bounds is refused before a key is derived with it, a huge one would keep the
+// launcher busy for hours.
+func TestConfigSectionIterationBounds(t *testing.T) {
+	encrypted, err := encryptConfigSection("backups", []byte(`{}`), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(encrypted, ":", 3)
+	counts := []string{"1", "9223372036854775807"}
+	for i := range counts {
+		_, err = decryptConfigSection("backups", parts[0]+":"+counts[i]+":"+parts[2], []byte("secret"))
+		if err == nil {
+			t.Fatalf("expected %s iterations to be refused", counts[i])
+		}
+	}
+}
+
+// Changing or removing a restricted section without the passphrase has to stop the launcher instead of lifting the
+// restriction.
+func TestConfigRestrictionsFailClosed(t *testing.T) {
+	base := t.TempDir()
+	defer func() {
+		configPassphrase = nil
+	}()
+	writeConfig := func(contents string) {
+		err := os.WriteFile(base+"/config.json", []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`{"gameArgs": ["--demo"], "wrapper": ["nice"]}`)
+	configPassphrase = []byte("secret")
+	err := configRestrictCommand(base, []string{"gameArgs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPassphrase = nil
+
+	tests := []struct {
+		name     string
+		contents string
+		valid    bool
+	}{
+		{name: "unchanged", contents: `{"gameArgs":["--demo"],"wrapper":["nice"]}`, valid: true},
+		{name: "other section changed", contents: `{"gameArgs": ["--demo"]}`, valid: true},
+		{name: "restricted section changed", contents: `{"gameArgs": []}`},
+		{name: "restricted section removed", contents: `{"wrapper": ["nice"]}`},
+		{name: "config removed", contents: `{}`},
+	}
+	for i := range tests {
+		writeConfig(tests[i].contents)
+		err = checkConfigSections(base)
+		if tests[i].valid && err != nil {
+			t.Errorf("%s: %s", tests[i].name, err)
+		} else if !tests[i].valid && err == nil {
+			t.Errorf("%s: expected the restriction to hold", tests[i].name)
+		}
+	}
+
+	configPassphrase = []byte("wrong")
+	err = configUnrestrictCommand(base, []string{"gameArgs"})
+	if err == nil {
+		t.Fatal("expected the wrong passphrase to be refused")
+	}
+	configPassphrase = []byte("secret")
+	err = configUnrestrictCommand(base, []string{"gameArgs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkConfigSections(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// The game exited with code 0.
+	GAME_EXIT_CLEAN string = "clean"
+	// The game exited with another code, Minecraft does that after writing a crash report.
+	GAME_EXIT_CRASH string = "crash"
+	// The JVM itself died, it was killed by a signal or wrote an error log.
+	GAME_EXIT_JVM_ABORT string = "jvm-abort"
+	// How many of the last lines of the output are printed when the game did not exit cleanly.
+	CRASH_TAIL_LINES int = 20
+)
+
+// How the process of the game ended.
+type GameExit struct {
+	Kind string
+	// The exit code the launcher exits with, 128 plus the signal when the process was killed by one like shells do.
+	Code int
+	// The signal that killed the process, empty when it exited on its own.
+	Signal string
+	// The error log of the JVM when it wrote one.
+	ErrorLog string
+}
+
+// Classifies the result of waiting for the game that was launched at a time. Errors that are not about how the process
+// exited, like a java that could not be started, are returned as they are.
+func classifyExit(result error, gameDir string, started time.Time) (*GameExit, error) {
+	exit := &GameExit{
+		Kind: GAME_EXIT_CLEAN,
+	}
+	if result != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(result, &exitErr) {
+			return nil, result
+		}
+		exit.Code = exitErr.ExitCode()
+		status, ok := exitErr.Sys().(syscall.WaitStatus)
+		if ok && status.Signaled() {
+			exit.Kind = GAME_EXIT_JVM_ABORT
+			exit.Signal = status.Signal().String()
+			exit.Code = 128 + int(status.Signal())
+		} else if exit.Code != 0 {
+			exit.Kind = GAME_EXIT_CRASH
+		}
+	}
+	exit.ErrorLog = findJvmErrorLog(gameDir, started)
+	if exit.ErrorLog != "" {
+		exit.Kind = GAME_EXIT_JVM_ABORT
+	}
+	return exit, nil
+}
+
+// Describes how the game exited for humans.
+func (this *GameExit) describe() string {
+	switch this.Kind {
+	case GAME_EXIT_CLEAN:
+		{
+			return "The game exited cleanly"
+		}
+	case GAME_EXIT_CRASH:
+		{
+			return fmt.Sprintf("The game crashed with exit code %d", this.Code)
+		}
+	default:
+		{
+			if this.Signal != "" {
+				return "The JVM was killed by signal " + this.Signal
+			}
+			return fmt.Sprintf("The JVM aborted with exit code %d", this.Code)
+		}
+	}
+}
+
+// Returns the last lines the game wrote, empty lines at the end left out.
+func crashTail(watcher *LogWatcher, lines int) []string {
+	tail := strings.Split(strings.TrimRight(watcher.output(), "\n \r\t"), "\n")
+	if len(tail) > lines {
+		tail = tail[len(tail)-lines:]
+	}
+	return tail
+}
+
+// Returns the directory the crash bundles of an instance are collected in.
+func crashDir(base string, instance *Instance) string {
+	return instanceDir(base, instance.Name) + "/crashes"
+}
+
+// Returns the newest error log a JVM wrote since the game was launched, or an empty string if there is none. The JVM
+// writes it to its working directory and falls back to the temporary directory when it can not. The log is named after
+// the pid of java, which is not the pid of the process the launcher started when the game runs through a wrapper.
+func findJvmErrorLog(gameDir string, started time.Time) string {
+	workingDir, _ := os.Getwd()
+	dirs := []string{workingDir, gameDir, os.TempDir()}
+	newest := ""
+	var newestTime time.Time
+	for i := range dirs {
+		if dirs[i] == "" {
+			continue
+		}
+		logs, _ := filepath.Glob(filepath.Join(dirs[i], "hs_err_pid*.log"))
+		for o := range logs {
+			info, err := os.Stat(logs[o])
+			if err != nil || info.ModTime().Before(started) || !info.ModTime().After(newestTime) {
+				continue
+			}
+			newest = filepath.ToSlash(logs[o])
+			newestTime = info.ModTime()
+		}
+	}
+	return newest
+}
+
+// Collects what a crashed game left behind into a timestamped zip in crashDir: the error log of the JVM and the newest
+// crash report, if it was written during the launch, and extra files the launcher has for it. The error log is moved
+// into the bundle, the crash report stays where the game put it. Returns the path of the bundle, or an empty string
+// when there was nothing to collect.
+func collectCrashArtifacts(base string, instance *Instance, gameDir string, started time.Time, extra map[string][]byte) (string, error) {
+	files := map[string]string{}
+	errorLog := findJvmErrorLog(gameDir, started)
+	if errorLog != "" {
+		files[filepath.Base(errorLog)] = errorLog
+	}
+	report := newestCrashReport(gameDir)
+	if report != "" {
+		info, err := os.Stat(report)
+		if err == nil && !info.ModTime().Before(started) {
+			files["crash-reports/"+filepath.Base(report)] = report
+		}
+	}
+	if len(files) == 0 && len(extra) == 0 {
+		return "", nil
+	}
+
+	dir := crashDir(base, instance)
+	err := createParents(dir)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to create "+dir), err)
+	}
+	path := dir + "/" + started.Format(BACKUP_TIME_FORMAT) + ".zip"
+	file, err := createFile(path + ".part")
+	if err != nil {
+		return "", errors.Join(errors.New("failed to create "+path), err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(path + ".part")
+	}()
+
+	writer := zip.NewWriter(file)
+	for name := range files {
+		err = func() error {
+			in, err := openFile(files[name])
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = in.Close()
+			}()
+			out, err := writer.Create(name)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, in)
+			return err
+		}()
+		if err != nil {
+			return "", errors.Join(errors.New("failed to add "+files[name]+" to "+path), err)
+		}
+	}
+	for name := range extra {
+		out, err := writer.Create(name)
+		if err == nil {
+			_, err = out.Write(extra[name])
+		}
+		if err != nil {
+			return "", errors.Join(errors.New("failed to add "+name+" to "+path), err)
+		}
+	}
+	err = writer.Close()
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil {
+		err = renameFile(path+".part", path)
+	}
+	if err != nil {
+		return "", errors.Join(errors.New("failed to write "+path), err)
+	}
+
+	if errorLog != "" {
+		_ = os.Remove(errorLog)
+	}
+	return path, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// The error log is named after the pid of java, which is not the one of the process the launcher started when the
+// game runs through a wrapper. The newest log written since the launch is the one of the game.
+func TestFindJvmErrorLog(t *testing.T) {
+	gameDir := t.TempDir()
+	t.Setenv("TMPDIR", t.TempDir())
+	started := time.Now().Add(-time.Minute)
+
+	logs := []struct {
+		name     string
+		modified time.Time
+	}{
+		{name: "hs_err_pid100.log", modified: started.Add(-time.Hour)},
+		{name: "hs_err_pid200.log", modified: started.Add(10 * time.Second)},
+		{name: "hs_err_pid300.log", modified: started.Add(20 * time.Second)},
+	}
+	exit, err := classifyExit(nil, gameDir, started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exit.Kind != GAME_EXIT_CLEAN {
+		t.Fatalf("expected a clean exit without error logs, got %s", exit.Kind)
+	}
+
+	for i := range logs {
+		path := gameDir + "/" + logs[i].name
+		err = os.WriteFile(path, []byte("#\n# A fatal error has been detected by the Java Runtime Environment:\n"), 0644)
+		if err == nil {
+			err = os.Chtimes(path, logs[i].modified, logs[i].modified)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	exit, err = classifyExit(nil, gameDir, started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exit.Kind != GAME_EXIT_JVM_ABORT || exit.ErrorLog != gameDir+"/hs_err_pid300.log" {
+		t.Fatalf("expected the JVM to abort with hs_err_pid300.log, got %s with %q", exit.Kind, exit.ErrorLog)
+	}
+
+	// Logs of earlier launches do not count
+	exit, err = classifyExit(nil, gameDir, started.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exit.Kind != GAME_EXIT_CLEAN {
+		t.Fatalf("expected old error logs to be ignored, got %q", exit.ErrorLog)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// How many host names are cached at most, expired ones are dropped when it is full.
+	DNS_CACHE_SIZE int = 1024
+
+	// How long the addresses of the first family get before the other family is dialed as well, the default of the
+	// dialer of Go.
+	DNS_FALLBACK_DELAY time.Duration = 300 * time.Millisecond
+	// The least time a single address gets when the addresses of a family share the timeout.
+	DNS_MIN_ATTEMPT time.Duration = 2 * time.Second
+)
+
+// A lookup that is cached, or still running when done is open.
+type dnsEntry struct {
+	done      chan struct{}
+	addresses []string
+	err       error
+	expires   time.Time
+}
+
+// Caches the addresses of host names for the shared dialer, so thousands of parallel downloads from the same hosts
+// don't each ask the resolver. Host names that don't exist are cached too, for a shorter time. The resolver of Go does
+// not tell how long a record may be cached, the configured times are the most they are kept. Lookups of the same host
+// name that run at the same time are done once.
+type DnsCache struct {
+	lock     sync.Mutex
+	entries  map[string]*dnsEntry
+	resolver *net.Resolver
+}
+
+var dnsCache = &DnsCache{
+	entries:  map[string]*dnsEntry{},
+	resolver: net.DefaultResolver,
+}
+
+// Returns the addresses of a host name, from the cache when they were looked up recently.
+func (this *DnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	this.lock.Lock()
+	entry, ok := this.entries[host]
+	if ok {
+		select {
+		case <-entry.done:
+			{
+				if time.Now().After(entry.expires) {
+					ok = false
+				}
+			}
+		default:
+		}
+	}
+	if !ok {
+		if len(this.entries) >= DNS_CACHE_SIZE {
+			this.dropExpired()
+		}
+		entry = &dnsEntry{
+			done: make(chan struct{}),
+		}
+		this.entries[host] = entry
+		this.lock.Unlock()
+		this.resolve(host, entry)
+	} else {
+		this.lock.Unlock()
+	}
+
+	select {
+	case <-entry.done:
+		{
+			return entry.addresses, entry.err
+		}
+	case <-ctx.Done():
+		{
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Looks up a host name and finishes its entry. Only answers that the host name does not exist are cached as failures,
+// timeouts and other errors of the resolver are not.
+func (this *DnsCache) resolve(host string, entry *dnsEntry) {
+	defer close(entry.done)
+
+	ctx, cancel := context.WithTimeout(launcherContext, time.Duration(config.Network.ConnectTimeout))
+	defer cancel()
+	addresses, err := this.resolver.LookupIPAddr(ctx, host)
+	if err == nil && len(addresses) == 0 {
+		err = &net.DNSError{
+			Err:        "no addresses",
+			Name:       host,
+			IsNotFound: true,
+		}
+	}
+
+	now := time.Now()
+	if err != nil {
+		entry.err = err
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			entry.expires = now.Add(time.Duration(config.Network.DnsNegativeTtl))
+		} else {
+			entry.expires = now
+		}
+		return
+	}
+
+	entry.addresses = make([]string, len(addresses))
+	for i := range addresses {
+		entry.addresses[i] = addresses[i].String()
+	}
+	entry.expires = now.Add(time.Duration(config.Network.DnsCacheTtl))
+}
+
+// Removes the entries that expired.
+func (this *DnsCache) trim() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.dropExpired()
+}
+
+// Removes the entries that expired, the lock has to be held.
+func (this *DnsCache) dropExpired() {
+	now := time.Now()
+	for host := range this.entries {
+		entry := this.entries[host]
+		select {
+		case <-entry.done:
+			{
+				if now.After(entry.expires) {
+					delete(this.entries, host)
+				}
+			}
+		default:
+		}
+	}
+}
+
+// Wraps a dialer so it connects to the cached addresses of host names. Like the dialer does on its own, the addresses
+// of the family of the first one are raced against the ones of the other family, which start after the fallback delay
+// of the dialer or when the first family failed, so a broken IPv6 network does not stall every connection.
+func (this *DnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		addresses, err := this.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		primaries, fallbacks := splitAddressFamilies(network, addresses)
+		if len(primaries) == 0 {
+			return nil, errors.New("no " + network + " address for " + host)
+		}
+		for i := range primaries {
+			primaries[i] = net.JoinHostPort(primaries[i], port)
+		}
+		for i := range fallbacks {
+			fallbacks[i] = net.JoinHostPort(fallbacks[i], port)
+		}
+
+		delay := dialer.FallbackDelay
+		if delay <= 0 {
+			delay = DNS_FALLBACK_DELAY
+		}
+		return dialParallel(ctx, primaries, fallbacks, delay, dialer.Timeout, func(ctx context.Context, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		})
+	}
+}
+
+// Splits addresses into the ones of the family of the first address and the ones of the other family. Addresses that
+// the network can not reach, like IPv6 ones for "tcp4", are left out.
+func splitAddressFamilies(network string, addresses []string) ([]string, []string) {
+	var primaries []string
+	var fallbacks []string
+	primaryIsV4 := false
+	for i := range addresses {
+		ip := net.ParseIP(addresses[i])
+		if ip == nil {
+			continue
+		}
+		isV4 := ip.To4() != nil
+		if (isV4 && strings.HasSuffix(network, "6")) || (!isV4 && strings.HasSuffix(network, "4")) {
+			continue
+		}
+		if len(primaries) == 0 {
+			primaryIsV4 = isV4
+		}
+		if isV4 == primaryIsV4 {
+			primaries = append(primaries, addresses[i])
+		} else {
+			fallbacks = append(fallbacks, addresses[i])
+		}
+	}
+	return primaries, fallbacks
+}
+
+// The result of dialing the addresses of one family.
+type dialResult struct {
+	connection net.Conn
+	err        error
+	primary    bool
+}
+
+// Dials the primary addresses and, after a delay or once they failed, the fallback addresses at the same time.
+// Returns the first connection, the ones that connect later are closed.
+func dialParallel(ctx context.Context, primaries []string, fallbacks []string, delay time.Duration, timeout time.Duration, dial func(ctx context.Context, address string) (net.Conn, error)) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return dialSerial(ctx, primaries, timeout, dial)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	returned := make(chan struct{})
+	defer close(returned)
+	results := make(chan dialResult)
+	race := func(addresses []string, primary bool) {
+		connection, err := dialSerial(ctx, addresses, timeout, dial)
+		select {
+		case results <- dialResult{connection: connection, err: err, primary: primary}:
+		case <-returned:
+			{
+				if connection != nil {
+					_ = connection.Close()
+				}
+			}
+		}
+	}
+
+	go race(primaries, true)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	fallbackStarted := false
+	running := 1
+	var failures error
+	for {
+		select {
+		case <-timer.C:
+			{
+				if !fallbackStarted {
+					fallbackStarted = true
+					running++
+					go race(fallbacks, false)
+				}
+			}
+		case result := <-results:
+			{
+				if result.err == nil {
+					return result.connection, nil
+				}
+				failures = errors.Join(failures, result.err)
+				running--
+				if result.primary && !fallbackStarted {
+					fallbackStarted = true
+					running++
+					go race(fallbacks, false)
+				}
+				if running == 0 {
+					return nil, failures
+				}
+			}
+		}
+	}
+}
+
+// Dials addresses one after another until one connects. The timeout is shared by all of them like the dialer shares
+// it, every address gets an equal part of what is left but at least DNS_MIN_ATTEMPT.
+func dialSerial(ctx context.Context, addresses []string, timeout time.Duration, dial func(ctx context.Context, address string) (net.Conn, error)) (net.Conn, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var failures error
+	for i := range addresses {
+		attempt := ctx
+		cancel := func() {}
+		deadline, ok := ctx.Deadline()
+		if ok {
+			remaining := time.Until(deadline)
+			partial := remaining / time.Duration(len(addresses)-i)
+			if partial < DNS_MIN_ATTEMPT {
+				partial = min(DNS_MIN_ATTEMPT, remaining)
+			}
+			attempt, cancel = context.WithTimeout(ctx, partial)
+		}
+		connection, err := dial(attempt, addresses[i])
+		cancel()
+		if err == nil {
+			return connection, nil
+		}
+		failures = errors.Join(failures, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, failures
+}
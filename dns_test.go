@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSplitAddressFamilies(t *testing.T) {
+	addresses := []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2"}
+	primaries, fallbacks := splitAddressFamilies("tcp", addresses)
+	if len(primaries) != 2 || primaries[0] != "2001:db8::1" || len(fallbacks) != 2 || fallbacks[0] != "192.0.2.1" {
+		t.Fatalf("unexpected split %v %v", primaries, fallbacks)
+	}
+	primaries, fallbacks = splitAddressFamilies("tcp4", addresses)
+	if len(primaries) != 2 || primaries[0] != "192.0.2.1" || len(fallbacks) != 0 {
+		t.Fatalf("unexpected split for tcp4 %v %v", primaries, fallbacks)
+	}
+}
+
+// An IPv6 network that swallows connection attempts must not hold up the IPv4 addresses for longer than the fallback
+// delay.
+func TestDialParallelFallsBack(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	dialer := &net.Dialer{}
+	started := time.Now()
+	connection, err := dialParallel(context.Background(), []string{"[2001:db8::1]:1"}, []string{listener.Addr().String()}, 50*time.Millisecond, 30*time.Second, func(ctx context.Context, address string) (net.Conn, error) {
+		if address != listener.Addr().String() {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return dialer.DialContext(ctx, "tcp", address)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = connection.Close()
+	if time.Since(started) > 5*time.Second {
+		t.Fatalf("connecting took %s", time.Since(started))
+	}
+}
+
+func TestDialParallelReportsEveryFailure(t *testing.T) {
+	first := errors.New("first")
+	second := errors.New("second")
+	_, err := dialParallel(context.Background(), []string{"a"}, []string{"b"}, time.Hour, 0, func(ctx context.Context, address string) (net.Conn, error) {
+		if address == "a" {
+			return nil, first
+		}
+		return nil, second
+	})
+	if !errors.Is(err, first) || !errors.Is(err, second) {
+		t.Fatalf("expected both failures, got %v", err)
+	}
+}
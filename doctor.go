@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Checks the setup of the launcher for common problems. Returns one line per check, problems are marked with "!!".
+func runDoctor(base string) []string {
+	var lines []string
+	check := func(name string, err error) {
+		if err != nil {
+			lines = append(lines, "[!!] "+name+": "+strings.ReplaceAll(err.Error(), "\n", "; "))
+		} else {
+			lines = append(lines, "[ok] "+name)
+		}
+	}
+
+	lines = append(lines, fmt.Sprintf("     %s %s on %s/%s, built with %s", LAUNCHER_NAME, LAUNCHER_VERSION, runtime.GOOS, runtime.GOARCH, runtime.Version()))
+
+	if fileExists(base + "/config.json") {
+		check("config.json is valid", config.validate())
+	} else {
+		lines = append(lines, "[ok] no config.json, using the defaults")
+	}
+
+	probe := base + "/.doctor"
+	file, err := createFile(probe)
+	if err == nil {
+		_ = file.Close()
+		_ = os.Remove(probe)
+	}
+	check("base directory "+base+" is writable", err)
+
+	check("hash cache is readable", hashCache.corruption)
+
+	java, err := findSystemJava(base, 0, "")
+	if err != nil {
+		lines = append(lines, "[ok] no system Java, runtimes will be downloaded")
+	} else {
+		check("system Java at "+java, nil)
+	}
+
+	if config.VanillaDirectory != "" {
+		if fileExists(config.VanillaDirectory) {
+			check("vanilla directory "+config.VanillaDirectory+" exists", nil)
+		} else {
+			check("vanilla directory "+config.VanillaDirectory+" exists", errors.New("it does not"))
+		}
+	}
+
+	instances, err := listInstances(base)
+	check(fmt.Sprintf("%d instances can be loaded", len(instances)), err)
+	for i := range instances {
+		gameDir := instances[i].gameDir(base)
+		if !fileExists(gameDir) {
+			check("game directory of "+instances[i].Name, errors.New(gameDir+" does not exist"))
+		}
+	}
+
+	if config.Network.Proxy != "" {
+		lines = append(lines, "     requests go through a proxy")
+	}
+	if config.SingleHost.Base != "" {
+		lines = append(lines, "     requests go through the single host "+config.SingleHost.Base)
+	}
+	return lines
+}
+
+func doctorCommand(base string, args []string) error {
+	if len(args) != 0 {
+		return errors.New("expected no arguments")
+	}
+
+	lines := runDoctor(base)
+	for i := range lines {
+		fmt.Println(lines[i])
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The directories of the game directory an instance runs with the ones of another after "instance merge --link", see
+// prepareSharedSession.
+var sharedGameDirs = []string{
+	"mods",
+	"config",
+}
+
+// Returns a hash of what decides the game an instance runs: its version, loader and the contents of its enabled mods.
+// Instances with the same fingerprint only differ in their worlds and settings.
+func instanceFingerprint(base string, instance *Instance) (string, error) {
+	digest := sha256.New()
+	loader := ""
+	if instance.Loader != nil {
+		loader = instance.Loader.Name + " " + instance.Loader.Version
+	}
+	_, _ = fmt.Fprintf(digest, "%s\n%s\n%t\n", instance.Version, loader, instance.Server)
+
+	mods, err := listMods(base, instance)
+	if err != nil {
+		return "", err
+	}
+	var hashes []string
+	for i := range mods {
+		if !mods[i].Enabled {
+			continue
+		}
+		hash, err := sha1File(modsDir(base, instance) + "/" + mods[i].File)
+		if err != nil {
+			return "", errors.Join(errors.New("failed to hash mod "+mods[i].File+" of "+instance.Name), err)
+		}
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for i := range hashes {
+		_, _ = fmt.Fprintln(digest, hashes[i])
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// Groups the instances that run the same game, see instanceFingerprint. Instances that already share the mods of
+// another one in their group are left out. Only groups of at least two instances are returned, sorted by name.
+func findDuplicateInstances(base string) ([][]*Instance, error) {
+	instances, err := listInstances(base)
+	if err != nil {
+		return nil, err
+	}
+
+	byFingerprint := map[string][]*Instance{}
+	var fingerprints []string
+	for i := range instances {
+		fingerprint, err := instanceFingerprint(base, instances[i])
+		if err != nil {
+			return nil, err
+		}
+		if byFingerprint[fingerprint] == nil {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+		byFingerprint[fingerprint] = append(byFingerprint[fingerprint], instances[i])
+	}
+
+	var groups [][]*Instance
+	for i := range fingerprints {
+		all := byFingerprint[fingerprints[i]]
+		names := map[string]bool{}
+		for o := range all {
+			names[all[o].Name] = true
+		}
+		var group []*Instance
+		for o := range all {
+			if !names[all[o].SharesWith] {
+				group = append(group, all[o])
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0].Name < groups[j][0].Name
+	})
+	return groups, nil
+}
+
+// Moves the worlds of an instance into the saves of another one. Worlds with a name the other instance uses already
+// get the name of the instance they came from appended.
+func moveSaves(base string, from *Instance, into *Instance) error {
+	source := from.gameDir(base) + "/saves"
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return errors.Join(errors.New("failed to list the worlds of "+from.Name), err)
+	}
+	target := into.gameDir(base) + "/saves"
+	err = createParents(target)
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+target), err)
+	}
+
+	for i := range entries {
+		name := entries[i].Name()
+		destination := target + "/" + name
+		if fileExists(destination) {
+			destination = target + "/" + name + " (" + from.Name + ")"
+		}
+		if fileExists(destination) {
+			return errors.New("both " + from.Name + " and " + into.Name + " have a world named " + name)
+		}
+		err = renameFile(source+"/"+name, destination)
+		if err != nil {
+			return errors.Join(errors.New("failed to move world "+name+" of "+from.Name), err)
+		}
+		fmt.Printf("Moved world %s of %s to %s\n", name, from.Name, destination)
+	}
+	return nil
+}
+
+// Makes an instance run with the mods and config of another one. The mods are the same, they are deleted. The config
+// may differ, it is kept next to where it was.
+func shareGameDirs(base string, from *Instance, into *Instance) error {
+	for i := range sharedGameDirs {
+		name := sharedGameDirs[i]
+		path := from.gameDir(base) + "/" + name
+		if !fileExists(path) {
+			continue
+		}
+		var err error
+		if name == "mods" {
+			err = removeAll(path)
+		} else {
+			err = renameFile(path, path+".unshared")
+		}
+		if err != nil {
+			return errors.Join(errors.New("failed to move the "+name+" of "+from.Name+" out of the way"), err)
+		}
+	}
+	from.SharesWith = into.Name
+	return saveInstance(base, from)
+}
+
+// Lists what merging an instance into another one without --link deletes: everything in its directory but its worlds,
+// which are moved, and its instance.json. A game directory outside of the instance is left alone, only its worlds are
+// moved.
+func listMergeLosses(base string, instance *Instance) ([]string, error) {
+	var losses []string
+	dirs := []string{instanceDir(base, instance.Name)}
+	if instance.GameDir == "" {
+		dirs = append(dirs, instance.gameDir(base))
+	}
+	for i := range dirs {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, errors.Join(errors.New("failed to list "+dirs[i]), err)
+		}
+		for o := range entries {
+			path := dirs[i] + "/" + entries[o].Name()
+			if path == instance.gameDir(base) || path == instance.gameDir(base)+"/saves" || entries[o].Name() == "instance.json" {
+				continue
+			}
+			losses = append(losses, path)
+		}
+	}
+	return losses, nil
+}
+
+func instanceDuplicatesCommand(base string, args []string) error {
+	if len(args) != 0 {
+		return errors.New("expected no arguments")
+	}
+
+	groups, err := findDuplicateInstances(base)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Println("No instances run the same game")
+		return nil
+	}
+	for i := range groups {
+		names := make([]string, len(groups[i]))
+		for o := range groups[i] {
+			names[o] = groups[i][o].Name
+		}
+		fmt.Printf("%s run the same version, loader and mods\n", strings.Join(names, ", "))
+		fmt.Printf("    Merge them into one:          instance merge %s\n", strings.Join(names, " "))
+		fmt.Printf("    Share mods, keep the worlds:  instance merge --link %s\n", strings.Join(names, " "))
+	}
+	return nil
+}
+
+func instanceMergeCommand(base string, args []string) error {
+	set := flag.NewFlagSet("instance merge", flag.ContinueOnError)
+	link := set.Bool("link", false, "keep the other instances with their worlds and run them with the mods and config of the first one instead")
+	force := set.Bool("force", false, "delete the files of the other instances that are not worlds")
+	args, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errors.New("expected the instance to merge into and at least one other")
+	}
+
+	into, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+	fingerprint, err := instanceFingerprint(base, into)
+	if err != nil {
+		return err
+	}
+	instances, err := listInstances(base)
+	if err != nil {
+		return err
+	}
+	var others []*Instance
+	for i := 1; i < len(args); i++ {
+		other, err := loadInstance(base, args[i])
+		if err != nil {
+			return err
+		}
+		if other.Name == into.Name {
+			return errors.New("can not merge " + into.Name + " into itself")
+		}
+		otherFingerprint, err := instanceFingerprint(base, other)
+		if err != nil {
+			return err
+		}
+		if otherFingerprint != fingerprint {
+			return errors.New(other.Name + " does not run the same version, loader and mods as " + into.Name)
+		}
+		if other.Locked {
+			return errors.New("instance " + other.Name + " is locked, unlock it with \"instance edit " + other.Name + " --locked=false\" first")
+		}
+		// Its mods are deleted either way, the ones that share them would be left without
+		for o := range instances {
+			if instances[o].SharesWith == other.Name {
+				return errors.New(instances[o].Name + " shares the mods of " + other.Name + ", merge it first")
+			}
+		}
+		others = append(others, other)
+	}
+	if *link && into.SharesWith != "" {
+		return errors.New(into.Name + " shares the mods of " + into.SharesWith + ", merge into that one instead")
+	}
+
+	if !*link && !*force {
+		var losses []string
+		for i := range others {
+			lost, err := listMergeLosses(base, others[i])
+			if err != nil {
+				return err
+			}
+			losses = append(losses, lost...)
+		}
+		if len(losses) != 0 {
+			fmt.Println("Merging deletes everything but the worlds of the other instances:")
+			for i := range losses {
+				fmt.Printf("    %s\n", losses[i])
+			}
+			return errors.New("refusing to delete them, merge with --force to delete them or with --link to keep them")
+		}
+	}
+
+	for i := range others {
+		other := others[i]
+		if *link {
+			err = shareGameDirs(base, other, into)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s now runs with the mods and config of %s\n", other.Name, into.Name)
+			continue
+		}
+
+		err = moveSaves(base, other, into)
+		if err != nil {
+			return err
+		}
+		err = removeAll(instanceDir(base, other.Name))
+		if err != nil {
+			return errors.Join(errors.New("failed to delete instance "+other.Name), err)
+		}
+		if other.GameDir != "" {
+			fmt.Printf("Left the game directory %s of %s alone\n", other.GameDir, other.Name)
+		}
+		fmt.Printf("Merged %s into %s\n", other.Name, into.Name)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// Creates instances that run the same game, with a world and some settings each.
+func createDuplicateInstances(t *testing.T, base string, names ...string) {
+	for i := range names {
+		instance := &Instance{
+			Name:    names[i],
+			Version: "1.20.4",
+		}
+		err := saveInstance(base, instance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gameDir := instance.gameDir(base)
+		err = os.MkdirAll(gameDir+"/saves/"+names[i]+" world", 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(gameDir+"/options.txt", []byte("lang:en_us\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Merging must not delete the settings of the other instance unless asked to.
+func TestInstanceMergeRefusesToDelete(t *testing.T) {
+	base := t.TempDir()
+	createDuplicateInstances(t, base, "a", "b")
+
+	err := instanceMergeCommand(base, []string{"a", "b"})
+	if err == nil {
+		t.Fatal("expected the merge to be refused")
+	}
+	if !fileExists(instanceDir(base, "b") + "/minecraft/options.txt") {
+		t.Fatal("the options of b were deleted")
+	}
+
+	err = instanceMergeCommand(base, []string{"--force", "a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(instanceDir(base, "b")) {
+		t.Fatal("b was not deleted")
+	}
+	if !fileExists(instanceDir(base, "a") + "/minecraft/saves/b world") {
+		t.Fatal("the world of b was not moved")
+	}
+}
+
+// An instance that shares the mods of another one runs in a session with a copy of them and its own worlds, the
+// instance it shares them with can not be deleted.
+func TestInstanceMergeLink(t *testing.T) {
+	base := t.TempDir()
+	createDuplicateInstances(t, base, "a", "b")
+	err := os.MkdirAll(instanceDir(base, "a")+"/minecraft/config", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(instanceDir(base, "a")+"/minecraft/config/mod.toml", []byte("shared = true\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = instanceMergeCommand(base, []string{"--link", "a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = instanceDeleteCommand(base, []string{"a"})
+	if err == nil {
+		t.Fatal("expected deleting a to be refused")
+	}
+
+	b, err := loadInstance(base, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, cleanup, err := prepareSharedSession(base, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(dir + "/config/mod.toml") {
+		t.Fatal("the config of a was not copied into the session")
+	}
+	if !fileExists(dir + "/saves/b world") {
+		t.Fatal("the worlds of b are missing from the session")
+	}
+	err = os.WriteFile(dir+"/servers.dat", []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+
+	if fileExists(dir) {
+		t.Fatal("the session was not deleted")
+	}
+	if !fileExists(b.gameDir(base) + "/servers.dat") {
+		t.Fatal("a file the game created was not kept")
+	}
+	if fileExists(b.gameDir(base) + "/config") {
+		t.Fatal("b has a config of its own")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	SHELL_SH         string = "sh"
+	SHELL_FISH       string = "fish"
+	SHELL_POWERSHELL string = "powershell"
+	SHELL_CMD        string = "cmd"
+)
+
+var shells = []string{
+	SHELL_SH,
+	SHELL_FISH,
+	SHELL_POWERSHELL,
+	SHELL_CMD,
+}
+
+// Returns the path of the file the classpath of an instance is written to by "instance env".
+func classpathFilePath(base string, instance *Instance) string {
+	return instanceDir(base, instance.Name) + "/classpath.txt"
+}
+
+// Formats setting an environment variable for a shell, quoted so the value is taken as it is.
+func shellExport(shell string, name string, value string) string {
+	switch shell {
+	case SHELL_FISH:
+		{
+			value = strings.ReplaceAll(value, "\\", "\\\\")
+			return "set -gx " + name + " '" + strings.ReplaceAll(value, "'", "\\'") + "'"
+		}
+	case SHELL_POWERSHELL:
+		{
+			return "$env:" + name + " = '" + strings.ReplaceAll(value, "'", "''") + "'"
+		}
+	case SHELL_CMD:
+		{
+			return "set \"" + name + "=" + value + "\""
+		}
+	default:
+		{
+			return "export " + name + "='" + strings.ReplaceAll(value, "'", "'\\''") + "'"
+		}
+	}
+}
+
+// Formats putting a directory in front of the PATH of a shell.
+func shellPrependPath(shell string, dir string) string {
+	switch shell {
+	case SHELL_FISH:
+		{
+			return "set -gx PATH '" + strings.ReplaceAll(strings.ReplaceAll(dir, "\\", "\\\\"), "'", "\\'") + "' $PATH"
+		}
+	case SHELL_POWERSHELL:
+		{
+			return "$env:PATH = '" + strings.ReplaceAll(dir, "'", "''") + "' + [IO.Path]::PathSeparator + $env:PATH"
+		}
+	case SHELL_CMD:
+		{
+			return "set \"PATH=" + dir + ";%PATH%\""
+		}
+	default:
+		{
+			return "export PATH='" + strings.ReplaceAll(dir, "'", "'\\''") + "':\"$PATH\""
+		}
+	}
+}
+
+// Returns the variables the game of an instance gets on top of the environment of the launcher, the ones of the
+// instance win over the ones of plugins.
+func gameEnvironment(instance *Instance, plugins *PluginChanges) map[string]string {
+	variables := map[string]string{}
+	for name := range plugins.Env {
+		variables[name] = plugins.Env[name]
+	}
+	for name := range instance.Env {
+		variables[name] = instance.Env[name]
+	}
+	return variables
+}
+
+// Returns the environment of the launcher with variables set, later entries win when the process is started.
+func processEnvironment(variables map[string]string) []string {
+	environment := os.Environ()
+	for name := range variables {
+		environment = append(environment, name+"="+variables[name])
+	}
+	return environment
+}
+
+func instanceEnvCommand(base string, args []string) error {
+	set := flag.NewFlagSet("instance env", flag.ContinueOnError)
+	shell := set.String("shell", DEFAULT_SHELL, "the shell to print the exports for, one of "+strings.Join(shells, ", "))
+	args, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+	if !slices.Contains(shells, *shell) {
+		return errors.New("unknown shell " + *shell + ", expected one of " + strings.Join(shells, ", "))
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+	if instance.Server {
+		return errors.New("instance env only works for clients, " + instance.Name + " is a server")
+	}
+
+	// The output is meant to be evaluated by the shell, so everything preparing the instance prints goes to stderr
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	javaHome, manifest, classpath, err := prepareInstanceEnvironment(base, instance)
+	os.Stdout = stdout
+	if err != nil {
+		return err
+	}
+
+	classpathFile := classpathFilePath(base, instance)
+	err = writeFile(classpathFile, []byte(strings.Join(classpath, string(filepath.ListSeparator))+"\n"))
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+classpathFile), err)
+	}
+
+	exports := [][2]string{
+		{"JAVA_HOME", javaHome},
+		{"LAUNCHER_INSTANCE", instance.Name},
+		{"LAUNCHER_GAME_DIR", instance.gameDir(base)},
+		{"LAUNCHER_CLASSPATH_FILE", classpathFile},
+		{"LAUNCHER_MAIN_CLASS", manifest.MainClass},
+	}
+	for i := range exports {
+		fmt.Println(shellExport(*shell, exports[i][0], exports[i][1]))
+	}
+	fmt.Println(shellPrependPath(*shell, javaHome+"/bin"))
+	return nil
+}
+
+// Downloads everything an instance needs and returns the Java it runs with, its manifest and its classpath.
+func prepareInstanceEnvironment(base string, instance *Instance) (string, *Manifest, []string, error) {
+	_, err := launch(base, instance, &LaunchOptions{
+		PrepareOnly: true,
+	})
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	version, err := resolveManifest(base, instance)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var manifest Manifest
+	err = loadVersionJson(base, version, &manifest)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	javaHome, err := provideInstanceRuntime(base, instance, manifest.javaVersion(), manifest.JavaVersion.Component)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	classpath, _, err := downloadLibraries(base, manifest.Libraries, map[string]bool{})
+	if err != nil {
+		return "", nil, nil, errors.Join(errors.New("failed to download libraries"), err)
+	}
+	javaHome, err = filepath.Abs(javaHome)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return javaHome, &manifest, append([]string{clientJarPath(base, manifest.Id)}, classpath...), nil
+}
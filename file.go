@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
@@ -10,10 +11,24 @@ import (
 	"hash"
 	"io"
 	"os"
+	"strings"
 )
 
-// Uses SHA to validate the integrity of a file. The hash needs to be provided in lower-case hexadecimal. Only returns
-// true when the file was successfully hashed and the hashes match.
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Marks a hash as MD5, only the few sources that provide nothing better use it, see md5Hash.
+	MD5_HASH_PREFIX string = "md5:"
+)
+
+// Turns the MD5 hash of a file from a source that only provides MD5, like Technic and ATLauncher, into a hash hashFile
+// accepts. Hashes of 32 characters without the prefix are refused, so no other source is checked with MD5.
+func md5Hash(md5 string) *string {
+	hash := MD5_HASH_PREFIX + strings.ToLower(md5)
+	return &hash
+}
+
+// Uses SHA to validate the integrity of a file, or MD5 for hashes made by md5Hash. The hash needs to be provided in
+// lower-case hexadecimal. Only returns true when the file was successfully hashed and the hashes match.
 func hashFile(path string, sha string) (bool, error) {
 	file, err := openFile(path)
 	if err != nil {
@@ -23,14 +38,29 @@ func hashFile(path string, sha string) (bool, error) {
 		_ = file.Close()
 	}()
 
+	valid, err := hashReader(file, sha)
+	if err != nil {
+		return false, errors.Join(errors.New("failed to hash file "+path), err)
+	}
+	return valid, nil
+}
+
+// Like hashFile for anything that can be read, like the files of a store that are not on disk.
+func hashReader(reader io.Reader, sha string) (bool, error) {
 	var digest hash.Hash
 	hashSize := len(sha)
-	switch hashSize {
-	case 40:
+	md5Sum, isMd5 := strings.CutPrefix(sha, MD5_HASH_PREFIX)
+	switch {
+	case isMd5:
+		{
+			digest = md5.New()
+			sha = md5Sum
+		}
+	case hashSize == 40:
 		{
 			digest = sha1.New()
 		}
-	case 64:
+	case hashSize == 64:
 		{
 			digest = sha256.New()
 		}
@@ -39,9 +69,9 @@ func hashFile(path string, sha string) (bool, error) {
 			return false, errors.New(fmt.Sprintf("Unknown hash size %d", hashSize))
 		}
 	}
-	_, err = io.Copy(digest, file)
+	_, err := copyBuffered(digest, reader)
 	if err != nil {
-		return false, errors.Join(errors.New("failed to hash file "+path), err)
+		return false, err
 	}
 	calculated := hex.EncodeToString(digest.Sum(nil))
 	return calculated == sha, nil
@@ -49,13 +79,21 @@ func hashFile(path string, sha string) (bool, error) {
 
 // Hashes a file (if it exists) using hashFile and attempts to delete it if the hashes do not match. The hash needs to
 // be provided in lower-case hexadecimal. Only returns true when the file was successfully hashed and the hashes match.
+// Files the hash cache knows to be unchanged are not hashed again.
 func validateHash(path string, hash string) (bool, error) {
 	if fileExists(path) {
+		if hashCache.lookup(path, hash) {
+			return true, nil
+		}
+
 		result, err := hashFile(path, hash)
 		if err != nil {
 			return false, errors.Join(errors.New(fmt.Sprintf("could not validate hash of %s", path)), err)
 		}
-		if !result {
+		if result {
+			hashCache.remember(path, hash)
+		} else {
+			hashCache.forget(path)
 			err = os.Remove(path)
 			if err != nil {
 				return false, errors.Join(errors.New(fmt.Sprintf("could not delete corrupted file %s", path)), err)
@@ -66,10 +104,30 @@ func validateHash(path string, hash string) (bool, error) {
 	return false, nil
 }
 
-func readJson(path string, structure any) error {
+// Checks the size of a file (if it exists) and attempts to delete it if the size does not match, a cheap check that
+// catches most corrupted files before hashing them. A size of 0 means the size is unknown and always matches. Only
+// returns false when the file exists and has a different size.
+func validateSize(path string, size uint64) (bool, error) {
+	if size == 0 {
+		return true, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || uint64(info.Size()) == size {
+		return true, nil
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		return false, errors.Join(errors.New(fmt.Sprintf("could not delete corrupted file %s", path)), err)
+	}
+	return false, nil
+}
+
+func readFile(path string) ([]byte, error) {
 	file, err := openFile(path)
 	if err != nil {
-		return errors.Join(errors.New("failed to open "+path), err)
+		return nil, errors.Join(errors.New("failed to open "+path), err)
 	}
 	defer func() {
 		_ = file.Close()
@@ -77,7 +135,15 @@ func readJson(path string, structure any) error {
 
 	buffer, err := io.ReadAll(file)
 	if err != nil {
-		return errors.Join(errors.New("failed to read "+path), err)
+		return nil, errors.Join(errors.New("failed to read "+path), err)
+	}
+	return buffer, nil
+}
+
+func readJson(path string, structure any) error {
+	buffer, err := readFile(path)
+	if err != nil {
+		return err
 	}
 
 	err = json.Unmarshal(buffer, structure)
@@ -116,3 +182,58 @@ func writeJson(path string, structure any) error {
 
 	return nil
 }
+
+// Copies a file, replacing the destination if it already exists. The copy is written next to the destination first so
+// the destination is never left half written.
+func copyFile(destination string, source string) error {
+	in, err := openFile(source)
+	if err != nil {
+		return errors.Join(errors.New("failed to open "+source), err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	temporary := destination + ".part"
+	out, err := createFile(temporary)
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+temporary), err)
+	}
+
+	_, err = io.Copy(out, in)
+	_ = out.Close()
+	if err != nil {
+		_ = os.Remove(temporary) // Don't care
+		return errors.Join(errors.New("failed to copy "+source+" to "+destination), err)
+	}
+
+	err = renameFile(temporary, destination)
+	if err != nil {
+		_ = os.Remove(temporary) // Don't care
+		return errors.Join(errors.New("failed to move "+temporary+" into place"), err)
+	}
+	return nil
+}
+
+// Writes a file, replacing it if it already exists. Like copyFile the data is written next to the file first.
+func writeFile(path string, data []byte) error {
+	temporary := path + ".part"
+	out, err := createFile(temporary)
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+temporary), err)
+	}
+
+	_, err = out.Write(data)
+	_ = out.Close()
+	if err != nil {
+		_ = os.Remove(temporary) // Don't care
+		return errors.Join(errors.New("failed to write "+path), err)
+	}
+
+	err = renameFile(temporary, path)
+	if err != nil {
+		_ = os.Remove(temporary) // Don't care
+		return errors.Join(errors.New("failed to move "+temporary+" into place"), err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"os"
+	"os/exec"
 	"strings"
 )
 
@@ -16,7 +17,7 @@ func insanifyPath(path string) string {
 // A wrapper for os.Stat that checks if a file exists, automatically converts paths from Unix to DOS/NT
 func fileExists(path string) bool {
 	_, err := os.Stat(insanifyPath(path))
-	return err != nil
+	return err == nil
 }
 
 // A wrapper for os.Open that opens a file, automatically converts paths from Unix to DOS/NT
@@ -31,7 +32,17 @@ func createFile(name string) (*os.File, error) {
 
 // A wrapper for os.Create that creates a file with specific permissions
 func createFileWithPerms(name string, perms os.FileMode) (*os.File, error) {
-	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perms)
+	return os.OpenFile(insanifyPath(name), os.O_RDWR|os.O_CREATE|os.O_TRUNC, perms)
+}
+
+// A wrapper for os.OpenFile that opens an existing file for appending, automatically converts paths from Unix to DOS/NT
+func appendFile(name string) (*os.File, error) {
+	return os.OpenFile(insanifyPath(name), os.O_WRONLY|os.O_APPEND, 0)
+}
+
+// A wrapper for os.Rename that moves a file, replacing the target if it exists, automatically converts paths from Unix to DOS/NT
+func renameFile(path string, target string) error {
+	return os.Rename(insanifyPath(path), insanifyPath(target))
 }
 
 // A wrapper for os.MkdirAll that creates a bunch of directories, automatically converts paths from Unix to DOS/NT
@@ -39,6 +50,11 @@ func createParents(path string) error {
 	return os.MkdirAll(insanifyPath(path), os.ModePerm)
 }
 
+// A wrapper for os.RemoveAll that deletes a file or directory and everything inside of it, automatically converts paths from Unix to DOS/NT
+func removeAll(path string) error {
+	return os.RemoveAll(insanifyPath(path))
+}
+
 // A wrapper for os.SymLink that creates a symbolic link, automatically converts paths from Unix to DOS/NT
 func createLink(path string, target string) error {
 	return os.Symlink(insanifyPath(target), insanifyPath(path))
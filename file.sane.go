@@ -28,11 +28,26 @@ func createFileWithPerms(name string, perms os.FileMode) (*os.File, error) {
 	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perms)
 }
 
+// A wrapper for os.OpenFile that opens an existing file for appending
+func appendFile(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+}
+
+// A wrapper for os.Rename that moves a file, replacing the target if it exists
+func renameFile(path string, target string) error {
+	return os.Rename(path, target)
+}
+
 // A wrapper for os.MkdirAll that creates a bunch of directories
 func createParents(path string) error {
 	return os.MkdirAll(path, os.ModePerm)
 }
 
+// A wrapper for os.RemoveAll that deletes a file or directory and everything inside of it
+func removeAll(path string) error {
+	return os.RemoveAll(path)
+}
+
 // A wrapper for os.SymLink that creates a symbolic link
 func createLink(path string, target string) error {
 	return os.Symlink(target, path)
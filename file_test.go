@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// Only hashes marked by md5Hash are checked with MD5, a bare hash of 32 characters is not a hash any source should use.
+func TestHashFileMd5(t *testing.T) {
+	path := t.TempDir() + "/file"
+	err := os.WriteFile(path, []byte("launcher"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := hashFile(path, *md5Hash("F3E08B5119358A8F58F17A678759F60C"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !valid {
+		t.Fatal("expected the MD5 hash to match")
+	}
+	valid, err = hashFile(path, *md5Hash("6c6c1c8ce0c6d0e8f5fba8d5f9c6fb1e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid {
+		t.Fatal("expected a wrong MD5 hash to not match")
+	}
+	_, err = hashFile(path, "f3e08b5119358a8f58f17a678759f60c")
+	if err == nil {
+		t.Fatal("expected a bare MD5 hash to be refused")
+	}
+}
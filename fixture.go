@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// A loopback server that answers every request the launcher makes from local files, so the whole pipeline from
+// resolving a version to building the command line can run in tests without reaching Mojang or anyone else.
+//
+// Requests go through the single host rewrite, so "https://piston-meta.mojang.com/mc/game/version_manifest_v2.json" is
+// served from "<dir>/piston-meta.mojang.com/mc/game/version_manifest_v2.json". Queries are ignored. Files have to be
+// the real ones or at least match the hashes the fixture metadata lists for them. testdata/meta-fixture has a small
+// version the tests launch this way.
+type MetaFixture struct {
+	Dir  string
+	Base string
+}
+
+// Starts serving a fixture directory on a random loopback port. The server runs until the launcher exits.
+func serveMetaFixture(dir string) (*MetaFixture, error) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, errors.New("the meta fixture " + dir + " is not a directory")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to start the meta fixture server"), err)
+	}
+
+	files := http.FileServer(http.Dir(dir))
+	go func() {
+		_ = http.Serve(listener, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			path := dir + "/" + strings.TrimPrefix(request.URL.Path, "/")
+			if !fileExists(path) {
+				// Missing fixtures are the usual reason a test fails, say which one
+				_, _ = fmt.Fprintf(os.Stderr, "Meta fixture has no %s\n", request.URL.Path)
+			}
+			files.ServeHTTP(writer, request)
+		}))
+	}()
+	return &MetaFixture{
+		Dir:  dir,
+		Base: "http://" + listener.Addr().String(),
+	}, nil
+}
+
+// Points every request at the fixture server. Mirrors and proxies are left out, nothing may leave the machine.
+func (this *MetaFixture) apply() {
+	config.SingleHost = SingleHostConfig{
+		Base: this.Base,
+	}
+	config.Mirrors = nil
+	config.Network.Proxy = ""
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Lets tests run the launcher as a process of its own, main exits the process when a command fails.
+func TestMain(m *testing.M) {
+	if os.Getenv("LAUNCHER_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Sets up a launcher directory that uses testdata/meta-fixture and a fake java that is only asked for its version.
+// Returns the fixture, the launcher directory and the java home.
+func setupMetaFixture(t *testing.T) (string, string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake java is a shell script")
+	}
+	fixture, err := filepath.Abs("testdata/meta-fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := t.TempDir()
+	java := t.TempDir()
+
+	err = os.Mkdir(java+"/bin", 0755)
+	if err == nil {
+		err = os.WriteFile(java+"/bin/java", []byte("#!/bin/sh\necho 'openjdk version \"17.0.9\" 2023-10-17' >&2\n"), 0755)
+	}
+	if err == nil {
+		err = os.Mkdir(base+"/tmp", 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(base+"/config.json", []byte(`{
+  "runtimeProviders": ["system"],
+  "jvm": {"maxHeap": "1G"},
+  "instances": [{"name": "fixture", "version": "fixture-1.0"}]
+}`), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fixture, base, java
+}
+
+// Prints the command line of the fixture instance, the command line is printed instead of run.
+func printFixtureCommand(t *testing.T, fixture string, base string, java string) []byte {
+	command := exec.Command(os.Args[0], "--meta-fixture", fixture, "launch", "fixture", "--print-command", "--normalize-paths")
+	command.Dir = base
+	command.Env = append(os.Environ(), "LAUNCHER_TEST_MAIN=1", "JAVA_HOME="+java, "TMPDIR="+base+"/tmp")
+	output, err := command.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s", err, output)
+	}
+	return output
+}
+
+// Resolves, downloads and builds the command line of a version served from testdata/meta-fixture, the whole pipeline
+// of a launch without reaching Mojang.
+func TestLaunchMetaFixture(t *testing.T) {
+	fixture, base, java := setupMetaFixture(t)
+	output := printFixtureCommand(t, fixture, base, java)
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	start := slices.Index(lines, "${java_home}/bin/java")
+	if start < 0 {
+		t.Fatalf("no command line in the output:\n%s", output)
+	}
+	expected := []string{
+		"${java_home}/bin/java",
+		"-Djava.library.path=${base_directory}/tmp/go-launcher-natives-*",
+		"-cp",
+		"${base_directory}/client/fixture-1.0.jar:${library_directory}/org/example/fixture/1.0/fixture-1.0.jar",
+		"-Xmx1G",
+		"net.minecraft.client.main.Main",
+		"--username",
+		"todo_name",
+		"--version",
+		"fixture-1.0",
+		"--gameDir",
+		"${game_directory}",
+		"--assetsDir",
+		"${assets_root}",
+		"--assetIndex",
+		"fixture",
+		"--uuid",
+		"00000000-0000-0000-0000-000000000000",
+		"--accessToken",
+		"0",
+		"--versionType",
+		"release",
+	}
+	if !slices.Equal(lines[start:], expected) {
+		t.Fatalf("expected the command line\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lines[start:], "\n"))
+	}
+
+	downloaded := []string{
+		"versions/fixture-1.0.json",
+		"client/fixture-1.0.jar",
+		"library/org/example/fixture/1.0/fixture-1.0.jar",
+		"assets/indexes/fixture.json",
+		"assets/objects/02/02220dc532dff75d85f4089f0f0f5ede71ccf797",
+	}
+	for i := range downloaded {
+		if !fileExists(base + "/" + downloaded[i]) {
+			t.Errorf("expected %s to be downloaded into the store", downloaded[i])
+		}
+	}
+}
+
+// Reads every file and directory below a directory, directories have no contents.
+func snapshotTree(t *testing.T, root string) map[string]string {
+	tree := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			tree[path] = ""
+			return err
+		}
+		data, err := os.ReadFile(path)
+		tree[path] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// Printing the command line must not write to the instance, not even to the template of a locked one.
+func TestPrintCommandLeavesInstanceAlone(t *testing.T) {
+	fixture, base, java := setupMetaFixture(t)
+	instance := &Instance{
+		Name:          "fixture",
+		Version:       "fixture-1.0",
+		Language:      "de",
+		HeapDumps:     true,
+		SnapshotSaves: true,
+		Locked:        true,
+	}
+	err := saveInstance(base, instance)
+	if err == nil {
+		err = os.MkdirAll(instance.gameDir(base)+"/saves/world", 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(instance.gameDir(base)+"/options.txt", []byte("lang:en_us\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := snapshotTree(t, instanceDir(base, instance.Name))
+	printFixtureCommand(t, fixture, base, java)
+	after := snapshotTree(t, instanceDir(base, instance.Name))
+	if !maps.Equal(before, after) {
+		t.Fatalf("the instance changed from\n%v\nto\n%v", before, after)
+	}
+}
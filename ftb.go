@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	FTB_API        string = "https://api.modpacks.ch/public"
+	CURSEFORGE_API string = "https://api.curseforge.com/v1"
+	// Where CurseForge serves files from, the API is only needed for the link when no key is configured.
+	CURSEFORGE_CDN string = "https://edge.forgecdn.net/files"
+)
+
+// A pack of Feed The Beast with its versions, the oldest first.
+type FtbPack struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	Versions []struct {
+		Id      int    `json:"id"`
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Updated int64  `json:"updated"`
+	} `json:"versions"`
+}
+
+// A version of a pack of Feed The Beast, the targets name the game and the mod loader it runs on.
+type FtbVersion struct {
+	Id      int       `json:"id"`
+	Name    string    `json:"name"`
+	Status  string    `json:"status"`
+	Message string    `json:"message"`
+	Files   []FtbFile `json:"files"`
+	Targets []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Type    string `json:"type"`
+	} `json:"targets"`
+}
+
+// A file of a version of an FTB pack. Files that are hosted by CurseForge have no URL, only a reference to the project
+// and file on CurseForge.
+type FtbFile struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	Url        string `json:"url"`
+	Sha1       string `json:"sha1"`
+	Size       uint64 `json:"size"`
+	ClientOnly bool   `json:"clientonly"`
+	ServerOnly bool   `json:"serveronly"`
+	Optional   bool   `json:"optional"`
+	CurseForge *struct {
+		Project int `json:"project"`
+		File    int `json:"file"`
+	} `json:"curseforge"`
+}
+
+// Returns the URL of a file of an FTB pack, asking CurseForge for the ones it hosts. The API of CurseForge is only used
+// when a key for it is configured in network.headers, the others are downloaded from the CDN of CurseForge directly.
+func (this *FtbFile) downloadUrl() (string, error) {
+	if this.Url != "" {
+		return this.Url, nil
+	}
+	if this.CurseForge == nil {
+		return "", errors.New(this.Name + " has no URL")
+	}
+
+	project := this.CurseForge.Project
+	file := this.CurseForge.File
+	if len(config.Network.Headers["api.curseforge.com"]) > 0 {
+		var response struct {
+			Data *string `json:"data"`
+		}
+		err := downloadJsonRaw(fmt.Sprintf("%s/mods/%d/files/%d/download-url", CURSEFORGE_API, project, file), nil, &response)
+		if err != nil {
+			return "", errors.Join(errors.New(fmt.Sprintf("failed to look up file %d of CurseForge project %d", file, project)), err)
+		}
+		if response.Data != nil && *response.Data != "" {
+			return *response.Data, nil
+		}
+	}
+	return fmt.Sprintf("%s/%d/%d/%s", CURSEFORGE_CDN, file/1000, file%1000, this.Name), nil
+}
+
+// Picks the version of a pack to install, the newest release unless one is named by its id or name.
+func (this *FtbPack) selectVersion(selected string) (int, error) {
+	if selected != "" {
+		for i := range this.Versions {
+			version := &this.Versions[i]
+			if strconv.Itoa(version.Id) == selected || version.Name == selected {
+				return version.Id, nil
+			}
+		}
+		return 0, errors.New(this.Name + " has no version " + selected)
+	}
+
+	newest := -1
+	for i := range this.Versions {
+		version := &this.Versions[i]
+		if version.Type != "release" && version.Type != "Release" {
+			continue
+		}
+		if newest == -1 || version.Updated > this.Versions[newest].Updated {
+			newest = i
+		}
+	}
+	if newest == -1 {
+		if len(this.Versions) == 0 {
+			return 0, errors.New(this.Name + " has no versions")
+		}
+		newest = len(this.Versions) - 1
+	}
+	return this.Versions[newest].Id, nil
+}
+
+// Creates an instance from a version of a pack of Feed The Beast, the newest release when none is selected.
+func installFtbPack(base string, id int, selected string, name string) error {
+	var pack FtbPack
+	err := downloadJsonRaw(fmt.Sprintf("%s/modpack/%d", FTB_API, id), nil, &pack)
+	if err != nil {
+		return errors.Join(errors.New(fmt.Sprintf("failed to look up FTB pack %d", id)), err)
+	}
+	if pack.Status == "error" {
+		return errors.New(fmt.Sprintf("failed to look up FTB pack %d: %s", id, pack.Message))
+	}
+	versionId, err := pack.selectVersion(selected)
+	if err != nil {
+		return err
+	}
+
+	var version FtbVersion
+	err = downloadJsonRaw(fmt.Sprintf("%s/modpack/%d/%d", FTB_API, id, versionId), nil, &version)
+	if err != nil {
+		return errors.Join(errors.New(fmt.Sprintf("failed to look up version %d of %s", versionId, pack.Name)), err)
+	}
+	if version.Status == "error" {
+		return errors.New(fmt.Sprintf("failed to look up version %d of %s: %s", versionId, pack.Name, version.Message))
+	}
+
+	if name == "" {
+		name = sanitizeInstanceName(pack.Name)
+	}
+	err = validateInstanceName(name)
+	if err != nil {
+		return err
+	}
+	if fileExists(instanceDir(base, name) + "/instance.json") {
+		return errors.New("instance " + name + " already exists")
+	}
+
+	instance := &Instance{
+		Name:       name,
+		PackSource: fmt.Sprintf("ftb:%d/%d", id, versionId),
+	}
+	for i := range version.Targets {
+		target := &version.Targets[i]
+		switch target.Type {
+		case "game":
+			{
+				instance.Version = target.Version
+			}
+		case "modloader":
+			{
+				instance.Loader = foreignLoader(target.Name, target.Version)
+			}
+		}
+	}
+	if instance.Version == "" {
+		return errors.New("the pack does not say which version of the game it needs")
+	}
+	gameDir := instance.gameDir(base)
+
+	provenance.setPack(pack.Name + " " + version.Name)
+	defer provenance.setPack("")
+	optional := 0
+	batch := downloadPool.batch("Pack")
+	for i := range version.Files {
+		file := &version.Files[i]
+		if file.ServerOnly {
+			continue
+		}
+		if file.Optional {
+			optional++
+			continue
+		}
+		target, err := resolvePackPath(gameDir, file.Path+"/"+file.Name)
+		if err != nil {
+			_ = batch.wait()
+			return err
+		}
+		batch.submit(func() error {
+			source, err := file.downloadUrl()
+			if err != nil {
+				return err
+			}
+			var hash *string
+			if file.Sha1 != "" {
+				hash = &file.Sha1
+			}
+			return downloadFileRaw(target, source, hash, file.Size, batch.progress)
+		})
+	}
+	err = batch.wait()
+	if err != nil {
+		return errors.Join(errors.New("failed to download the files of "+pack.Name), err)
+	}
+
+	err = commitInstance(base, instance)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s %s as instance %s (%s)\n", pack.Name, version.Name, name, instance.Version)
+	warnLoaderNotInstalled(instance)
+	if optional > 0 {
+		fmt.Printf("Skipped %d optional files\n", optional)
+	}
+	return nil
+}
+
+func packFtbCommand(base string, args []string) error {
+	set := flag.NewFlagSet("pack ftb", flag.ContinueOnError)
+	name := set.String("name", "", "the name of the new instance, defaults to the name of the pack")
+	version := set.String("version", "", "the id or name of the version of the pack, defaults to the newest release")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one pack id")
+	}
+	id, err := strconv.Atoi(positional[0])
+	if err != nil {
+		return errors.New("the id of an FTB pack is a number, it is shown on the page of the pack")
+	}
+	return installFtbPack(base, id, *version, *name)
+}
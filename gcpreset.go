@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// G1 tuned for short pauses and a large young generation, the flags Aikar recommends for servers.
+	GC_PRESET_AIKAR string = "aikar"
+	// ZGC, generational where the JVM has it, for large heaps that should never pause for long.
+	GC_PRESET_ZGC string = "zgc"
+	// Shenandoah, concurrent like ZGC but lighter on small heaps.
+	GC_PRESET_SHENANDOAH string = "shenandoah"
+	// The G1 flags the official launcher uses.
+	GC_PRESET_CLIENT_DEFAULT string = "client-default"
+)
+
+var gcPresets = []string{
+	GC_PRESET_AIKAR,
+	GC_PRESET_ZGC,
+	GC_PRESET_SHENANDOAH,
+	GC_PRESET_CLIENT_DEFAULT,
+}
+
+// Checks the name of a GC preset.
+func validateGcPreset(preset string) error {
+	if preset != "" && !slices.Contains(gcPresets, preset) {
+		return errors.New("unknown GC preset " + preset + ", expected one of " + strings.Join(gcPresets, ", "))
+	}
+	return nil
+}
+
+// Returns the JVM arguments of a GC preset for a major version of Java. Collectors that are experimental in that
+// version are unlocked, and the ones it does not have at all are an error instead of a JVM that does not start.
+func gcPresetArguments(preset string, javaMajor uint32) ([]string, error) {
+	switch preset {
+	case "":
+		{
+			return nil, nil
+		}
+	case GC_PRESET_AIKAR:
+		{
+			return []string{
+				"-XX:+UseG1GC",
+				"-XX:+ParallelRefProcEnabled",
+				"-XX:MaxGCPauseMillis=200",
+				"-XX:+UnlockExperimentalVMOptions",
+				"-XX:+DisableExplicitGC",
+				"-XX:+AlwaysPreTouch",
+				"-XX:G1NewSizePercent=30",
+				"-XX:G1MaxNewSizePercent=40",
+				"-XX:G1HeapRegionSize=8M",
+				"-XX:G1ReservePercent=20",
+				"-XX:G1HeapWastePercent=5",
+				"-XX:G1MixedGCCountTarget=4",
+				"-XX:InitiatingHeapOccupancyPercent=15",
+				"-XX:G1MixedGCLiveThresholdPercent=90",
+				"-XX:SurvivorRatio=32",
+				"-XX:+PerfDisableSharedMem",
+				"-XX:MaxTenuringThreshold=1",
+			}, nil
+		}
+	case GC_PRESET_ZGC:
+		{
+			if javaMajor < 11 {
+				return nil, errors.New(fmt.Sprintf("the %s GC preset needs Java 11 or newer, the version uses Java %d", preset, javaMajor))
+			}
+			var arguments []string
+			if javaMajor < 15 {
+				arguments = append(arguments, "-XX:+UnlockExperimentalVMOptions")
+			}
+			arguments = append(arguments, "-XX:+UseZGC")
+			// Generational ZGC is the default from Java 23 on
+			if javaMajor == 21 || javaMajor == 22 {
+				arguments = append(arguments, "-XX:+ZGenerational")
+			}
+			return append(arguments, "-XX:+AlwaysPreTouch", "-XX:+DisableExplicitGC"), nil
+		}
+	case GC_PRESET_SHENANDOAH:
+		{
+			if javaMajor < 11 {
+				return nil, errors.New(fmt.Sprintf("the %s GC preset needs Java 11 or newer, the version uses Java %d", preset, javaMajor))
+			}
+			var arguments []string
+			if javaMajor < 15 {
+				arguments = append(arguments, "-XX:+UnlockExperimentalVMOptions")
+			}
+			return append(arguments, "-XX:+UseShenandoahGC", "-XX:+AlwaysPreTouch", "-XX:+DisableExplicitGC"), nil
+		}
+	case GC_PRESET_CLIENT_DEFAULT:
+		{
+			return []string{
+				"-XX:+UnlockExperimentalVMOptions",
+				"-XX:+UseG1GC",
+				"-XX:G1NewSizePercent=20",
+				"-XX:G1ReservePercent=20",
+				"-XX:MaxGCPauseMillis=50",
+				"-XX:G1HeapRegionSize=32M",
+			}, nil
+		}
+	default:
+		{
+			return nil, validateGcPreset(preset)
+		}
+	}
+}
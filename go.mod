@@ -1,3 +1,5 @@
 module launcher
 
 go 1.21
+
+require github.com/tetratelabs/wazero v1.8.2
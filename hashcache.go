@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A hash that was verified for a file while it had a specific size and modification time.
+type HashCacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Hash    string `json:"hash"`
+}
+
+// Remembers which files were already verified so unchanged files don't have to be hashed on every launch. A file
+// counts as unchanged while its size and modification time stay the same, stored in hashes.json in the base
+// directory.
+type HashCache struct {
+	lock    sync.Mutex
+	path    string
+	base    string
+	entries map[string]HashCacheEntry
+	dirty   bool
+	// Why the cache could not be read when it was loaded, nil if it could.
+	corruption error
+	// Ignores the cache when looking up hashes so every file is hashed again, the results are still remembered.
+	fullVerify bool
+}
+
+var hashCache = &HashCache{
+	entries: map[string]HashCacheEntry{},
+}
+
+// Loads the hash cache of a base directory, a missing or broken cache is started over. Entries that can not be right
+// are dropped right away, the files they belong to are hashed again when they are needed.
+func loadHashCache(base string) {
+	hashCache.lock.Lock()
+	defer hashCache.lock.Unlock()
+
+	hashCache.path = base + "/hashes.json"
+	hashCache.base = base
+	hashCache.entries = map[string]HashCacheEntry{}
+	hashCache.corruption = nil
+	if !fileExists(hashCache.path) {
+		return
+	}
+
+	err := readJson(hashCache.path, &hashCache.entries)
+	if err != nil {
+		// A broken cache only costs time, everything is hashed again
+		fmt.Printf("Warning: the hash cache is corrupt, every file will be hashed again\n")
+		hashCache.corruption = err
+		hashCache.entries = map[string]HashCacheEntry{}
+		hashCache.dirty = true
+		return
+	}
+	if hashCache.entries == nil {
+		hashCache.entries = map[string]HashCacheEntry{}
+	}
+
+	for path := range hashCache.entries {
+		if !validCacheEntry(hashCache.entries[path]) {
+			delete(hashCache.entries, path)
+			hashCache.dirty = true
+		}
+	}
+}
+
+// Checks that an entry could have been written by remember, with a hash hashFile knows and a size that makes sense.
+func validCacheEntry(entry HashCacheEntry) bool {
+	if len(entry.Hash) != 40 && len(entry.Hash) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(entry.Hash)
+	return err == nil && entry.Hash == strings.ToLower(entry.Hash) && entry.Size >= 0
+}
+
+// Checks if a file is known to have a hash and was not changed since.
+func (this *HashCache) lookup(path string, hash string) bool {
+	if this.fullVerify {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	this.lock.Lock()
+	entry, ok := this.entries[path]
+	this.lock.Unlock()
+	return ok && entry.Hash == hash && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano()
+}
+
+// Returns the hash a file is known to have if it was not changed since it was verified, an empty string otherwise.
+func (this *HashCache) hashOf(path string) string {
+	if this.fullVerify {
+		return ""
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	this.lock.Lock()
+	entry, ok := this.entries[path]
+	this.lock.Unlock()
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return ""
+	}
+	return entry.Hash
+}
+
+// Records that a file was just verified to have a hash.
+func (this *HashCache) remember(path string, hash string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.entries[path] = HashCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Hash:    hash,
+	}
+	this.dirty = true
+}
+
+// Drops what is known about a file.
+func (this *HashCache) forget(path string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	_, ok := this.entries[path]
+	if ok {
+		delete(this.entries, path)
+		this.dirty = true
+	}
+}
+
+// What checking the hash cache found, every entry counted here was dropped.
+type HashCacheReport struct {
+	Checked int
+	// Entries of files that no longer exist.
+	Missing int
+	// Entries of files that were changed since they were hashed.
+	Changed int
+	// Entries of files that were hashed again and did not have the remembered hash.
+	Mismatched int
+}
+
+// Checks every entry of the cache against the file it belongs to, dropping the ones of missing and changed files. Up
+// to sample of the remaining entries, chosen at random, are hashed again to catch a cache that lies. The files of
+// dropped entries are hashed again the next time they are needed, so the cache rebuilds itself as it is used.
+func (this *HashCache) check(store StoreBackend, sample int) (*HashCacheReport, error) {
+	this.lock.Lock()
+	paths := make([]string, 0, len(this.entries))
+	for path := range this.entries {
+		paths = append(paths, path)
+	}
+	this.lock.Unlock()
+
+	report := &HashCacheReport{}
+	var intact []string
+	for i := range paths {
+		err := checkInterrupted()
+		if err != nil {
+			return nil, err
+		}
+
+		this.lock.Lock()
+		entry, ok := this.entries[paths[i]]
+		this.lock.Unlock()
+		if !ok {
+			continue
+		}
+
+		report.Checked++
+		file, err := this.statEntry(store, paths[i])
+		switch {
+		case err != nil:
+			{
+				report.Missing++
+				this.forget(paths[i])
+			}
+		case file.Size != entry.Size || file.ModTime.UnixNano() != entry.ModTime:
+			{
+				report.Changed++
+				this.forget(paths[i])
+			}
+		default:
+			{
+				intact = append(intact, paths[i])
+			}
+		}
+	}
+
+	rand.Shuffle(len(intact), func(a int, b int) {
+		intact[a], intact[b] = intact[b], intact[a]
+	})
+	for i := 0; i < sample && i < len(intact); i++ {
+		err := checkInterrupted()
+		if err != nil {
+			return nil, err
+		}
+
+		this.lock.Lock()
+		entry := this.entries[intact[i]]
+		this.lock.Unlock()
+
+		result, err := this.hashEntry(store, intact[i], entry.Hash)
+		if err != nil || !result {
+			report.Mismatched++
+			this.forget(intact[i])
+		}
+	}
+	return report, nil
+}
+
+// Returns the path of a file of the cache inside of the store, files outside of it are only on disk.
+func (this *HashCache) storePath(path string) (string, bool) {
+	relative, ok := strings.CutPrefix(path, this.base+"/")
+	if !ok || this.base == "" {
+		return "", false
+	}
+	for i := range storeDirs {
+		if strings.HasPrefix(relative, storeDirs[i]+"/") {
+			return relative, true
+		}
+	}
+	return "", false
+}
+
+// Looks up the size and modification time of a file of the cache, through the store when it is part of it.
+func (this *HashCache) statEntry(store StoreBackend, path string) (StoreFile, error) {
+	relative, ok := this.storePath(path)
+	if ok {
+		return store.stat(relative)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return StoreFile{}, err
+	}
+	return StoreFile{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// Hashes a file of the cache, through the store when it is part of it.
+func (this *HashCache) hashEntry(store StoreBackend, path string, hash string) (bool, error) {
+	relative, ok := this.storePath(path)
+	if !ok {
+		return hashFile(path, hash)
+	}
+	reader, err := store.open(relative)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	return hashReader(reader, hash)
+}
+
+// Writes the cache if anything changed since it was loaded.
+func (this *HashCache) save() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if !this.dirty || this.path == "" {
+		return nil
+	}
+
+	err := writeJson(this.path, this.entries)
+	if err != nil {
+		return errors.Join(errors.New("failed to save hash cache"), err)
+	}
+	this.dirty = false
+	return nil
+}
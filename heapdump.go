@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Returns the directory the JVM writes heap dumps of an instance to.
+func heapDumpDir(base string, instance *Instance) string {
+	return instanceDir(base, instance.Name) + "/heapdumps"
+}
+
+// Returns the arguments that make the JVM write a heap dump when it runs out of memory, if the instance wants that.
+func heapDumpArguments(base string, instance *Instance) []string {
+	if !instance.HeapDumps {
+		return nil
+	}
+	return []string{
+		"-XX:+HeapDumpOnOutOfMemoryError",
+		"-XX:HeapDumpPath=" + heapDumpDir(base, instance),
+	}
+}
+
+// Lists the heap dumps of an instance, newest first.
+func listHeapDumps(base string, instance *Instance) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(heapDumpDir(base, instance))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var dumps []os.FileInfo
+	for i := range entries {
+		if !strings.HasSuffix(entries[i].Name(), ".hprof") {
+			continue
+		}
+		info, err := entries[i].Info()
+		if err != nil {
+			return nil, err
+		}
+		dumps = append(dumps, info)
+	}
+
+	sort.Slice(dumps, func(a int, b int) bool {
+		return dumps[a].ModTime().After(dumps[b].ModTime())
+	})
+	return dumps, nil
+}
+
+// Deletes the oldest heap dumps of an instance until they fit in the configured limit. The newest dump is always kept,
+// even when it is larger than the limit on its own.
+func pruneHeapDumps(base string, instance *Instance) error {
+	dumps, err := listHeapDumps(base, instance)
+	if err != nil {
+		return errors.Join(errors.New("failed to list heap dumps"), err)
+	}
+
+	var total uint64
+	for i := range dumps {
+		total += uint64(dumps[i].Size())
+		if i == 0 || total <= config.HeapDumpLimit {
+			continue
+		}
+
+		path := heapDumpDir(base, instance) + "/" + dumps[i].Name()
+		err = os.Remove(path)
+		if err != nil {
+			return errors.Join(errors.New("failed to delete heap dump "+path), err)
+		}
+		total -= uint64(dumps[i].Size())
+	}
+	return nil
+}
+
+// Returns the path of the newest heap dump of an instance, or an empty string if there is none.
+func newestHeapDump(base string, instance *Instance) string {
+	dumps, err := listHeapDumps(base, instance)
+	if err != nil || len(dumps) == 0 {
+		return ""
+	}
+	return heapDumpDir(base, instance) + "/" + dumps[0].Name()
+}
@@ -5,27 +5,47 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// Downloads of at least this many bytes are resumed instead of restarted after an interruption.
+//
+//goland:noinspection GoSnakeCaseUsage
+const RESUME_THRESHOLD uint64 = 4 * 1024 * 1024
+
 type Downloadable interface {
 	url() string
 	hash() *string
+	// The expected size in bytes, 0 when it is unknown.
+	size() uint64
 }
 
 // Downloads a file and optionally validates its hash. If the parent of the path does not exist it will be created. If
 // the hash does not match the file will be deleted.
-func downloadFile(path string, downloadable Downloadable) error {
-	return downloadFileRaw(path, downloadable.url(), downloadable.hash())
+func downloadFile(path string, downloadable Downloadable, progress *Progress) error {
+	return downloadFileRaw(path, downloadable.url(), downloadable.hash(), downloadable.size(), progress)
 }
 
 // Downloads a file and optionally validates its hash. If the parent of the path does not exist it will be created. If
-// the hash does not match the file will be deleted.
-func downloadFileRaw(path string, url string, hash *string) error {
-	var err error
+// the hash does not match the file will be deleted. When the size is known existing files of a different size are
+// deleted without hashing them, and when the server announces or sends a different size the download fails. A server
+// announcing the wrong size is flagged as suspect before anything is written. What is downloaded is counted in the
+// progress of the batch the download belongs to, downloads outside of a batch pass nil.
+func downloadFileRaw(path string, url string, hash *string, size uint64, progress *Progress) error {
+	err := checkInterrupted()
+	if err != nil {
+		return err
+	}
+	recordArtifact(path, url, hash, size)
+	_, err = validateSize(path, size)
+	if err != nil {
+		return err
+	}
 	if hash != nil {
 		valid, err := validateHash(path, *hash)
 		if err != nil {
@@ -41,29 +61,111 @@ func downloadFileRaw(path string, url string, hash *string) error {
 		return errors.Join(errors.New("failed to create parents of "+path), err)
 	}
 
-	file, err := createFile(path)
-	if err != nil {
-		return errors.Join(errors.New("failed to create file "+path), err)
+	if hash != nil {
+		override := findOverride("", *hash)
+		if override != "" {
+			err = copyFile(path, override)
+			if err != nil {
+				return errors.Join(errors.New("failed to copy override of "+path), err)
+			}
+			provenance.record(path, url, "override "+override, hash)
+			return nil
+		}
+	}
+
+	if hash == nil && isSuspect(url) {
+		return errors.New("refusing to download " + url + " without a hash from a suspect server")
 	}
 
-	response, err := http.Get(url)
+	return withMirrors(url, func(source string) error {
+		err := retry(source, func() error {
+			return transferFile(path, source, hash, size, progress)
+		})
+		if err == nil {
+			provenance.record(path, url, source, hash)
+		}
+		return err
+	})
+}
+
+// A single attempt at downloading a file for downloadFileRaw. Files are downloaded into a .part file that is only moved
+// to the path once its hash matches, so the path never holds a truncated or corrupted file. The .part files of at least
+// RESUME_THRESHOLD bytes are kept when the download fails, the next attempt or run resumes them with a range request.
+func transferFile(path string, url string, hash *string, size uint64, progress *Progress) error {
+	resumable := size >= RESUME_THRESHOLD
+	target := path + ".part"
+	var offset int64
+	if resumable {
+		info, err := os.Stat(target)
+		if err == nil {
+			if uint64(info.Size()) < size {
+				offset = info.Size()
+			} else {
+				_ = os.Remove(target)
+			}
+		}
+	}
+
+	response, err := httpGetFrom(url, offset)
+	var status *StatusError
+	if offset > 0 && errors.As(err, &status) && status.Code == http.StatusRequestedRangeNotSatisfiable {
+		_ = os.Remove(target)
+		return errors.New("the server can not resume " + url + ", starting over")
+	}
 	if err != nil {
-		return errors.Join(errors.New("failed to download "+url), err)
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if offset > 0 && (response.StatusCode != http.StatusPartialContent ||
+		!strings.HasPrefix(response.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset))) {
+		// The server ignored the range, it is sending everything
+		offset = 0
 	}
-	if response.StatusCode/100 != 2 {
-		return errors.New("failed to download " + url + ": " + response.Status)
+
+	expected := size - uint64(offset)
+	if size != 0 && response.ContentLength >= 0 && uint64(response.ContentLength) != expected {
+		flagSuspect(url, fmt.Sprintf("announced %d bytes for %s, expected %d", response.ContentLength, path, expected))
+		return &PermanentError{
+			Err: errors.New(fmt.Sprintf("expected %d bytes but the server announced %d", expected, response.ContentLength)),
+		}
 	}
 
-	_, err = io.Copy(file, response.Body)
+	var file *os.File
+	if offset > 0 {
+		file, err = appendFile(target)
+	} else {
+		file, err = createFile(target)
+	}
 	if err != nil {
-		_ = os.Remove(path) // Don't care
-		return errors.Join(errors.New("failed to download "+url), err)
+		return &PermanentError{
+			Err: errors.Join(errors.New("failed to create file "+target), err),
+		}
 	}
 
+	written, err := copyBuffered(file, &progressReader{
+		reader:   response.Body,
+		progress: progress,
+	})
 	_ = file.Close()
+	if err != nil {
+		if !resumable {
+			_ = os.Remove(target) // Don't care
+		}
+		return err
+	}
+
+	received := uint64(offset + written)
+	if size != 0 && received != size {
+		_ = os.Remove(target) // Don't care
+		return errors.New(fmt.Sprintf("expected %d bytes for %s but received %d", size, path, received))
+	}
 
 	if hash != nil {
-		valid, err := validateHash(path, *hash)
+		// Deletes the .part file when it does not match
+		valid, err := validateHash(target, *hash)
 		if err != nil {
 			return errors.Join(errors.New("could not validate hash of "+path), err)
 		}
@@ -71,6 +173,18 @@ func downloadFileRaw(path string, url string, hash *string) error {
 			return errors.New("download " + path + " failed to download")
 		}
 	}
+
+	err = renameFile(target, path)
+	if err != nil {
+		return &PermanentError{
+			Err: errors.Join(errors.New("failed to move "+target+" into place"), err),
+		}
+	}
+	if hash != nil {
+		hashCache.forget(target)
+		hashCache.remember(path, *hash)
+	}
+	progress.countFile()
 	return nil
 }
 
@@ -83,32 +197,72 @@ func downloadJson(downloadable Downloadable, structure any) error {
 // Downloads a JSON file, optionally validates its hash and then deserializes it. If the hashes don't match the
 // structure is not touched.
 func downloadJsonRaw(url string, hash *string, structure any) error {
-	response, err := http.Get(url)
+	var buffer []byte
+	err := withMirrors(url, func(url string) error {
+		return retry(url, func() error {
+			return transferJson(url, hash, &buffer)
+		})
+	})
 	if err != nil {
-		return errors.Join(errors.New("failed to download "+url), err)
+		return err
 	}
-	if response.StatusCode/100 != 2 {
-		return errors.New("failed to download " + url + ": " + response.Status)
+
+	err = json.Unmarshal(buffer, structure)
+	if err != nil {
+		return errors.Join(errors.New("Failed to parse JSON of "+url), err)
+	}
+
+	return nil
+}
+
+// Downloads a small file into memory, failing when it is larger than the limit.
+func downloadBytes(url string, limit int64) ([]byte, error) {
+	var buffer []byte
+	err := retry(url, func() error {
+		response, err := httpGet(url)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = response.Body.Close()
+		}()
+
+		buffer, err = io.ReadAll(io.LimitReader(response.Body, limit+1))
+		if err != nil {
+			return errors.Join(errors.New("failed to copy "+url+" into a buffer"), err)
+		}
+		if int64(len(buffer)) > limit {
+			return &PermanentError{
+				Err: errors.New(url + " is larger than expected"),
+			}
+		}
+		return nil
+	})
+	return buffer, err
+}
+
+// A single attempt at downloading a JSON file for downloadJsonRaw.
+func transferJson(url string, hash *string, buffer *[]byte) error {
+	response, err := httpGet(url)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
 
-	buffer, err := io.ReadAll(response.Body)
+	*buffer, err = io.ReadAll(response.Body)
 	if err != nil {
 		return errors.Join(errors.New("failed to copy "+url+" into a buffer"), err)
 	}
 
 	if hash != nil {
 		digest := sha1.New()
-		digest.Write(buffer)
+		digest.Write(*buffer)
 		calculated := hex.EncodeToString(digest.Sum(nil))
 		if calculated != *hash {
 			return errors.New("failed to verify hash of " + url + ", got " + calculated + " and expected " + *hash)
 		}
 	}
-
-	err = json.Unmarshal(buffer, structure)
-	if err != nil {
-		return errors.Join(errors.New("Failed to parse JSON of "+url), err)
-	}
-
 	return nil
 }
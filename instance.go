@@ -0,0 +1,640 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	VERSION_LATEST_RELEASE  string = "latest-release"
+	VERSION_LATEST_SNAPSHOT string = "latest-snapshot"
+
+	SHARE_LINK_SCHEME string = "go-launcher"
+	SHARE_LINK_KIND   string = "instance"
+)
+
+type InstanceLoader struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// The launcher does not install mod loaders, the loader of an instance is only recorded. Tells the user the game of the
+// instance starts without its mods.
+func warnLoaderNotInstalled(instance *Instance) {
+	if instance.Loader == nil || instance.Loader.Name == "" {
+		return
+	}
+	fmt.Printf("Warning: mod loaders are not installed by the launcher, %s %s is not loaded and the game starts without mods\n", instance.Loader.Name, instance.Loader.Version)
+}
+
+// A single installation of the game with its own game directory. The version may be one of the special
+// VERSION_LATEST_RELEASE and VERSION_LATEST_SNAPSHOT values to track the newest version.
+type Instance struct {
+	Name       string          `json:"name"`
+	Version    string          `json:"version"`
+	Loader     *InstanceLoader `json:"loader,omitempty"`
+	PackSource string          `json:"packSource,omitempty"`
+	// Overrides the directory the game is run in, used for profiles imported from the official launcher.
+	GameDir string `json:"gameDir,omitempty"`
+	// The locale and time zone the game runs with, the ones of the system are used when empty.
+	Language string `json:"language,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	// Makes the JVM write a heap dump to the instance directory when the game runs out of memory.
+	HeapDumps bool `json:"heapDumps,omitempty"`
+	// Keeps the worlds of every snapshot in a directory of their own, away from the worlds of releases.
+	SnapshotSaves bool `json:"snapshotSaves,omitempty"`
+	// The title of the game window, ${instance} and ${version} are replaced. Only versions and mods that know the
+	// --title argument use it, the others ignore it.
+	Title string `json:"title,omitempty"`
+	// Always passes the classpath in a pathing jar instead of only when the command line gets too long.
+	PathingJar bool `json:"pathingJar,omitempty"`
+	// Turns the game directory into a template the game never writes to, every launch runs in a copy of it instead.
+	// The session policy decides if the copy is kept, see SESSION_DISCARD and SESSION_PERSIST. Copies are discarded when
+	// it is empty.
+	Locked        bool   `json:"locked,omitempty"`
+	SessionPolicy string `json:"sessionPolicy,omitempty"`
+	// Runs the dedicated server of the version instead of the game.
+	Server bool `json:"server,omitempty"`
+	// A server instance that has to be running on this machine before the game starts, it is started when it is not and
+	// the game joins it. The shutdown policy decides what happens to a server that was started once the game exits, see
+	// SERVER_SHUTDOWN_STOP and SERVER_SHUTDOWN_KEEP. Servers are stopped when it is empty.
+	Requires       string `json:"requires,omitempty"`
+	ServerShutdown string `json:"serverShutdown,omitempty"`
+	// How much the worlds, logs, screenshots, crash reports and heap dumps of the instance may use before launching
+	// warns about it and offers to clean up, see checkDiskBudget.
+	DiskBudget ByteSize `json:"diskBudget,omitempty"`
+	// The largest and initial heap of the JVM and extra arguments for it, see userJvmArguments for how they combine with
+	// the ones of the config.
+	MaxHeap string   `json:"maxHeap,omitempty"`
+	MinHeap string   `json:"minHeap,omitempty"`
+	JvmArgs []string `json:"jvmArgs,omitempty"`
+	// The GC preset the JVM is tuned with, see gcPresetArguments. The one of the config is used when it is empty.
+	GcPreset string `json:"gcPreset,omitempty"`
+	// The instance whose mods and config this one runs with, set by "instance merge --link". Every launch runs in a
+	// session with a copy of them, see prepareSharedSession.
+	SharesWith string `json:"sharesWith,omitempty"`
+	// A command java is run through, like "gamemoderun" or "nice -n 10", see instanceWrapper.
+	Wrapper []string `json:"wrapper,omitempty"`
+	// Variables set in the environment of the game, like "__GL_THREADED_OPTIMIZATIONS", see gameEnvironment.
+	Env map[string]string `json:"env,omitempty"`
+	// Overrides the restart policy of the config, see launchWithRestarts.
+	Restart *RestartPolicy `json:"restart,omitempty"`
+}
+
+// Returns the directory holding everything that belongs to an instance.
+func instanceDir(base string, name string) string {
+	return base + "/instances/" + name
+}
+
+// Returns the directory the game is run in.
+func (this *Instance) gameDir(base string) string {
+	if this.GameDir != "" {
+		return this.GameDir
+	}
+	return instanceDir(base, this.Name) + "/minecraft"
+}
+
+// Checks that an instance name can safely be used as a directory name.
+func validateInstanceName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return errors.New("invalid instance name \"" + name + "\"")
+	}
+	if strings.ContainsAny(name, "/\\:*?\"<>|") {
+		return errors.New("instance name \"" + name + "\" contains illegal characters")
+	}
+	return nil
+}
+
+// Replaces every character validateInstanceName does not allow, for names that come from somewhere else.
+func sanitizeInstanceName(name string) string {
+	return strings.Map(func(char rune) rune {
+		if strings.ContainsRune("/\\:*?\"<>|", char) {
+			return '_'
+		}
+		return char
+	}, name)
+}
+
+func loadInstance(base string, name string) (*Instance, error) {
+	err := validateInstanceName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	path := instanceDir(base, name) + "/instance.json"
+	if !fileExists(path) {
+		return nil, errors.New("instance " + name + " does not exist")
+	}
+
+	var instance Instance
+	err = readJson(path, &instance)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to load instance "+name), err)
+	}
+	instance.Name = name
+	return &instance, nil
+}
+
+// Loads every instance, sorted by name. Directories without an instance.json are skipped.
+func listInstances(base string) ([]*Instance, error) {
+	entries, err := os.ReadDir(base + "/instances")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Join(errors.New("failed to list instances"), err)
+	}
+
+	var instances []*Instance
+	for i := range entries {
+		if !entries[i].IsDir() || !fileExists(instanceDir(base, entries[i].Name())+"/instance.json") {
+			continue
+		}
+		instance, err := loadInstance(base, entries[i].Name())
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+func saveInstance(base string, instance *Instance) error {
+	dir := instanceDir(base, instance.Name)
+	err := createParents(dir)
+	if err != nil {
+		return errors.Join(errors.New("failed to create instance directory "+dir), err)
+	}
+	err = createParents(instance.gameDir(base))
+	if err != nil {
+		return errors.Join(errors.New("failed to create game directory of "+instance.Name), err)
+	}
+
+	err = writeJson(dir+"/instance.json", instance)
+	if err != nil {
+		return errors.Join(errors.New("failed to save instance "+instance.Name), err)
+	}
+	return nil
+}
+
+// Returns the window title of an instance for a version with its placeholders replaced.
+func windowTitle(instance *Instance, manifest *Manifest) (string, error) {
+	title, unknown := formatTemplate(instance.Title, map[string]string{
+		"instance": instance.Name,
+		"version":  manifest.Id,
+	})
+	if len(unknown) > 0 {
+		return "", errors.New("the title of " + instance.Name + " uses unknown placeholders ${" + strings.Join(unknown, "}, ${") + "}, only ${instance} and ${version} are replaced")
+	}
+	return title, nil
+}
+
+// Resolves the version an instance should be launched with, following the latest release or snapshot if requested.
+func resolveVersion(versions *VersionManifest, version string) string {
+	switch version {
+	case "", VERSION_LATEST_RELEASE:
+		{
+			return versions.Latest.Release
+		}
+	case VERSION_LATEST_SNAPSHOT:
+		{
+			return versions.Latest.Snapshot
+		}
+	default:
+		{
+			return version
+		}
+	}
+}
+
+// Creates a share link describing how an instance was set up. Only the version, loader and pack source are included,
+// no files are shared so the link can be given to anyone.
+func createShareLink(instance *Instance) string {
+	values := url.Values{}
+	values.Set("version", instance.Version)
+	if instance.Loader != nil {
+		values.Set("loader", instance.Loader.Name)
+		values.Set("loaderVersion", instance.Loader.Version)
+	}
+	if instance.PackSource != "" {
+		values.Set("pack", instance.PackSource)
+	}
+
+	link := url.URL{
+		Scheme:   SHARE_LINK_SCHEME,
+		Opaque:   SHARE_LINK_KIND,
+		RawQuery: values.Encode(),
+	}
+	return link.String()
+}
+
+// Parses a link created by createShareLink into a new unnamed instance.
+func parseShareLink(link string) (*Instance, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to parse share link"), err)
+	}
+	if parsed.Scheme != SHARE_LINK_SCHEME || parsed.Opaque != SHARE_LINK_KIND {
+		return nil, errors.New("not an instance share link: " + link)
+	}
+
+	values := parsed.Query()
+	instance := Instance{
+		Version:    values.Get("version"),
+		PackSource: values.Get("pack"),
+	}
+	if instance.Version == "" {
+		return nil, errors.New("share link has no version")
+	}
+
+	loader := values.Get("loader")
+	if loader != "" {
+		instance.Loader = &InstanceLoader{
+			Name:    loader,
+			Version: values.Get("loaderVersion"),
+		}
+	}
+
+	return &instance, nil
+}
+
+var instanceCommands = []Command{
+	{
+		Name:        "create",
+		Usage:       "<name> [--version <version>] [--from-link <link>] [flags], -h lists every flag",
+		Description: "Creates a new instance, optionally recreating the setup described by a share link",
+		Run:         instanceCreateCommand,
+	},
+	{
+		Name:        "edit",
+		Usage:       "<name> [flags], -h lists every flag",
+		Description: "Changes the settings of an instance, takes the same flags as create",
+		Run:         instanceEditCommand,
+	},
+	{
+		Name:        "share",
+		Usage:       "<name>",
+		Description: "Prints a link that recreates the setup of an instance with \"instance create --from-link\"",
+		Run:         instanceShareCommand,
+	},
+	{
+		Name:        "info",
+		Usage:       "<name>",
+		Description: "Shows the settings of an instance and how much space it uses",
+		Run:         instanceInfoCommand,
+	},
+	{
+		Name:        "env",
+		Usage:       "<name> [--shell <sh|fish|powershell|cmd>]",
+		Description: "Prints exports of the Java, game directory and classpath of an instance, for eval in a shell",
+		Run:         instanceEnvCommand,
+	},
+	{
+		Name:        "import-vanilla",
+		Usage:       "",
+		Description: "Creates an instance for every profile of the official launcher",
+		Run:         instanceImportVanillaCommand,
+	},
+	{
+		Name:        "duplicates",
+		Usage:       "",
+		Description: "Finds instances that run the same version, loader and mods",
+		Run:         instanceDuplicatesCommand,
+	},
+	{
+		Name:        "merge",
+		Usage:       "<into> <other>... [--link]",
+		Description: "Moves the worlds of instances that run the same game into one, or links their mods and config to it",
+		Run:         instanceMergeCommand,
+	},
+	{
+		Name:        "delete",
+		Usage:       "<name>",
+		Description: "Deletes an instance, the shared library and asset store is left alone until \"store gc\" is run",
+		Run:         instanceDeleteCommand,
+	},
+}
+
+func instanceCommand(base string, args []string) error {
+	return runCommand(instanceCommands, base, args)
+}
+
+// Registers the flags that configure an instance, binding them directly to the fields of the instance so they can be
+// used to create a new instance or edit an existing one.
+func bindInstanceFlags(set *flag.FlagSet, instance *Instance) {
+	loader := func() *InstanceLoader {
+		if instance.Loader == nil {
+			instance.Loader = &InstanceLoader{}
+		}
+		return instance.Loader
+	}
+
+	set.StringVar(&instance.Version, "version", instance.Version, "the game version, "+VERSION_LATEST_RELEASE+" or "+VERSION_LATEST_SNAPSHOT)
+	set.Func("loader", "the mod loader the instance is made for, it is not installed", func(value string) error {
+		loader().Name = value
+		return nil
+	})
+	set.Func("loader-version", "the version of the mod loader", func(value string) error {
+		loader().Version = value
+		return nil
+	})
+	set.StringVar(&instance.PackSource, "pack", instance.PackSource, "where the mod pack of the instance comes from")
+	set.StringVar(&instance.Language, "language", instance.Language, "the language the game runs with, like \"de\"")
+	set.StringVar(&instance.Country, "country", instance.Country, "the country the game runs with, like \"DE\"")
+	set.StringVar(&instance.Timezone, "timezone", instance.Timezone, "the time zone the game runs with, like \"Europe/Berlin\"")
+	set.BoolVar(&instance.HeapDumps, "heap-dumps", instance.HeapDumps, "write a heap dump when the game runs out of memory")
+	set.StringVar(&instance.Title, "title", instance.Title, "the title of the game window, ${instance} and ${version} are replaced and $${ is a literal ${")
+	set.BoolVar(&instance.PathingJar, "pathing-jar", instance.PathingJar, "always pass the classpath in a jar whose manifest lists the libraries")
+	set.BoolVar(&instance.Locked, "locked", instance.Locked, "use the game directory as a template, every launch runs in a copy of it")
+	set.Func("session-policy", "what happens to the copy of a locked instance after the game exits, "+SESSION_DISCARD+" or "+SESSION_PERSIST+" per user", func(value string) error {
+		if value != SESSION_DISCARD && value != SESSION_PERSIST {
+			return errors.New("unknown session policy " + value)
+		}
+		instance.SessionPolicy = value
+		return nil
+	})
+	set.BoolVar(&instance.Server, "server", instance.Server, "run the dedicated server of the version instead of the game")
+	set.StringVar(&instance.Requires, "requires", instance.Requires, "a server instance to start before the game and join")
+	set.Func("server-shutdown", "what happens to the required server once the game exits, "+SERVER_SHUTDOWN_STOP+" or "+SERVER_SHUTDOWN_KEEP, func(value string) error {
+		if value != SERVER_SHUTDOWN_STOP && value != SERVER_SHUTDOWN_KEEP {
+			return errors.New("unknown server shutdown policy " + value)
+		}
+		instance.ServerShutdown = value
+		return nil
+	})
+	set.BoolVar(&instance.SnapshotSaves, "snapshot-saves", instance.SnapshotSaves, "keep the worlds of snapshots apart from the worlds of releases")
+	bindHeapFlags(set, &instance.MaxHeap, &instance.MinHeap)
+	set.Func("jvm-arg", "an extra argument for the JVM, can be repeated", func(value string) error {
+		instance.JvmArgs = append(instance.JvmArgs, value)
+		return nil
+	})
+	set.Func("env", "a variable for the environment of the game as NAME=VALUE, can be repeated, NAME= removes it", func(value string) error {
+		name, variable, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return errors.New("expected NAME=VALUE, got " + value)
+		}
+		if variable == "" {
+			delete(instance.Env, name)
+			return nil
+		}
+		if instance.Env == nil {
+			instance.Env = map[string]string{}
+		}
+		instance.Env[name] = variable
+		return nil
+	})
+	bindRestartFlags(set, instance)
+	set.Func("wrapper", "a command java is run through, like \"gamemoderun\" or \"nice -n 10\", an empty one uses the one of the config", func(value string) error {
+		instance.Wrapper = strings.Fields(value)
+		return nil
+	})
+	set.Func("gc", "the GC preset the JVM is tuned with, one of "+strings.Join(gcPresets, ", ")+", or none to use the one of the config", func(value string) error {
+		if value == "none" {
+			value = ""
+		}
+		instance.GcPreset = value
+		return validateGcPreset(value)
+	})
+	set.Func("disk-budget", "how much disk space the instance may use before launching warns, like 2GiB, 0 for no limit", func(value string) error {
+		size, err := parseByteSize(value)
+		instance.DiskBudget = size
+		return err
+	})
+}
+
+// Saves an instance that was created or edited, keeping the profiles of the official launcher up to date.
+func commitInstance(base string, instance *Instance) error {
+	err := saveInstance(base, instance)
+	if err != nil {
+		return err
+	}
+	if config.VanillaDirectory != "" {
+		err = updateVanillaProfile(base, instance, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func instanceCreateCommand(base string, args []string) error {
+	instance := &Instance{
+		Version: VERSION_LATEST_RELEASE,
+	}
+	set := flag.NewFlagSet("instance create", flag.ContinueOnError)
+	bindInstanceFlags(set, instance)
+	link := set.String("from-link", "", "a share link created by \"instance share\"")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	name := positional[0]
+	err = validateInstanceName(name)
+	if err != nil {
+		return err
+	}
+	if fileExists(instanceDir(base, name) + "/instance.json") {
+		return errors.New("instance " + name + " already exists")
+	}
+
+	if *link != "" {
+		linked, err := parseShareLink(*link)
+		if err != nil {
+			return err
+		}
+		instance.Version = linked.Version
+		instance.Loader = linked.Loader
+		instance.PackSource = linked.PackSource
+	}
+	instance.Name = name
+
+	err = commitInstance(base, instance)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created instance %s (%s)\n", name, instance.Version)
+	return nil
+}
+
+func instanceEditCommand(base string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected an instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	set := flag.NewFlagSet("instance edit", flag.ContinueOnError)
+	bindInstanceFlags(set, instance)
+	positional, err := parseFlags(set, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	err = commitInstance(base, instance)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Updated instance %s\n", instance.Name)
+	return nil
+}
+
+func instanceShareCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(createShareLink(instance))
+	return nil
+}
+
+func instanceInfoCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Name:       %s\n", instance.Name)
+	fmt.Printf("Version:    %s\n", instance.Version)
+	if instance.Loader != nil {
+		fmt.Printf("Loader:     %s %s\n", instance.Loader.Name, instance.Loader.Version)
+	}
+	if instance.PackSource != "" {
+		fmt.Printf("Pack:       %s\n", instance.PackSource)
+	}
+	fmt.Printf("Game dir:   %s\n", instance.gameDir(base))
+	if instance.Server {
+		fmt.Printf("Server:     port %d\n", serverPort(instance.gameDir(base)))
+	}
+	if instance.Requires != "" {
+		fmt.Printf("Requires:   %s\n", instance.Requires)
+	}
+	if instance.MaxHeap != "" || instance.MinHeap != "" {
+		fmt.Printf("Heap:       %s initial, %s largest\n", firstHeapSize(instance.MinHeap, "default"), firstHeapSize(instance.MaxHeap, "default"))
+	}
+	if len(instance.JvmArgs) > 0 {
+		fmt.Printf("JVM args:   %s\n", strings.Join(instance.JvmArgs, " "))
+	}
+	if len(instance.Wrapper) > 0 {
+		fmt.Printf("Wrapper:    %s\n", strings.Join(instance.Wrapper, " "))
+	}
+	if len(instance.Env) > 0 {
+		names := make([]string, 0, len(instance.Env))
+		for name := range instance.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i := range names {
+			fmt.Printf("Env:        %s=%s\n", names[i], instance.Env[names[i]])
+		}
+	}
+	if instance.GcPreset != "" {
+		fmt.Printf("GC preset:  %s\n", instance.GcPreset)
+	}
+	restart := instanceRestartPolicy(instance)
+	if restart.MaxRestarts > 0 {
+		within := "any time"
+		if restart.Within > 0 {
+			within = "within " + time.Duration(restart.Within).String()
+		}
+		fmt.Printf("Restarts:   up to %d after crashes %s, waiting %s\n", restart.MaxRestarts, within, time.Duration(restart.Backoff))
+	}
+	if instance.SharesWith != "" {
+		fmt.Printf("Shares:     mods and config of %s\n", instance.SharesWith)
+	}
+
+	mods, err := listMods(base, instance)
+	if err != nil {
+		return err
+	}
+	enabled := 0
+	for i := range mods {
+		if mods[i].Enabled {
+			enabled++
+		}
+	}
+	fmt.Printf("Mods:       %d, %d enabled\n", len(mods), enabled)
+
+	logs, err := listLogs(instance.gameDir(base))
+	if err != nil {
+		return err
+	}
+	var logSize int64
+	for i := range logs {
+		logSize += logs[i].Size
+	}
+	fmt.Printf("Logs:       %d files, %s\n", len(logs), formatBytes(float64(logSize)))
+
+	dumps, err := listHeapDumps(base, instance)
+	if err != nil {
+		return err
+	}
+	var dumpSize int64
+	for i := range dumps {
+		dumpSize += dumps[i].Size()
+	}
+	fmt.Printf("Heap dumps: %d files, %s\n", len(dumps), formatBytes(float64(dumpSize)))
+	if instance.DiskBudget != 0 {
+		usage := measureDiskUsage(base, instance)
+		var total uint64
+		for i := range usage {
+			total += usage[i].Size
+		}
+		fmt.Printf("Disk usage: %s of %s\n", formatBytes(float64(total)), formatBytes(float64(instance.DiskBudget)))
+	}
+	return nil
+}
+
+func instanceDeleteCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	instances, err := listInstances(base)
+	if err != nil {
+		return err
+	}
+	for i := range instances {
+		if instances[i].SharesWith == instance.Name {
+			return errors.New(instances[i].Name + " shares the mods and config of " + instance.Name + ", merge or delete it first")
+		}
+	}
+
+	err = removeAll(instanceDir(base, instance.Name))
+	if err != nil {
+		return errors.Join(errors.New("failed to delete instance "+instance.Name), err)
+	}
+	fmt.Printf("Deleted instance %s\n", instance.Name)
+	return nil
+}
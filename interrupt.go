@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Cancelled once the user interrupts the launcher. Downloads and extractions stop as soon as they notice, a running
+// game is left alone since it receives the interrupt itself.
+var launcherContext = context.Background()
+
+// Returned by long-running work that noticed the launcher was interrupted.
+var errInterrupted = errors.New("interrupted")
+
+// Cancels launcherContext on the first SIGINT or SIGTERM so everything can clean up after itself. A second one exits
+// right away.
+func handleInterrupts() {
+	ctx, cancel := context.WithCancel(context.Background())
+	launcherContext = ctx
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("Interrupted, stopping, interrupt again to exit right away")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+}
+
+// Returns errInterrupted once the launcher was interrupted.
+func checkInterrupted() error {
+	if launcherContext.Err() != nil {
+		return errInterrupted
+	}
+	return nil
+}
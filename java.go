@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A JVM downloaded from Adoptium, one directory of jdkDir.
+type InstalledJava struct {
+	// The name of its directory, the version with the image appended for images that are not a JRE.
+	Name  string
+	Major int
+	Size  uint64
+	// When it was last used to launch, or when it was installed if it was never used.
+	LastUsed time.Time
+	// Whether an installed version needs it, see findPrunableJava.
+	Needed bool
+}
+
+// Remembers when a runtime from jdkDir was used, runtimes of other providers are left alone.
+func markJavaUsed(base string, home string) {
+	relative, ok := strings.CutPrefix(home, jdkDir(base))
+	if !ok {
+		return
+	}
+	name, _, _ := strings.Cut(relative, "/")
+	now := time.Now()
+	_ = os.Chtimes(jdkDir(base)+name, now, now)
+}
+
+// Returns the major versions of Java the installed versions need.
+func neededJavaVersions(base string) (map[int]bool, error) {
+	pattern := base + "/versions/*.json"
+	if config.VanillaDirectory != "" {
+		pattern = config.VanillaDirectory + "/versions/*/*.json"
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	needed := map[int]bool{}
+	for i := range paths {
+		var manifest Manifest
+		err = readJson(paths[i], &manifest)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to read "+paths[i]), err)
+		}
+		needed[int(manifest.javaVersion())] = true
+	}
+	return needed, nil
+}
+
+// Returns the size of every file below a directory.
+func directorySize(dir string) uint64 {
+	var size uint64
+	_ = filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := entry.Info()
+		if err == nil && info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size
+}
+
+// Lists the JVMs downloaded from Adoptium, sorted by version. The newest JVM of every major version an installed
+// version needs is needed, every other one can be pruned. Unfinished extractions are not listed.
+func listInstalledJava(base string) ([]InstalledJava, error) {
+	entries, err := os.ReadDir(jdkDir(base))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Join(errors.New("failed to list installed Java"), err)
+	}
+	needed, err := neededJavaVersions(base)
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []InstalledJava
+	for i := range entries {
+		name := entries[i].Name()
+		if !entries[i].IsDir() || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		info, err := entries[i].Info()
+		if err != nil {
+			return nil, err
+		}
+		semver, _, _ := strings.Cut(name, "-")
+		parts := semverParts(semver)
+		if len(parts) == 0 {
+			continue
+		}
+		installed = append(installed, InstalledJava{
+			Name:     name,
+			Major:    parts[0],
+			Size:     directorySize(jdkDir(base) + name),
+			LastUsed: info.ModTime(),
+		})
+	}
+	sort.Slice(installed, func(a int, b int) bool {
+		return slices.Compare(semverParts(installed[a].Name), semverParts(installed[b].Name)) < 0
+	})
+
+	// Only the newest of every major version and image is ever used
+	newest := map[string]int{}
+	for i := range installed {
+		_, image, _ := strings.Cut(installed[i].Name, "-")
+		newest[fmt.Sprintf("%d-%s", installed[i].Major, image)] = i
+	}
+	for key := range newest {
+		java := &installed[newest[key]]
+		java.Needed = needed[java.Major]
+	}
+	return installed, nil
+}
+
+var javaCommands = []Command{
+	{
+		Name:        "list",
+		Usage:       "",
+		Description: "Lists the JVMs downloaded from Adoptium with their size and when they were last used",
+		Run:         javaListCommand,
+	},
+	{
+		Name:        "prune",
+		Usage:       "[--dry-run]",
+		Description: "Deletes the JVMs no installed version needs, keeping the newest one of every needed major version",
+		Run:         javaPruneCommand,
+	},
+}
+
+func javaCommand(base string, args []string) error {
+	return runCommand(javaCommands, base, args)
+}
+
+func javaListCommand(base string, args []string) error {
+	if len(args) != 0 {
+		return errors.New("expected no arguments")
+	}
+	installed, err := listInstalledJava(base)
+	if err != nil {
+		return err
+	}
+	if len(installed) == 0 {
+		fmt.Println("No Java was downloaded")
+		return nil
+	}
+
+	var total uint64
+	for i := range installed {
+		java := &installed[i]
+		state := "needed"
+		if !java.Needed {
+			state = "unused"
+		}
+		fmt.Printf("%-24s Java %-3d %10s  last used %s  %s\n", java.Name, java.Major, formatBytes(float64(java.Size)), java.LastUsed.Format(time.DateTime), state)
+		total += java.Size
+	}
+	fmt.Printf("%d JVMs using %s\n", len(installed), formatBytes(float64(total)))
+	return nil
+}
+
+func javaPruneCommand(base string, args []string) error {
+	set := flag.NewFlagSet("java prune", flag.ContinueOnError)
+	dryRun := set.Bool("dry-run", false, "only list the JVMs that would be deleted")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errors.New("expected no arguments")
+	}
+
+	installed, err := listInstalledJava(base)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	var size uint64
+	for i := range installed {
+		java := &installed[i]
+		if java.Needed {
+			continue
+		}
+		count++
+		size += java.Size
+		if *dryRun {
+			fmt.Println(java.Name)
+			continue
+		}
+
+		dir := jdkDir(base) + java.Name
+		_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				hashCache.forget(path)
+			}
+			return nil
+		})
+		err = removeAll(dir)
+		if err != nil {
+			return errors.Join(errors.New("failed to delete "+dir), err)
+		}
+		fmt.Printf("Deleted %s\n", java.Name)
+	}
+
+	if *dryRun {
+		fmt.Printf("Would delete %d JVMs (%s)\n", count, formatBytes(float64(size)))
+		return nil
+	}
+	fmt.Printf("Deleted %d JVMs (%s)\n", count, formatBytes(float64(size)))
+	return hashCache.save()
+}
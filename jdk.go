@@ -7,9 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 type AdoptiumPackage struct {
@@ -31,6 +36,10 @@ func (this *AdoptiumPackage) hash() *string {
 	return &this.Checksum
 }
 
+func (this *AdoptiumPackage) size() uint64 {
+	return this.Size
+}
+
 type AdoptiumBinary struct {
 	Architecture  string          `json:"architecture"`
 	DownloadCount uint64          `json:"download_count"`
@@ -91,6 +100,11 @@ func extractTar(destination string, source string) error {
 
 	reader := tar.NewReader(stream)
 	for {
+		err = checkInterrupted()
+		if err != nil {
+			return err
+		}
+
 		header, err := reader.Next()
 		if err != nil {
 			if err == io.EOF {
@@ -155,8 +169,12 @@ func extractZip(destination string, source string) error {
 	}()
 
 	for i := range reader.File {
-		file := reader.File[i]
+		err = checkInterrupted()
+		if err != nil {
+			return err
+		}
 
+		file := reader.File[i]
 		if file.FileInfo().IsDir() {
 			err = createParents(destination + file.Name)
 			if err != nil {
@@ -192,7 +210,21 @@ func extractZip(destination string, source string) error {
 	return nil
 }
 
+// Returns the home directory of the JVM extracted into a directory. The JVMs for macOS are app bundles, their home is
+// below JDK_MACOS_HOME.
 func findJdk(path string) (string, error) {
+	dir, err := findJdkDir(path)
+	if err != nil {
+		return "", err
+	}
+	if fileExists(dir + JDK_MACOS_HOME) {
+		return dir + JDK_MACOS_HOME, nil
+	}
+	return dir, nil
+}
+
+// Returns the top level directory of the archive of a JVM that was extracted into a directory.
+func findJdkDir(path string) (string, error) {
 	dirs, err := os.ReadDir(path)
 	if err == nil {
 		for i := range dirs {
@@ -205,9 +237,211 @@ func findJdk(path string) (string, error) {
 	return "", errors.Join(errors.New("failed to find JVM dir"), err)
 }
 
-func downloadJdk(base string, version uint32) (string, error) {
+// Returns the directory the JVMs downloaded from Adoptium are kept in, one directory per release.
+func jdkDir(base string) string {
+	return base + "/library/net/java/jdk/"
+}
+
+// Finds the newest JVM of a major version that was downloaded before.
+func findInstalledJdk(base string, version uint32) (string, error) {
+	entries, err := os.ReadDir(jdkDir(base))
+	if err != nil {
+		return "", errors.Join(errNoRuntime, err)
+	}
+
+	var newest []int
+	var found string
+	for i := range entries {
+		name := entries[i].Name()
+		// Other images and unfinished extractions have a suffix
+		if !entries[i].IsDir() || strings.Contains(name, "-") || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		parts := semverParts(name)
+		if len(parts) == 0 || parts[0] != int(version) || slices.Compare(parts, newest) <= 0 {
+			continue
+		}
+		jdk, err := findJdk(jdkDir(base) + name + "/")
+		if err == nil {
+			newest = parts
+			found = jdk
+		}
+	}
+	if found == "" {
+		return "", errors.Join(errNoRuntime, errors.New(fmt.Sprintf("no Java %d was downloaded before", version)))
+	}
+	return found, nil
+}
+
+// Splits a version like "17.0.9+9" into its numbers.
+func semverParts(semver string) []int {
+	fields := strings.FieldsFunc(semver, func(char rune) bool {
+		return char < '0' || char > '9'
+	})
+	parts := make([]int, 0, len(fields))
+	for i := range fields {
+		part, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// The images Adoptium offers, a JRE to run the game and a full JDK with tools like jlink.
+	ADOPTIUM_IMAGE_JRE string = "jre"
+	ADOPTIUM_IMAGE_JDK string = "jdk"
+
+	// Where the home directory of a JVM for macOS is inside of its bundle.
+	JDK_MACOS_HOME string = "/Contents/Home"
+
+	// How many releases are asked for at once, and how many pages are looked through before giving up.
+	ADOPTIUM_PAGE_SIZE int = 10
+	ADOPTIUM_MAX_PAGES int = 10
+)
+
+// Checks if a release of Adoptium is newer than another one.
+func (this *AdoptiumVersion) newerThan(other *AdoptiumVersion) bool {
+	if this.Major != other.Major {
+		return this.Major > other.Major
+	}
+	if this.Minor != other.Minor {
+		return this.Minor > other.Minor
+	}
+	if this.Security != other.Security {
+		return this.Security > other.Security
+	}
+	if this.Patch != other.Patch {
+		return this.Patch > other.Patch
+	}
+	return this.Build > other.Build
+}
+
+// Returns the extension of a package of Adoptium, or an empty string for packages that can not be extracted.
+func adoptiumExtension(name string) string {
+	if strings.HasSuffix(name, ".tar.gz") {
+		return "tar.gz"
+	}
+	if strings.HasSuffix(name, ".zip") {
+		return "zip"
+	}
+	return ""
+}
+
+// Picks the binary of a release that runs here. Releases can list binaries for other systems and images as well as
+// installers, only an archive of the asked for image with the normal heap size is used.
+func selectAdoptiumBinary(release *AdoptiumRelease, osName string, arch string, image string) *AdoptiumBinary {
+	for i := range release.Binaries {
+		binary := &release.Binaries[i]
+		if binary.Os != osName || binary.Architecture != arch || binary.ImageType != image {
+			continue
+		}
+		if binary.JvmImpl != "hotspot" || (binary.HeapSize != "" && binary.HeapSize != "normal") {
+			continue
+		}
+		if binary.Package.Link == "" || adoptiumExtension(binary.Package.Name) == "" {
+			continue
+		}
+		return binary
+	}
+	return nil
+}
+
+// Finds the newest release of a major version with a binary that runs here, looking through the pages of the API until
+// one has a usable binary. Returns nil when no page has one.
+func findAdoptiumRelease(version uint32, osName string, arch string, image string) (*AdoptiumRelease, *AdoptiumBinary, error) {
 	// https://api.adoptium.net/v3/assets/feature_releases/17/ga?architecture=x64&heap_size=normal&image_type=jre&jvm_impl=hotspot&os=linux&page=0&page_size=10&project=jdk&sort_method=DEFAULT&sort_order=DESC&vendor=eclipse
-	var releases []AdoptiumRelease
+	for page := 0; page < ADOPTIUM_MAX_PAGES; page++ {
+		var releases []AdoptiumRelease
+		err := downloadJsonRaw(fmt.Sprintf(
+			URL_ADOPTIUM_API+"assets/feature_releases/%d/ga?architecture=%s&heap_size=normal&image_type=%s&jvm_impl=hotspot&os=%s&page=%d&page_size=%d&project=jdk&sort_method=DEFAULT&sort_order=DESC&vendor=eclipse",
+			version,
+			arch,
+			image,
+			osName,
+			page,
+			ADOPTIUM_PAGE_SIZE,
+		), nil, &releases)
+		var status *StatusError
+		if errors.As(err, &status) && status.Code == http.StatusNotFound {
+			// Adoptium answers pages past the last one, and versions it has nothing for, with a 404
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sort.Slice(releases, func(a int, b int) bool {
+			return releases[a].VersionData.newerThan(&releases[b].VersionData)
+		})
+		for i := range releases {
+			binary := selectAdoptiumBinary(&releases[i], osName, arch, image)
+			if binary != nil {
+				return &releases[i], binary, nil
+			}
+		}
+		if len(releases) < ADOPTIUM_PAGE_SIZE {
+			return nil, nil, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// Downloads the newest JRE of a major version from Adoptium unless it is installed already.
+func downloadJdk(base string, version uint32) (string, error) {
+	return downloadAdoptium(base, version, ADOPTIUM_IMAGE_JRE)
+}
+
+// A JVM archive of Adoptium pinned by a lockfile or a bundle, so exactly the same JVM is installed again without asking
+// Adoptium which release is the newest. Archives only run on the system and architecture they were built for.
+type LockedJdk struct {
+	Major  uint32 `json:"major"`
+	Semver string `json:"semver"`
+	Image  string `json:"image"`
+	Os     string `json:"os"`
+	Arch   string `json:"arch"`
+	Name   string `json:"name"`
+	Url    string `json:"url"`
+	Size   uint64 `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+func (this *LockedJdk) url() string {
+	return this.Url
+}
+
+func (this *LockedJdk) hash() *string {
+	return &this.Sha256
+}
+
+func (this *LockedJdk) size() uint64 {
+	return this.Size
+}
+
+// Returns the directory a pinned JVM is extracted into.
+func (this *LockedJdk) dir(base string) string {
+	if this.Image != ADOPTIUM_IMAGE_JRE {
+		return jdkDir(base) + this.Semver + "-" + this.Image + "/"
+	}
+	return jdkDir(base) + this.Semver + "/"
+}
+
+// Returns where the archive of a pinned JVM is downloaded to.
+func (this *LockedJdk) archive(base string) string {
+	return this.dir(base) + "jdk-" + this.Semver + "." + adoptiumExtension(this.Name)
+}
+
+// Checks if a pinned JVM is the JRE of a major version for this system.
+func (this *LockedJdk) runsHere(version uint32) bool {
+	osName, arch := adoptiumPlatform()
+	return this.Major == version && this.Image == ADOPTIUM_IMAGE_JRE && this.Os == osName && this.Arch == arch
+}
+
+// Returns the names Adoptium uses for the system and architecture the launcher runs on.
+func adoptiumPlatform() (string, string) {
 	var arch string
 	switch runtime.GOARCH {
 	case "amd64":
@@ -218,82 +452,122 @@ func downloadJdk(base string, version uint32) (string, error) {
 		{
 			arch = "x32"
 		}
+	case "arm64":
+		{
+			arch = "aarch64"
+		}
 	default:
 		{
 			arch = runtime.GOARCH
 		}
 	}
+	// Adoptium calls macOS by its name
+	osName := runtime.GOOS
+	if osName == "darwin" {
+		osName = "mac"
+	}
+	return osName, arch
+}
 
-	err := downloadJsonRaw(fmt.Sprintf(
-		"https://api.adoptium.net/v3/assets/feature_releases/%d/ga?architecture=%s&heap_size=normal&image_type=jre&jvm_impl=hotspot&os=%s&page=0&page_size=10&project=jdk&sort_method=DEFAULT&sort_order=DESC&vendor=eclipse",
-		version,
-		arch,
-		runtime.GOOS,
-	), nil, &releases)
+// Downloads the newest image of a major version from Adoptium unless it is installed already. Returns the home
+// directory of the runtime.
+func downloadAdoptium(base string, version uint32, image string) (string, error) {
+	osName, arch := adoptiumPlatform()
+	latest, binaryInfo, err := findAdoptiumRelease(version, osName, arch, image)
 	if err != nil {
+		// Offline, a JVM that was installed before or imported from a bundle still works
+		if image == ADOPTIUM_IMAGE_JRE {
+			jdk, installedErr := findInstalledJdk(base, version)
+			if installedErr == nil {
+				return jdk, nil
+			}
+		}
 		return "", err
 	}
-
-	sort.Slice(releases, func(indexA int, indexB int) bool {
-		a := releases[indexA].VersionData
-		b := releases[indexB].VersionData
-
-		if a.Major != b.Major {
-			return a.Major < b.Major
-		}
-
-		if a.Minor != b.Minor {
-			return a.Minor < b.Minor
-		}
-
-		if a.Security != b.Security {
-			return a.Security < b.Security
-		}
-
-		return a.Build < b.Build
-	})
-
-	latest := releases[len(releases)-1]
-	if len(latest.Binaries) != 1 {
-		return "", errors.New("an incorrect amount of binaries was returned")
+	if latest == nil {
+		return "", errors.Join(errNoRuntime, errors.New(fmt.Sprintf("Adoptium has no Java %d for %s/%s", version, osName, arch)))
 	}
 
-	binary := latest.Binaries[0].Package
+	binary := binaryInfo.Package
+	return installLockedJdk(base, &LockedJdk{
+		Major:  version,
+		Semver: latest.VersionData.Semver,
+		Image:  image,
+		Os:     osName,
+		Arch:   arch,
+		Name:   binary.Name,
+		Url:    binary.Link,
+		Size:   binary.Size,
+		Sha256: binary.Checksum,
+	}, binary.SignatureLink)
+}
 
-	// This should be
-	// extension := runtime.GOOS == "windows" ? "zip" : "tar.gz"
-	var extension string
-	if runtime.GOOS == "windows" {
-		extension = "zip"
-	} else {
-		extension = "tar.gz"
+// Installs a JVM archive of Adoptium unless it is installed already, downloading it when the archive is not there
+// either. The signature is verified when there is one, a pinned archive is protected by its hash. Returns the home
+// directory of the runtime.
+func installLockedJdk(base string, locked *LockedJdk, signatureUrl string) (string, error) {
+	extension := adoptiumExtension(locked.Name)
+	if extension == "" {
+		return "", errors.New("don't know how to extract " + locked.Name)
 	}
+	path := locked.dir(base)
+	archive := locked.archive(base)
+	recordJdk(locked)
 
-	path := base + "/library/net/java/jdk/" + latest.VersionData.Semver + "/"
-	archive := path + "jdk-" + latest.VersionData.Semver + "." + extension
-	valid, err := validateHash(archive, binary.Checksum)
+	valid, err := validateHash(archive, locked.Sha256)
 	if err != nil {
 		return "", errors.Join(errors.New("failed to hash JVM package"), err)
 	}
 	if valid {
-		path, err = findJdk(path)
-		return path, err
+		recordArtifact(archive, locked.url(), locked.hash(), locked.size())
+		jdk, err := findJdk(path)
+		if err == nil {
+			return jdk, nil
+		}
+	} else {
+		batch := downloadPool.batch("JDK")
+		batch.submit(func() error {
+			return downloadFile(archive, locked, batch.progress)
+		})
+		err = batch.wait()
+		if err != nil {
+			return "", errors.Join(errors.New("could not download JVM"), err)
+		}
+
+		err = verifyAdoptiumSignature(archive, signatureUrl)
+		if err != nil {
+			hashCache.forget(archive)
+			_ = os.Remove(archive)
+			return "", err
+		}
 	}
 
-	err = downloadFile(archive, &binary)
+	// Extract next to the final location and move the JVM into place once it is complete, an interrupted extraction
+	// must not look like an installed JVM
+	extracted := strings.TrimSuffix(path, "/") + ".part/"
+	defer func() {
+		_ = removeAll(extracted) // Don't care
+	}()
+	err = removeAll(extracted)
 	if err != nil {
-		return "", errors.Join(errors.New("could not download JVM"), err)
+		return "", errors.Join(errors.New("failed to clean up "+extracted), err)
 	}
-
-	if runtime.GOOS == "windows" {
-		err = extractZip(path, archive)
+	if extension == "zip" {
+		err = extractZip(extracted, archive)
 	} else {
-		err = extractTar(path, archive)
+		err = extractTar(extracted, archive)
 	}
 	if err != nil {
 		return "", errors.Join(errors.New("failed to extract jvm"), err)
 	}
 
-	path, err = findJdk(path)
-	return path, err
+	jdk, err := findJdkDir(extracted)
+	if err != nil {
+		return "", err
+	}
+	err = renameFile(jdk, path+filepath.Base(jdk))
+	if err != nil {
+		return "", errors.Join(errors.New("failed to move jvm into place"), err)
+	}
+	return findJdk(path)
 }
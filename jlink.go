@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The modules the game and common mods use, the runtimes built by jlink contain only these unless the config lists
+// others.
+var defaultJlinkModules = []string{
+	"java.base",
+	"java.compiler",
+	"java.desktop",
+	"java.instrument",
+	"java.logging",
+	"java.management",
+	"java.naming",
+	"java.net.http",
+	"java.scripting",
+	"java.sql",
+	"jdk.crypto.ec",
+	"jdk.management",
+	"jdk.net",
+	"jdk.unsupported",
+	"jdk.zipfs",
+}
+
+// Returns the directory of the runtime jlink built for a major version.
+func jlinkRuntimeDir(base string, version uint32) string {
+	return base + "/runtimes/jlink-" + strconv.FormatUint(uint64(version), 10)
+}
+
+// Provides a runtime that only contains the modules the game needs, built with jlink from a JDK of Adoptium. The JDK
+// is deleted once the runtime is built, the runtime is a fraction of its size. Experimental, mods that need modules
+// that are not in the list break.
+func provideJlinkRuntime(base string, version uint32, _ string) (string, error) {
+	if version < 9 {
+		return "", errors.Join(errNoRuntime, errors.New(fmt.Sprintf("Java %d has no jlink", version)))
+	}
+
+	home := jlinkRuntimeDir(base, version)
+	// jlink writes the release file last
+	if fileExists(home + "/release") {
+		return home, nil
+	}
+
+	jdk, err := downloadAdoptium(base, version, ADOPTIUM_IMAGE_JDK)
+	if err != nil {
+		return "", err
+	}
+
+	modules := config.JlinkModules
+	if len(modules) == 0 {
+		modules = defaultJlinkModules
+	}
+	compress := "--compress=2"
+	if version >= 21 {
+		compress = "--compress=zip-6"
+	}
+
+	output := home + ".part"
+	err = removeAll(output)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to clean up "+output), err)
+	}
+	err = createParents(filepath.Dir(output))
+	if err != nil {
+		return "", errors.Join(errors.New("failed to create parents of "+output), err)
+	}
+
+	fmt.Printf("Building a Java %d runtime with jlink\n", version)
+	process := execute(jdk+"/bin/jlink",
+		"--add-modules", strings.Join(modules, ","),
+		"--strip-debug",
+		"--no-header-files",
+		"--no-man-pages",
+		compress,
+		"--output", output,
+	)
+	log, err := process.CombinedOutput()
+	if err != nil {
+		_ = removeAll(output)
+		return "", errors.Join(errors.New("jlink failed: "+strings.TrimSpace(string(log))), err)
+	}
+	err = renameFile(output, home)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to move the runtime into place"), err)
+	}
+
+	// The JDK and its archive are only needed to build the runtime
+	err = removeAll(filepath.Dir(strings.TrimSuffix(jdk, JDK_MACOS_HOME)))
+	if err != nil {
+		fmt.Printf("Failed to delete the JDK the runtime was built from: %s\n", err)
+	}
+	return home, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Leaves the largest heap to the JVM instead of picking one, see automaticHeapSize.
+	HEAP_JVM_DEFAULT string = "default"
+
+	// The largest heap picked for versions without and with a mod loader, at most 1 / HEAP_AUTOMATIC_FRACTION of the
+	// memory of the machine.
+	HEAP_AUTOMATIC_VANILLA  uint64 = 2 * 1024 * 1024 * 1024
+	HEAP_AUTOMATIC_MODDED   uint64 = 4 * 1024 * 1024 * 1024
+	HEAP_AUTOMATIC_MINIMUM  uint64 = 512 * 1024 * 1024
+	HEAP_AUTOMATIC_FRACTION uint64 = 2
+)
+
+// Memory and extra arguments for the JVM of every instance.
+type JvmConfig struct {
+	// The largest and the initial heap, like "4G" or "512M" as -Xmx and -Xms take them. The largest heap is picked from
+	// the memory of the machine when it is empty, HEAP_JVM_DEFAULT leaves it to the JVM.
+	MaxHeap string   `json:"maxHeap"`
+	MinHeap string   `json:"minHeap"`
+	Args    []string `json:"args"`
+	// The GC preset of instances that do not pick one, see gcPresetArguments.
+	GcPreset string `json:"gcPreset"`
+}
+
+// Parses a heap size the way -Xmx does, a number of bytes with an optional k, m, g or t.
+func parseHeapSize(value string) (uint64, error) {
+	units := map[string]uint64{
+		"":  1,
+		"k": 1024,
+		"m": 1024 * 1024,
+		"g": 1024 * 1024 * 1024,
+		"t": 1024 * 1024 * 1024 * 1024,
+	}
+	number := strings.TrimRight(value, "kKmMgGtT")
+	unit, ok := units[strings.ToLower(value[len(number):])]
+	size, err := strconv.ParseUint(number, 10, 64)
+	if !ok || err != nil || size == 0 {
+		return 0, errors.New("invalid heap size " + value + ", expected something like 4G or 512M")
+	}
+	return size * unit, nil
+}
+
+// Checks a largest heap size, which may be HEAP_JVM_DEFAULT as well.
+func validateMaxHeapSize(value string) error {
+	if value == HEAP_JVM_DEFAULT {
+		return nil
+	}
+	_, err := parseHeapSize(value)
+	return err
+}
+
+// Adds the --xmx and --xms flags to a flag set.
+func bindHeapFlags(set *flag.FlagSet, maxHeap *string, minHeap *string) {
+	set.Func("xmx", "the largest heap of the JVM, like 4G, or "+HEAP_JVM_DEFAULT+" to let the JVM pick", func(value string) error {
+		*maxHeap = value
+		return validateMaxHeapSize(value)
+	})
+	set.Func("xms", "the initial heap of the JVM, like 1G", func(value string) error {
+		_, err := parseHeapSize(value)
+		*minHeap = value
+		return err
+	})
+}
+
+// Picks the first heap size that is set.
+func firstHeapSize(sizes ...string) string {
+	for i := range sizes {
+		if sizes[i] != "" {
+			return sizes[i]
+		}
+	}
+	return ""
+}
+
+// Returns the JVM arguments the user asked for, they come right after the ones of the version. The GC preset comes
+// first, then the extra arguments of the config and the ones of the instance, and the heap sizes come last, so the JVM,
+// which uses the last of repeated options, lets extra arguments win over the preset, the instance win over the config
+// and the heap sizes win over everything. For the heap sizes the launch wins over the instance, which wins over the
+// config, and automaticHeapSize picks the largest heap when none of them and none of the extra arguments set one.
+func userJvmArguments(instance *Instance, options *LaunchOptions, javaMajor uint32) ([]string, error) {
+	preset := instance.GcPreset
+	if preset == "" {
+		preset = config.Jvm.GcPreset
+	}
+	arguments, err := gcPresetArguments(preset, javaMajor)
+	if err != nil {
+		return nil, err
+	}
+	arguments = append(arguments, config.Jvm.Args...)
+	arguments = append(arguments, instance.JvmArgs...)
+
+	maxHeap := firstHeapSize(options.MaxHeap, instance.MaxHeap, config.Jvm.MaxHeap)
+	minHeap := firstHeapSize(options.MinHeap, instance.MinHeap, config.Jvm.MinHeap)
+	switch maxHeap {
+	case "":
+		{
+			// Extra arguments that size the heap on their own were there before automatic sizing, they keep working
+			if lastJvmOption(arguments, "-Xmx") != "" {
+				break
+			}
+			maxHeap = automaticHeapSize(instance, firstHeapSize(minHeap, lastJvmOption(arguments, "-Xms")))
+		}
+	case HEAP_JVM_DEFAULT:
+		{
+			maxHeap = ""
+		}
+	}
+	if maxHeap != "" && minHeap != "" {
+		maximum, err := parseHeapSize(maxHeap)
+		if err != nil {
+			return nil, err
+		}
+		minimum, err := parseHeapSize(minHeap)
+		if err != nil {
+			return nil, err
+		}
+		if minimum > maximum {
+			return nil, errors.New(fmt.Sprintf("the initial heap of %s is larger than the largest heap of %s", minHeap, maxHeap))
+		}
+	}
+	if maxHeap != "" {
+		arguments = append(arguments, "-Xmx"+maxHeap)
+	}
+	if minHeap != "" {
+		arguments = append(arguments, "-Xms"+minHeap)
+	}
+	return arguments, nil
+}
+
+// Picks the largest heap for an instance from the memory of the machine. The JVM picks a quarter of the memory by
+// default, which is too little for mod packs on small machines and more than the game needs on large ones. Returns
+// nothing when the memory is unknown or too small to pick a heap, the JVM decides then.
+func automaticHeapSize(instance *Instance, minHeap string) string {
+	memory := totalMemory()
+	heap := HEAP_AUTOMATIC_VANILLA
+	if instance.Loader != nil && instance.Loader.Name != "" {
+		heap = HEAP_AUTOMATIC_MODDED
+	}
+	heap = min(heap, memory/HEAP_AUTOMATIC_FRACTION)
+	if heap < HEAP_AUTOMATIC_MINIMUM {
+		return ""
+	}
+
+	// Never less than the initial heap that was asked for
+	minimum, err := parseHeapSize(minHeap)
+	if err == nil && minimum > heap {
+		return minHeap
+	}
+	return fmt.Sprintf("%dM", heap/1024/1024)
+}
+
+// Returns the value of the last JVM option with a prefix in a list of arguments, like the "4G" of "-Xmx4G". Returns
+// nothing when none of them has it.
+func lastJvmOption(arguments []string, prefix string) string {
+	for i := len(arguments) - 1; i >= 0; i-- {
+		if strings.HasPrefix(arguments[i], prefix) {
+			return arguments[i][len(prefix):]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// The group the game announces worlds opened to LAN on, about every one and a half seconds.
+	LAN_MULTICAST_ADDRESS string        = "224.0.2.60:4445"
+	LAN_LISTEN_TIME       time.Duration = 3 * time.Second
+)
+
+// A world somebody on the local network opened to LAN.
+type LanWorld struct {
+	Motd    string
+	Address string
+}
+
+var lanAnnouncementPattern = regexp.MustCompile(`\[MOTD](.*)\[/MOTD]\[AD](.*)\[/AD]`)
+
+// Parses an announcement of the game. The game only announces the port, the host is the one that sent it.
+func parseLanAnnouncement(message string, source *net.UDPAddr) *LanWorld {
+	match := lanAnnouncementPattern.FindStringSubmatch(message)
+	if match == nil {
+		return nil
+	}
+
+	address := strings.TrimSpace(match[2])
+	port, err := strconv.Atoi(address)
+	if err == nil {
+		if port <= 0 || port > 65535 {
+			return nil
+		}
+		address = net.JoinHostPort(source.IP.String(), strconv.Itoa(port))
+	} else {
+		_, _, err = net.SplitHostPort(address)
+		if err != nil {
+			return nil
+		}
+	}
+
+	return &LanWorld{
+		Motd:    match[1],
+		Address: address,
+	}
+}
+
+// Listens for announcements of LAN worlds for a while. Returns every world that was announced in the order they were
+// first seen.
+func discoverLanWorlds(duration time.Duration) ([]LanWorld, error) {
+	group, err := net.ResolveUDPAddr("udp4", LAN_MULTICAST_ADDRESS)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to listen for LAN worlds"), err)
+	}
+	defer func() {
+		_ = connection.Close()
+	}()
+
+	err = connection.SetReadDeadline(time.Now().Add(duration))
+	if err != nil {
+		return nil, err
+	}
+
+	var worlds []LanWorld
+	seen := map[string]bool{}
+	buffer := make([]byte, 1024)
+	for {
+		length, source, err := connection.ReadFromUDP(buffer)
+		if err != nil {
+			var timeout net.Error
+			if errors.As(err, &timeout) && timeout.Timeout() {
+				return worlds, nil
+			}
+			return nil, errors.Join(errors.New("failed to listen for LAN worlds"), err)
+		}
+		err = checkInterrupted()
+		if err != nil {
+			return nil, err
+		}
+
+		world := parseLanAnnouncement(string(buffer[:length]), source)
+		if world != nil && !seen[world.Address] {
+			seen[world.Address] = true
+			worlds = append(worlds, *world)
+		}
+	}
+}
+
+// Finds a LAN world by its number in the list printed by "lan list", its address or its message of the day.
+func findLanWorld(worlds []LanWorld, entry string) (*LanWorld, error) {
+	number, err := strconv.Atoi(entry)
+	if err == nil {
+		if number < 1 || number > len(worlds) {
+			return nil, errors.New(fmt.Sprintf("there is no LAN world %d, %d were found", number, len(worlds)))
+		}
+		return &worlds[number-1], nil
+	}
+
+	var found *LanWorld
+	for i := range worlds {
+		if worlds[i].Address == entry {
+			return &worlds[i], nil
+		}
+		if strings.EqualFold(worlds[i].Motd, entry) {
+			if found != nil {
+				return nil, errors.New("more than one LAN world is called " + entry + ", use its number or address")
+			}
+			found = &worlds[i]
+		}
+	}
+	if found == nil {
+		return nil, errors.New("no LAN world " + entry + " was found")
+	}
+	return found, nil
+}
+
+// Finds a LAN world to join, listening for announcements first.
+func joinLanWorld(entry string) (string, error) {
+	fmt.Println("Looking for LAN worlds")
+	worlds, err := discoverLanWorlds(LAN_LISTEN_TIME)
+	if err != nil {
+		return "", err
+	}
+	world, err := findLanWorld(worlds, entry)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Joining %s on %s\n", world.Motd, world.Address)
+	return world.Address, nil
+}
+
+var lanCommands = []Command{
+	{
+		Name:        "list",
+		Usage:       "[--wait <duration>]",
+		Description: "Lists the worlds opened to LAN on the local network",
+		Run:         lanListCommand,
+	},
+}
+
+func lanCommand(base string, args []string) error {
+	return runCommand(lanCommands, base, args)
+}
+
+func lanListCommand(base string, args []string) error {
+	set := flag.NewFlagSet("lan list", flag.ContinueOnError)
+	wait := set.Duration("wait", LAN_LISTEN_TIME, "how long to listen for announcements")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errors.New("expected no arguments")
+	}
+
+	worlds, err := discoverLanWorlds(*wait)
+	if err != nil {
+		return err
+	}
+	if len(worlds) == 0 {
+		fmt.Println("No LAN worlds were found")
+		return nil
+	}
+	for i := range worlds {
+		fmt.Printf("%d. %s (%s)\n", i+1, worlds[i].Motd, worlds[i].Address)
+	}
+	return nil
+}
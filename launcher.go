@@ -3,17 +3,27 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"runtime"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 //goland:noinspection GoSnakeCaseUsage
 const (
+	LAUNCHER_NAME    string = "go-launcher"
+	LAUNCHER_VERSION string = "0.0.0"
+	LAUNCHER_URL     string = "https://github.com/gudenau/go-launcher"
+
 	URL_VERSION_MANIFEST string = "https://piston-meta.mojang.com/mc/game/version_manifest_v2.json"
 	URL_RESOURCES        string = "https://resources.download.minecraft.net/"
+	URL_ADOPTIUM_API     string = "https://api.adoptium.net/v3/"
+	URL_LIBRARIES        string = "https://libraries.minecraft.net/"
+	URL_MAVEN_CENTRAL    string = "https://repo1.maven.org/maven2/"
 )
 
 type VersionInfo struct {
@@ -34,6 +44,10 @@ func (this *VersionInfo) hash() *string {
 	return &this.Sha1
 }
 
+func (this *VersionInfo) size() uint64 {
+	return 0
+}
+
 type VersionManifest struct {
 	Latest struct {
 		Release  string `json:"release"`
@@ -69,20 +83,17 @@ func testRules(rules []Rule, features map[string]bool) bool {
 }
 
 func (this *Rule) testRule(features map[string]bool) bool {
+	// Features the launcher does not know count as turned off, see checkRuleFeatures
 	for ruleFeature := range this.Features {
-		value, ok := features[ruleFeature]
-		if !ok {
-			return false
-		}
-		if value != this.Features[ruleFeature] {
+		if features[ruleFeature] != this.Features[ruleFeature] {
 			return false
 		}
 	}
 
-	if this.Os.Arch != "" && runtime.GOARCH != this.Os.Arch {
+	if this.Os.Arch != "" && mojangArch() != this.Os.Arch {
 		return false
 	}
-	if this.Os.Name != "" && runtime.GOOS != this.Os.Name {
+	if this.Os.Name != "" && mojangOsName() != this.Os.Name {
 		return false
 	}
 
@@ -104,12 +115,53 @@ func (this *Artifact) hash() *string {
 	return &this.Sha1
 }
 
+func (this *Artifact) size() uint64 {
+	return this.Size
+}
+
 type Library struct {
 	Downloads struct {
-		Artifact Artifact `json:"artifact"`
+		Artifact    Artifact            `json:"artifact"`
+		Classifiers map[string]Artifact `json:"classifiers"`
 	}
 	Name  string `json:"name"`
 	Rules []Rule `json:"rules"`
+	// Profiles of mod loaders only name their libraries, the artifact is found by its maven coordinate in the
+	// repository at the URL, the configured ones or the one of Mojang. The hash and size are optional.
+	Url  string `json:"url"`
+	Sha1 string `json:"sha1"`
+	Size uint64 `json:"size"`
+	// The classifiers of the natives of old versions, keyed by the operating system.
+	Natives map[string]string `json:"natives"`
+	Extract struct {
+		Exclude []string `json:"exclude"`
+	} `json:"extract"`
+}
+
+// Returns the artifact of a library, resolving the maven coordinate of its name when there are no downloads. Returns
+// nil when the library has no artifact, like the ones of old versions that only hold natives.
+func (this *Library) artifact() (*Artifact, error) {
+	if this.Downloads.Artifact.Url != "" {
+		return &this.Downloads.Artifact, nil
+	}
+	if this.Name == "" || len(this.Natives) > 0 {
+		return nil, nil
+	}
+
+	path, err := mavenPath(this.Name)
+	if err != nil {
+		return nil, errors.Join(errors.New("library has neither downloads nor a valid name"), err)
+	}
+	repository := this.Url
+	if repository == "" {
+		repository = URL_LIBRARIES
+	}
+	return &Artifact{
+		Path: path,
+		Sha1: this.Sha1,
+		Size: this.Size,
+		Url:  strings.TrimSuffix(repository, "/") + "/" + path,
+	}, nil
 }
 
 type Argument struct {
@@ -123,21 +175,26 @@ func (this *Argument) UnmarshalJSON(bytes []byte) error {
 	if err != nil {
 		return err
 	}
-	switch raw.(type) {
+	switch value := raw.(type) {
 	case string:
 		{
-			this.Value = append(this.Value, raw.(string))
+			this.Value = append(this.Value, value)
 		}
 
 	case map[string]interface{}:
 		{
-			object := raw.(map[string]interface{})
-			rawRules, ok := object["rules"]
+			rawRules, ok := value["rules"]
 			if ok {
-				rules := rawRules.([]interface{})
+				rules, ok := rawRules.([]interface{})
+				if !ok {
+					return errors.New("rules of argument were not a list")
+				}
 				ruleCount := len(rules)
 				for i := 0; i < ruleCount; i++ {
-					rawRule := rules[i].(map[string]interface{})
+					rawRule, ok := rules[i].(map[string]interface{})
+					if !ok {
+						return errors.New("rule of argument was not an object")
+					}
 					var rule Rule
 
 					rule.Action, ok = rawRule["action"].(string)
@@ -173,22 +230,30 @@ func (this *Argument) UnmarshalJSON(bytes []byte) error {
 				}
 			}
 
-			rawValue, ok := object["value"]
+			rawValue, ok := value["value"]
 			if ok {
-				switch rawValue.(type) {
+				switch rawValue := rawValue.(type) {
 				case string:
 					{
-						this.Value = append(this.Value, rawValue.(string))
+						this.Value = append(this.Value, rawValue)
 					}
 
 				case []interface{}:
 					{
-						rawValues := rawValue.([]interface{})
-						valueCount := len(rawValues)
+						valueCount := len(rawValue)
 						for i := 0; i < valueCount; i++ {
-							this.Value = append(this.Value, rawValues[i].(string))
+							text, ok := rawValue[i].(string)
+							if !ok {
+								return errors.New(fmt.Sprintf("value of argument was not a string: %v", rawValue[i]))
+							}
+							this.Value = append(this.Value, text)
 						}
 					}
+
+				default:
+					{
+						return errors.New(fmt.Sprintf("can't handle argument value JSON: %s", string(bytes)))
+					}
 				}
 			} else {
 				return errors.New("rule had no value")
@@ -219,6 +284,10 @@ func (this *AssetIndex) hash() *string {
 	return &this.Sha1
 }
 
+func (this *AssetIndex) size() uint64 {
+	return this.Size
+}
+
 type Manifest struct {
 	Arguments struct {
 		Game []Argument `json:"game"`
@@ -248,13 +317,61 @@ type Manifest struct {
 		} `json:"file"`
 		Type string `json:"type"`
 	} `json:"logging"`
-	MainClass              string `json:"mainClass"`
+	MainClass string `json:"mainClass"`
+	// Versions older than 1.13 have the arguments of the game in one string instead of arguments.
+	MinecraftArguments     string `json:"minecraftArguments"`
 	MinimumLauncherVersion uint32 `json:"minimumLauncherVersion"`
 	ReleaseTime            string `json:"releaseTime"`
 	Time                   string `json:"time"`
 	Type                   string `json:"type"`
 }
 
+// Returns the major version of Java a version needs. Versions older than 1.7.10 don't say, they run on Java 8 like
+// the official launcher runs them.
+func (this *Manifest) javaVersion() uint32 {
+	if this.JavaVersion.MajorVersion == 0 {
+		return 8
+	}
+	return this.JavaVersion.MajorVersion
+}
+
+// Returns the JVM arguments of a version. Versions older than 1.13 don't have any, the JVM gets the natives and the
+// classpath like the official launcher passes them.
+func (this *Manifest) jvmArguments() []Argument {
+	if len(this.Arguments.Jvm) == 0 && this.MinecraftArguments != "" {
+		return []Argument{
+			{
+				Value: []string{"-Djava.library.path=${natives_directory}", "-cp", "${classpath}"},
+			},
+		}
+	}
+	return this.Arguments.Jvm
+}
+
+// Returns the game arguments of a version, split from the single string of versions older than 1.13. Those versions
+// know the size of the window too, they only don't list it.
+func (this *Manifest) gameArguments() []Argument {
+	if len(this.Arguments.Game) == 0 && this.MinecraftArguments != "" {
+		return []Argument{
+			{
+				Value: strings.Fields(this.MinecraftArguments),
+			},
+			{
+				Value: []string{"--width", "${resolution_width}", "--height", "${resolution_height}"},
+				Rules: []Rule{
+					{
+						Action: "allow",
+						Features: map[string]bool{
+							"has_custom_resolution": true,
+						},
+					},
+				},
+			},
+		}
+	}
+	return this.Arguments.Game
+}
+
 type AssetEntry struct {
 	Hash string `json:"hash"`
 	Size uint64 `json:"size"`
@@ -268,39 +385,185 @@ func (this *AssetEntry) hash() *string {
 	return &this.Hash
 }
 
+func (this *AssetEntry) size() uint64 {
+	return this.Size
+}
+
 type AssetManifest struct {
 	Objects map[string]AssetEntry `json:"objects"`
 }
 
+// Downloads the JSON of a version into the store unless it is there already and reads it, launching a version that
+// was installed before does not need to ask Mojang for it again.
+func loadVersionJson(base string, version *VersionInfo, manifest *Manifest) error {
+	path := "versions/" + version.Id + ".json"
+	err := storeBackend.download(path, version.url(), version.hash(), version.size(), nil)
+	if err != nil {
+		return errors.Join(errors.New("failed to download manifest"), err)
+	}
+
+	data, err := readStoreFile(path)
+	if err != nil {
+		return errors.Join(errors.New("failed to read manifest"), err)
+	}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return errors.Join(errors.New("failed to parse "+path), err)
+	}
+	err = checkUnknownFields("version "+version.Id, data, manifest)
+	if err != nil {
+		return errors.Join(errors.New("failed to read manifest"), err)
+	}
+	return nil
+}
+
 func downloadVersionManifest(manifest *VersionManifest) error {
 	return downloadJsonRaw(URL_VERSION_MANIFEST, nil, manifest)
 }
 
-func downloadManifest(versions *VersionManifest, version string, manifest *Manifest) error {
+func findVersion(versions *VersionManifest, version string) (*VersionInfo, error) {
 	for i := range versions.Versions {
-		current := versions.Versions[i]
-		if current.Id == version {
-			return downloadJson(&current, manifest)
+		if versions.Versions[i].Id == version {
+			return &versions.Versions[i], nil
 		}
 	}
-	return errors.New("failed to find version manifest url for version " + version)
+	return nil, errors.New("failed to find version manifest url for version " + version)
 }
 
-func jankyFormat(argument string, environment map[string]string) string {
-	for {
-		start := strings.Index(argument, "${")
-		if start == -1 {
-			return argument
-		}
-
-		end := strings.Index(argument, "}")
-		value, ok := environment[argument[start+2:end]]
-		if !ok { //TODO Graceful error handling
-			return argument
-		}
+// Finds the manifest of the version an instance uses. Instances with a lockfile always use the manifest it recorded.
+func resolveManifest(base string, instance *Instance) (*VersionInfo, error) {
+	lockfile, err := loadLockfile(base, instance)
+	if err != nil {
+		return nil, err
+	}
+	if lockfile != nil {
+		fmt.Printf("Using version %s from the lockfile of %s\n", lockfile.Manifest.Id, instance.Name)
+		return &lockfile.Manifest, nil
+	}
 
-		argument = argument[:start] + value + argument[end+1:]
+	var versionManifest VersionManifest
+	err = downloadVersionManifest(&versionManifest)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to download version manifest"), err)
 	}
+	return findVersion(&versionManifest, resolveVersion(&versionManifest, instance.Version))
+}
+
+var commands = []Command{
+	{
+		Name:        "launch",
+		Usage:       "[instance] [--join-lan <world>] [--skip-ping] [--ignore-world-versions] [--xmx <size>] [--xms <size>] [--width <pixels> --height <pixels>] [--fullscreen] [--console] [--print-command|--dry-run [--normalize-paths]] [-- <game arguments>]",
+		Description: "Downloads everything an instance needs and starts the game, defaults to the \"default\" instance",
+		Run:         launchCommand,
+	},
+	{
+		Name:        "instance",
+		Usage:       "<create|edit|share|info|import-vanilla|delete> ...",
+		Description: "Manages instances",
+		Run:         instanceCommand,
+	},
+	{
+		Name:        "mods",
+		Usage:       "<list|enable|disable|blame|bisect> ...",
+		Description: "Manages the mods of an instance",
+		Run:         modsCommand,
+	},
+	{
+		Name:        "profile",
+		Usage:       "<create|list|launch> ...",
+		Description: "Manages server profiles that pair an instance with a server, its resource pack and mods",
+		Run:         profileCommand,
+	},
+	{
+		Name:        "audit",
+		Usage:       "<endpoints>",
+		Description: "Shows what the launcher talks to",
+		Run:         auditCommand,
+	},
+	{
+		Name:        "store",
+		Usage:       "<gc|check-index> ...",
+		Description: "Manages the library and asset store shared by all instances",
+		Run:         storeCommand,
+	},
+	{
+		Name:        "library",
+		Usage:       "<install> ...",
+		Description: "Installs maven artifacts into the shared store by hand",
+		Run:         libraryCommand,
+	},
+	{
+		Name:        "java",
+		Usage:       "<list|prune> ...",
+		Description: "Manages the JVMs downloaded from Adoptium",
+		Run:         javaCommand,
+	},
+	{
+		Name:        "pack",
+		Usage:       "<import|technic|atlauncher|ftb> ...",
+		Description: "Imports mod packs",
+		Run:         packCommand,
+	},
+	{
+		Name:        "import",
+		Usage:       "<detect> ...",
+		Description: "Imports the instances of other launchers",
+		Run:         importCommand,
+	},
+	{
+		Name:        "bundle",
+		Usage:       "<export|import> ...",
+		Description: "Moves versions to machines without internet",
+		Run:         bundleCommand,
+	},
+	{
+		Name:        "backup",
+		Usage:       "<create|list|restore|prune> ...",
+		Description: "Backs up the worlds of instances",
+		Run:         backupCommand,
+	},
+	{
+		Name:        "lockfile",
+		Usage:       "<create|install|remove> ...",
+		Description: "Pins an instance to the exact files it was installed with",
+		Run:         lockfileCommand,
+	},
+	{
+		Name:        "doctor",
+		Usage:       "",
+		Description: "Checks the setup of the launcher for common problems",
+		Run:         doctorCommand,
+	},
+	{
+		Name:        "support",
+		Usage:       "<bundle> ...",
+		Description: "Helps with reporting problems",
+		Run:         supportCommand,
+	},
+	{
+		Name:        "config",
+		Usage:       "<encrypt|decrypt> ...",
+		Description: "Protects sections of the config with a passphrase",
+		Run:         configCommand,
+	},
+	{
+		Name:        "lan",
+		Usage:       "<list> ...",
+		Description: "Finds worlds opened to LAN on the local network",
+		Run:         lanCommand,
+	},
+	{
+		Name:        "ping",
+		Usage:       "<host[:port]> [--json] [--protocol <version>]",
+		Description: "Shows the MOTD, version, players and latency of a server",
+		Run:         pingCommand,
+	},
+	{
+		Name:        "nbt",
+		Usage:       "<print> ...",
+		Description: "Inspects NBT files of the game",
+		Run:         nbtCommand,
+	},
 }
 
 func main() {
@@ -310,72 +573,530 @@ func main() {
 		return
 	}
 
-	var versionManifest VersionManifest
-	err = downloadVersionManifest(&versionManifest)
+	err = loadConfig(base)
 	if err != nil {
-		fmt.Printf("Failed to download version manifest: %s\n", err)
-		return
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	storeBackend = newFileStoreBackend(base)
+
+	set := flag.NewFlagSet("launcher", flag.ContinueOnError)
+	proxy := set.String("proxy", "", "the proxy every request goes through, overrides network.proxy of the config")
+	var limit *Rate
+	set.Func("limit", "the most bandwidth downloads may use, like 5MB/s, overrides network.rateLimit of the config", func(value string) error {
+		rate, err := parseRate(value)
+		limit = &rate
+		return err
+	})
+	set.BoolVar(&hashCache.fullVerify, "full-verify", false, "hash every file again instead of trusting the hash cache")
+	schema := set.String("schema", "", "how unknown fields and rule features of manifests are handled, "+SCHEMA_LENIENT+" or "+SCHEMA_STRICT+", overrides schema of the config")
+	reportUnknown := set.String("report-unknown", "", "write the fields and rule features of manifests the launcher did not know to a JSON file")
+	// Only meant for integration tests, so it is left out of the usage
+	metaFixture := set.String("meta-fixture", "", "serve every request from the files of a directory, see MetaFixture")
+	set.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: launcher [--proxy <url>] [--limit <rate>] [--full-verify] [--schema <mode>] [--report-unknown <file>] <command> ...")
+		visible := flag.NewFlagSet("launcher", flag.ContinueOnError)
+		set.VisitAll(func(option *flag.Flag) {
+			if option.Name != "meta-fixture" {
+				visible.Var(option.Value, option.Name, option.Usage)
+			}
+		})
+		visible.PrintDefaults()
+		printCommands(commands)
+	}
+	err = set.Parse(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+
+	// The config commands have to run to lift restrictions that no longer match
+	err = checkConfigSections(base)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		if len(set.Args()) == 0 || set.Args()[0] != "config" {
+			os.Exit(1)
+		}
+	}
+
+	var fixture *MetaFixture
+	if *metaFixture != "" {
+		fixture, err = serveMetaFixture(*metaFixture)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(2)
+		}
+		fixture.apply()
+	}
+
+	// The remote config is downloaded with the network settings of the local one, the command line overrides both
+	err = loadRemoteConfig(base)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	if limit != nil {
+		config.Network.RateLimit = *limit
+	}
+	if *schema != "" {
+		config.Schema = *schema
+	}
+	if *proxy != "" || *schema != "" {
+		if *proxy != "" {
+			config.Network.Proxy = *proxy
+		}
+		err = config.validate()
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(2)
+		}
+	}
+	if fixture != nil {
+		fixture.apply()
+	}
+
+	setupNetwork()
+	loadHashCache(base)
+	loadProvenance(base)
+	err = createConfigInstances(base)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+	}
+	handleInterrupts()
+	if isInteractive() {
+		progressReporter = &ConsoleProgressReporter{}
+	}
+
+	args := set.Args()
+	if len(args) == 0 {
+		args = []string{"launch"}
+	}
+
+	err = runCommand(commands, base, args)
+	saveErr := provenance.save()
+	if saveErr != nil {
+		fmt.Printf("%s\n", saveErr)
+	}
+	if *reportUnknown != "" {
+		reportErr := schemaReport.write(*reportUnknown)
+		if reportErr != nil {
+			fmt.Printf("%s\n", reportErr)
+		}
+	}
+	if err != nil {
+		var exit *ExitCodeError
+		if errors.As(err, &exit) {
+			os.Exit(exit.Code)
+		}
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+}
+
+// Returned by commands that want the launcher to exit with a specific code, like the one of the game.
+type ExitCodeError struct {
+	Code int
+}
+
+func (this *ExitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", this.Code)
+}
+
+// Turns the exit code of the game into the result of a command.
+func exitWith(code int, err error) error {
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return &ExitCodeError{
+			Code: code,
+		}
+	}
+	return nil
+}
+
+func launchCommand(base string, args []string) error {
+	set := flag.NewFlagSet("launch", flag.ContinueOnError)
+	lan := set.String("join-lan", "", "a LAN world to join, by its number in \"lan list\", its address or its name")
+	options := &LaunchOptions{}
+	bindHeapFlags(set, &options.MaxHeap, &options.MinHeap)
+	bindWindowFlags(set, options)
+	set.BoolVar(&options.SkipPing, "skip-ping", false, "join the server without checking that it is up and runs the version of the instance")
+	set.BoolVar(&options.IgnoreWorldVersions, "ignore-world-versions", false, "start the game even when worlds were saved by a newer version")
+	set.BoolVar(&options.Console, "console", false, "keep the console window of Java on Windows for debugging")
+	set.BoolVar(&options.PrintCommand, "print-command", false, "print the java command line, one argument per line, instead of starting the game")
+	set.BoolVar(&options.DryRun, "dry-run", false, "download and verify everything, then print the version, working directory, environment and command line instead of starting the game")
+	noRestart := set.Bool("no-restart", false, "don't restart the game when it crashes, whatever the restart policy says")
+	set.BoolVar(&options.NormalizePaths, "normalize-paths", false, "replace the directories of the launcher in the printed command line with placeholders")
+	args, options.GameArgs = splitPassThrough(args)
+	args, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if options.NormalizePaths && !options.PrintCommand && !options.DryRun {
+		return errors.New("--normalize-paths only works with --print-command or --dry-run")
+	}
+	if options.PrintCommand && options.DryRun {
+		return errors.New("--print-command and --dry-run can not be used together")
+	}
+	// A dry run skips everything starting the game would, like printing the command line does
+	options.PrintCommand = options.PrintCommand || options.DryRun
+
+	name := "default"
+	if len(args) > 1 {
+		return errors.New("expected at most one instance name")
+	}
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	var instance *Instance
+	if name == "default" && !fileExists(instanceDir(base, name)+"/instance.json") {
+		instance = &Instance{
+			Name:    name,
+			Version: VERSION_LATEST_RELEASE,
+		}
+		err = saveInstance(base, instance)
+	} else {
+		instance, err = loadInstance(base, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *lan != "" {
+		options.QuickPlayServer, err = joinLanWorld(*lan)
+		if err != nil {
+			return err
+		}
+	}
+	return exitWith(launchWithRestarts(base, instance, options, *noRestart))
+}
+
+// Settings for a single launch of an instance.
+type LaunchOptions struct {
+	// A server to join right away as host[:port], empty to open the main menu.
+	QuickPlayServer string
+	// Only downloads everything the game needs without starting it.
+	PrepareOnly bool
+	// Override the heap sizes of the instance and the config for this launch.
+	MaxHeap string
+	MinHeap string
+	// Prints the command line the game would be started with instead of starting it, see normalizeCommand for the
+	// placeholders paths are replaced with.
+	PrintCommand   bool
+	NormalizePaths bool
+	// Like PrintCommand, but prints the working directory and environment of the game too, see printDryRun. Implies
+	// PrintCommand.
+	DryRun bool
+	// Starts the game with a console window on Windows, see gameJavaExecutable.
+	Console bool
+	// Joins QuickPlayServer without pinging it first, see checkQuickPlayServer.
+	SkipPing bool
+	// Starts the game even when worlds were saved by a newer version, see checkWorldVersions.
+	IgnoreWorldVersions bool
+	// Override the window of the config for this launch, see launchWindow.
+	Width      uint32
+	Height     uint32
+	Fullscreen bool
+	// Passed to the game after every other argument, or to the server after "nogui".
+	GameArgs []string
+	// Called once the process of the game or server started, see launchWithRestarts.
+	Started func()
+	// A server profile whose files are installed into the directory the game runs in, the session of a locked instance
+	// instead of its template. See installProfileFiles.
+	Profile *ServerProfile
+}
+
+// Downloads everything required to run an instance and runs it. Returns the exit code of the game.
+func launch(base string, instance *Instance, options *LaunchOptions) (int, error) {
+	if instance.Server {
+		return launchServer(base, instance, options)
+	}
+	warnLoaderNotInstalled(instance)
+
+	var required *Instance
+	if instance.Requires != "" {
+		var err error
+		required, err = loadRequiredServer(base, instance)
+		if err != nil {
+			return 0, err
+		}
+		if options.QuickPlayServer == "" {
+			joined := *options
+			joined.QuickPlayServer = serverAddress(base, required)
+			options = &joined
+		}
+	}
+
+	conditional, err := applicableChanges(instance)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = runPlugins(base, &PluginEvent{
+		Event:    PLUGIN_PRE_RESOLVE,
+		Instance: instance.Name,
+		Version:  instance.Version,
+		GameDir:  instance.gameDir(base),
+	}, conditional.DisablePlugins)
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := resolveManifest(base, instance)
+	if err != nil {
+		return 0, err
 	}
 
 	var manifest Manifest
-	err = downloadManifest(&versionManifest, versionManifest.Latest.Release, &manifest)
+	err = loadVersionJson(base, version, &manifest)
 	if err != nil {
-		fmt.Printf("Failed to download manifest: %s\n", err)
-		return
+		return 0, err
+	}
+
+	window, err := launchWindow(options)
+	if err != nil {
+		return 0, err
 	}
 
 	features := map[string]bool{}
 	features["is_demo_user"] = false
-	features["has_custom_resolution"] = true
+	features["has_custom_resolution"] = window.Width != 0
 	features["has_quick_plays_support"] = false
 	features["is_quick_play_singleplayer"] = false
-	features["is_quick_play_multiplayer"] = false
+	features["is_quick_play_multiplayer"] = options.QuickPlayServer != ""
 	features["is_quick_play_realms"] = false
+	err = checkRuleFeatures(&manifest, features)
+	if err != nil {
+		return 0, err
+	}
 
 	var javaPath string
-	javaPath, err = downloadJdk(base, manifest.JavaVersion.MajorVersion)
+	javaPath, err = provideInstanceRuntime(base, instance, manifest.javaVersion(), manifest.JavaVersion.Component)
 	if err != nil {
-		fmt.Printf("Failed to download Java %d: %s", manifest.JavaVersion.MajorVersion, err)
-		return
+		return 0, err
+	}
+	// The game runs in its game directory, a relative path to Java would be looked up there
+	javaPath, err = filepath.Abs(javaPath)
+	if err != nil {
+		return 0, err
 	}
 
-	classpath, err := downloadLibraries(base, manifest.Libraries, features)
+	var classpath []string
+	var natives []NativeLibrary
+	var assets []string
+	var logConfig string
+	jar := "client/" + manifest.Id + ".jar"
+	err = runPhases(func() error {
+		var err error
+		classpath, natives, err = downloadLibraries(base, manifest.Libraries, features)
+		if err != nil {
+			return errors.Join(errors.New("failed to download libraries"), err)
+		}
+		return nil
+	}, func() error {
+		var err error
+		assets, err = downloadAssets(base, manifest)
+		if err != nil {
+			return errors.Join(errors.New("failed to download assets"), err)
+		}
+		return nil
+	}, func() error {
+		client := manifest.Downloads["client"]
+		batch := downloadPool.batch("Client")
+		batch.submit(func() error {
+			return storeBackend.download(jar, client.Url, &client.Sha1, client.Size, batch.progress)
+		})
+		err := batch.wait()
+		if err != nil {
+			return errors.Join(errors.New("failed to download client"), err)
+		}
+		logConfig, err = downloadLogConfig(base, &manifest)
+		return err
+	})
 	if err != nil {
-		fmt.Printf("Failed to download libraries: %s", err)
-		return
+		return 0, err
 	}
 
-	err = downloadAssets(base, manifest)
+	jar = storeBackend.local(jar)
+	references := append(append([]string{storeBackend.local("versions/" + manifest.Id + ".json"), jar}, classpath...), assets...)
+	if logConfig != "" {
+		references = append(references, logConfig)
+	}
+	for i := range natives {
+		references = append(references, natives[i].Path)
+	}
+	if !options.PrintCommand {
+		err = saveReferences(base, instance, references)
+		if err != nil {
+			return 0, err
+		}
+	}
+	downloadSummary.print()
+	err = hashCache.save()
 	if err != nil {
-		fmt.Printf("Failed to download assets: %s", err)
-		return
+		fmt.Printf("%s\n", err)
+	}
+	// The game may run for hours, what was downloaded for it is recorded before it starts
+	err = provenance.save()
+	if err != nil {
+		fmt.Printf("%s\n", err)
+	}
+
+	if config.VanillaDirectory != "" {
+		err = updateVanillaProfile(base, instance, true)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if options.PrepareOnly {
+		return 0, nil
 	}
 
-	jar := base + "/client/" + manifest.Id + ".jar"
-	hash := manifest.Downloads["client"].Sha1
-	err = downloadFileRaw(jar, manifest.Downloads["client"].Url, &hash)
+	if required != nil && !options.PrintCommand {
+		server, err := startRequiredServer(base, required, instance.ServerShutdown)
+		if err != nil {
+			return 0, err
+		}
+		if server != nil && instance.ServerShutdown != SERVER_SHUTDOWN_KEEP {
+			defer server.stop()
+		}
+	}
+	if options.QuickPlayServer != "" && !options.SkipPing && !options.PrintCommand {
+		err = checkQuickPlayServer(jar, options.QuickPlayServer)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The game runs in its game directory, the paths passed to it must not be relative to the one of the launcher
+	gameDir, err := filepath.Abs(instance.gameDir(base))
 	if err != nil {
-		fmt.Printf("Failed to download client: %s", err)
-		return
+		return 0, err
+	}
+	// Printing the command line must not change the instance, the steps that write to it are skipped
+	if !options.PrintCommand {
+		err = createParents(gameDir)
+		if err != nil {
+			return 0, errors.Join(errors.New("failed to create game directory"), err)
+		}
+		err = checkDiskBudget(base, instance)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if instance.Locked && !options.PrintCommand {
+		var cleanup func()
+		gameDir, cleanup, err = prepareSession(base, instance)
+		if err != nil {
+			return 0, err
+		}
+		defer cleanup()
+	}
+	if instance.SharesWith != "" && !instance.Locked && !options.PrintCommand {
+		var cleanup func()
+		gameDir, cleanup, err = prepareSharedSession(base, instance)
+		if err != nil {
+			return 0, err
+		}
+		defer cleanup()
+	}
+	if options.Profile != nil && !options.PrintCommand && !options.DryRun {
+		err = installProfileFiles(gameDir, options.Profile)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !options.PrintCommand {
+		err = applyLocaleOptions(gameDir, instance)
+		if err != nil {
+			return 0, err
+		}
+		err = prepareSaves(gameDir, instance, &manifest)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			err := restoreSaves(gameDir)
+			if err != nil {
+				fmt.Printf("%s\n", err)
+			}
+		}()
+	}
+	if !options.PrintCommand && !options.IgnoreWorldVersions {
+		err = checkWorldVersions(gameDir, jar, &manifest)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if instance.HeapDumps && !options.PrintCommand {
+		err = createParents(heapDumpDir(base, instance))
+		if err != nil {
+			return 0, errors.Join(errors.New("failed to create heap dump directory"), err)
+		}
+		err = pruneHeapDumps(base, instance)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if !options.PrintCommand {
+		disabledMods, err := disableConditionalMods(gameDir, conditional.DisableMods)
+		defer func() {
+			err := restoreConditionalMods(gameDir, disabledMods)
+			if err != nil {
+				fmt.Printf("Failed to enable the mods of %s again: %s\n", instance.Name, err)
+			}
+		}()
+		if err != nil {
+			return 0, errors.Join(errors.New("failed to disable mods"), err)
+		}
+	}
+
+	plugins, err := runPlugins(base, &PluginEvent{
+		Event:    PLUGIN_PRE_LAUNCH,
+		Instance: instance.Name,
+		Version:  manifest.Id,
+		GameDir:  gameDir,
+	}, conditional.DisablePlugins)
+	if err != nil {
+		return 0, err
+	}
+
+	userArguments, err := userJvmArguments(instance, options, manifest.javaVersion())
+	if err != nil {
+		return 0, err
 	}
 
 	var command []string
 	command = nil
 
-	cp := jar
-	for i := range classpath {
-		cp = cp + ":" + classpath[i]
+	cp := joinClasspath(append([]string{jar}, classpath...))
+
+	// The natives directory only exists while the game runs, a printed command line has the pattern of its name
+	nativesDir := os.TempDir() + "/" + LAUNCHER_NAME + "-natives-*"
+	if !options.PrintCommand {
+		var cleanup func()
+		nativesDir, cleanup, err = prepareNativesDir(manifest.Id, natives)
+		if err != nil {
+			return 0, err
+		}
+		defer cleanup()
 	}
 
+	// Paths are handed to Java in the form of the operating system, the classpath is joined by joinClasspath
 	environment := map[string]string{}
-	environment["natives_directory"] = "natives"
-	environment["launcher_name"] = "PickAName"
-	environment["launcher_version"] = "0.0.0"
+	environment["natives_directory"] = filepath.FromSlash(nativesDir)
+	environment["launcher_name"] = config.Branding.Name
+	environment["launcher_version"] = config.Branding.Version
 	environment["classpath"] = cp
+	// Used by the version JSONs of loaders that put libraries on the module path
+	environment["library_directory"] = filepath.FromSlash(libraryDir(base))
+	environment["classpath_separator"] = string(os.PathListSeparator)
 	environment["auth_player_name"] = "todo_name"
 	environment["version_name"] = manifest.Id
-	environment["game_directory"] = "run"
-	environment["assets_root"] = base + "/assets"
+	environment["game_directory"] = filepath.FromSlash(gameDir)
+	environment["assets_root"] = filepath.FromSlash(assetsDir(base))
 	environment["assets_index_name"] = manifest.AssetIndex.Id
 	environment["auth_uuid"] = "00000000-0000-0000-0000-000000000000"
 	environment["clientid"] = "0"
@@ -383,65 +1104,253 @@ func main() {
 	environment["auth_access_token"] = "0"
 	environment["user_type"] = "asdf"
 	environment["version_type"] = manifest.Type
-	environment["resolution_width"] = "800"
-	environment["resolution_height"] = "800"
+	environment["resolution_width"] = strconv.FormatUint(uint64(window.Width), 10)
+	environment["resolution_height"] = strconv.FormatUint(uint64(window.Height), 10)
 	environment["quickPlayPath"] = "asdf"
 	environment["quickPlaySingleplayer"] = "asdf"
-	environment["quickPlayMultiplayer"] = "asdf"
+	environment["quickPlayMultiplayer"] = options.QuickPlayServer
 	environment["quickPlayRealms"] = "asdf"
-
-	for index := range manifest.Arguments.Jvm {
-		argument := manifest.Arguments.Jvm[index]
+	// Only used by versions older than 1.13
+	environment["auth_session"] = "0"
+	environment["user_properties"] = "{}"
+	environment["game_assets"] = filepath.FromSlash(assetsDir(base))
+
+	var unknownVariables []string
+	jvmArguments := manifest.jvmArguments()
+	for index := range jvmArguments {
+		argument := jvmArguments[index]
 		if testRules(argument.Rules, features) {
 			for o := range argument.Value {
-				command = append(command, jankyFormat(argument.Value[o], environment))
+				formatted, unknown := formatTemplate(argument.Value[o], environment)
+				command = append(command, formatted)
+				unknownVariables = append(unknownVariables, unknown...)
 			}
 		}
 	}
 
+	// The argument names the configuration as ${path}, like the official launcher fills it in
+	if logConfig != "" {
+		formatted, _ := formatTemplate(manifest.Logging["client"].Argument, map[string]string{
+			"path": filepath.FromSlash(logConfig),
+		})
+		command = append(command, formatted)
+	}
+	command = append(command, localeArguments(instance)...)
+	command = append(command, heapDumpArguments(base, instance)...)
+	command = append(command, userArguments...)
+	command = append(command, conditional.JvmArgs...)
+	command = append(command, plugins.JvmArgs...)
 	command = append(command, manifest.MainClass)
 
-	for index := range manifest.Arguments.Game {
-		argument := manifest.Arguments.Game[index]
+	gameArguments := manifest.gameArguments()
+	for index := range gameArguments {
+		argument := gameArguments[index]
 		if testRules(argument.Rules, features) {
 			for o := range argument.Value {
-				command = append(command, jankyFormat(argument.Value[o], environment))
+				formatted, unknown := formatTemplate(argument.Value[o], environment)
+				command = append(command, formatted)
+				unknownVariables = append(unknownVariables, unknown...)
 			}
 		}
 	}
+	err = checkUnknownVariables(&manifest, unknownVariables)
+	if err != nil {
+		return 0, err
+	}
 
-	var java string
-	if runtime.GOOS == "windows" {
-		java = javaPath + "/bin/javaw.exe"
-	} else {
-		java = javaPath + "/bin/java"
+	if instance.Title != "" {
+		title, err := windowTitle(instance, &manifest)
+		if err != nil {
+			return 0, err
+		}
+		command = append(command, "--title", title)
+	}
+	if window.Fullscreen {
+		command = append(command, "--fullscreen")
+	}
+	if options.QuickPlayServer != "" && !supportsQuickPlay(&manifest) {
+		command = append(command, legacyServerArguments(options.QuickPlayServer)...)
+	}
+	command = append(command, conditional.GameArgs...)
+	command = append(command, plugins.GameArgs...)
+	command = append(command, config.GameArgs...)
+	command = append(command, options.GameArgs...)
+
+	java := gameJavaExecutable(javaPath, options.Console)
+
+	if options.DryRun {
+		executable, arguments := wrapCommand(instance, java, command)
+		printDryRun(base, javaPath, gameDir, &manifest, append([]string{executable}, arguments...), gameEnvironment(instance, plugins), options.NormalizePaths)
+		return 0, nil
+	}
+	if options.PrintCommand {
+		executable, arguments := wrapCommand(instance, java, command)
+		printed := append([]string{executable}, arguments...)
+		if options.NormalizePaths {
+			printed = normalizeCommand(base, javaPath, gameDir, printed)
+		}
+		for i := range printed {
+			fmt.Println(printed[i])
+		}
+		return 0, nil
+	}
+
+	err = saveHostAudit(base)
+	if err != nil {
+		return 0, err
+	}
+	err = checkInterrupted()
+	if err != nil {
+		return 0, err
+	}
+
+	command, err = fitJavaArguments(base, instance, java, manifest.javaVersion(), command, cp)
+	if err != nil {
+		return 0, err
 	}
 
-	process := execute(java, command...)
-	process.Stdout = os.Stdout
-	process.Stderr = os.Stderr
-	result := process.Run()
+	record := &LaunchRecord{
+		Time:      time.Now(),
+		Version:   manifest.Id,
+		Java:      java,
+		Arguments: command,
+	}
+	watcher := &LogWatcher{}
+	// Only the id of the manifest is needed once the game runs
+	manifest = Manifest{
+		Id: manifest.Id,
+	}
+	releaseMemory()
+	process := executeWrapped(instance, java, command...)
+	process.Dir = gameDir
+	process.Env = processEnvironment(gameEnvironment(instance, plugins))
+	var output io.Writer = io.MultiWriter(os.Stdout, watcher)
+	// The logging configuration prints XML events, they are turned back into lines for the console and the watcher
+	var events *Log4jWriter
+	if logConfig != "" {
+		events = newLog4jWriter(output)
+		output = events
+	}
+	process.Stdout = output
+	process.Stderr = io.MultiWriter(os.Stderr, watcher)
+	// Children of the game holding on to its output must not keep the launcher waiting once the game is gone
+	process.WaitDelay = 5 * time.Second
+	result := process.Start()
 	if result == nil {
-		os.Exit(0)
-	} else {
-		os.Exit(result.(*exec.ExitError).ExitCode())
+		if options.Started != nil {
+			options.Started()
+		}
+		stop := watchStartup(process, watcher, time.Duration(config.StartupTimeout))
+		result = process.Wait()
+		stop()
+	}
+	if events != nil {
+		_ = events.flush()
+	}
+
+	exit, err := classifyExit(result, gameDir, record.Time)
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to run the game"), err)
+	}
+	exitCode := exit.Code
+	record.ExitCode = exitCode
+	record.Exit = exit.Kind
+	record.Duration = Duration(time.Since(record.Time))
+	saveLaunchRecord(base, instance, record)
+	_, _ = runPlugins(base, &PluginEvent{
+		Event:    PLUGIN_POST_EXIT,
+		Instance: instance.Name,
+		Version:  manifest.Id,
+		GameDir:  gameDir,
+		ExitCode: &exitCode,
+	}, conditional.DisablePlugins)
+	printCrashSummary(base, instance, gameDir, record.Time, exit, watcher)
+	err = archiveLogs(base, gameDir)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+	}
+	return exitCode, nil
+}
+
+// Tells the user what went wrong when the game did not exit cleanly: how it exited, the last lines it wrote and the
+// crash report it wrote during the launch, and collects what the crash left behind.
+func printCrashSummary(base string, instance *Instance, gameDir string, started time.Time, exit *GameExit, watcher *LogWatcher) {
+	if exit.Kind == GAME_EXIT_CLEAN && !watcher.outOfMemory {
+		return
+	}
+
+	fmt.Println(exit.describe())
+	extra := map[string][]byte{}
+	if watcher.hung {
+		if watcher.lastLine != "" {
+			fmt.Printf("The game hung while starting, the last thing it logged was: %s\n", watcher.lastLine)
+		} else {
+			fmt.Println("The game hung before it logged anything")
+		}
+		extra["output.log"] = []byte(watcher.output())
+		partial, err := os.ReadFile(logsDir(gameDir) + "/latest.log")
+		if err == nil {
+			extra["latest.log"] = partial
+		}
+	}
+	if exit.Kind != GAME_EXIT_CLEAN {
+		if !watcher.hung {
+			tail := crashTail(watcher, CRASH_TAIL_LINES)
+			fmt.Println("The last lines of the game were:")
+			for i := range tail {
+				fmt.Printf("    %s\n", tail[i])
+			}
+		}
+		report := newestCrashReport(gameDir)
+		if report != "" {
+			info, err := os.Stat(report)
+			if err == nil && !info.ModTime().Before(started) {
+				fmt.Printf("Crash report: %s\n", report)
+			}
+		}
+		bundle, err := collectCrashArtifacts(base, instance, gameDir, started, extra)
+		if err != nil {
+			fmt.Printf("Failed to collect the crash artifacts: %s\n", err)
+		} else if bundle != "" {
+			fmt.Printf("Crash artifacts: %s\n", bundle)
+		}
+	}
+	if watcher.outOfMemory {
+		fmt.Println("The game ran out of memory")
+		if instance.HeapDumps {
+			err := pruneHeapDumps(base, instance)
+			if err != nil {
+				fmt.Printf("%s\n", err)
+			}
+
+			dump := newestHeapDump(base, instance)
+			if dump != "" {
+				fmt.Printf("Heap dump: %s\n", dump)
+			}
+		}
 	}
 }
 
-func downloadAssets(base string, version Manifest) error {
-	jsonPath := base + "/assets/indexes/" + version.AssetIndex.Id + ".json"
-	err := downloadFile(jsonPath, &version.AssetIndex)
+// Downloads the asset index of a version and every object it references. Returns the paths of every file that
+// belongs to the assets of the version.
+func downloadAssets(base string, version Manifest) ([]string, error) {
+	jsonPath := "assets/indexes/" + version.AssetIndex.Id + ".json"
+	err := storeBackend.download(jsonPath, version.AssetIndex.url(), version.AssetIndex.hash(), version.AssetIndex.size(), nil)
 	if err != nil {
-		return errors.Join(errors.New("failed to download asset manifest"), err)
+		return nil, errors.Join(errors.New("failed to download asset manifest"), err)
 	}
 
 	var manifest AssetManifest
-	err = readJson(jsonPath, &manifest)
+	data, err := readStoreFile(jsonPath)
+	if err == nil {
+		err = json.Unmarshal(data, &manifest)
+	}
 	if err != nil {
-		return errors.Join(errors.New("failed to read asset manifest"), err)
+		return nil, errors.Join(errors.New("failed to read asset manifest"), err)
 	}
 
-	channel := make(chan error)
+	paths := []string{storeBackend.local(jsonPath)}
+	batch := downloadPool.batch("Assets")
 	downloaded := map[string]bool{}
 	for key := range manifest.Objects {
 		object := manifest.Objects[key]
@@ -450,30 +1359,34 @@ func downloadAssets(base string, version Manifest) error {
 		}
 
 		downloaded[object.Hash] = true
-		go func(base string, entry AssetEntry, channel chan error) {
-			file := entry.Hash[0:2] + "/" + entry.Hash
-			path := base + "/assets/objects/" + file
-			channel <- downloadFile(path, &entry)
-		}(base, object, channel)
+		path := "assets/objects/" + object.Hash[0:2] + "/" + object.Hash
+		paths = append(paths, storeBackend.local(path))
+		batch.submit(func() error {
+			return storeBackend.download(path, object.url(), object.hash(), object.size(), batch.progress)
+		})
 	}
 
-	err = nil
-	length := len(downloaded)
-	for i := 0; i < length; i++ {
-		err = errors.Join(err, <-channel)
+	err = batch.wait()
+	if err != nil {
+		return nil, err
 	}
 
-	return err
+	return paths, nil
 }
 
-func downloadLibraries(base string, libraries []Library, features map[string]bool) ([]string, error) {
+// Downloads the libraries of a version. Returns the classpath and the jars of the natives old versions list next to it.
+func downloadLibraries(base string, libraries []Library, features map[string]bool) ([]string, []NativeLibrary, error) {
 	length := len(libraries)
 	if length == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
+	libraries = substituteArm64Libraries(libraries)
+	length = len(libraries)
+
 	var classpath []string
-	channel := make(chan error)
+	var natives []NativeLibrary
+	batch := downloadPool.batch("Libraries")
 	for i := 0; i < length; i++ {
 		library := libraries[i]
 
@@ -481,22 +1394,60 @@ func downloadLibraries(base string, libraries []Library, features map[string]boo
 			continue
 		}
 
-		path := base + "/library/" + library.Downloads.Artifact.Path
-		classpath = append(classpath, path)
+		native, err := library.nativesArtifact()
+		if err != nil {
+			return nil, nil, err
+		}
+		if native != nil {
+			path := "library/" + native.Path
+			natives = append(natives, NativeLibrary{
+				Path:    storeBackend.local(path),
+				Exclude: library.Extract.Exclude,
+			})
+			if len(library.Downloads.Classifiers) == 0 {
+				repositories := libraryRepositories(&library)
+				batch.submit(func() error {
+					return downloadMavenArtifact(storeBackend.local(path), native, repositories, batch.progress)
+				})
+			} else {
+				batch.submit(func() error {
+					return storeBackend.download(path, native.url(), native.hash(), native.size(), batch.progress)
+				})
+			}
+		}
 
-		go func(path string, lib Library) {
-			channel <- downloadFile(path, &library.Downloads.Artifact)
-		}(path, library)
-	}
+		override := findLibraryOverride(&library)
+		if override != "" {
+			classpath = append(classpath, override)
+			continue
+		}
 
-	var err error
-	err = nil
-	length = len(classpath)
-	for i := 0; i < length; i++ {
-		err = errors.Join(err, <-channel)
+		artifact, err := library.artifact()
+		if err != nil {
+			return nil, nil, err
+		}
+		if artifact == nil {
+			continue
+		}
+
+		path := "library/" + artifact.Path
+		classpath = append(classpath, storeBackend.local(path))
+
+		if library.Downloads.Artifact.Url == "" {
+			repositories := libraryRepositories(&library)
+			batch.submit(func() error {
+				return downloadMavenArtifact(storeBackend.local(path), artifact, repositories, batch.progress)
+			})
+			continue
+		}
+		batch.submit(func() error {
+			return storeBackend.download(path, artifact.url(), artifact.hash(), artifact.size(), batch.progress)
+		})
 	}
+
+	err := batch.wait()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return classpath, nil
+	return classpath, natives, nil
 }
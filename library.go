@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A maven artifact that was installed into the store by hand with "library install", for version JSONs and agents
+// written by hand. The path is relative to the library directory.
+type InstalledLibrary struct {
+	Coordinate string `json:"coordinate"`
+	Path       string `json:"path"`
+	Sha1       string `json:"sha1"`
+}
+
+// Every artifact installed by hand, "store gc" keeps them like the files an instance uses.
+type InstalledLibraries struct {
+	Libraries []InstalledLibrary `json:"libraries"`
+}
+
+func installedLibrariesPath(base string) string {
+	return base + "/installed-libraries.json"
+}
+
+func loadInstalledLibraries(base string) (*InstalledLibraries, error) {
+	var installed InstalledLibraries
+	path := installedLibrariesPath(base)
+	if !fileExists(path) {
+		return &installed, nil
+	}
+	err := readJson(path, &installed)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read "+path), err)
+	}
+	return &installed, nil
+}
+
+// Records an installed artifact, replacing an earlier install of the same coordinate.
+func (this *InstalledLibraries) add(library InstalledLibrary) {
+	for i := range this.Libraries {
+		if this.Libraries[i].Coordinate == library.Coordinate {
+			this.Libraries[i] = library
+			return
+		}
+	}
+	this.Libraries = append(this.Libraries, library)
+	sort.Slice(this.Libraries, func(i, j int) bool {
+		return this.Libraries[i].Coordinate < this.Libraries[j].Coordinate
+	})
+}
+
+// Returns the SHA-1 hash of a file in lower-case hexadecimal.
+func sha1File(path string) (string, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	digest := sha1.New()
+	_, err = copyBuffered(digest, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+var libraryCommands = []Command{
+	{
+		Name:        "install",
+		Usage:       "<group:artifact:version[:classifier][@extension]> [--repo <url>]",
+		Description: "Downloads a maven artifact into the shared store and keeps it there for version JSONs written by hand",
+		Run:         libraryInstallCommand,
+	},
+}
+
+func libraryCommand(base string, args []string) error {
+	return runCommand(libraryCommands, base, args)
+}
+
+func libraryInstallCommand(base string, args []string) error {
+	set := flag.NewFlagSet("library install", flag.ContinueOnError)
+	repository := set.String("repo", "", "the repository to download from before the configured ones, Maven Central is searched last without it")
+	args, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("expected exactly one maven coordinate")
+	}
+
+	coordinate := args[0]
+	relative, err := mavenPath(coordinate)
+	if err != nil {
+		return err
+	}
+	library := Library{
+		Name: coordinate,
+		Url:  *repository,
+	}
+	repositories := libraryRepositories(&library)
+	if *repository == "" {
+		repositories = append(repositories, MavenRepository{
+			Url: URL_MAVEN_CENTRAL,
+		})
+	}
+
+	path := libraryDir(base) + "/" + relative
+	batch := downloadPool.batch("Library")
+	batch.submit(func() error {
+		return downloadMavenArtifact(path, &Artifact{
+			Path: relative,
+		}, repositories, batch.progress)
+	})
+	err = batch.wait()
+	if err != nil {
+		return errors.Join(errors.New("failed to download "+coordinate), err)
+	}
+
+	// Repositories without checksums leave the hash unknown, it is recorded now so later changes to the file show
+	hash := hashCache.hashOf(path)
+	if hash == "" {
+		hash, err = sha1File(path)
+		if err != nil {
+			return errors.Join(errors.New("failed to hash "+path), err)
+		}
+		hashCache.remember(path, hash)
+	}
+	err = hashCache.save()
+	if err != nil {
+		fmt.Printf("%s\n", err)
+	}
+
+	installed, err := loadInstalledLibraries(base)
+	if err != nil {
+		return err
+	}
+	installed.add(InstalledLibrary{
+		Coordinate: coordinate,
+		Path:       relative,
+		Sha1:       hash,
+	})
+	err = writeJson(installedLibrariesPath(base), installed)
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+installedLibrariesPath(base)), err)
+	}
+	fmt.Printf("Installed %s to %s (sha1 %s)\n", coordinate, path, hash)
+	return nil
+}
+
+// Adds the artifacts installed by hand to the reference counts of the store.
+func countInstalledLibraries(base string, counts map[string]int) error {
+	installed, err := loadInstalledLibraries(base)
+	if err != nil {
+		return err
+	}
+	for i := range installed.Libraries {
+		relative, ok := strings.CutPrefix(libraryDir(base)+"/"+installed.Libraries[i].Path, base+"/")
+		if ok {
+			counts[relative]++
+		}
+	}
+	return nil
+}
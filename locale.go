@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// Returns the system properties that make the JVM use the locale and time zone of an instance.
+func localeArguments(instance *Instance) []string {
+	var arguments []string
+	if instance.Language != "" {
+		arguments = append(arguments, "-Duser.language="+instance.Language)
+	}
+	if instance.Country != "" {
+		arguments = append(arguments, "-Duser.country="+instance.Country)
+	}
+	if instance.Timezone != "" {
+		arguments = append(arguments, "-Duser.timezone="+instance.Timezone)
+	}
+	return arguments
+}
+
+// Sets the language in the options.txt of the game to match the locale of an instance. The game uses codes like
+// "de_de", when only a language is configured it is used for the country as well.
+func applyLocaleOptions(gameDir string, instance *Instance) error {
+	if instance.Language == "" {
+		return nil
+	}
+
+	country := instance.Country
+	if country == "" {
+		country = instance.Language
+	}
+	return setGameOption(gameDir, "lang", strings.ToLower(instance.Language+"_"+country))
+}
+
+// Sets a single key of the options.txt in a game directory, creating the file if needed. Every other line is kept as
+// it is.
+func setGameOption(gameDir string, key string, value string) error {
+	path := gameDir + "/options.txt"
+	var lines []string
+	if fileExists(path) {
+		file, err := openFile(path)
+		if err != nil {
+			return errors.Join(errors.New("failed to open "+path), err)
+		}
+		contents, err := io.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			return errors.Join(errors.New("failed to read "+path), err)
+		}
+		lines = strings.Split(strings.TrimRight(string(contents), "\r\n"), "\n")
+	}
+
+	found := false
+	for i := range lines {
+		if strings.HasPrefix(lines[i], key+":") {
+			lines[i] = key + ":" + value
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, key+":"+value)
+	}
+
+	file, err := createFile(path)
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+path), err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_, err = io.WriteString(file, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+path), err)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A file recorded in a lockfile. The path is relative to the base directory unless the file is outside of it, like
+// in the directory of the official launcher.
+type LockedArtifact struct {
+	Path string `json:"path"`
+	Url  string `json:"url"`
+	Size uint64 `json:"size"`
+	Sha1 string `json:"sha1"`
+}
+
+func (this *LockedArtifact) url() string {
+	return this.Url
+}
+
+func (this *LockedArtifact) hash() *string {
+	return &this.Sha1
+}
+
+func (this *LockedArtifact) size() uint64 {
+	return this.Size
+}
+
+// Returns where a locked artifact belongs.
+func (this *LockedArtifact) resolve(base string) string {
+	if filepath.IsAbs(this.Path) {
+		return this.Path
+	}
+	return base + "/" + this.Path
+}
+
+// Pins the version of an instance and every file it needs, so installing it again results in exactly the same files
+// no matter what changed upstream. The JVM is only pinned when it came from Adoptium.
+type Lockfile struct {
+	Manifest  VersionInfo      `json:"manifest"`
+	Artifacts []LockedArtifact `json:"artifacts"`
+	Jdk       *LockedJdk       `json:"jdk,omitempty"`
+}
+
+func lockfilePath(base string, instance *Instance) string {
+	return instanceDir(base, instance.Name) + "/lock.json"
+}
+
+// Loads the lockfile of an instance, nil if it does not have one.
+func loadLockfile(base string, instance *Instance) (*Lockfile, error) {
+	path := lockfilePath(base, instance)
+	if !fileExists(path) {
+		return nil, nil
+	}
+
+	var lockfile Lockfile
+	err := readJson(path, &lockfile)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to load lockfile of "+instance.Name), err)
+	}
+	return &lockfile, nil
+}
+
+// Collects every file with a hash that passes through downloadFileRaw while it is set, and the JRE of Adoptium that is
+// installed.
+type ArtifactRecorder struct {
+	lock      sync.Mutex
+	base      string
+	artifacts map[string]LockedArtifact
+	jdk       *LockedJdk
+}
+
+var artifactRecorder *ArtifactRecorder
+
+// Records a file for the lockfile if a recorder is active.
+func recordArtifact(path string, url string, hash *string, size uint64) {
+	recorder := artifactRecorder
+	if recorder == nil || hash == nil {
+		return
+	}
+
+	relative, ok := strings.CutPrefix(path, recorder.base+"/")
+	if !ok {
+		relative = path
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.artifacts[relative] = LockedArtifact{
+		Path: relative,
+		Url:  url,
+		Size: size,
+		Sha1: *hash,
+	}
+}
+
+// Records the JVM for the lockfile if a recorder is active. Only the JRE the game runs on is recorded, not the JDKs of
+// other uses like jlink.
+func recordJdk(jdk *LockedJdk) {
+	recorder := artifactRecorder
+	if recorder == nil || jdk.Image != ADOPTIUM_IMAGE_JRE {
+		return
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.jdk = jdk
+}
+
+// Provides the runtime of an instance. The JVM pinned by the lockfile of the instance is used when it runs here, every
+// other instance gets one from the providers of provideRuntime.
+func provideInstanceRuntime(base string, instance *Instance, version uint32, component string) (string, error) {
+	lockfile, err := loadLockfile(base, instance)
+	if err != nil {
+		return "", err
+	}
+	if lockfile == nil || lockfile.Jdk == nil || !lockfile.Jdk.runsHere(version) {
+		return provideRuntime(base, version, component)
+	}
+
+	home, err := installLockedJdk(base, lockfile.Jdk, "")
+	if err != nil {
+		return "", errors.Join(errors.New("failed to install the Java of the lockfile of "+instance.Name), err)
+	}
+	fmt.Printf("Using Java %d from the lockfile of %s: %s\n", version, instance.Name, home)
+	markJavaUsed(base, home)
+	return home, nil
+}
+
+var lockfileCommands = []Command{
+	{
+		Name:        "create",
+		Usage:       "<instance>",
+		Description: "Installs an instance and records its version and every file it needs in a lockfile, launches keep using that version",
+		Run:         lockfileCreateCommand,
+	},
+	{
+		Name:        "install",
+		Usage:       "<instance>",
+		Description: "Downloads every file recorded in the lockfile of an instance",
+		Run:         lockfileInstallCommand,
+	},
+	{
+		Name:        "remove",
+		Usage:       "<instance>",
+		Description: "Deletes the lockfile of an instance so it follows its version setting again",
+		Run:         lockfileRemoveCommand,
+	},
+}
+
+func lockfileCommand(base string, args []string) error {
+	return runCommand(lockfileCommands, base, args)
+}
+
+func lockfileCreateCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+	if fileExists(lockfilePath(base, instance)) {
+		return errors.New("instance " + instance.Name + " already has a lockfile, remove it first to create a new one")
+	}
+
+	version, err := resolveManifest(base, instance)
+	if err != nil {
+		return err
+	}
+
+	artifactRecorder = &ArtifactRecorder{
+		base:      base,
+		artifacts: map[string]LockedArtifact{},
+	}
+	defer func() {
+		artifactRecorder = nil
+	}()
+	_, err = launch(base, instance, &LaunchOptions{
+		PrepareOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	lockfile := Lockfile{
+		Manifest: *version,
+		Jdk:      artifactRecorder.jdk,
+	}
+	for path := range artifactRecorder.artifacts {
+		lockfile.Artifacts = append(lockfile.Artifacts, artifactRecorder.artifacts[path])
+	}
+	sort.Slice(lockfile.Artifacts, func(a int, b int) bool {
+		return lockfile.Artifacts[a].Path < lockfile.Artifacts[b].Path
+	})
+
+	err = writeJson(lockfilePath(base, instance), &lockfile)
+	if err != nil {
+		return errors.Join(errors.New("failed to write lockfile of "+instance.Name), err)
+	}
+	fmt.Printf("Locked %s to version %s with %d files\n", instance.Name, version.Id, len(lockfile.Artifacts))
+	return nil
+}
+
+func lockfileInstallCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+	lockfile, err := loadLockfile(base, instance)
+	if err != nil {
+		return err
+	}
+	if lockfile == nil {
+		return errors.New("instance " + instance.Name + " has no lockfile")
+	}
+
+	batch := downloadPool.batch("Locked")
+	for i := range lockfile.Artifacts {
+		artifact := &lockfile.Artifacts[i]
+		batch.submit(func() error {
+			return downloadFile(artifact.resolve(base), artifact, batch.progress)
+		})
+	}
+	err = batch.wait()
+	if err != nil {
+		return errors.Join(errors.New("failed to install the lockfile of "+instance.Name), err)
+	}
+	if lockfile.Jdk != nil && lockfile.Jdk.runsHere(lockfile.Jdk.Major) {
+		_, err = installLockedJdk(base, lockfile.Jdk, "")
+		if err != nil {
+			return errors.Join(errors.New("failed to install the Java of the lockfile of "+instance.Name), err)
+		}
+	}
+
+	downloadSummary.print()
+	return hashCache.save()
+}
+
+func lockfileRemoveCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(lockfilePath(base, instance))
+	if err != nil {
+		return errors.Join(errors.New("failed to remove the lockfile of "+instance.Name), err)
+	}
+	fmt.Printf("Removed the lockfile of %s\n", instance.Name)
+	return nil
+}
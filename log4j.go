@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// The only kind of logging configuration versions ship.
+	LOGGING_LOG4J2_XML string = "log4j2-xml"
+)
+
+// Returns where the logging configurations of versions are kept, the official launcher keeps them there too.
+func logConfigDir(base string) string {
+	return assetsDir(base) + "/log_configs"
+}
+
+// Downloads the log4j configuration the logging section of a version names for the client and verifies it. Returns
+// its path, or an empty string when the version has none.
+func downloadLogConfig(base string, manifest *Manifest) (string, error) {
+	logging, ok := manifest.Logging["client"]
+	if !ok || logging.File.Url == "" {
+		return "", nil
+	}
+	if logging.Type != LOGGING_LOG4J2_XML {
+		fmt.Printf("Warning: %s uses logging of type %s, the default logging of the game is used instead\n", manifest.Id, logging.Type)
+		return "", nil
+	}
+	err := validateInstanceName(logging.File.Id)
+	if err != nil {
+		return "", errors.Join(errors.New("the logging configuration of "+manifest.Id+" has an invalid id"), err)
+	}
+
+	path := logConfigDir(base) + "/" + logging.File.Id
+	err = downloadFileRaw(path, logging.File.Url, &logging.File.Sha1, logging.File.Size, nil)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to download the logging configuration of "+manifest.Id), err)
+	}
+	return path, nil
+}
+
+// An event of the XMLLayout of log4j, the logging configurations of Mojang write these to the console.
+type Log4jEvent struct {
+	Logger    string `xml:"logger,attr"`
+	Timestamp int64  `xml:"timestamp,attr"`
+	Level     string `xml:"level,attr"`
+	Thread    string `xml:"thread,attr"`
+	Message   string `xml:"Message"`
+	Throwable string `xml:"Throwable"`
+}
+
+// Turns the XML events the logging configurations of Mojang print into the lines latest.log has, like
+// "[12:34:56] [Render thread/INFO]: Setting user: Player". Everything that is not part of an event is passed on as it
+// is.
+type Log4jWriter struct {
+	lock        sync.Mutex
+	destination io.Writer
+	partial     string
+	event       strings.Builder
+}
+
+func newLog4jWriter(destination io.Writer) *Log4jWriter {
+	return &Log4jWriter{
+		destination: destination,
+	}
+}
+
+func (this *Log4jWriter) Write(buffer []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	lines := strings.Split(this.partial+string(buffer), "\n")
+	this.partial = lines[len(lines)-1]
+	for i := 0; i < len(lines)-1; i++ {
+		err := this.line(lines[i] + "\n")
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(buffer), nil
+}
+
+func (this *Log4jWriter) line(line string) error {
+	if this.event.Len() == 0 && !strings.HasPrefix(strings.TrimSpace(line), "<log4j:Event") {
+		_, err := io.WriteString(this.destination, line)
+		return err
+	}
+
+	this.event.WriteString(line)
+	if !strings.Contains(line, "</log4j:Event>") {
+		return nil
+	}
+	raw := this.event.String()
+	this.event.Reset()
+
+	var event Log4jEvent
+	err := xml.Unmarshal([]byte(raw), &event)
+	if err != nil {
+		// Not an event after all, better to show it as it is than to lose it
+		_, err = io.WriteString(this.destination, raw)
+		return err
+	}
+	formatted := fmt.Sprintf("[%s] [%s/%s]: %s\n", time.UnixMilli(event.Timestamp).Format("15:04:05"), event.Thread, event.Level, event.Message)
+	if event.Throwable != "" {
+		formatted += strings.TrimRight(event.Throwable, "\r\n") + "\n"
+	}
+	_, err = io.WriteString(this.destination, formatted)
+	return err
+}
+
+// Writes what is left once the game exited, an event that never ended is written as it is.
+func (this *Log4jWriter) flush() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	rest := this.event.String() + this.partial
+	this.event.Reset()
+	this.partial = ""
+	if rest == "" {
+		return nil
+	}
+	_, err := io.WriteString(this.destination, rest)
+	return err
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An archived log file of an instance.
+type LogFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+func logsDir(gameDir string) string {
+	return gameDir + "/logs"
+}
+
+// The logs the game writes to while it runs, they are never compressed or deleted by the launcher.
+var activeLogs = []string{
+	"latest.log",
+	"debug.log",
+}
+
+// Compresses every finished log of a game directory with gzip. The game compresses its own logs when it starts, this
+// catches the ones it leaves behind, like those of mod loaders and crashed sessions.
+func compressLogs(gameDir string) error {
+	dir := logsDir(gameDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return errors.Join(errors.New("failed to list logs"), err)
+	}
+
+	for i := range entries {
+		name := entries[i].Name()
+		active := false
+		for o := range activeLogs {
+			active = active || name == activeLogs[o]
+		}
+		if active || entries[i].IsDir() || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+
+		err = compressFile(dir + "/" + name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replaces a file with a gzip compressed copy that has .gz appended to its name and the same modification time.
+func compressFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Join(errors.New("failed to compress "+path), err)
+	}
+
+	in, err := openFile(path)
+	if err != nil {
+		return errors.Join(errors.New("failed to compress "+path), err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	temporary := path + ".gz.part"
+	out, err := createFile(temporary)
+	if err != nil {
+		return errors.Join(errors.New("failed to compress "+path), err)
+	}
+	stream := gzip.NewWriter(out)
+	_, err = io.Copy(stream, in)
+	if err == nil {
+		err = stream.Close()
+	}
+	_ = out.Close()
+	if err == nil {
+		err = os.Chtimes(temporary, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = renameFile(temporary, path+".gz")
+	}
+	if err != nil {
+		_ = os.Remove(temporary) // Don't care
+		return errors.Join(errors.New("failed to compress "+path), err)
+	}
+
+	_ = in.Close()
+	err = os.Remove(path)
+	if err != nil {
+		return errors.Join(errors.New("failed to delete "+path+" after compressing it"), err)
+	}
+	return nil
+}
+
+// Lists the logs of a game directory, including the active ones.
+func listLogs(gameDir string) ([]LogFile, error) {
+	dir := logsDir(gameDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Join(errors.New("failed to list logs"), err)
+	}
+
+	var logs []LogFile
+	for i := range entries {
+		if entries[i].IsDir() {
+			continue
+		}
+		info, err := entries[i].Info()
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to list logs"), err)
+		}
+		logs = append(logs, LogFile{
+			Path:    dir + "/" + entries[i].Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return logs, nil
+}
+
+// Deletes compressed logs of every instance that are older than the configured age, then the oldest ones until all of
+// them fit in the configured size.
+func enforceLogRetention(base string) error {
+	instances, err := listInstances(base)
+	if err != nil {
+		return err
+	}
+
+	var archived []LogFile
+	for i := range instances {
+		logs, err := listLogs(instances[i].gameDir(base))
+		if err != nil {
+			return err
+		}
+		for o := range logs {
+			if strings.HasSuffix(logs[o].Path, ".gz") {
+				archived = append(archived, logs[o])
+			}
+		}
+	}
+
+	sort.Slice(archived, func(a int, b int) bool {
+		return archived[a].ModTime.After(archived[b].ModTime)
+	})
+
+	retention := &config.Logs
+	var total uint64
+	for i := range archived {
+		log := archived[i]
+		total += uint64(log.Size)
+		expired := retention.MaxAge > 0 && time.Since(log.ModTime) > time.Duration(retention.MaxAge)
+		oversized := retention.MaxSize > 0 && total > retention.MaxSize
+		if !expired && !oversized {
+			continue
+		}
+
+		err = os.Remove(log.Path)
+		if err != nil {
+			return errors.Join(errors.New("failed to delete log "+log.Path), err)
+		}
+		total -= uint64(log.Size)
+	}
+	return nil
+}
+
+// Compresses the logs of the session that just ended and applies the retention policy.
+func archiveLogs(base string, gameDir string) error {
+	err := compressLogs(gameDir)
+	if err != nil {
+		return err
+	}
+	return enforceLogRetention(base)
+}
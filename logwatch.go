@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// How many of the last lines of the output are kept for the crash bundle of a game that hung.
+	LOG_TAIL_LINES int = 500
+)
+
+// Lines every version logs once its window is up and it finished loading, see watchStartup.
+var startupMarkers = []string{
+	"Sound engine started",
+	"-atlas",
+}
+
+// Watches the output of the game line by line for things the launcher should know about once the game exits.
+type LogWatcher struct {
+	lock    sync.Mutex
+	partial string
+	// Set when the JVM reported running out of memory.
+	outOfMemory bool
+	// When the game last wrote a line and what it was.
+	lastOutput time.Time
+	lastLine   string
+	// Set once the game logged one of the startupMarkers.
+	started bool
+	// Set when the game was killed for not finishing its startup.
+	hung bool
+	tail []string
+}
+
+func (this *LogWatcher) Write(buffer []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	lines := strings.Split(this.partial+string(buffer), "\n")
+	this.partial = lines[len(lines)-1]
+	for i := 0; i < len(lines)-1; i++ {
+		this.line(strings.TrimRight(lines[i], "\r"))
+	}
+	return len(buffer), nil
+}
+
+func (this *LogWatcher) line(line string) {
+	if strings.Contains(line, "java.lang.OutOfMemoryError") {
+		this.outOfMemory = true
+	}
+	for i := range startupMarkers {
+		if strings.Contains(line, startupMarkers[i]) {
+			this.started = true
+		}
+	}
+	this.lastOutput = time.Now()
+	if strings.TrimSpace(line) != "" {
+		this.lastLine = line
+	}
+	this.tail = append(this.tail, line)
+	if len(this.tail) > LOG_TAIL_LINES {
+		this.tail = this.tail[len(this.tail)-LOG_TAIL_LINES:]
+	}
+}
+
+// Returns the last lines of the output.
+func (this *LogWatcher) output() string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return strings.Join(append(this.tail, this.partial), "\n")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// The first version of LWJGL with natives for arm64 on both Linux and Windows, older ones are replaced by it.
+	LWJGL_ARM64_VERSION string = "3.3.1"
+	LWJGL_GROUP         string = "org.lwjgl"
+)
+
+// Checks if a dotted version is older than another one. Parts that are not numbers count as 0.
+func versionBefore(version string, other string) bool {
+	parts := strings.Split(version, ".")
+	otherParts := strings.Split(other, ".")
+	for i := 0; i < len(parts) || i < len(otherParts); i++ {
+		var a, b int
+		if i < len(parts) {
+			a, _ = strconv.Atoi(parts[i])
+		}
+		if i < len(otherParts) {
+			b, _ = strconv.Atoi(otherParts[i])
+		}
+		if a != b {
+			return a < b
+		}
+	}
+	return false
+}
+
+// Returns a library of LWJGL that is downloaded from Maven Central by its coordinate.
+func lwjglLibrary(coordinate string, rules []Rule) Library {
+	return Library{
+		Name:  coordinate,
+		Rules: rules,
+		Url:   URL_MAVEN_CENTRAL,
+	}
+}
+
+// Mojang only ships natives for x86 on Linux and, before 1.19, on Windows. On arm64 the libraries of LWJGL 3 are
+// replaced by the ones on Maven Central that have natives for it, the way Prism does. Versions of LWJGL that have none
+// are updated to LWJGL_ARM64_VERSION as a whole, the classes have to match the natives. LWJGL 2 of versions older than
+// 1.13 has no arm64 natives at all and is left alone.
+//
+// The arm64 natives of LWJGL 3.3 are loaded from the classpath instead of being extracted, so natives listed the old
+// way become libraries on the classpath too.
+func substituteArm64Libraries(libraries []Library) []Library {
+	if runtime.GOARCH != "arm64" || (runtime.GOOS != "linux" && runtime.GOOS != "windows") {
+		return libraries
+	}
+	return substituteLwjglLibraries(libraries, mojangOsName())
+}
+
+func substituteLwjglLibraries(libraries []Library, osName string) []Library {
+	arm64Natives := "natives-" + osName + "-arm64"
+
+	var substituted []Library
+	seen := map[string]bool{}
+	add := func(library Library) {
+		if library.Name == "" || !seen[library.Name] {
+			seen[library.Name] = true
+			substituted = append(substituted, library)
+		}
+	}
+	for i := range libraries {
+		library := libraries[i]
+		parts := strings.Split(library.Name, ":")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] != LWJGL_GROUP {
+			add(library)
+			continue
+		}
+
+		version := parts[2]
+		updated := versionBefore(version, LWJGL_ARM64_VERSION)
+		if updated {
+			version = LWJGL_ARM64_VERSION
+		}
+		coordinate := parts[0] + ":" + parts[1] + ":" + version
+
+		if len(parts) == 4 {
+			// The natives of 1.19 and newer are libraries with a classifier, the ones of other systems are left to
+			// their rules
+			if strings.HasPrefix(parts[3], "natives-"+osName) {
+				add(lwjglLibrary(coordinate+":"+arm64Natives, library.Rules))
+			} else {
+				add(library)
+			}
+			continue
+		}
+
+		classes := library
+		if updated {
+			classes = lwjglLibrary(coordinate, library.Rules)
+		}
+		classes.Natives = nil
+		add(classes)
+		if library.Natives[osName] != "" {
+			add(lwjglLibrary(coordinate+":"+arm64Natives, library.Rules))
+		}
+	}
+	return substituted
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Returns the total memory of the machine in bytes, 0 when it is unknown.
+func totalMemory() uint64 {
+	file, err := openFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kilobytes, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kilobytes * 1024
+		}
+	}
+	return 0
+}
+
+// Returns the vendor of the GPU the game most likely runs on from the PCI vendor ids of the DRM devices.
+func gpuVendor() string {
+	devices, err := filepath.Glob("/sys/class/drm/card*/device/vendor")
+	if err != nil {
+		return ""
+	}
+	var vendors []string
+	for i := range devices {
+		id, err := os.ReadFile(devices[i])
+		if err == nil {
+			vendors = append(vendors, gpuVendorOf(strings.TrimSpace(string(id))))
+		}
+	}
+	return preferredGpuVendor(vendors)
+}
@@ -0,0 +1,62 @@
+//go:build !linux
+
+package main
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Runs a command of the operating system, returning its output or nothing when it failed.
+func systemOutput(executable string, args ...string) string {
+	output, err := execute(executable, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// Returns the total memory of the machine in bytes, 0 when it is unknown.
+func totalMemory() uint64 {
+	var output string
+	switch runtime.GOOS {
+	case "darwin":
+		{
+			output = systemOutput("sysctl", "-n", "hw.memsize")
+		}
+	case "windows":
+		{
+			output = systemOutput("powershell", "-NoProfile", "-Command", "(Get-CimInstance Win32_ComputerSystem).TotalPhysicalMemory")
+		}
+	}
+	memory, _ := strconv.ParseUint(output, 10, 64)
+	return memory
+}
+
+// Returns the vendor of the GPU the game most likely runs on from the names of the GPUs.
+func gpuVendor() string {
+	var output string
+	switch runtime.GOOS {
+	case "darwin":
+		{
+			output = systemOutput("system_profiler", "SPDisplaysDataType")
+		}
+	case "windows":
+		{
+			output = systemOutput("powershell", "-NoProfile", "-Command", "(Get-CimInstance Win32_VideoController).Name")
+		}
+	}
+
+	var vendors []string
+	lines := strings.Split(output, "\n")
+	for i := range lines {
+		line := strings.TrimSpace(lines[i])
+		// system_profiler lists a lot more than the names of the GPUs
+		if runtime.GOOS == "darwin" && !strings.HasPrefix(line, "Chipset Model:") {
+			continue
+		}
+		vendors = append(vendors, gpuVendorOf(line))
+	}
+	return preferredGpuVendor(vendors)
+}
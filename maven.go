@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Only downloads artifacts the repository has a checksum for.
+	MAVEN_CHECKSUMS_REQUIRE string = "require"
+	// Verifies artifacts against the checksum of the repository when it has one, the default.
+	MAVEN_CHECKSUMS_VERIFY string = "verify"
+	// Never asks the repository for checksums, for repositories that serve broken ones.
+	MAVEN_CHECKSUMS_IGNORE string = "ignore"
+)
+
+// A maven repository libraries are searched in, like the ones of Fabric and NeoForge or a private mirror. The checksum
+// policy decides how the .sha1 files of the repository are used for artifacts the library does not have a hash of, see
+// MAVEN_CHECKSUMS_REQUIRE, MAVEN_CHECKSUMS_VERIFY and MAVEN_CHECKSUMS_IGNORE. Checksums are verified when it is empty.
+type MavenRepository struct {
+	Url       string `json:"url"`
+	Checksums string `json:"checksums"`
+}
+
+// Returns the repositories to search for a library in order. The repository the library names comes first, the
+// configured ones second and the one of Mojang last. A repository the library names that is configured as well keeps
+// its configured checksum policy.
+func libraryRepositories(library *Library) []MavenRepository {
+	var repositories []MavenRepository
+	seen := map[string]bool{}
+	add := func(repository MavenRepository) {
+		key := strings.TrimSuffix(repository.Url, "/")
+		if !seen[key] {
+			seen[key] = true
+			repositories = append(repositories, repository)
+		}
+	}
+
+	if library.Url != "" {
+		named := MavenRepository{
+			Url: library.Url,
+		}
+		for i := range config.MavenRepositories {
+			if strings.TrimSuffix(config.MavenRepositories[i].Url, "/") == strings.TrimSuffix(library.Url, "/") {
+				named = config.MavenRepositories[i]
+			}
+		}
+		add(named)
+	}
+	for i := range config.MavenRepositories {
+		add(config.MavenRepositories[i])
+	}
+	add(MavenRepository{
+		Url: URL_LIBRARIES,
+	})
+	return repositories
+}
+
+// Downloads the .sha1 file of an artifact. Returns an empty string when the repository has none.
+func fetchChecksum(url string) (string, error) {
+	var checksum string
+	err := retry(url+".sha1", func() error {
+		response, err := httpGet(url + ".sha1")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = response.Body.Close()
+		}()
+
+		contents, err := io.ReadAll(io.LimitReader(response.Body, 1024))
+		if err != nil {
+			return err
+		}
+		// Some repositories append the file name to the hash
+		fields := strings.Fields(string(contents))
+		if len(fields) == 0 {
+			return &PermanentError{
+				Err: errors.New("the checksum of " + url + " is empty"),
+			}
+		}
+		checksum = strings.ToLower(fields[0])
+		return nil
+	})
+
+	var status *StatusError
+	if errors.As(err, &status) && status.Code == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = hex.DecodeString(checksum)
+	if len(checksum) != 40 || err != nil {
+		return "", errors.New("the checksum of " + url + " is not a SHA-1 hash")
+	}
+	return checksum, nil
+}
+
+// Downloads an artifact from the first of the repositories that has it. Artifacts without a hash are verified with
+// the checksums of the repository as its policy says, and are kept as they are once they were downloaded since
+// released maven artifacts never change.
+func downloadMavenArtifact(path string, artifact *Artifact, repositories []MavenRepository, progress *Progress) error {
+	if artifact.Sha1 == "" && hashCache.hashOf(path) != "" {
+		return nil
+	}
+
+	var failures error
+	for i := range repositories {
+		repository := repositories[i]
+		url := strings.TrimSuffix(repository.Url, "/") + "/" + artifact.Path
+
+		hash := artifact.Sha1
+		if hash == "" && repository.Checksums != MAVEN_CHECKSUMS_IGNORE {
+			var err error
+			hash, err = fetchChecksum(url)
+			if err != nil {
+				return errors.Join(errors.New("failed to download "+artifact.Path), err)
+			}
+			if hash == "" && repository.Checksums == MAVEN_CHECKSUMS_REQUIRE {
+				failures = errors.Join(failures, errors.New(repository.Url+" has no checksum for it"))
+				continue
+			}
+		}
+
+		var err error
+		if hash == "" {
+			if fileExists(path) {
+				return nil
+			}
+			err = downloadFileRaw(path, url, nil, artifact.Size, progress)
+		} else {
+			err = downloadFileRaw(path, url, &hash, artifact.Size, progress)
+		}
+		if err == nil {
+			return nil
+		}
+
+		var status *StatusError
+		if !errors.As(err, &status) || status.Code != http.StatusNotFound {
+			return err
+		}
+		failures = errors.Join(failures, errors.New(repository.Url+" does not have it"))
+	}
+	return errors.Join(errors.New("no repository has "+artifact.Path), failures)
+}
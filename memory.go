@@ -0,0 +1,15 @@
+package main
+
+import (
+	"runtime/debug"
+)
+
+// Gives back what preparing a launch needed before the launcher waits for the game, which may take hours: the idle
+// connections of the shared client, expired DNS entries and the memory of the manifests that were parsed.
+func releaseMemory() {
+	if httpClient != nil {
+		httpClient.CloseIdleConnections()
+	}
+	dnsCache.trim()
+	debug.FreeOSMemory()
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An instance or installed pack of another launcher that can be turned into an instance of this one. The game
+// directory stays where it is, the instance uses it like the ones imported from the official launcher.
+type ForeignInstance struct {
+	Launcher string
+	Name     string
+	GameDir  string
+	Version  string
+	Loader   *InstanceLoader
+}
+
+// The id "import detect" selects an instance with.
+func (this *ForeignInstance) id() string {
+	return strings.ToLower(this.Launcher) + "/" + this.Name
+}
+
+// Another launcher whose instances can be imported. Every directory it may keep its instances in is listed, the ones
+// that don't exist are skipped.
+type ForeignLauncher struct {
+	Name string
+	Dirs func(home string, configDir string) []string
+	List func(launcher string, dir string) ([]ForeignInstance, error)
+}
+
+var foreignLaunchers = []ForeignLauncher{
+	{
+		Name: "GDLauncher",
+		Dirs: func(home string, configDir string) []string {
+			return []string{
+				configDir + "/gdlauncher_next/instances",
+			}
+		},
+		List: listGdLauncherInstances,
+	},
+	{
+		Name: "ATLauncher",
+		Dirs: func(home string, configDir string) []string {
+			return []string{
+				configDir + "/ATLauncher/instances",
+				home + "/.local/share/atlauncher/instances",
+				home + "/ATLauncher/instances",
+			}
+		},
+		List: listAtLauncherInstances,
+	},
+	{
+		Name: "Technic",
+		Dirs: func(home string, configDir string) []string {
+			return []string{
+				home + "/.technic",
+				configDir + "/.technic",
+				configDir + "/technic",
+			}
+		},
+		List: listTechnicPacks,
+	},
+	{
+		Name: "CurseForge",
+		Dirs: func(home string, configDir string) []string {
+			return []string{
+				home + "/curseforge/minecraft/Instances",
+				home + "/Documents/curseforge/minecraft/Instances",
+			}
+		},
+		List: listCurseForgeInstances,
+	},
+}
+
+// Lists the directories inside of a directory.
+func listSubdirectories(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := range entries {
+		if entries[i].IsDir() {
+			names = append(names, entries[i].Name())
+		}
+	}
+	return names, nil
+}
+
+// Turns the name of a mod loader another launcher uses into the one of this launcher, like "Forge" or "fabric-loader".
+func foreignLoader(name string, version string) *InstanceLoader {
+	name = strings.ToLower(name)
+	name = strings.TrimSuffix(name, "-loader")
+	if name == "" || name == "vanilla" {
+		return nil
+	}
+	return &InstanceLoader{
+		Name:    name,
+		Version: version,
+	}
+}
+
+// The config.json of an instance of GDLauncher.
+type GdLauncherInstance struct {
+	Loader struct {
+		LoaderType    string `json:"loaderType"`
+		McVersion     string `json:"mcVersion"`
+		LoaderVersion string `json:"loaderVersion"`
+	} `json:"loader"`
+}
+
+func listGdLauncherInstances(launcher string, dir string) ([]ForeignInstance, error) {
+	names, err := listSubdirectories(dir)
+	if err != nil {
+		return nil, err
+	}
+	var instances []ForeignInstance
+	for i := range names {
+		path := dir + "/" + names[i] + "/config.json"
+		if !fileExists(path) {
+			continue
+		}
+		var settings GdLauncherInstance
+		err = readJson(path, &settings)
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", path, err)
+			continue
+		}
+		// Forge versions are prefixed with the version of the game
+		version := strings.TrimPrefix(settings.Loader.LoaderVersion, settings.Loader.McVersion+"-")
+		instances = append(instances, ForeignInstance{
+			Launcher: launcher,
+			Name:     names[i],
+			GameDir:  dir + "/" + names[i],
+			Version:  settings.Loader.McVersion,
+			Loader:   foreignLoader(settings.Loader.LoaderType, version),
+		})
+	}
+	return instances, nil
+}
+
+// The instance.json of an instance of ATLauncher, the id is the version of the game.
+type AtLauncherInstance struct {
+	Id       string `json:"id"`
+	Launcher struct {
+		Name          string `json:"name"`
+		Pack          string `json:"pack"`
+		Version       string `json:"version"`
+		LoaderVersion *struct {
+			Type    string `json:"type"`
+			Version string `json:"version"`
+		} `json:"loaderVersion"`
+	} `json:"launcher"`
+}
+
+func listAtLauncherInstances(launcher string, dir string) ([]ForeignInstance, error) {
+	names, err := listSubdirectories(dir)
+	if err != nil {
+		return nil, err
+	}
+	var instances []ForeignInstance
+	for i := range names {
+		path := dir + "/" + names[i] + "/instance.json"
+		if !fileExists(path) {
+			continue
+		}
+		var settings AtLauncherInstance
+		err = readJson(path, &settings)
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", path, err)
+			continue
+		}
+		name := settings.Launcher.Name
+		if name == "" {
+			name = names[i]
+		}
+		instance := ForeignInstance{
+			Launcher: launcher,
+			Name:     name,
+			GameDir:  dir + "/" + names[i],
+			Version:  settings.Id,
+		}
+		if settings.Launcher.LoaderVersion != nil {
+			instance.Loader = foreignLoader(settings.Launcher.LoaderVersion.Type, settings.Launcher.LoaderVersion.Version)
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// The installedPacks file of the Technic launcher, keyed by the slug of the pack.
+type TechnicInstalledPacks struct {
+	InstalledPacks map[string]struct {
+		Name      string `json:"name"`
+		Build     string `json:"build"`
+		Directory string `json:"directory"`
+	} `json:"installedPacks"`
+}
+
+func listTechnicPacks(launcher string, dir string) ([]ForeignInstance, error) {
+	var installed TechnicInstalledPacks
+	err := readJson(dir+"/installedPacks", &installed)
+	if err != nil {
+		return nil, err
+	}
+	var instances []ForeignInstance
+	for slug := range installed.InstalledPacks {
+		pack := installed.InstalledPacks[slug]
+		gameDir := dir + "/modpacks/" + slug
+		// Packs installed somewhere else name their directory relative to the one of the launcher
+		if pack.Directory != "" {
+			gameDir = strings.ReplaceAll(pack.Directory, "%MODPACKS%", dir+"/modpacks")
+		}
+		if !fileExists(gameDir + "/bin/version.json") {
+			// Listed but never installed
+			continue
+		}
+		var manifest TechnicVersion
+		err = readJson(gameDir+"/bin/version.json", &manifest)
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", gameDir, err)
+			continue
+		}
+		version, loader := technicVersion(&manifest)
+		name := pack.Name
+		if name == "" {
+			name = slug
+		}
+		instances = append(instances, ForeignInstance{
+			Launcher: launcher,
+			Name:     name,
+			GameDir:  gameDir,
+			Version:  version,
+			Loader:   loader,
+		})
+	}
+	return instances, nil
+}
+
+// The bin/version.json a Technic pack ships, a version JSON that may inherit from the one of the game.
+type TechnicVersion struct {
+	Id           string `json:"id"`
+	InheritsFrom string `json:"inheritsFrom"`
+	Libraries    []struct {
+		Name string `json:"name"`
+	} `json:"libraries"`
+}
+
+// Finds the version of the game and the mod loader of the version.json a Technic pack ships, from the libraries of the
+// loader it lists.
+func technicVersion(manifest *TechnicVersion) (string, *InstanceLoader) {
+	version := manifest.InheritsFrom
+	if version == "" {
+		version, _, _ = strings.Cut(manifest.Id, "-")
+	}
+	loaders := map[string]string{
+		"net.minecraftforge:forge":          "forge",
+		"net.minecraftforge:minecraftforge": "forge",
+		"net.neoforged:neoforge":            "neoforge",
+		"net.fabricmc:fabric-loader":        "fabric",
+		"org.quiltmc:quilt-loader":          "quilt",
+	}
+	for i := range manifest.Libraries {
+		parts := strings.Split(manifest.Libraries[i].Name, ":")
+		if len(parts) < 3 {
+			continue
+		}
+		name, ok := loaders[parts[0]+":"+parts[1]]
+		if ok {
+			return version, &InstanceLoader{
+				Name:    name,
+				Version: strings.TrimSuffix(strings.TrimPrefix(parts[2], version+"-"), "-"+version),
+			}
+		}
+	}
+	return version, nil
+}
+
+// The minecraftinstance.json of an instance of the CurseForge app. The name of the loader is like "forge-47.2.0" or
+// "fabric-0.15.7-1.20.1".
+type CurseForgeInstance struct {
+	Name          string `json:"name"`
+	GameVersion   string `json:"gameVersion"`
+	BaseModLoader *struct {
+		Name         string `json:"name"`
+		ForgeVersion string `json:"forgeVersion"`
+	} `json:"baseModLoader"`
+}
+
+func listCurseForgeInstances(launcher string, dir string) ([]ForeignInstance, error) {
+	names, err := listSubdirectories(dir)
+	if err != nil {
+		return nil, err
+	}
+	var instances []ForeignInstance
+	for i := range names {
+		path := dir + "/" + names[i] + "/minecraftinstance.json"
+		if !fileExists(path) {
+			continue
+		}
+		var settings CurseForgeInstance
+		err = readJson(path, &settings)
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", path, err)
+			continue
+		}
+		name := settings.Name
+		if name == "" {
+			name = names[i]
+		}
+		instance := ForeignInstance{
+			Launcher: launcher,
+			Name:     name,
+			GameDir:  dir + "/" + names[i],
+			Version:  settings.GameVersion,
+		}
+		if settings.BaseModLoader != nil {
+			loader, version, _ := strings.Cut(settings.BaseModLoader.Name, "-")
+			if settings.BaseModLoader.ForgeVersion != "" {
+				version = settings.BaseModLoader.ForgeVersion
+			}
+			instance.Loader = foreignLoader(loader, version)
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// Scans the directories of every known launcher for instances. Directories that don't exist are skipped, broken ones
+// are reported and skipped.
+func detectForeignInstances() ([]ForeignInstance, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to find the home directory"), err)
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = home
+	}
+	home = filepath.ToSlash(home)
+	configDir = filepath.ToSlash(configDir)
+
+	var instances []ForeignInstance
+	seen := map[string]bool{}
+	for i := range foreignLaunchers {
+		launcher := &foreignLaunchers[i]
+		dirs := launcher.Dirs(home, configDir)
+		for o := range dirs {
+			if seen[dirs[o]] || !fileExists(dirs[o]) {
+				continue
+			}
+			seen[dirs[o]] = true
+			found, err := launcher.List(launcher.Name, dirs[o])
+			if err != nil {
+				fmt.Printf("Failed to list the instances of %s in %s: %s\n", launcher.Name, dirs[o], err)
+				continue
+			}
+			instances = append(instances, found...)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].id() < instances[j].id()
+	})
+	return instances, nil
+}
+
+// Creates an instance of this launcher for an instance of another one.
+func importForeignInstance(base string, foreign *ForeignInstance) error {
+	name := sanitizeInstanceName(foreign.Name)
+	err := validateInstanceName(name)
+	if err != nil {
+		return err
+	}
+	if fileExists(instanceDir(base, name) + "/instance.json") {
+		return errors.New("there already is an instance named " + name)
+	}
+	if foreign.Version == "" {
+		return errors.New("the version of the game is unknown")
+	}
+
+	instance := Instance{
+		Name:    name,
+		Version: foreign.Version,
+		Loader:  foreign.Loader,
+		GameDir: foreign.GameDir,
+	}
+	return saveInstance(base, &instance)
+}
+
+var importCommands = []Command{
+	{
+		Name:        "detect",
+		Usage:       "[<launcher>/<name>...] [--all]",
+		Description: "Finds the instances of GDLauncher, ATLauncher, Technic and the CurseForge app, and imports the selected ones",
+		Run:         importDetectCommand,
+	},
+}
+
+func importCommand(base string, args []string) error {
+	return runCommand(importCommands, base, args)
+}
+
+func importDetectCommand(base string, args []string) error {
+	set := flag.NewFlagSet("import detect", flag.ContinueOnError)
+	all := set.Bool("all", false, "import every instance that was found")
+	args, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+
+	instances, err := detectForeignInstances()
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		fmt.Println("No instances of other launchers were found")
+		return nil
+	}
+
+	if len(args) == 0 && !*all {
+		for i := range instances {
+			instance := &instances[i]
+			loader := ""
+			if instance.Loader != nil {
+				loader = " with " + instance.Loader.Name + " " + instance.Loader.Version
+			}
+			fmt.Printf("%s\n    %s%s in %s\n", instance.id(), instance.Version, loader, instance.GameDir)
+		}
+		fmt.Println("Import them with \"import detect <launcher>/<name>...\" or \"import detect --all\"")
+		return nil
+	}
+
+	selected := map[string]bool{}
+	for i := range args {
+		selected[strings.ToLower(args[i])] = true
+	}
+	var failures error
+	for i := range instances {
+		instance := &instances[i]
+		if !*all && !selected[strings.ToLower(instance.id())] {
+			continue
+		}
+		delete(selected, strings.ToLower(instance.id()))
+
+		err = importForeignInstance(base, instance)
+		if err != nil {
+			failures = errors.Join(failures, errors.Join(errors.New("failed to import "+instance.id()), err))
+			continue
+		}
+		fmt.Printf("Imported %s as %s\n", instance.id(), sanitizeInstanceName(instance.Name))
+	}
+	for id := range selected {
+		failures = errors.Join(failures, errors.New("found no instance "+id))
+	}
+	return failures
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Returns the URLs to try for a download in order. Configured mirrors of the host come first, skipping the ones that
+// were flagged as suspect during this run, and the original URL is always the last fallback.
+func candidateUrls(rawUrl string) []string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return []string{rawUrl}
+	}
+
+	var candidates []string
+	mirrors := config.Mirrors[parsed.Host]
+	for i := range mirrors {
+		mirrored := strings.TrimSuffix(mirrors[i], "/") + parsed.EscapedPath()
+		if parsed.RawQuery != "" {
+			mirrored += "?" + parsed.RawQuery
+		}
+		if !isSuspect(mirrored) {
+			candidates = append(candidates, mirrored)
+		}
+	}
+	return append(candidates, rawUrl)
+}
+
+// Runs a download from every candidate URL in turn until one of them succeeds.
+func withMirrors(rawUrl string, download func(url string) error) error {
+	candidates := candidateUrls(rawUrl)
+	var failures error
+	for i := range candidates {
+		err := download(candidates[i])
+		if err == nil {
+			return nil
+		}
+		failures = errors.Join(failures, err)
+	}
+	return failures
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	MOD_EXTENSION          string = ".jar"
+	MOD_DISABLED_EXTENSION string = ".jar.disabled"
+)
+
+// What could be learned about a mod from its jar.
+type ModInfo struct {
+	// The name of the file in the mods directory.
+	File    string
+	Enabled bool
+	// The ids the mod declares in its loader metadata.
+	Ids []string
+	// The names of the mixin configurations of the mod.
+	Mixins []string
+	// The packages the classes of the mod are in, shortened to at most three parts.
+	Packages []string
+}
+
+// The name of a mod for humans, the first id if there is one or the file name otherwise.
+func (this *ModInfo) name() string {
+	if len(this.Ids) > 0 {
+		return this.Ids[0]
+	}
+	return this.File
+}
+
+func modsDir(base string, instance *Instance) string {
+	return instance.gameDir(base) + "/mods"
+}
+
+// Reads the metadata of every mod in the mods directory of an instance, including disabled ones.
+func listMods(base string, instance *Instance) ([]ModInfo, error) {
+	return listModsIn(modsDir(base, instance))
+}
+
+// Reads the metadata of every mod in a mods directory, including disabled ones.
+func listModsIn(dir string) ([]ModInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Join(errors.New("failed to list mods"), err)
+	}
+
+	var mods []ModInfo
+	for i := range entries {
+		name := entries[i].Name()
+		enabled := strings.HasSuffix(name, MOD_EXTENSION)
+		if entries[i].IsDir() || (!enabled && !strings.HasSuffix(name, MOD_DISABLED_EXTENSION)) {
+			continue
+		}
+
+		mod, err := readModInfo(dir + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		mod.File = name
+		mod.Enabled = enabled
+		mods = append(mods, *mod)
+	}
+
+	sort.Slice(mods, func(a int, b int) bool {
+		return mods[a].File < mods[b].File
+	})
+	return mods, nil
+}
+
+var modsTomlIdPattern = regexp.MustCompile(`(?m)^\s*modId\s*=\s*"([^"]+)"`)
+
+func readModInfo(path string) (*ModInfo, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to open mod "+path), err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var mod ModInfo
+	packages := map[string]bool{}
+	for i := range reader.File {
+		file := reader.File[i]
+		switch {
+		case file.Name == "fabric.mod.json":
+			{
+				var metadata struct {
+					Id     string `json:"id"`
+					Mixins []any  `json:"mixins"`
+				}
+				err = readZipJson(file, &metadata)
+				if err != nil {
+					return nil, errors.Join(errors.New("failed to read fabric.mod.json of "+path), err)
+				}
+				mod.Ids = append(mod.Ids, metadata.Id)
+				mod.Mixins = append(mod.Mixins, mixinNames(metadata.Mixins)...)
+			}
+
+		case file.Name == "quilt.mod.json":
+			{
+				var metadata struct {
+					QuiltLoader struct {
+						Id string `json:"id"`
+					} `json:"quilt_loader"`
+					Mixin any `json:"mixin"`
+				}
+				err = readZipJson(file, &metadata)
+				if err != nil {
+					return nil, errors.Join(errors.New("failed to read quilt.mod.json of "+path), err)
+				}
+				mod.Ids = append(mod.Ids, metadata.QuiltLoader.Id)
+				switch mixin := metadata.Mixin.(type) {
+				case string:
+					{
+						mod.Mixins = append(mod.Mixins, mixin)
+					}
+				case []any:
+					{
+						mod.Mixins = append(mod.Mixins, mixinNames(mixin)...)
+					}
+				}
+			}
+
+		case file.Name == "META-INF/mods.toml" || file.Name == "META-INF/neoforge.mods.toml":
+			{
+				contents, err := readZipFile(file)
+				if err != nil {
+					return nil, errors.Join(errors.New("failed to read mods.toml of "+path), err)
+				}
+				matches := modsTomlIdPattern.FindAllStringSubmatch(string(contents), -1)
+				for o := range matches {
+					mod.Ids = append(mod.Ids, matches[o][1])
+				}
+			}
+
+		case strings.HasSuffix(file.Name, ".mixins.json") && !strings.Contains(file.Name, "/"):
+			{
+				mod.Mixins = append(mod.Mixins, file.Name)
+			}
+
+		case strings.HasSuffix(file.Name, ".class") && !strings.HasPrefix(file.Name, "META-INF/"):
+			{
+				parts := strings.Split(file.Name, "/")
+				parts = parts[:len(parts)-1]
+				if len(parts) > 3 {
+					parts = parts[:3]
+				}
+				if len(parts) > 1 {
+					packages[strings.Join(parts, ".")] = true
+				}
+			}
+		}
+	}
+
+	for name := range packages {
+		mod.Packages = append(mod.Packages, name)
+	}
+	sort.Strings(mod.Packages)
+	mod.Mixins = deduplicate(mod.Mixins)
+	return &mod, nil
+}
+
+// Extracts the names of mixin configurations from a fabric.mod.json, they are either strings or objects with a config.
+func mixinNames(mixins []any) []string {
+	var names []string
+	for i := range mixins {
+		switch mixin := mixins[i].(type) {
+		case string:
+			{
+				names = append(names, mixin)
+			}
+		case map[string]any:
+			{
+				name, ok := mixin["config"].(string)
+				if ok {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	return io.ReadAll(reader)
+}
+
+func readZipJson(file *zip.File, structure any) error {
+	contents, err := readZipFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(contents, structure)
+}
+
+// Returns the strings in order with duplicates removed.
+func deduplicate(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for i := range values {
+		if !seen[values[i]] {
+			seen[values[i]] = true
+			result = append(result, values[i])
+		}
+	}
+	return result
+}
+
+// Removes the enabled or disabled extension from the file name of a mod.
+func trimModExtension(name string) string {
+	name, ok := strings.CutSuffix(name, MOD_DISABLED_EXTENSION)
+	if ok {
+		return name
+	}
+	return strings.TrimSuffix(name, MOD_EXTENSION)
+}
+
+// Finds a mod by its file name, with or without extension, or one of its ids.
+func findMod(mods []ModInfo, name string) *ModInfo {
+	name = trimModExtension(name)
+	for i := range mods {
+		mod := &mods[i]
+		if trimModExtension(mod.File) == name {
+			return mod
+		}
+		for o := range mod.Ids {
+			if mod.Ids[o] == name {
+				return mod
+			}
+		}
+	}
+	return nil
+}
+
+// Enables or disables a mod by renaming its jar, the loaders only pick up files ending in .jar.
+func setModEnabled(base string, instance *Instance, mod *ModInfo, enabled bool) error {
+	return setModEnabledIn(modsDir(base, instance), mod, enabled)
+}
+
+// Enables or disables a mod of a mods directory by renaming it.
+func setModEnabledIn(dir string, mod *ModInfo, enabled bool) error {
+	if mod.Enabled == enabled {
+		return nil
+	}
+
+	var target string
+	if enabled {
+		target = strings.TrimSuffix(mod.File, MOD_DISABLED_EXTENSION) + MOD_EXTENSION
+	} else {
+		target = strings.TrimSuffix(mod.File, MOD_EXTENSION) + MOD_DISABLED_EXTENSION
+	}
+
+	err := renameFile(dir+"/"+mod.File, dir+"/"+target)
+	if err != nil {
+		return errors.Join(errors.New("failed to rename "+mod.File), err)
+	}
+	mod.File = target
+	mod.Enabled = enabled
+	return nil
+}
+
+var modsCommands = []Command{
+	{
+		Name:        "list",
+		Usage:       "<instance>",
+		Description: "Lists the mods of an instance",
+		Run:         modsListCommand,
+	},
+	{
+		Name:        "disable",
+		Usage:       "<instance> <mod>",
+		Description: "Disables a mod, identified by its file name or id, without deleting it",
+		Run: func(base string, args []string) error {
+			return modsToggleCommand(base, args, false)
+		},
+	},
+	{
+		Name:        "enable",
+		Usage:       "<instance> <mod>",
+		Description: "Enables a mod that was disabled",
+		Run: func(base string, args []string) error {
+			return modsToggleCommand(base, args, true)
+		},
+	},
+	{
+		Name:        "blame",
+		Usage:       "<instance>",
+		Description: "Ranks the mods that most likely caused the last crash of an instance",
+		Run:         modsBlameCommand,
+	},
+	{
+		Name:        "bisect",
+		Usage:       "<instance> [--ask] [--keep <mod>]...",
+		Description: "Finds the mod causing a crash by launching the instance with halves of its mods until one is left",
+		Run:         modsBisectCommand,
+	},
+}
+
+func modsCommand(base string, args []string) error {
+	return runCommand(modsCommands, base, args)
+}
+
+func modsListCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	mods, err := listMods(base, instance)
+	if err != nil {
+		return err
+	}
+
+	for i := range mods {
+		mod := mods[i]
+		state := "enabled"
+		if !mod.Enabled {
+			state = "disabled"
+		}
+		fmt.Printf("%-40s %-8s %s\n", mod.File, state, strings.Join(mod.Ids, ", "))
+	}
+	return nil
+}
+
+func modsToggleCommand(base string, args []string, enabled bool) error {
+	if len(args) != 2 {
+		return errors.New("expected an instance and a mod")
+	}
+
+	instance, err := loadInstance(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	err = checkUnlocked(instance)
+	if err != nil {
+		return err
+	}
+
+	mods, err := listMods(base, instance)
+	if err != nil {
+		return err
+	}
+
+	mod := findMod(mods, args[1])
+	if mod == nil {
+		return errors.New("instance " + instance.Name + " has no mod " + args[1])
+	}
+
+	err = setModEnabled(base, instance, mod, enabled)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		fmt.Printf("Enabled %s\n", mod.name())
+	} else {
+		fmt.Printf("Disabled %s\n", mod.name())
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	URL_MOJANG_RUNTIMES string = "https://launchermeta.mojang.com/v1/products/java-runtime/2ec0cc96c44e5a76b9c8b7c39df7210883d12871/all.json"
+
+	// Written into a runtime of Mojang once every file of it was installed, holds the hash of its manifest.
+	MOJANG_RUNTIME_MARKER string = ".installed"
+)
+
+// A file of the manifest of a runtime.
+type MojangRuntimeFile struct {
+	// One of "file", "directory" or "link".
+	Type       string `json:"type"`
+	Executable bool   `json:"executable"`
+	Downloads  struct {
+		Raw Artifact `json:"raw"`
+	} `json:"downloads"`
+	// Where a link points to, relative to the link.
+	Target string `json:"target"`
+}
+
+// A release of a runtime component, like "java-runtime-gamma" or "jre-legacy".
+type MojangRuntimeRelease struct {
+	Manifest Artifact `json:"manifest"`
+	Version  struct {
+		Name     string `json:"name"`
+		Released string `json:"released"`
+	} `json:"version"`
+}
+
+// Returns the name Mojang uses for the platform the launcher runs on.
+func mojangPlatform() (string, error) {
+	platforms := map[string]string{
+		"linux/amd64":   "linux",
+		"linux/386":     "linux-i386",
+		"darwin/amd64":  "mac-os",
+		"darwin/arm64":  "mac-os-arm64",
+		"windows/amd64": "windows-x64",
+		"windows/386":   "windows-x86",
+		"windows/arm64": "windows-arm64",
+	}
+	platform, ok := platforms[runtime.GOOS+"/"+runtime.GOARCH]
+	if !ok {
+		return "", errors.Join(errNoRuntime, errors.New("Mojang has no runtimes for "+runtime.GOOS+"/"+runtime.GOARCH))
+	}
+	return platform, nil
+}
+
+// Returns the major version of a Java version name, "1.8.0_51" is 8 and "17.0.8" is 17.
+func javaMajorVersion(name string) uint32 {
+	name = strings.TrimPrefix(name, "1.")
+	end := strings.IndexFunc(name, func(char rune) bool {
+		return char < '0' || char > '9'
+	})
+	if end != -1 {
+		name = name[:end]
+	}
+	major, _ := strconv.ParseUint(name, 10, 32)
+	return uint32(major)
+}
+
+// Returns the directory a runtime component of Mojang is installed in.
+func mojangRuntimeDir(base string, component string) string {
+	return base + "/runtimes/mojang/" + component
+}
+
+// Returns the home directory of an installed runtime, the ones for macOS are app bundles.
+func mojangRuntimeHome(dir string) string {
+	if fileExists(dir + "/jre.bundle/Contents/Home") {
+		return dir + "/jre.bundle/Contents/Home"
+	}
+	return dir
+}
+
+// Finds the component a version asks for among the runtimes of Mojang, or the component of its major version when it
+// does not name one or Mojang does not have it. The newest release wins when there are more.
+func findMojangComponent(components map[string][]MojangRuntimeRelease, version uint32, named string) (string, *MojangRuntimeRelease) {
+	var names []string
+	if len(components[named]) > 0 {
+		names = append(names, named)
+	} else {
+		for name := range components {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var component string
+	var newest *MojangRuntimeRelease
+	for i := range names {
+		releases := components[names[i]]
+		for o := range releases {
+			release := &releases[o]
+			if names[i] != named && javaMajorVersion(release.Version.Name) != version {
+				continue
+			}
+			if newest == nil || release.Version.Released > newest.Version.Released {
+				component = names[i]
+				newest = release
+			}
+		}
+	}
+	return component, newest
+}
+
+// Finds a runtime of Mojang that was installed before, for when their servers can not be reached. The component a
+// version asks for is preferred over any other of its major version.
+func findInstalledMojangRuntime(base string, version uint32, component string) (string, error) {
+	if component != "" && fileExists(mojangRuntimeDir(base, component)+"/"+MOJANG_RUNTIME_MARKER) {
+		return mojangRuntimeHome(mojangRuntimeDir(base, component)), nil
+	}
+	entries, err := os.ReadDir(base + "/runtimes/mojang")
+	if err != nil {
+		return "", err
+	}
+	for i := range entries {
+		dir := mojangRuntimeDir(base, entries[i].Name())
+		if !fileExists(dir + "/" + MOJANG_RUNTIME_MARKER) {
+			continue
+		}
+		var release MojangRuntimeRelease
+		err = readJson(dir+"/"+MOJANG_RUNTIME_MARKER, &release)
+		if err == nil && javaMajorVersion(release.Version.Name) == version {
+			return mojangRuntimeHome(dir), nil
+		}
+	}
+	return "", errors.Join(errNoRuntime, errors.New(fmt.Sprintf("no Java %d of Mojang was installed before", version)))
+}
+
+// Provides the runtimes the official launcher uses. Every file of a runtime is listed with its hash in a manifest, so
+// installing it is much like installing the assets.
+func provideMojangRuntime(base string, version uint32, component string) (string, error) {
+	platform, err := mojangPlatform()
+	if err != nil {
+		return "", err
+	}
+
+	var all map[string]map[string][]MojangRuntimeRelease
+	err = downloadJsonRaw(URL_MOJANG_RUNTIMES, nil, &all)
+	if err != nil {
+		home, installedErr := findInstalledMojangRuntime(base, version, component)
+		if installedErr == nil {
+			return home, nil
+		}
+		return "", err
+	}
+
+	component, release := findMojangComponent(all[platform], version, component)
+	if release == nil {
+		return "", errors.Join(errNoRuntime, errors.New(fmt.Sprintf("Mojang has no Java %d for %s", version, platform)))
+	}
+
+	dir := mojangRuntimeDir(base, component)
+	var installed MojangRuntimeRelease
+	if fileExists(dir+"/"+MOJANG_RUNTIME_MARKER) && readJson(dir+"/"+MOJANG_RUNTIME_MARKER, &installed) == nil &&
+		installed.Manifest.Sha1 == release.Manifest.Sha1 {
+		return mojangRuntimeHome(dir), nil
+	}
+
+	var manifest struct {
+		Files map[string]MojangRuntimeFile `json:"files"`
+	}
+	err = downloadJson(&release.Manifest, &manifest)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to download the manifest of "+component), err)
+	}
+
+	fmt.Printf("Installing %s (Java %s) from Mojang\n", component, release.Version.Name)
+	err = installMojangRuntime(dir, manifest.Files)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to install "+component), err)
+	}
+	err = writeJson(dir+"/"+MOJANG_RUNTIME_MARKER, release)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to install "+component), err)
+	}
+	return mojangRuntimeHome(dir), nil
+}
+
+// Creates the directories, downloads the files and creates the links of a runtime.
+func installMojangRuntime(dir string, files map[string]MojangRuntimeFile) error {
+	err := os.Remove(dir + "/" + MOJANG_RUNTIME_MARKER)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	// Parents sort before their children
+	sort.Strings(paths)
+
+	batch := downloadPool.batch("Runtime")
+	var links []string
+	for i := range paths {
+		file := files[paths[i]]
+		target, err := resolvePackPath(dir, paths[i])
+		if err != nil {
+			return err
+		}
+
+		switch file.Type {
+		case "directory":
+			{
+				err = createParents(target)
+				if err != nil {
+					return errors.Join(errors.New("failed to create "+target), err)
+				}
+			}
+		case "file":
+			{
+				batch.submit(func() error {
+					err := downloadFile(target, &file.Downloads.Raw, batch.progress)
+					if err != nil || !file.Executable {
+						return err
+					}
+					return os.Chmod(target, 0755)
+				})
+			}
+		case "link":
+			{
+				links = append(links, paths[i])
+			}
+		}
+	}
+	err = batch.wait()
+	if err != nil {
+		return err
+	}
+
+	// Windows needs special rights for links, the runtimes for it don't have any
+	for i := range links {
+		target := dir + "/" + links[i]
+		_ = os.Remove(target)
+		err = createParents(filepath.Dir(target))
+		if err == nil {
+			err = createLink(target, files[links[i]].Target)
+		}
+		if err != nil {
+			return errors.Join(errors.New("failed to link "+target), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestFindMojangComponent(t *testing.T) {
+	release := func(name string, released string) MojangRuntimeRelease {
+		var release MojangRuntimeRelease
+		release.Version.Name = name
+		release.Version.Released = released
+		return release
+	}
+	components := map[string][]MojangRuntimeRelease{
+		"java-runtime-alpha": {release("16.0.1.9.1", "2021-05-10")},
+		"java-runtime-beta":  {release("17.0.1.12.1", "2021-11-10")},
+		"java-runtime-gamma": {release("17.0.8", "2023-08-01")},
+		"jre-legacy":         {release("8.0.51", "2015-07-01")},
+	}
+
+	tests := []struct {
+		version  uint32
+		named    string
+		expected string
+	}{
+		{version: 17, named: "java-runtime-beta", expected: "java-runtime-beta"},
+		{version: 17, named: "", expected: "java-runtime-gamma"},
+		{version: 17, named: "java-runtime-delta", expected: "java-runtime-gamma"},
+		{version: 8, named: "jre-legacy", expected: "jre-legacy"},
+		{version: 21, named: "", expected: ""},
+	}
+	for i := range tests {
+		test := tests[i]
+		component, _ := findMojangComponent(components, test.version, test.named)
+		if component != test.expected {
+			t.Errorf("Java %d named %q: expected %q, got %q", test.version, test.named, test.expected, component)
+		}
+	}
+}
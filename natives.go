@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// A jar of natives of an old version, the files in it are extracted into the natives directory before the game starts.
+type NativeLibrary struct {
+	Path string
+	// The start of the paths of the files that are not extracted, like "META-INF/".
+	Exclude []string
+}
+
+// Returns the name Mojang uses for the operating system in rules and natives.
+func mojangOsName() string {
+	if runtime.GOOS == "darwin" {
+		return "osx"
+	}
+	return runtime.GOOS
+}
+
+// Returns the name Mojang uses for the architecture in rules.
+func mojangArch() string {
+	if runtime.GOARCH == "386" {
+		return "x86"
+	}
+	return runtime.GOARCH
+}
+
+// Returns the artifact of the natives of a library for this system, or nil when it has none. Old versions list the
+// natives as classifiers of the library, with the bitness of the system in the name of some of them. Libraries without
+// downloads are resolved by their maven coordinate like artifact does.
+func (this *Library) nativesArtifact() (*Artifact, error) {
+	classifier := this.Natives[mojangOsName()]
+	if classifier == "" {
+		return nil, nil
+	}
+	bits := "64"
+	if runtime.GOARCH == "386" || runtime.GOARCH == "arm" {
+		bits = "32"
+	}
+	classifier = strings.ReplaceAll(classifier, "${arch}", bits)
+
+	if len(this.Downloads.Classifiers) > 0 {
+		artifact, ok := this.Downloads.Classifiers[classifier]
+		if !ok {
+			// Some libraries list natives for systems they have no jar for
+			return nil, nil
+		}
+		return &artifact, nil
+	}
+	if this.Name == "" {
+		return nil, errors.New("library has natives for " + mojangOsName() + " but neither downloads nor a name")
+	}
+	path, err := mavenPath(this.Name + ":" + classifier)
+	if err != nil {
+		return nil, errors.Join(errors.New("library has natives for "+mojangOsName()+" but an invalid name"), err)
+	}
+	repository := this.Url
+	if repository == "" {
+		repository = URL_LIBRARIES
+	}
+	return &Artifact{
+		Path: path,
+		Url:  strings.TrimSuffix(repository, "/") + "/" + path,
+	}, nil
+}
+
+// Creates a natives directory for a single launch and extracts the natives of the version into it. Every launch gets
+// its own, so two instances of the same version never share one and a game that still runs keeps its natives. The
+// returned function deletes the directory once the game exited.
+func prepareNativesDir(version string, natives []NativeLibrary) (string, func(), error) {
+	dir, err := os.MkdirTemp("", LAUNCHER_NAME+"-natives-")
+	if err != nil {
+		return "", nil, errors.Join(errors.New("failed to create the natives directory of "+version), err)
+	}
+	// The path is handed to the JVM, which resolves it against the game directory when it is relative
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		_ = removeAll(dir)
+		return "", nil, errors.Join(errors.New("failed to create the natives directory of "+version), err)
+	}
+	cleanup := func() {
+		err := removeAll(dir)
+		if err != nil {
+			fmt.Printf("Failed to delete natives directory %s: %s\n", dir, err)
+		}
+	}
+
+	for i := range natives {
+		err = extractNativeLibrary(dir, &natives[i])
+		if err != nil {
+			cleanup()
+			return "", nil, errors.Join(errors.New("failed to extract the natives of "+natives[i].Path), err)
+		}
+	}
+	return dir, cleanup, nil
+}
+
+func extractNativeLibrary(dir string, native *NativeLibrary) error {
+	reader, err := zip.OpenReader(native.Path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	for i := range reader.File {
+		file := reader.File[i]
+		if file.FileInfo().IsDir() || nativeExcluded(file.Name, native.Exclude) {
+			continue
+		}
+		if !filepath.IsLocal(file.Name) {
+			return errors.New("refusing to extract " + file.Name + " outside of the natives directory")
+		}
+		target := dir + "/" + file.Name
+		err = createParents(filepath.Dir(target))
+		if err != nil {
+			return err
+		}
+		err = extractZipFile(file, target)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nativeExcluded(name string, exclude []string) bool {
+	for i := range exclude {
+		if strings.HasPrefix(name, exclude[i]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The types of NBT tags, the format the game stores worlds and settings like servers.dat in.
+//
+//goland:noinspection GoSnakeCaseUsage
+const (
+	NBT_END        byte = 0
+	NBT_BYTE       byte = 1
+	NBT_SHORT      byte = 2
+	NBT_INT        byte = 3
+	NBT_LONG       byte = 4
+	NBT_FLOAT      byte = 5
+	NBT_DOUBLE     byte = 6
+	NBT_BYTE_ARRAY byte = 7
+	NBT_STRING     byte = 8
+	NBT_LIST       byte = 9
+	NBT_COMPOUND   byte = 10
+	NBT_INT_ARRAY  byte = 11
+	NBT_LONG_ARRAY byte = 12
+)
+
+var nbtTypeNames = []string{
+	"TAG_End",
+	"TAG_Byte",
+	"TAG_Short",
+	"TAG_Int",
+	"TAG_Long",
+	"TAG_Float",
+	"TAG_Double",
+	"TAG_Byte_Array",
+	"TAG_String",
+	"TAG_List",
+	"TAG_Compound",
+	"TAG_Int_Array",
+	"TAG_Long_Array",
+}
+
+// A named NBT tag. The value depends on the type: int8, int16, int32, int64, float32, float64, []byte, string,
+// *NbtList, []NbtTag for compounds in the order they were read, []int32 or []int64.
+type NbtTag struct {
+	Type  byte
+	Name  string
+	Value any
+}
+
+// The value of a list tag, lists only hold unnamed values of a single type.
+type NbtList struct {
+	Type   byte
+	Values []any
+}
+
+// Returns the child of a compound tag with the name, nil if there is none or the tag is not a compound.
+func (this *NbtTag) child(name string) *NbtTag {
+	children, ok := this.Value.([]NbtTag)
+	if !ok {
+		return nil
+	}
+	for i := range children {
+		if children[i].Name == name {
+			return &children[i]
+		}
+	}
+	return nil
+}
+
+// Sets the child of a compound tag, replacing an existing child with the same name.
+func (this *NbtTag) setChild(tag NbtTag) {
+	children, _ := this.Value.([]NbtTag)
+	for i := range children {
+		if children[i].Name == tag.Name {
+			children[i] = tag
+			return
+		}
+	}
+	this.Value = append(children, tag)
+}
+
+// Reads an NBT file, which may or may not be compressed with gzip. Returns the root tag and if it was compressed.
+func readNbtFile(path string) (*NbtTag, bool, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, false, errors.Join(errors.New("failed to open "+path), err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	buffered := bufio.NewReader(file)
+	magic, _ := buffered.Peek(2)
+	compressed := len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+
+	var reader io.Reader = buffered
+	if compressed {
+		stream, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, false, errors.Join(errors.New("failed to decompress "+path), err)
+		}
+		reader = stream
+	}
+
+	tag, err := readNbt(reader)
+	if err != nil {
+		return nil, false, errors.Join(errors.New("failed to read NBT from "+path), err)
+	}
+	return tag, compressed, nil
+}
+
+// Writes an NBT file, optionally compressed with gzip. The file is replaced only once it was written completely.
+func writeNbtFile(path string, tag *NbtTag, compressed bool) error {
+	var buffer bytes.Buffer
+	var writer io.Writer = &buffer
+	var stream *gzip.Writer
+	if compressed {
+		stream = gzip.NewWriter(&buffer)
+		writer = stream
+	}
+
+	err := writeNbt(writer, tag)
+	if err == nil && stream != nil {
+		err = stream.Close()
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to encode NBT for "+path), err)
+	}
+
+	temporary := path + ".part"
+	file, err := createFile(temporary)
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+temporary), err)
+	}
+	_, err = file.Write(buffer.Bytes())
+	_ = file.Close()
+	if err == nil {
+		err = renameFile(temporary, path)
+	}
+	if err != nil {
+		_ = removeAll(temporary) // Don't care
+		return errors.Join(errors.New("failed to write "+path), err)
+	}
+	return nil
+}
+
+// Reads a single named tag, the root of an NBT file.
+func readNbt(reader io.Reader) (*NbtTag, error) {
+	var kind byte
+	err := binary.Read(reader, binary.BigEndian, &kind)
+	if err != nil {
+		return nil, err
+	}
+	if kind == NBT_END {
+		return nil, errors.New("NBT data starts with an end tag")
+	}
+
+	name, err := readNbtString(reader)
+	if err != nil {
+		return nil, err
+	}
+	value, err := readNbtValue(reader, kind, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &NbtTag{
+		Type:  kind,
+		Name:  name,
+		Value: value,
+	}, nil
+}
+
+func readNbtString(reader io.Reader) (string, error) {
+	var length uint16
+	err := binary.Read(reader, binary.BigEndian, &length)
+	if err != nil {
+		return "", err
+	}
+	buffer := make([]byte, length)
+	_, err = io.ReadFull(reader, buffer)
+	return string(buffer), err
+}
+
+// Reads the length of an array or list, refusing negative lengths.
+func readNbtLength(reader io.Reader) (int, error) {
+	var length int32
+	err := binary.Read(reader, binary.BigEndian, &length)
+	if err != nil {
+		return 0, err
+	}
+	if length < 0 {
+		return 0, errors.New(fmt.Sprintf("negative NBT length %d", length))
+	}
+	return int(length), nil
+}
+
+// Reads the payload of a tag. Nesting is limited like the game does so broken files can not exhaust the stack.
+func readNbtValue(reader io.Reader, kind byte, depth int) (any, error) {
+	if depth > 512 {
+		return nil, errors.New("NBT is nested too deeply")
+	}
+
+	switch kind {
+	case NBT_BYTE:
+		{
+			var value int8
+			err := binary.Read(reader, binary.BigEndian, &value)
+			return value, err
+		}
+	case NBT_SHORT:
+		{
+			var value int16
+			err := binary.Read(reader, binary.BigEndian, &value)
+			return value, err
+		}
+	case NBT_INT:
+		{
+			var value int32
+			err := binary.Read(reader, binary.BigEndian, &value)
+			return value, err
+		}
+	case NBT_LONG:
+		{
+			var value int64
+			err := binary.Read(reader, binary.BigEndian, &value)
+			return value, err
+		}
+	case NBT_FLOAT:
+		{
+			var value float32
+			err := binary.Read(reader, binary.BigEndian, &value)
+			return value, err
+		}
+	case NBT_DOUBLE:
+		{
+			var value float64
+			err := binary.Read(reader, binary.BigEndian, &value)
+			return value, err
+		}
+	case NBT_BYTE_ARRAY:
+		{
+			length, err := readNbtLength(reader)
+			if err != nil {
+				return nil, err
+			}
+			value := make([]byte, length)
+			_, err = io.ReadFull(reader, value)
+			return value, err
+		}
+	case NBT_STRING:
+		{
+			return readNbtString(reader)
+		}
+	case NBT_LIST:
+		{
+			var element byte
+			err := binary.Read(reader, binary.BigEndian, &element)
+			if err != nil {
+				return nil, err
+			}
+			// Empty lists never read a value, the type has to be checked before anything uses it
+			if element > NBT_LONG_ARRAY {
+				return nil, errors.New(fmt.Sprintf("unknown NBT tag type %d of list elements", element))
+			}
+			length, err := readNbtLength(reader)
+			if err != nil {
+				return nil, err
+			}
+			list := &NbtList{
+				Type: element,
+			}
+			for i := 0; i < length; i++ {
+				value, err := readNbtValue(reader, element, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				list.Values = append(list.Values, value)
+			}
+			return list, nil
+		}
+	case NBT_COMPOUND:
+		{
+			children := []NbtTag{}
+			for {
+				var child byte
+				err := binary.Read(reader, binary.BigEndian, &child)
+				if err != nil {
+					return nil, err
+				}
+				if child == NBT_END {
+					return children, nil
+				}
+				name, err := readNbtString(reader)
+				if err != nil {
+					return nil, err
+				}
+				value, err := readNbtValue(reader, child, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				children = append(children, NbtTag{
+					Type:  child,
+					Name:  name,
+					Value: value,
+				})
+			}
+		}
+	case NBT_INT_ARRAY:
+		{
+			length, err := readNbtLength(reader)
+			if err != nil {
+				return nil, err
+			}
+			value := make([]int32, length)
+			err = binary.Read(reader, binary.BigEndian, value)
+			return value, err
+		}
+	case NBT_LONG_ARRAY:
+		{
+			length, err := readNbtLength(reader)
+			if err != nil {
+				return nil, err
+			}
+			value := make([]int64, length)
+			err = binary.Read(reader, binary.BigEndian, value)
+			return value, err
+		}
+	default:
+		{
+			return nil, errors.New(fmt.Sprintf("unknown NBT tag type %d", kind))
+		}
+	}
+}
+
+// Writes a single named tag, the root of an NBT file.
+func writeNbt(writer io.Writer, tag *NbtTag) error {
+	err := binary.Write(writer, binary.BigEndian, tag.Type)
+	if err != nil {
+		return err
+	}
+	err = writeNbtString(writer, tag.Name)
+	if err != nil {
+		return err
+	}
+	return writeNbtValue(writer, tag.Type, tag.Value)
+}
+
+func writeNbtString(writer io.Writer, value string) error {
+	if len(value) > math.MaxUint16 {
+		return errors.New("NBT string is too long")
+	}
+	err := binary.Write(writer, binary.BigEndian, uint16(len(value)))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, value)
+	return err
+}
+
+func writeNbtValue(writer io.Writer, kind byte, value any) error {
+	switch kind {
+	case NBT_BYTE, NBT_SHORT, NBT_INT, NBT_LONG, NBT_FLOAT, NBT_DOUBLE:
+		{
+			return binary.Write(writer, binary.BigEndian, value)
+		}
+	case NBT_BYTE_ARRAY, NBT_INT_ARRAY, NBT_LONG_ARRAY:
+		{
+			length := 0
+			switch array := value.(type) {
+			case []byte:
+				{
+					length = len(array)
+				}
+			case []int32:
+				{
+					length = len(array)
+				}
+			case []int64:
+				{
+					length = len(array)
+				}
+			default:
+				{
+					return errors.New(fmt.Sprintf("%T is not a valid %s value", value, nbtTypeNames[kind]))
+				}
+			}
+			err := binary.Write(writer, binary.BigEndian, int32(length))
+			if err != nil {
+				return err
+			}
+			return binary.Write(writer, binary.BigEndian, value)
+		}
+	case NBT_STRING:
+		{
+			text, ok := value.(string)
+			if !ok {
+				return errors.New(fmt.Sprintf("%T is not a valid %s value", value, nbtTypeNames[kind]))
+			}
+			return writeNbtString(writer, text)
+		}
+	case NBT_LIST:
+		{
+			list, ok := value.(*NbtList)
+			if !ok {
+				return errors.New(fmt.Sprintf("%T is not a valid %s value", value, nbtTypeNames[kind]))
+			}
+			err := binary.Write(writer, binary.BigEndian, list.Type)
+			if err != nil {
+				return err
+			}
+			err = binary.Write(writer, binary.BigEndian, int32(len(list.Values)))
+			if err != nil {
+				return err
+			}
+			for i := range list.Values {
+				err = writeNbtValue(writer, list.Type, list.Values[i])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case NBT_COMPOUND:
+		{
+			children, ok := value.([]NbtTag)
+			if !ok {
+				return errors.New(fmt.Sprintf("%T is not a valid %s value", value, nbtTypeNames[kind]))
+			}
+			for i := range children {
+				err := writeNbt(writer, &children[i])
+				if err != nil {
+					return err
+				}
+			}
+			return binary.Write(writer, binary.BigEndian, NBT_END)
+		}
+	default:
+		{
+			return errors.New(fmt.Sprintf("unknown NBT tag type %d", kind))
+		}
+	}
+}
+
+// Formats a tag and everything inside of it as an indented tree.
+func formatNbt(builder *strings.Builder, kind byte, name string, value any, indent int) {
+	builder.WriteString(strings.Repeat("  ", indent))
+	builder.WriteString(nbtTypeNames[kind])
+	if name != "" {
+		builder.WriteString(fmt.Sprintf("(%q)", name))
+	}
+	builder.WriteString(": ")
+
+	switch kind {
+	case NBT_LIST:
+		{
+			list, ok := value.(*NbtList)
+			if !ok {
+				builder.WriteString(fmt.Sprintf("%v\n", value))
+				return
+			}
+			builder.WriteString(fmt.Sprintf("%d entries of %s\n", len(list.Values), nbtTypeNames[list.Type]))
+			for i := range list.Values {
+				formatNbt(builder, list.Type, "", list.Values[i], indent+1)
+			}
+		}
+	case NBT_COMPOUND:
+		{
+			children, ok := value.([]NbtTag)
+			if !ok {
+				builder.WriteString(fmt.Sprintf("%v\n", value))
+				return
+			}
+			builder.WriteString(fmt.Sprintf("%d entries\n", len(children)))
+			sorted := append([]NbtTag{}, children...)
+			sort.SliceStable(sorted, func(a int, b int) bool {
+				return sorted[a].Name < sorted[b].Name
+			})
+			for i := range sorted {
+				formatNbt(builder, sorted[i].Type, sorted[i].Name, sorted[i].Value, indent+1)
+			}
+		}
+	case NBT_STRING:
+		{
+			builder.WriteString(fmt.Sprintf("%q\n", value))
+		}
+	default:
+		{
+			builder.WriteString(fmt.Sprintf("%v\n", value))
+		}
+	}
+}
+
+// Adds a server to the multiplayer list of the game in servers.dat, unless a server with the address is already there.
+func addServerToList(gameDir string, name string, address string) error {
+	path := gameDir + "/servers.dat"
+	root := &NbtTag{
+		Type:  NBT_COMPOUND,
+		Value: []NbtTag{},
+	}
+	if fileExists(path) {
+		var err error
+		root, _, err = readNbtFile(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	servers := &NbtList{
+		Type: NBT_COMPOUND,
+	}
+	existing := root.child("servers")
+	if existing != nil {
+		list, ok := existing.Value.(*NbtList)
+		if ok && (list.Type == NBT_COMPOUND || len(list.Values) == 0) {
+			servers = list
+			servers.Type = NBT_COMPOUND
+		}
+	}
+
+	for i := range servers.Values {
+		server := NbtTag{
+			Type:  NBT_COMPOUND,
+			Value: servers.Values[i],
+		}
+		ip := server.child("ip")
+		if ip != nil && ip.Value == address {
+			return nil
+		}
+	}
+
+	servers.Values = append(servers.Values, []NbtTag{
+		{
+			Type:  NBT_STRING,
+			Name:  "name",
+			Value: name,
+		},
+		{
+			Type:  NBT_STRING,
+			Name:  "ip",
+			Value: address,
+		},
+	})
+	root.setChild(NbtTag{
+		Type:  NBT_LIST,
+		Name:  "servers",
+		Value: servers,
+	})
+	return writeNbtFile(path, root, false)
+}
+
+var nbtCommands = []Command{
+	{
+		Name:        "print",
+		Usage:       "<file>",
+		Description: "Prints the contents of an NBT file like level.dat or servers.dat",
+		Run:         nbtPrintCommand,
+	},
+}
+
+func nbtCommand(base string, args []string) error {
+	return runCommand(nbtCommands, base, args)
+}
+
+func nbtPrintCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one file")
+	}
+
+	tag, compressed, err := readNbtFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var builder strings.Builder
+	if compressed {
+		builder.WriteString("(gzip compressed)\n")
+	}
+	formatNbt(&builder, tag.Type, tag.Name, tag.Value, 0)
+	fmt.Print(builder.String())
+	return nil
+}
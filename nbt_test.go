@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNbtRejectsUnknownListTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "empty list",
+			data: []byte{NBT_LIST, 0, 0, 0xff, 0, 0, 0, 0},
+		},
+		{
+			name: "list in compound",
+			data: []byte{NBT_COMPOUND, 0, 0, NBT_LIST, 0, 1, 'a', 13, 0, 0, 0, 0, NBT_END},
+		},
+	}
+	for i := range tests {
+		test := tests[i]
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readNbt(bytes.NewReader(test.data))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestNbtRoundTrip(t *testing.T) {
+	tag := &NbtTag{
+		Type: NBT_COMPOUND,
+		Value: []NbtTag{
+			{
+				Type: NBT_LIST,
+				Name: "servers",
+				Value: &NbtList{
+					Type: NBT_END,
+				},
+			},
+			{
+				Type:  NBT_LONG_ARRAY,
+				Name:  "longs",
+				Value: []int64{1, -2},
+			},
+		},
+	}
+	var buffer bytes.Buffer
+	err := writeNbt(&buffer, tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := readNbt(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var builder strings.Builder
+	formatNbt(&builder, read.Type, read.Name, read.Value, 0)
+	expected := "TAG_Compound: 2 entries\n" +
+		"  TAG_Long_Array(\"longs\"): [1 -2]\n" +
+		"  TAG_List(\"servers\"): 0 entries of TAG_End\n"
+	if builder.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, builder.String())
+	}
+}
+
+func TestWorldDataVersion(t *testing.T) {
+	world := t.TempDir()
+	err := writeNbtFile(world+"/level.dat", &NbtTag{
+		Type: NBT_COMPOUND,
+		Value: []NbtTag{
+			{
+				Type: NBT_COMPOUND,
+				Name: "Data",
+				Value: []NbtTag{
+					{
+						Type:  NBT_INT,
+						Name:  "DataVersion",
+						Value: int32(3700),
+					},
+				},
+			},
+		},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := worldDataVersion(world)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3700 {
+		t.Fatalf("expected 3700, got %d", version)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var httpClient *http.Client
+
+// Hosts that sent something that contradicts the manifests during this run.
+var suspectHosts = map[string]bool{}
+var suspectHostsLock sync.Mutex
+
+// Sets up the shared HTTP client from the network configuration, needs to be called after the config is loaded.
+func setupNetwork() {
+	network := &config.Network
+	profile := performanceProfile()
+	profile.DownloadConcurrency = limitToOpenFiles(profile.DownloadConcurrency)
+	profile.PerHostConcurrency = limitToOpenFiles(profile.PerHostConcurrency)
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(network.ConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if network.DnsCacheTtl > 0 {
+		transport.DialContext = dnsCache.dialContext(dialer)
+	}
+	transport.TLSHandshakeTimeout = time.Duration(network.ConnectTimeout)
+	transport.ResponseHeaderTimeout = time.Duration(network.ReadTimeout)
+	transport.MaxConnsPerHost = profile.PerHostConcurrency
+	transport.MaxIdleConnsPerHost = profile.PerHostConcurrency
+	if network.Proxy != "" {
+		// Validated when the config was loaded
+		proxy, _ := url.Parse(network.Proxy)
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	httpClient = &http.Client{
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+	downloadPool = newDownloadPool(profile.DownloadConcurrency)
+	downloadBucket = nil
+	if network.RateLimit > 0 {
+		downloadBucket = newTokenBucket(network.RateLimit)
+	}
+}
+
+// Cancels the request of a response body when no data arrives for too long, a total timeout would kill large downloads
+// on slow connections.
+type timeoutReader struct {
+	reader  io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+func (this *timeoutReader) Read(buffer []byte) (int, error) {
+	this.timer.Reset(this.timeout)
+	return this.reader.Read(buffer)
+}
+
+func (this *timeoutReader) Close() error {
+	this.timer.Stop()
+	this.cancel()
+	return this.reader.Close()
+}
+
+// Returned by httpGet when the server responds with anything but a success.
+type StatusError struct {
+	Url    string
+	Status string
+	Code   int
+	// How long the server asked to wait before trying again, 0 if it did not say.
+	RetryAfter time.Duration
+}
+
+func (this *StatusError) Error() string {
+	return "server responded to " + this.Url + " with " + this.Status
+}
+
+// Wraps errors that retrying would not fix.
+type PermanentError struct {
+	Err error
+}
+
+func (this *PermanentError) Error() string {
+	return this.Err.Error()
+}
+
+func (this *PermanentError) Unwrap() error {
+	return this.Err
+}
+
+// Checks if retrying could fix an error. Everything is retried except for permanent errors and responses that are not
+// server errors or rate limits.
+func isTransient(err error) bool {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code/100 == 5 || status.Code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// Hosts that asked us to slow down, mapped to the time requests to them may continue.
+var hostBackoffs = map[string]time.Time{}
+var hostBackoffsLock sync.Mutex
+
+// Parses a Retry-After header, either a number of seconds or a date. Returns 0 when there is none.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(header)
+	if err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	date, err := http.ParseTime(header)
+	if err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// Holds back every request to a host for a while.
+func backOffHost(host string, delay time.Duration) {
+	hostBackoffsLock.Lock()
+	defer hostBackoffsLock.Unlock()
+	until := time.Now().Add(delay)
+	if until.After(hostBackoffs[host]) {
+		hostBackoffs[host] = until
+	}
+}
+
+// Waits until a host accepts requests again, or the launcher is interrupted.
+func waitForHost(host string) error {
+	hostBackoffsLock.Lock()
+	delay := time.Until(hostBackoffs[host])
+	hostBackoffsLock.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(delay):
+		{
+			return nil
+		}
+	case <-launcherContext.Done():
+		{
+			return errInterrupted
+		}
+	}
+}
+
+// Returns how long to wait before an attempt, doubling the configured backoff for every failed attempt up to the
+// configured maximum. Half of the delay is random so parallel downloads don't retry in lock step.
+func retryDelay(attempt int) time.Duration {
+	delay := time.Duration(config.Network.Backoff)
+	for i := 2; i < attempt && delay < time.Duration(config.Network.MaxBackoff); i++ {
+		delay *= 2
+	}
+	delay = min(delay, time.Duration(config.Network.MaxBackoff))
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Runs an attempt to transfer something from a URL until it succeeds, fails with an error that is not transient or the
+// configured amount of retries is used up. Stops early when the launcher is interrupted.
+func retry(url string, attempt func() error) error {
+	var failures error
+	attempts := config.Network.Retries + 1
+	for current := 1; current <= attempts; current++ {
+		if current > 1 {
+			select {
+			case <-time.After(retryDelay(current)):
+			case <-launcherContext.Done():
+			}
+		}
+		err := checkInterrupted()
+		if err != nil {
+			return errors.Join(errors.New("failed to download "+url), err)
+		}
+
+		err = attempt()
+		if err == nil {
+			return nil
+		}
+		if checkInterrupted() != nil {
+			// Whatever failed, it failed because the request was cancelled
+			return errors.Join(errors.New("failed to download "+url), errInterrupted)
+		}
+		failures = errors.Join(failures, errors.New(fmt.Sprintf("attempt %d of %d failed", current, attempts)), err)
+		if !isTransient(err) {
+			break
+		}
+	}
+
+	return errors.Join(errors.New("failed to download "+url), failures)
+}
+
+// Rewrites a URL to go through the single host reverse proxy when one is configured, otherwise it is returned as is.
+func rewriteUrl(rawUrl string) string {
+	if config.SingleHost.Base == "" {
+		return rawUrl
+	}
+
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || parsed.Host == "" {
+		return rawUrl
+	}
+
+	upstream, ok := config.SingleHost.Upstreams[parsed.Host]
+	if !ok {
+		upstream = parsed.Host
+	}
+
+	rewritten := strings.TrimSuffix(config.SingleHost.Base, "/") + "/" + strings.Trim(upstream, "/") + parsed.EscapedPath()
+	if parsed.RawQuery != "" {
+		rewritten += "?" + parsed.RawQuery
+	}
+	return rewritten
+}
+
+// Keeps redirects inside of the single host reverse proxy, servers like GitHub redirect downloads to other hosts. The
+// headers of the redirected request are updated for the host it goes to.
+func checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	if config.SingleHost.Base != "" {
+		proxy, err := url.Parse(config.SingleHost.Base)
+		if err != nil {
+			return err
+		}
+		if request.URL.Host != proxy.Host {
+			rewritten, err := url.Parse(rewriteUrl(request.URL.String()))
+			if err != nil {
+				return err
+			}
+			request.URL = rewritten
+			request.Host = rewritten.Host
+		}
+	}
+
+	applyHeaders(request)
+	return nil
+}
+
+// Sets the User-Agent and the configured headers of the host a request goes to. Headers configured for other hosts are
+// removed, redirected requests start out with the headers of the original one.
+func applyHeaders(request *http.Request) {
+	request.Header.Set("User-Agent", config.Network.UserAgent)
+
+	host := request.URL.Hostname()
+	for other := range config.Network.Headers {
+		if other == host {
+			continue
+		}
+		for name := range config.Network.Headers[other] {
+			request.Header.Del(name)
+		}
+	}
+
+	headers := config.Network.Headers[host]
+	for name := range headers {
+		request.Header.Set(name, headers[name])
+	}
+}
+
+// Sends a GET request using the shared client. Responses that are not successful are turned into a StatusError. The
+// body of the returned response has to be closed.
+func httpGet(url string) (*http.Response, error) {
+	return httpGetFrom(url, 0)
+}
+
+// Like httpGet but asks the server to skip the first bytes of the response when the offset is not 0. Servers are free
+// to ignore that, only a response with the status 206 starts at the offset.
+func httpGetFrom(url string, offset int64) (*http.Response, error) {
+	if httpClient == nil {
+		setupNetwork()
+	}
+
+	ctx, cancel := context.WithCancel(launcherContext)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rewriteUrl(url), nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	applyHeaders(request)
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	err = waitForHost(request.URL.Host)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	recordTransfer(request.URL.Host, 1, 0)
+	if response.StatusCode/100 != 2 {
+		_ = response.Body.Close()
+		cancel()
+		status := &StatusError{
+			Url:        url,
+			Status:     response.Status,
+			Code:       response.StatusCode,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
+		if status.Code == http.StatusTooManyRequests || (status.Code == http.StatusServiceUnavailable && status.RetryAfter > 0) {
+			return nil, rateLimited(request.URL.Host, status)
+		}
+		return nil, status
+	}
+
+	if downloadBucket != nil {
+		response.Body = &limitedReader{
+			reader: response.Body,
+			bucket: downloadBucket,
+		}
+	}
+
+	timeout := time.Duration(config.Network.ReadTimeout)
+	response.Body = &timeoutReader{
+		reader: &auditReader{
+			reader: response.Body,
+			host:   request.URL.Host,
+		},
+		timer:   time.AfterFunc(timeout, cancel),
+		timeout: timeout,
+		cancel:  cancel,
+	}
+	return response, nil
+}
+
+// Makes every request to a host that responded with a rate limit wait as long as it asked, or the configured backoff
+// if it did not say. Waiting longer than the configured maximum is not worth it, the error becomes permanent then.
+func rateLimited(host string, status *StatusError) error {
+	delay := status.RetryAfter
+	if delay == 0 {
+		delay = time.Duration(config.Network.Backoff)
+	}
+	if delay > time.Duration(config.Network.MaxRetryAfter) {
+		return &PermanentError{
+			Err: errors.Join(errors.New(fmt.Sprintf("%s asked to wait %s, longer than network.maxRetryAfter", host, delay)), status),
+		}
+	}
+
+	fmt.Printf("%s is rate limiting, waiting %s\n", host, delay.Round(time.Second))
+	backOffHost(host, delay)
+	return status
+}
+
+// Flags the host of a URL as suspect for the rest of the run, printing a warning the first time.
+func flagSuspect(rawUrl string, reason string) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return
+	}
+
+	suspectHostsLock.Lock()
+	defer suspectHostsLock.Unlock()
+	if !suspectHosts[parsed.Host] {
+		suspectHosts[parsed.Host] = true
+		fmt.Printf("Warning: %s is suspect, it %s\n", parsed.Host, reason)
+	}
+}
+
+// Checks if the host of a URL was flagged as suspect during this run.
+func isSuspect(rawUrl string) bool {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+
+	suspectHostsLock.Lock()
+	defer suspectHostsLock.Unlock()
+	return suspectHosts[parsed.Host]
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Converts a maven coordinate (group:artifact:version[:classifier][@extension]) into the path of the artifact inside of
+// a maven repository.
+func mavenPath(coordinate string) (string, error) {
+	extension := "jar"
+	index := strings.LastIndex(coordinate, "@")
+	if index != -1 {
+		extension = coordinate[index+1:]
+		coordinate = coordinate[:index]
+	}
+
+	parts := strings.Split(coordinate, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return "", errors.New("invalid maven coordinate " + coordinate)
+	}
+	for i := range parts {
+		if parts[i] == "" {
+			return "", errors.New("invalid maven coordinate " + coordinate)
+		}
+	}
+
+	group := strings.ReplaceAll(parts[0], ".", "/")
+	artifact := parts[1]
+	version := parts[2]
+	file := artifact + "-" + version
+	if len(parts) == 4 {
+		file += "-" + parts[3]
+	}
+
+	return group + "/" + artifact + "/" + version + "/" + file + "." + extension, nil
+}
+
+// Looks for a replacement of an artifact in the configured override repository. Artifacts are matched by their maven
+// path first and by a file named after their hash second, either may be empty. Returns an empty string when there is
+// no override repository or no matching file.
+func findOverride(path string, hash string) string {
+	if config.OverrideRepository == "" {
+		return ""
+	}
+
+	if path != "" {
+		override := config.OverrideRepository + "/" + path
+		if fileExists(override) {
+			return override
+		}
+	}
+
+	if hash != "" {
+		override := config.OverrideRepository + "/" + hash
+		if fileExists(override) {
+			return override
+		}
+	}
+
+	return ""
+}
+
+// Finds the override of a library, matching by the maven path of its artifact or by its maven coordinate.
+func findLibraryOverride(library *Library) string {
+	override := findOverride(library.Downloads.Artifact.Path, library.Downloads.Artifact.Sha1)
+	if override != "" || library.Name == "" {
+		return override
+	}
+
+	path, err := mavenPath(library.Name)
+	if err != nil {
+		return ""
+	}
+	return findOverride(path, "")
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The hosts the mrpack format allows downloads from, launchers are expected to refuse everything else.
+var mrpackHosts = []string{
+	"cdn.modrinth.com",
+	"github.com",
+	"raw.githubusercontent.com",
+	"gitlab.com",
+}
+
+// The dependencies of an mrpack that are mod loaders, mapped to the names instances use.
+var mrpackLoaders = map[string]string{
+	"fabric-loader": "fabric",
+	"quilt-loader":  "quilt",
+	"forge":         "forge",
+	"neoforge":      "neoforge",
+}
+
+type MrpackFile struct {
+	Path   string            `json:"path"`
+	Hashes map[string]string `json:"hashes"`
+	Env    *struct {
+		Client string `json:"client"`
+		Server string `json:"server"`
+	} `json:"env"`
+	Downloads []string `json:"downloads"`
+	FileSize  uint64   `json:"fileSize"`
+}
+
+func (this *MrpackFile) url() string {
+	return this.Downloads[0]
+}
+
+func (this *MrpackFile) hash() *string {
+	hash, ok := this.Hashes["sha1"]
+	if !ok {
+		return nil
+	}
+	return &hash
+}
+
+func (this *MrpackFile) size() uint64 {
+	return this.FileSize
+}
+
+// The modrinth.index.json of an mrpack.
+type MrpackIndex struct {
+	FormatVersion int               `json:"formatVersion"`
+	Game          string            `json:"game"`
+	VersionId     string            `json:"versionId"`
+	Name          string            `json:"name"`
+	Files         []MrpackFile      `json:"files"`
+	Dependencies  map[string]string `json:"dependencies"`
+}
+
+// The manifest.json of a CurseForge pack.
+type CurseForgeManifest struct {
+	Minecraft struct {
+		Version    string `json:"version"`
+		ModLoaders []struct {
+			Id      string `json:"id"`
+			Primary bool   `json:"primary"`
+		} `json:"modLoaders"`
+	} `json:"minecraft"`
+	ManifestType string `json:"manifestType"`
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Files        []struct {
+		ProjectId int  `json:"projectID"`
+		FileId    int  `json:"fileID"`
+		Required  bool `json:"required"`
+	} `json:"files"`
+	Overrides string `json:"overrides"`
+}
+
+// What importing a pack would do, gathered without downloading anything.
+type PackAnalysis struct {
+	Format  string
+	Name    string
+	Version string
+	Loader  *InstanceLoader
+	Mods    int
+	Files   int
+	// The bytes that would be downloaded, only known for files that declare their size.
+	DownloadSize uint64
+	UnknownSizes int
+	// Files that can not be downloaded, with the reason.
+	Unavailable []string
+	Overrides   int
+	// Why the report is incomplete, empty when it is not.
+	Partial string
+}
+
+// Returns the amount of memory to give a pack, a rough guess based on how many mods it has.
+func (this *PackAnalysis) recommendedMemory() string {
+	switch {
+	case this.Mods == 0:
+		{
+			return "2 GiB"
+		}
+	case this.Mods <= 50:
+		{
+			return "4 GiB"
+		}
+	case this.Mods <= 150:
+		{
+			return "6 GiB"
+		}
+	default:
+		{
+			return "8 GiB"
+		}
+	}
+}
+
+func (this *PackAnalysis) print() {
+	fmt.Printf("Pack:        %s %s (%s)\n", this.Name, this.Version, this.Format)
+	if this.Loader != nil {
+		fmt.Printf("Loader:      %s %s\n", this.Loader.Name, this.Loader.Version)
+	} else {
+		fmt.Println("Loader:      none")
+	}
+	fmt.Printf("Mods:        %d\n", this.Mods)
+	fmt.Printf("Files:       %d, %d overrides\n", this.Files, this.Overrides)
+	if this.UnknownSizes > 0 {
+		fmt.Printf("Download:    %s, %d files of unknown size\n", formatBytes(float64(this.DownloadSize)), this.UnknownSizes)
+	} else {
+		fmt.Printf("Download:    %s\n", formatBytes(float64(this.DownloadSize)))
+	}
+	fmt.Printf("Memory:      %s recommended\n", this.recommendedMemory())
+	if len(this.Unavailable) > 0 {
+		fmt.Printf("Unavailable: %d files\n", len(this.Unavailable))
+		for i := range this.Unavailable {
+			fmt.Printf("  %s\n", this.Unavailable[i])
+		}
+	}
+	if this.Partial != "" {
+		fmt.Printf("This report is partial, %s\n", this.Partial)
+	}
+}
+
+// Finds a file in a zip.
+func findZipFile(reader *zip.Reader, name string) *zip.File {
+	for i := range reader.File {
+		if reader.File[i].Name == name {
+			return reader.File[i]
+		}
+	}
+	return nil
+}
+
+// Resolves a path from a pack inside of a directory, refusing paths that would end up outside of it.
+func resolvePackPath(dir string, relative string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(relative, "\\", "/"))
+	if cleaned == "." || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") || strings.Contains(cleaned, ":") {
+		return "", errors.New("pack contains the unsafe path " + relative)
+	}
+	return dir + "/" + cleaned, nil
+}
+
+// Checks if a file of an mrpack can be downloaded, returns why not otherwise.
+func checkMrpackFile(file *MrpackFile) string {
+	if len(file.Downloads) == 0 {
+		return "no download"
+	}
+	parsed, err := url.Parse(file.Downloads[0])
+	if err != nil {
+		return "invalid download URL"
+	}
+	allowed := false
+	for i := range mrpackHosts {
+		allowed = allowed || parsed.Hostname() == mrpackHosts[i]
+	}
+	if !allowed {
+		return "download from " + parsed.Hostname() + " is not allowed"
+	}
+	if file.hash() == nil {
+		return "no SHA-1"
+	}
+	return ""
+}
+
+// Skips files the client does not need.
+func mrpackClientFile(file *MrpackFile) bool {
+	return file.Env == nil || file.Env.Client != "unsupported"
+}
+
+// Counts the files inside of the override directories of a pack.
+func countOverrides(reader *zip.Reader, prefixes []string) int {
+	count := 0
+	for i := range reader.File {
+		for o := range prefixes {
+			if strings.HasPrefix(reader.File[i].Name, prefixes[o]+"/") && !reader.File[i].FileInfo().IsDir() {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+func analyzeMrpack(reader *zip.Reader, index *MrpackIndex) *PackAnalysis {
+	analysis := &PackAnalysis{
+		Format:    "mrpack",
+		Name:      index.Name,
+		Version:   index.VersionId,
+		Overrides: countOverrides(reader, []string{"overrides", "client-overrides"}),
+	}
+	for dependency := range index.Dependencies {
+		loader, ok := mrpackLoaders[dependency]
+		if ok {
+			analysis.Loader = &InstanceLoader{
+				Name:    loader,
+				Version: index.Dependencies[dependency],
+			}
+		}
+	}
+
+	for i := range index.Files {
+		file := &index.Files[i]
+		if !mrpackClientFile(file) {
+			continue
+		}
+		analysis.Files++
+		if strings.HasPrefix(file.Path, "mods/") {
+			analysis.Mods++
+		}
+		if file.FileSize == 0 {
+			analysis.UnknownSizes++
+		}
+		analysis.DownloadSize += file.FileSize
+
+		reason := checkMrpackFile(file)
+		if reason != "" {
+			analysis.Unavailable = append(analysis.Unavailable, file.Path+": "+reason)
+		}
+	}
+	return analysis
+}
+
+// A file of a CurseForge project as the API of CurseForge describes it.
+type CurseForgeFile struct {
+	Id          int    `json:"id"`
+	FileName    string `json:"fileName"`
+	FileLength  uint64 `json:"fileLength"`
+	DownloadUrl string `json:"downloadUrl"`
+	IsAvailable bool   `json:"isAvailable"`
+}
+
+// Looks up the files of a CurseForge pack through the API of CurseForge, which needs a key configured in
+// network.headers. The files that could not be looked up are nil and have an error.
+func lookupCurseForgeFiles(manifest *CurseForgeManifest) ([]*CurseForgeFile, []error) {
+	files := make([]*CurseForgeFile, len(manifest.Files))
+	failures := make([]error, len(manifest.Files))
+	batch := downloadPool.batch("CurseForge")
+	for i := range manifest.Files {
+		index := i
+		project := manifest.Files[i].ProjectId
+		id := manifest.Files[i].FileId
+		batch.submit(func() error {
+			var response struct {
+				Data *CurseForgeFile `json:"data"`
+			}
+			err := downloadJsonRaw(fmt.Sprintf("%s/mods/%d/files/%d", CURSEFORGE_API, project, id), nil, &response)
+			if err == nil && response.Data == nil {
+				err = errors.New("CurseForge does not know it")
+			}
+			files[index] = response.Data
+			failures[index] = err
+			return nil
+		})
+	}
+	_ = batch.wait()
+	return files, failures
+}
+
+func analyzeCurseForge(reader *zip.Reader, manifest *CurseForgeManifest) *PackAnalysis {
+	overrides := manifest.Overrides
+	if overrides == "" {
+		overrides = "overrides"
+	}
+	analysis := &PackAnalysis{
+		Format:    "CurseForge",
+		Name:      manifest.Name,
+		Version:   manifest.Version,
+		Overrides: countOverrides(reader, []string{overrides}),
+	}
+	for i := range manifest.Minecraft.ModLoaders {
+		loader := manifest.Minecraft.ModLoaders[i]
+		if loader.Primary || analysis.Loader == nil {
+			name, version, _ := strings.Cut(loader.Id, "-")
+			analysis.Loader = &InstanceLoader{
+				Name:    name,
+				Version: version,
+			}
+		}
+	}
+
+	// The files are only described by ids, what they are is only known to the API
+	if len(config.Network.Headers["api.curseforge.com"]) == 0 {
+		analysis.Files = len(manifest.Files)
+		analysis.Mods = len(manifest.Files)
+		analysis.UnknownSizes = len(manifest.Files)
+		if len(manifest.Files) > 0 {
+			analysis.Partial = "configure a key for api.curseforge.com in network.headers to look up the names, sizes and availability of its files"
+		}
+		return analysis
+	}
+
+	files, failures := lookupCurseForgeFiles(manifest)
+	failed := 0
+	for i := range manifest.Files {
+		analysis.Files++
+		analysis.Mods++
+		if failures[i] != nil {
+			fmt.Printf("Failed to look up file %d of CurseForge project %d: %s\n", manifest.Files[i].FileId, manifest.Files[i].ProjectId, failures[i])
+			analysis.UnknownSizes++
+			failed++
+			continue
+		}
+
+		file := files[i]
+		if file.FileLength == 0 {
+			analysis.UnknownSizes++
+		}
+		analysis.DownloadSize += file.FileLength
+		if !manifest.Files[i].Required {
+			continue
+		}
+		if !file.IsAvailable {
+			analysis.Unavailable = append(analysis.Unavailable, file.FileName+": no longer available")
+		} else if file.DownloadUrl == "" {
+			analysis.Unavailable = append(analysis.Unavailable, file.FileName+": the author does not allow other launchers to download it")
+		}
+	}
+	if failed > 0 {
+		analysis.Partial = fmt.Sprintf("%d files could not be looked up on CurseForge", failed)
+	}
+	return analysis
+}
+
+var packCommands = []Command{
+	{
+		Name:        "import",
+		Usage:       "<file> [--name <instance>] [--analyze]",
+		Description: "Creates an instance from a Modrinth pack, or reports what importing a Modrinth or CurseForge pack would do",
+		Run:         packImportCommand,
+	},
+	{
+		Name:        "technic",
+		Usage:       "<slug or link> [--build <build>] [--name <instance>]",
+		Description: "Creates an instance from a pack of the Technic platform, from its Solder server or its zip",
+		Run:         packTechnicCommand,
+	},
+	{
+		Name:        "atlauncher",
+		Usage:       "<pack> [--version <version>] | --share-code <code> [--definition <Configs.json>] [--name <instance>]",
+		Description: "Creates an instance from an ATLauncher pack, with the optional mods a share code selects",
+		Run:         packAtLauncherCommand,
+	},
+	{
+		Name:        "ftb",
+		Usage:       "<pack id> [--version <version>] [--name <instance>]",
+		Description: "Creates an instance from a Feed The Beast pack, including the files it has on CurseForge",
+		Run:         packFtbCommand,
+	},
+}
+
+func packCommand(base string, args []string) error {
+	return runCommand(packCommands, base, args)
+}
+
+func packImportCommand(base string, args []string) error {
+	set := flag.NewFlagSet("pack import", flag.ContinueOnError)
+	name := set.String("name", "", "the name of the new instance, defaults to the name of the pack")
+	analyze := set.Bool("analyze", false, "only report what the import would do")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one pack file")
+	}
+
+	file := positional[0]
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return errors.Join(errors.New("failed to open pack "+file), err)
+	}
+	defer func() {
+		_ = archive.Close()
+	}()
+	reader := &archive.Reader
+
+	indexFile := findZipFile(reader, "modrinth.index.json")
+	if indexFile != nil {
+		var index MrpackIndex
+		err = readZipJson(indexFile, &index)
+		if err != nil {
+			return errors.Join(errors.New("failed to read modrinth.index.json of "+file), err)
+		}
+
+		analysis := analyzeMrpack(reader, &index)
+		if *analyze {
+			analysis.print()
+			return nil
+		}
+		return importMrpack(base, reader, &index, analysis, file, *name)
+	}
+
+	manifestFile := findZipFile(reader, "manifest.json")
+	if manifestFile != nil {
+		var manifest CurseForgeManifest
+		err = readZipJson(manifestFile, &manifest)
+		if err != nil {
+			return errors.Join(errors.New("failed to read manifest.json of "+file), err)
+		}
+		if manifest.ManifestType == "minecraftModpack" {
+			analysis := analyzeCurseForge(reader, &manifest)
+			if *analyze {
+				analysis.print()
+				return nil
+			}
+			return errors.New("CurseForge packs can only be analyzed, their files need the CurseForge API")
+		}
+	}
+
+	return errors.New(file + " is not a Modrinth or CurseForge pack")
+}
+
+// Creates an instance from an mrpack: downloads its files into the game directory and copies the overrides on top.
+func importMrpack(base string, reader *zip.Reader, index *MrpackIndex, analysis *PackAnalysis, file string, name string) error {
+	if index.Game != "minecraft" {
+		return errors.New("the pack is for " + index.Game + ", not minecraft")
+	}
+	if len(analysis.Unavailable) > 0 {
+		analysis.print()
+		return errors.New("the pack has files that can not be downloaded")
+	}
+	version := index.Dependencies["minecraft"]
+	if version == "" {
+		return errors.New("the pack does not say which version of the game it needs")
+	}
+
+	if name == "" {
+		name = sanitizeInstanceName(index.Name)
+	}
+	err := validateInstanceName(name)
+	if err != nil {
+		return err
+	}
+	if fileExists(instanceDir(base, name) + "/instance.json") {
+		return errors.New("instance " + name + " already exists")
+	}
+
+	source, err := filepath.Abs(file)
+	if err != nil {
+		source = file
+	}
+	instance := &Instance{
+		Name:       name,
+		Version:    version,
+		Loader:     analysis.Loader,
+		PackSource: source,
+	}
+	gameDir := instance.gameDir(base)
+
+	provenance.setPack(index.Name + " " + index.VersionId)
+	defer provenance.setPack("")
+	batch := downloadPool.batch("Pack")
+	for i := range index.Files {
+		packFile := &index.Files[i]
+		if !mrpackClientFile(packFile) {
+			continue
+		}
+		target, err := resolvePackPath(gameDir, packFile.Path)
+		if err != nil {
+			_ = batch.wait()
+			return err
+		}
+		batch.submit(func() error {
+			return downloadFile(target, packFile, batch.progress)
+		})
+	}
+	err = batch.wait()
+	if err != nil {
+		return errors.Join(errors.New("failed to download the files of "+index.Name), err)
+	}
+
+	// Client overrides win over the common ones
+	prefixes := []string{"overrides/", "client-overrides/"}
+	for i := range prefixes {
+		err = extractPackOverrides(reader, prefixes[i], gameDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = commitInstance(base, instance)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %s as instance %s (%s)\n", index.Name, name, version)
+	return nil
+}
+
+// Copies everything below a directory of a pack into the game directory.
+func extractPackOverrides(reader *zip.Reader, prefix string, gameDir string) error {
+	for i := range reader.File {
+		file := reader.File[i]
+		relative, ok := strings.CutPrefix(file.Name, prefix)
+		if !ok || relative == "" || file.FileInfo().IsDir() {
+			continue
+		}
+
+		target, err := resolvePackPath(gameDir, relative)
+		if err != nil {
+			return err
+		}
+		err = createParents(filepath.Dir(target))
+		if err != nil {
+			return errors.Join(errors.New("failed to create parents of "+target), err)
+		}
+
+		err = func() error {
+			in, err := file.Open()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = in.Close()
+			}()
+
+			out, err := createFile(target)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = out.Close()
+			}()
+
+			_, err = io.Copy(out, in)
+			return err
+		}()
+		if err != nil {
+			return errors.Join(errors.New("failed to extract "+file.Name), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// A panic that was turned into an error by recoverPanic. The stack is the one of the goroutine that panicked, it is
+// printed with the error so the bug can be reported.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (this *PanicError) Error() string {
+	return fmt.Sprintf("internal error: %v, please report this with the following stack\n%s", this.Value, this.Stack)
+}
+
+// Turns a panic of the function it is deferred in into an error returned by that function, so a bug in one command or
+// download fails it instead of the whole process. Commands and the jobs of pools and phases are run behind it.
+func recoverPanic(err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	*err = errors.Join(*err, &PanicError{
+		Value: recovered,
+		Stack: debug.Stack(),
+	})
+}
+
+// Runs a function, returning a panic as a PanicError.
+func runRecovering(function func() error) (err error) {
+	defer recoverPanic(&err)
+	return function()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Arguments of version JSONs written by hand or by loaders that get the format wrong have to fail to parse, not panic.
+func TestArgumentMalformedJson(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "number", json: `1`},
+		{name: "list", json: `["--demo"]`},
+		{name: "null value", json: `{"value": null}`},
+		{name: "no value", json: `{"rules": []}`},
+		{name: "numeric value", json: `{"value": 1}`},
+		{name: "object value", json: `{"value": {"a": "b"}}`},
+		{name: "numbers in value", json: `{"value": ["--width", 854]}`},
+		{name: "rules not a list", json: `{"rules": {"action": "allow"}, "value": "--demo"}`},
+		{name: "rule not an object", json: `{"rules": ["allow"], "value": "--demo"}`},
+		{name: "rule without action", json: `{"rules": [{"features": {"is_demo_user": true}}], "value": "--demo"}`},
+		{name: "numeric action", json: `{"rules": [{"action": 1}], "value": "--demo"}`},
+		{name: "feature not a boolean", json: `{"rules": [{"action": "allow", "features": {"is_demo_user": "yes"}}], "value": "--demo"}`},
+	}
+	for i := range tests {
+		test := tests[i]
+		t.Run(test.name, func(t *testing.T) {
+			var argument Argument
+			err := runRecovering(func() error {
+				return json.Unmarshal([]byte(test.json), &argument)
+			})
+			var panicked *PanicError
+			if errors.As(err, &panicked) {
+				t.Fatalf("panicked: %v", panicked.Value)
+			}
+			if err == nil {
+				t.Fatalf("expected an error, got %+v", argument)
+			}
+		})
+	}
+}
+
+func TestArgumentJson(t *testing.T) {
+	tests := []struct {
+		json  string
+		value []string
+		rules int
+	}{
+		{json: `"--demo"`, value: []string{"--demo"}},
+		{json: `{"value": "--demo"}`, value: []string{"--demo"}},
+		{json: `{"rules": [{"action": "allow", "os": "linux"}], "value": ["--width", "854"]}`, value: []string{"--width", "854"}, rules: 1},
+	}
+	for i := range tests {
+		var argument Argument
+		err := json.Unmarshal([]byte(tests[i].json), &argument)
+		if err != nil {
+			t.Errorf("%s: %s", tests[i].json, err)
+			continue
+		}
+		if strings.Join(argument.Value, " ") != strings.Join(tests[i].value, " ") || len(argument.Rules) != tests[i].rules {
+			t.Errorf("%s: got %+v", tests[i].json, argument)
+		}
+	}
+}
+
+// Waiting for the game can fail for other reasons than the exit of the process, those are errors and not exit codes.
+func TestClassifyExitWithoutExitError(t *testing.T) {
+	tests := []error{
+		exec.ErrNotFound,
+		errors.New("exec: already started"),
+		fmt.Errorf("wrapped: %w", errors.New("broken pipe")),
+	}
+	for i := range tests {
+		var exit *GameExit
+		err := runRecovering(func() error {
+			var err error
+			exit, err = classifyExit(tests[i], t.TempDir(), time.Now())
+			return err
+		})
+		var panicked *PanicError
+		if errors.As(err, &panicked) {
+			t.Fatalf("%s: panicked: %v", tests[i], panicked.Value)
+		}
+		if !errors.Is(err, tests[i]) || exit != nil {
+			t.Errorf("%s: expected the error to be returned, got %v and %+v", tests[i], err, exit)
+		}
+	}
+
+	exit, err := classifyExit(nil, t.TempDir(), time.Now())
+	if err != nil || exit.Kind != GAME_EXIT_CLEAN || exit.Code != 0 {
+		t.Fatalf("expected a clean exit, got %+v and %v", exit, err)
+	}
+}
+
+// A bug in a command has to fail the command instead of the launcher.
+func TestRunCommandRecoversPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(base string, args []string) error
+	}{
+		{
+			name: "nil map",
+			run: func(base string, args []string) error {
+				var values map[string]string
+				values[base] = args[0]
+				return nil
+			},
+		},
+		{
+			name: "type assertion",
+			run: func(base string, args []string) error {
+				var value any = base
+				_ = value.(int)
+				return nil
+			},
+		},
+		{
+			name: "index",
+			run: func(base string, args []string) error {
+				_ = args[len(args)]
+				return nil
+			},
+		},
+	}
+	for i := range tests {
+		commands := []Command{
+			{
+				Name: "test",
+				Run:  tests[i].run,
+			},
+		}
+		err := runCommand(commands, t.TempDir(), []string{"test", "argument"})
+		var panicked *PanicError
+		if !errors.As(err, &panicked) {
+			t.Errorf("%s: expected a PanicError, got %v", tests[i].name, err)
+		}
+	}
+}
+
+func TestDownloadBatchRecoversPanics(t *testing.T) {
+	pool := newDownloadPool(2)
+	batch := pool.batch("Test")
+	batch.submit(func() error {
+		var values map[string]int
+		values["a"]++
+		return nil
+	})
+	err := batch.wait()
+	var panicked *PanicError
+	if !errors.As(err, &panicked) {
+		t.Fatalf("expected a PanicError, got %v", err)
+	}
+}
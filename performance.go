@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// One download at a time with small buffers, for slow machines, metered connections and laptops on battery.
+	PERFORMANCE_LOW_POWER string = "low-power"
+	// The concurrency of the network section of the config, one phase of a launch after another.
+	PERFORMANCE_DEFAULT string = "default"
+	// Many downloads with large buffers, the libraries, assets and client of a launch are downloaded at the same time.
+	PERFORMANCE_MAX string = "max"
+)
+
+var performanceProfiles = []string{
+	PERFORMANCE_LOW_POWER,
+	PERFORMANCE_DEFAULT,
+	PERFORMANCE_MAX,
+}
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// The files the launcher keeps open besides the ones of downloads, like logs, the hash cache and idle connections.
+	OPEN_FILES_RESERVED uint64 = 64
+	// A download has a connection and the file it writes open, an extraction the archive and the file it writes.
+	OPEN_FILES_PER_WORKER uint64 = 2
+)
+
+var openFilesWarning sync.Once
+
+// Everything a performance profile decides.
+type PerformanceProfile struct {
+	// How many files are downloaded at once.
+	DownloadConcurrency int
+	// How many connections may be open to a single host at once, 0 for no limit.
+	PerHostConcurrency int
+	// The size of the buffers files are copied and hashed with.
+	BufferSize int
+	// Runs the download phases of a launch at the same time instead of one after another.
+	OverlapPhases bool
+}
+
+// Returns the profile the config selects. The default one uses the concurrency of the network section, the others
+// replace it.
+func performanceProfile() PerformanceProfile {
+	switch config.Performance {
+	case PERFORMANCE_LOW_POWER:
+		{
+			return PerformanceProfile{
+				DownloadConcurrency: 1,
+				PerHostConcurrency:  1,
+				BufferSize:          8 * 1024,
+			}
+		}
+	case PERFORMANCE_MAX:
+		{
+			return PerformanceProfile{
+				DownloadConcurrency: 64,
+				PerHostConcurrency:  32,
+				BufferSize:          256 * 1024,
+				OverlapPhases:       true,
+			}
+		}
+	default:
+		{
+			return PerformanceProfile{
+				DownloadConcurrency: config.Network.DownloadConcurrency,
+				PerHostConcurrency:  config.Network.PerHostConcurrency,
+				BufferSize:          32 * 1024,
+			}
+		}
+	}
+}
+
+// Lowers a number of workers that would open more files at once than the system allows, the default limit of macOS is
+// only 256. Warns once when the limit is that low.
+func limitToOpenFiles(workers int) int {
+	limit := openFileLimit()
+	if limit == 0 || workers <= 0 {
+		return workers
+	}
+
+	allowed := 1
+	if limit > OPEN_FILES_RESERVED+OPEN_FILES_PER_WORKER {
+		allowed = int(min((limit-OPEN_FILES_RESERVED)/OPEN_FILES_PER_WORKER, uint64(workers)))
+	}
+	if allowed < workers {
+		openFilesWarning.Do(func() {
+			fmt.Printf("Warning: only %d files may be open at once, downloads are limited to %d at a time. Raise the limit with \"ulimit -n\" for faster downloads\n", limit, allowed)
+		})
+	}
+	return allowed
+}
+
+func validatePerformanceProfile(name string) error {
+	if name != "" && !slices.Contains(performanceProfiles, name) {
+		return errors.New("unknown performance profile " + name + ", expected one of " + strings.Join(performanceProfiles, ", "))
+	}
+	return nil
+}
+
+// Copies everything from a reader to a writer with a buffer of the size the performance profile selects. io.CopyBuffer
+// ignores the buffer when the writer is an io.ReaderFrom or the reader an io.WriterTo, like files are, so both are
+// hidden behind types that are neither.
+func copyBuffered(destination io.Writer, source io.Reader) (int64, error) {
+	return io.CopyBuffer(plainWriter{destination}, plainReader{source}, make([]byte, performanceProfile().BufferSize))
+}
+
+// Hides every method of a writer but Write.
+type plainWriter struct {
+	io.Writer
+}
+
+// Hides every method of a reader but Read.
+type plainReader struct {
+	io.Reader
+}
+
+// Runs the phases of a launch, at the same time when the performance profile overlaps them. Returns the errors of
+// every phase that failed, phases that run one after another stop at the first one.
+func runPhases(phases ...func() error) error {
+	if !performanceProfile().OverlapPhases {
+		for i := range phases {
+			err := phases[i]()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var waitGroup sync.WaitGroup
+	errs := make([]error, len(phases))
+	for i := range phases {
+		waitGroup.Add(1)
+		go func(index int) {
+			defer waitGroup.Done()
+			errs[index] = runRecovering(phases[index])
+		}(i)
+	}
+	waitGroup.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// The fingerprint of the key Adoptium signs its releases with.
+	ADOPTIUM_KEY_FINGERPRINT string = "3b04d753c9050d9a5d343f39843c48a565f8f04b"
+	// The file in embeddedKeys with that key, exported with "gpg --armor --export".
+	ADOPTIUM_KEY_FILE string = "keys/adoptium.asc"
+
+	PGP_TAG_SIGNATURE    byte = 2
+	PGP_TAG_PUBLIC_KEY   byte = 6
+	PGP_ALGORITHM_RSA    byte = 1
+	PGP_BINARY_SIGNATURE byte = 0
+
+	PGP_MAX_SIGNATURE_SIZE int64 = 64 * 1024
+)
+
+// The public keys built into the launcher.
+//
+//go:embed keys
+var embeddedKeys embed.FS
+
+// The hash algorithms signatures may use, weaker ones like SHA-1 are refused.
+var pgpHashes = map[byte]crypto.Hash{
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+// An RSA public key of OpenPGP, only version 4 keys are understood.
+type PgpKey struct {
+	Fingerprint string
+	Key         *rsa.PublicKey
+}
+
+// A version 4 signature over a binary document.
+type PgpSignature struct {
+	Hash crypto.Hash
+	// The part of the packet that is hashed together with the document.
+	Hashed []byte
+	// The fingerprint or, for older signatures, the key ID of the key that made the signature.
+	Issuer    string
+	Signature []byte
+}
+
+// Removes the ASCII armor of OpenPGP data, data without armor is returned as it is.
+func dearmor(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP")) {
+		return data, nil
+	}
+
+	var body strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	state := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case state == 0 && strings.HasPrefix(line, "-----BEGIN PGP"):
+			{
+				state = 1
+			}
+		case state == 1 && line == "":
+			{
+				// The headers end at the first empty line
+				state = 2
+			}
+		case state == 1 && !strings.Contains(line, ":"):
+			{
+				// No headers at all
+				state = 2
+				body.WriteString(line)
+			}
+		case state == 2 && (strings.HasPrefix(line, "=") || strings.HasPrefix(line, "-----END")):
+			{
+				state = 3
+			}
+		case state == 2:
+			{
+				body.WriteString(line)
+			}
+		}
+	}
+	if state != 3 {
+		return nil, errors.New("broken PGP armor")
+	}
+	return base64.StdEncoding.DecodeString(body.String())
+}
+
+// Splits OpenPGP data into its packets. Returns the tag and body of every packet, packets of partial length are not
+// supported since keys and signatures don't use them.
+func readPgpPackets(data []byte) ([]byte, [][]byte, error) {
+	var tags []byte
+	var bodies [][]byte
+	for len(data) > 0 {
+		header := data[0]
+		if header&0x80 == 0 {
+			return nil, nil, errors.New("invalid PGP packet header")
+		}
+
+		var tag byte
+		var length int
+		var offset int
+		if header&0x40 != 0 {
+			tag = header & 0x3f
+			if len(data) < 2 {
+				return nil, nil, errors.New("truncated PGP packet")
+			}
+			switch first := int(data[1]); {
+			case first < 192:
+				{
+					length, offset = first, 2
+				}
+			case first < 224:
+				{
+					if len(data) < 3 {
+						return nil, nil, errors.New("truncated PGP packet")
+					}
+					length, offset = (first-192)<<8+int(data[2])+192, 3
+				}
+			case first == 255:
+				{
+					if len(data) < 6 {
+						return nil, nil, errors.New("truncated PGP packet")
+					}
+					length, offset = int(binary.BigEndian.Uint32(data[2:6])), 6
+				}
+			default:
+				{
+					return nil, nil, errors.New("PGP packets of partial length are not supported")
+				}
+			}
+		} else {
+			tag = (header >> 2) & 0x0f
+			sizes := []int{1, 2, 4}
+			kind := int(header & 0x03)
+			if kind == 3 {
+				length, offset = len(data)-1, 1
+			} else {
+				size := sizes[kind]
+				if len(data) < 1+size {
+					return nil, nil, errors.New("truncated PGP packet")
+				}
+				for i := 0; i < size; i++ {
+					length = length<<8 | int(data[1+i])
+				}
+				offset = 1 + size
+			}
+		}
+
+		if length < 0 || offset+length > len(data) {
+			return nil, nil, errors.New("truncated PGP packet")
+		}
+		tags = append(tags, tag)
+		bodies = append(bodies, data[offset:offset+length])
+		data = data[offset+length:]
+	}
+	return tags, bodies, nil
+}
+
+// Reads a multiprecision integer of OpenPGP. Returns the integer and the rest of the data.
+func readMpi(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("truncated PGP integer")
+	}
+	bits := int(binary.BigEndian.Uint16(data))
+	length := (bits + 7) / 8
+	if len(data) < 2+length {
+		return nil, nil, errors.New("truncated PGP integer")
+	}
+	return data[2 : 2+length], data[2+length:], nil
+}
+
+// Reads the primary key of an OpenPGP public key, it has to be an RSA key.
+func readPgpKey(data []byte) (*PgpKey, error) {
+	data, err := dearmor(data)
+	if err != nil {
+		return nil, err
+	}
+	tags, bodies, err := readPgpPackets(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 || tags[0] != PGP_TAG_PUBLIC_KEY {
+		return nil, errors.New("not a PGP public key")
+	}
+
+	body := bodies[0]
+	if len(body) < 6 || body[0] != 4 {
+		return nil, errors.New("only version 4 PGP keys are supported")
+	}
+	if body[5] != PGP_ALGORITHM_RSA {
+		return nil, errors.New("only RSA PGP keys are supported")
+	}
+	modulus, rest, err := readMpi(body[6:])
+	if err != nil {
+		return nil, err
+	}
+	exponent, _, err := readMpi(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(exponent) > 4 {
+		return nil, errors.New("the exponent of the PGP key is too large")
+	}
+
+	digest := sha1.New()
+	digest.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+	digest.Write(body)
+	return &PgpKey{
+		Fingerprint: hex.EncodeToString(digest.Sum(nil)),
+		Key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		},
+	}, nil
+}
+
+// Reads a detached signature over a binary document.
+func readPgpSignature(data []byte) (*PgpSignature, error) {
+	data, err := dearmor(data)
+	if err != nil {
+		return nil, err
+	}
+	tags, bodies, err := readPgpPackets(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) != 1 || tags[0] != PGP_TAG_SIGNATURE {
+		return nil, errors.New("not a single PGP signature")
+	}
+
+	body := bodies[0]
+	if len(body) < 6 || body[0] != 4 {
+		return nil, errors.New("only version 4 PGP signatures are supported")
+	}
+	if body[1] != PGP_BINARY_SIGNATURE {
+		return nil, errors.New("not a signature of a binary document")
+	}
+	if body[2] != PGP_ALGORITHM_RSA {
+		return nil, errors.New("only RSA PGP signatures are supported")
+	}
+	hash, ok := pgpHashes[body[3]]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unsupported PGP hash algorithm %d", body[3]))
+	}
+
+	hashedLength := int(binary.BigEndian.Uint16(body[4:6]))
+	if len(body) < 6+hashedLength+2 {
+		return nil, errors.New("truncated PGP signature")
+	}
+	signature := &PgpSignature{
+		Hash:   hash,
+		Hashed: body[:6+hashedLength],
+	}
+	unhashedLength := int(binary.BigEndian.Uint16(body[6+hashedLength:]))
+	rest := body[8+hashedLength:]
+	if len(rest) < unhashedLength+2 {
+		return nil, errors.New("truncated PGP signature")
+	}
+
+	// The issuer may be in either of the subpacket areas
+	signature.Issuer = pgpIssuer(body[6:6+hashedLength], rest[:unhashedLength])
+	signature.Signature, _, err = readMpi(rest[unhashedLength+2:])
+	if err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// Finds the issuer of a signature in its subpackets, the fingerprint is preferred over the key ID.
+func pgpIssuer(areas ...[]byte) string {
+	var keyId string
+	for i := range areas {
+		area := areas[i]
+		for len(area) > 0 {
+			length := int(area[0])
+			offset := 1
+			switch {
+			case length >= 192 && length < 255:
+				{
+					if len(area) < 2 {
+						return keyId
+					}
+					length, offset = (length-192)<<8+int(area[1])+192, 2
+				}
+			case length == 255:
+				{
+					if len(area) < 5 {
+						return keyId
+					}
+					length, offset = int(binary.BigEndian.Uint32(area[1:5])), 5
+				}
+			}
+			if length == 0 || offset+length > len(area) {
+				return keyId
+			}
+
+			packet := area[offset : offset+length]
+			switch packet[0] & 0x7f {
+			case 33:
+				{
+					if len(packet) == 22 && packet[1] == 4 {
+						return hex.EncodeToString(packet[2:])
+					}
+				}
+			case 16:
+				{
+					if len(packet) == 9 {
+						keyId = hex.EncodeToString(packet[1:])
+					}
+				}
+			}
+			area = area[offset+length:]
+		}
+	}
+	return keyId
+}
+
+// Checks a detached signature of a document against a key.
+func verifyPgpSignature(key *PgpKey, signature *PgpSignature, document io.Reader) error {
+	if signature.Issuer != "" && !strings.HasSuffix(key.Fingerprint, signature.Issuer) {
+		return errors.New("the signature was made by the key " + signature.Issuer + ", not " + key.Fingerprint)
+	}
+
+	digest := signature.Hash.New()
+	_, err := io.Copy(digest, document)
+	if err != nil {
+		return err
+	}
+	digest.Write(signature.Hashed)
+	trailer := []byte{4, 0xff, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(trailer[2:], uint32(len(signature.Hashed)))
+	digest.Write(trailer)
+
+	// Leading zeros are dropped from the integer, RSA wants it as long as the modulus
+	size := key.Key.Size()
+	if len(signature.Signature) > size {
+		return errors.New("the signature is longer than the key")
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(signature.Signature):], signature.Signature)
+	err = rsa.VerifyPKCS1v15(key.Key, signature.Hash, digest.Sum(nil), padded)
+	if err != nil {
+		return errors.Join(errors.New("the signature does not match"), err)
+	}
+	return nil
+}
+
+// Reads a public key from a file. The key has to have the fingerprint when one is given.
+func loadPgpKey(path string, fingerprint string) (*PgpKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePgpKey(path, data, fingerprint)
+}
+
+// Reads a public key that was loaded from somewhere, the name says where in errors. The key has to have the fingerprint
+// when one is given.
+func parsePgpKey(name string, data []byte, fingerprint string) (*PgpKey, error) {
+	key, err := readPgpKey(data)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read "+name), err)
+	}
+	fingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, " ", ""))
+	if fingerprint != "" && key.Fingerprint != fingerprint {
+		return nil, errors.New("the key " + name + " has the fingerprint " + key.Fingerprint + " instead of " + fingerprint)
+	}
+	return key, nil
+}
+
+// Returns the key Adoptium signs its releases with. It is the one built into the launcher unless the config points to
+// another export of it.
+func adoptiumKey() (*PgpKey, error) {
+	if config.AdoptiumKey != "" {
+		return loadPgpKey(config.AdoptiumKey, ADOPTIUM_KEY_FINGERPRINT)
+	}
+	data, err := embeddedKeys.ReadFile(ADOPTIUM_KEY_FILE)
+	if err != nil {
+		return nil, errors.Join(errors.New("the launcher was built without "+ADOPTIUM_KEY_FILE+", set adoptiumKey in the config to an export of the key"), err)
+	}
+	return parsePgpKey(ADOPTIUM_KEY_FILE, data, ADOPTIUM_KEY_FINGERPRINT)
+}
+
+// Verifies the signature of a JVM archive downloaded from Adoptium whenever Adoptium published one, see adoptiumKey. An
+// archive without a signature is only accepted when no key is configured, a pinned archive is protected by its hash.
+func verifyAdoptiumSignature(archive string, signatureUrl string) error {
+	if signatureUrl == "" {
+		if config.AdoptiumKey == "" {
+			return nil
+		}
+		return errors.New("Adoptium did not publish a signature for " + archive)
+	}
+
+	key, err := adoptiumKey()
+	if err != nil {
+		return errors.Join(errors.New("failed to load the Adoptium key"), err)
+	}
+
+	signatureData, err := downloadBytes(signatureUrl, PGP_MAX_SIGNATURE_SIZE)
+	if err != nil {
+		return err
+	}
+	signature, err := readPgpSignature(signatureData)
+	if err != nil {
+		return errors.Join(errors.New("failed to read the signature of "+archive), err)
+	}
+
+	file, err := openFile(archive)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	err = verifyPgpSignature(key, signature, file)
+	if err != nil {
+		return errors.Join(errors.New("failed to verify the signature of "+archive), err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// The fingerprint of testdata/pgp/key.asc, a key made with gpg only to sign testdata/pgp/document.txt.
+//
+//goland:noinspection GoSnakeCaseUsage
+const TEST_PGP_KEY_FINGERPRINT string = "f2aa3f85f963d4dd4bf38750160c86adeb1beff0"
+
+// Reads the test key and the signature of the test document.
+func readTestPgpFiles(t *testing.T) (*PgpKey, *PgpSignature, []byte) {
+	key, err := loadPgpKey("testdata/pgp/key.asc", TEST_PGP_KEY_FINGERPRINT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile("testdata/pgp/document.txt.asc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := readPgpSignature(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := os.ReadFile("testdata/pgp/document.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, signature, document
+}
+
+func TestPgpSignature(t *testing.T) {
+	key, signature, document := readTestPgpFiles(t)
+	err := verifyPgpSignature(key, signature, bytes.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPgpSignatureOfTamperedDocument(t *testing.T) {
+	key, signature, document := readTestPgpFiles(t)
+	document[0] ^= 1
+	err := verifyPgpSignature(key, signature, bytes.NewReader(document))
+	if err == nil {
+		t.Fatal("expected the signature of a changed document to be refused")
+	}
+}
+
+// A key that is not the pinned one must not be used, even when it reads fine.
+func TestPgpKeyFingerprint(t *testing.T) {
+	_, err := loadPgpKey("testdata/pgp/key.asc", ADOPTIUM_KEY_FINGERPRINT)
+	if err == nil {
+		t.Fatal("expected the test key to be refused as the Adoptium key")
+	}
+}
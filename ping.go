@@ -0,0 +1,314 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	SERVER_PING_TIMEOUT time.Duration = 5 * time.Second
+	// The largest status response that is read, servers put their icon in it so it is not small.
+	SERVER_STATUS_MAX_SIZE int = 1024 * 1024
+)
+
+// What a server answers to a status request of the server list ping protocol.
+type ServerStatus struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+		// Some of the players that are online, servers may leave it out or fill it with anything.
+		Sample []struct {
+			Name string `json:"name"`
+			Id   string `json:"id"`
+		} `json:"sample"`
+	} `json:"players"`
+	Description json.RawMessage `json:"description"`
+	// How long the status took to arrive, not part of the response.
+	Latency time.Duration `json:"-"`
+}
+
+var formattingCodePattern = regexp.MustCompile("§.")
+
+// Returns the MOTD of a server as plain text. It is either a string or a text component, formatting is dropped.
+func (this *ServerStatus) motd() string {
+	var builder strings.Builder
+	appendChatText(&builder, this.Description)
+	return strings.TrimSpace(formattingCodePattern.ReplaceAllString(builder.String(), ""))
+}
+
+func appendChatText(builder *strings.Builder, raw json.RawMessage) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		builder.WriteString(text)
+		return
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		for i := range list {
+			appendChatText(builder, list[i])
+		}
+		return
+	}
+	var component struct {
+		Text  string            `json:"text"`
+		Extra []json.RawMessage `json:"extra"`
+	}
+	if json.Unmarshal(raw, &component) == nil {
+		builder.WriteString(component.Text)
+		for i := range component.Extra {
+			appendChatText(builder, component.Extra[i])
+		}
+	}
+}
+
+// Resolves the address of a server like the game does: addresses without a port use the SRV record of the host, or
+// the default port when there is none.
+func resolveServerAddress(address string) (string, uint16, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+		_, records, err := net.LookupSRV("minecraft", "tcp", host)
+		if err == nil && len(records) > 0 {
+			return strings.TrimSuffix(records[0].Target, "."), records[0].Port, nil
+		}
+		return host, uint16(SERVER_DEFAULT_PORT), nil
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil || port == 0 {
+		return "", 0, errors.New("invalid port in server address " + address)
+	}
+	return host, uint16(port), nil
+}
+
+func appendVarInt(buffer []byte, value int32) []byte {
+	return binary.AppendUvarint(buffer, uint64(uint32(value)))
+}
+
+func appendPacket(buffer []byte, packet []byte) []byte {
+	return append(appendVarInt(buffer, int32(len(packet))), packet...)
+}
+
+func readVarInt(reader io.ByteReader) (int32, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(value), nil
+		}
+	}
+	return 0, errors.New("VarInt is too long")
+}
+
+// Asks a server for its status with the server list ping protocol of 1.7 and newer. The protocol version is the one
+// the client would join with, servers that support more than one answer with it when they support it.
+func pingServer(address string, protocol int) (*ServerStatus, error) {
+	host, port, err := resolveServerAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	connection, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))), SERVER_PING_TIMEOUT)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to connect to "+address), err)
+	}
+	defer func() {
+		_ = connection.Close()
+	}()
+	err = connection.SetDeadline(time.Now().Add(SERVER_PING_TIMEOUT))
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake and the status request, the handshake has the host the player typed instead of the resolved one
+	typed, _, err := net.SplitHostPort(address)
+	if err != nil {
+		typed = address
+	}
+	handshake := appendVarInt(nil, 0x00)
+	handshake = appendVarInt(handshake, int32(protocol))
+	handshake = appendVarInt(handshake, int32(len(typed)))
+	handshake = append(handshake, typed...)
+	handshake = binary.BigEndian.AppendUint16(handshake, port)
+	handshake = appendVarInt(handshake, 1)
+	request := appendPacket(appendPacket(nil, handshake), []byte{0x00})
+	_, err = connection.Write(request)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to ask "+address+" for its status"), err)
+	}
+
+	reader := bufio.NewReader(connection)
+	length, err := readVarInt(reader)
+	if err == nil && (length <= 0 || int(length) > SERVER_STATUS_MAX_SIZE) {
+		err = errors.New("invalid packet length " + strconv.Itoa(int(length)))
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New(address+" did not answer with a status"), err)
+	}
+	packet := make([]byte, length)
+	_, err = io.ReadFull(reader, packet)
+	if err != nil {
+		return nil, errors.Join(errors.New(address+" did not answer with a status"), err)
+	}
+	latency := time.Since(started)
+
+	packetReader := bytes.NewReader(packet)
+	id, err := readVarInt(packetReader)
+	if err != nil || id != 0x00 {
+		return nil, errors.New(address + " did not answer with a status")
+	}
+	size, err := readVarInt(packetReader)
+	if err != nil || size < 0 || int(size) > packetReader.Len() {
+		return nil, errors.New(address + " answered with a malformed status")
+	}
+	response := make([]byte, size)
+	_, _ = packetReader.Read(response)
+
+	var status ServerStatus
+	err = json.Unmarshal(response, &status)
+	if err != nil {
+		return nil, errors.Join(errors.New(address+" answered with a malformed status"), err)
+	}
+	status.Latency = latency
+	return &status, nil
+}
+
+// The version.json inside of the client jar of versions from 1.14 on.
+type ClientVersionJson struct {
+	ProtocolVersion int `json:"protocol_version"`
+	WorldVersion    int `json:"world_version"`
+}
+
+// Reads the version.json of a client jar. Returns nothing when the jar has none or it can not be read.
+func readClientVersionJson(jar string) *ClientVersionJson {
+	reader, err := zip.OpenReader(jar)
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	file, err := reader.Open("version.json")
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var version ClientVersionJson
+	if json.NewDecoder(file).Decode(&version) != nil {
+		return nil
+	}
+	return &version
+}
+
+// Returns the protocol version of a client jar, or 0 when it does not say.
+func clientProtocolVersion(jar string) int {
+	version := readClientVersionJson(jar)
+	if version == nil {
+		return 0
+	}
+	return version.ProtocolVersion
+}
+
+func printServerStatus(address string, status *ServerStatus) {
+	fmt.Printf("%s: %s\n", address, status.motd())
+	fmt.Printf("    Version: %s (protocol %d)\n", status.Version.Name, status.Version.Protocol)
+	fmt.Printf("    Players: %d/%d\n", status.Players.Online, status.Players.Max)
+	fmt.Printf("    Latency: %s\n", status.Latency.Round(time.Millisecond))
+	for i := range status.Players.Sample {
+		fmt.Printf("    - %s\n", formattingCodePattern.ReplaceAllString(status.Players.Sample[i].Name, ""))
+	}
+}
+
+// Pings the server a launch quick plays before the game starts, so a server that is down or runs another version is
+// reported right away instead of after the game loaded. Servers of unknown protocol versions are only pinged.
+func checkQuickPlayServer(jar string, address string) error {
+	protocol := clientProtocolVersion(jar)
+	ping := protocol
+	if ping == 0 {
+		// Servers answer a status request of any version, -1 is what the game uses when it does not know either
+		ping = -1
+	}
+	status, err := pingServer(address, ping)
+	if err != nil {
+		return errors.Join(errors.New("the server "+address+" is not reachable, launch with --skip-ping to start anyways"), err)
+	}
+	printServerStatus(address, status)
+	if protocol != 0 && status.Version.Protocol != protocol {
+		return errors.New(fmt.Sprintf("the server %s runs %s (protocol %d) but the instance uses protocol %d, launch with --skip-ping to start anyways", address, status.Version.Name, status.Version.Protocol, protocol))
+	}
+	return nil
+}
+
+func pingCommand(base string, args []string) error {
+	set := flag.NewFlagSet("ping", flag.ContinueOnError)
+	protocol := set.Int("protocol", -1, "the protocol version to ping with, servers that support several answer with the one they would use for it")
+	asJson := set.Bool("json", false, "print the status as JSON")
+	args, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("expected exactly one server address")
+	}
+
+	address := args[0]
+	status, err := pingServer(address, *protocol)
+	if err != nil {
+		return err
+	}
+	if !*asJson {
+		printServerStatus(address, status)
+		return nil
+	}
+
+	var players []string
+	for i := range status.Players.Sample {
+		players = append(players, formattingCodePattern.ReplaceAllString(status.Players.Sample[i].Name, ""))
+	}
+	data, err := json.MarshalIndent(struct {
+		Address   string   `json:"address"`
+		Motd      string   `json:"motd"`
+		Version   string   `json:"version"`
+		Protocol  int      `json:"protocol"`
+		Online    int      `json:"online"`
+		Max       int      `json:"max"`
+		Players   []string `json:"players"`
+		LatencyMs int64    `json:"latencyMs"`
+	}{
+		Address:   address,
+		Motd:      status.motd(),
+		Version:   status.Version.Name,
+		Protocol:  status.Version.Protocol,
+		Online:    status.Players.Online,
+		Max:       status.Players.Max,
+		Players:   players,
+		LatencyMs: status.Latency.Milliseconds(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Everything the launcher does differently on systems other than Windows, platform.windows.go has the same for Windows.
+//
+//goland:noinspection GoSnakeCaseUsage
+const (
+	EXECUTABLE_SUFFIX string = ""
+	// Linux limits single arguments to 128 KiB and macOS the whole command line to 256 KiB. Some room is left for the
+	// environment and the executable.
+	COMMAND_LINE_LIMIT int    = 200 * 1024
+	ARGUMENT_LIMIT     int    = 128*1024 - 1
+	ARGUMENT_OVERHEAD  int    = 1
+	DEFAULT_SHELL      string = SHELL_SH
+)
+
+// Returns the executable of a runtime the game is started with.
+func gameJavaExecutable(javaHome string, _ bool) string {
+	return javaExecutable(javaHome)
+}
+
+// Checks if a file in the plugin directory is a program, anything that may be executed is.
+func isExecutableFile(info os.FileInfo) bool {
+	return info.Mode().Perm()&0111 != 0
+}
+
+// Stops the terminal from showing what is typed. Returns the function that turns it back on, or nil when it could not
+// be turned off.
+func disableEcho() func() {
+	stty := exec.Command("stty", "-echo")
+	stty.Stdin = os.Stdin
+	if stty.Run() != nil {
+		return nil
+	}
+	return func() {
+		restore := exec.Command("stty", "echo")
+		restore.Stdin = os.Stdin
+		_ = restore.Run()
+	}
+}
+
+// Returns how many files the launcher may have open at once, raising the soft limit to the hard one first. Returns 0
+// when the limit is unknown.
+func openFileLimit() uint64 {
+	var limit syscall.Rlimit
+	err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit)
+	if err != nil {
+		return 0
+	}
+	if limit.Cur < limit.Max {
+		raised := limit
+		raised.Cur = limit.Max
+		if syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised) == nil {
+			limit = raised
+		}
+	}
+	return uint64(limit.Cur)
+}
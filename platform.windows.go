@@ -0,0 +1,46 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Everything the launcher does differently on Windows, platform.other.go has the same for every other system.
+//
+//goland:noinspection GoSnakeCaseUsage
+const (
+	EXECUTABLE_SUFFIX string = ".exe"
+	// Windows limits the whole command line to 32767 characters, some room is left for the executable.
+	COMMAND_LINE_LIMIT int = 32000
+	ARGUMENT_LIMIT     int = COMMAND_LINE_LIMIT
+	// Windows puts quotes around arguments with spaces, every argument is counted with them.
+	ARGUMENT_OVERHEAD int    = 3
+	DEFAULT_SHELL     string = SHELL_POWERSHELL
+)
+
+// Returns the executable of a runtime the game is started with. On Windows that is javaw, which does not open a console
+// window next to the game, unless the console is wanted for debugging.
+func gameJavaExecutable(javaHome string, console bool) string {
+	if console {
+		return javaExecutable(javaHome)
+	}
+	return javaHome + "/bin/javaw" + EXECUTABLE_SUFFIX
+}
+
+// Checks if a file in the plugin directory is a program, Windows goes by the extension.
+func isExecutableFile(info os.FileInfo) bool {
+	return strings.HasSuffix(strings.ToLower(info.Name()), EXECUTABLE_SUFFIX)
+}
+
+// Stops the terminal from showing what is typed. The console of Windows has no stty, so passphrases stay visible there.
+// Returns the function that turns it back on, or nil when it could not be turned off.
+func disableEcho() func() {
+	return nil
+}
+
+// Windows has no limit on open files that matters to the launcher.
+func openFileLimit() uint64 {
+	return 0
+}
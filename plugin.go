@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	PLUGINS_DIR string = "plugins"
+
+	// Sent before the version of an instance is resolved, before anything is downloaded.
+	PLUGIN_PRE_RESOLVE string = "pre-resolve"
+	// Sent once everything is downloaded, right before the game starts. The only event whose changes are used.
+	PLUGIN_PRE_LAUNCH string = "pre-launch"
+	// Sent after the game exited.
+	PLUGIN_POST_EXIT string = "post-exit"
+
+	PLUGIN_TIMEOUT time.Duration = 30 * time.Second
+)
+
+// What a plugin is told about an event, written as JSON to its standard input.
+type PluginEvent struct {
+	Event    string `json:"event"`
+	Instance string `json:"instance"`
+	Version  string `json:"version"`
+	// The directory the game runs in, the pack WebAssembly plugins read from and download into.
+	GameDir string `json:"gameDir,omitempty"`
+	// The changes of the plugins that ran before, only for PLUGIN_PRE_LAUNCH.
+	Changes *PluginChanges `json:"changes,omitempty"`
+	// The exit code of the game, only for PLUGIN_POST_EXIT.
+	ExitCode *int `json:"exitCode,omitempty"`
+}
+
+// The changes a plugin may make to a launch, read as JSON from its standard output. A plugin that writes nothing
+// changes nothing. Environment variables replace the ones of the launcher, arguments are added to the ones of the
+// version.
+type PluginChanges struct {
+	Env      map[string]string `json:"env,omitempty"`
+	JvmArgs  []string          `json:"jvmArgs,omitempty"`
+	GameArgs []string          `json:"gameArgs,omitempty"`
+}
+
+// Lists the plugins in the plugins directory in the order they run, by name. Plugins are executable files, on Windows
+// any .exe, or WebAssembly modules ending in .wasm that run sandboxed, see runWasmPlugin.
+func listPlugins(base string) ([]string, error) {
+	dir := base + "/" + PLUGINS_DIR
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Join(errors.New("failed to list plugins"), err)
+	}
+
+	var plugins []string
+	for i := range entries {
+		info, err := entries[i].Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if !strings.HasSuffix(info.Name(), ".wasm") && !isExecutableFile(info) {
+			continue
+		}
+		plugins = append(plugins, dir+"/"+info.Name())
+	}
+	sort.Strings(plugins)
+	return plugins, nil
+}
+
+// Runs a single plugin for an event. Returns what it wants to change, nil when it wrote nothing.
+func runPlugin(plugin string, event *PluginEvent) (*PluginChanges, error) {
+	if strings.HasSuffix(plugin, ".wasm") {
+		return runWasmPlugin(plugin, event)
+	}
+
+	input, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(launcherContext, PLUGIN_TIMEOUT)
+	defer cancel()
+	process := execute(plugin)
+	process.Stdin = bytes.NewReader(input)
+	process.Stderr = os.Stderr
+	var output bytes.Buffer
+	process.Stdout = &output
+	err = process.Start()
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		{
+			_ = process.Process.Kill()
+			<-done
+			return nil, errors.New(fmt.Sprintf("did not finish within %s", PLUGIN_TIMEOUT))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parsePluginChanges(&output)
+}
+
+// Reads the changes a plugin wrote to its standard output. Returns nil when it wrote nothing.
+func parsePluginChanges(output *bytes.Buffer) (*PluginChanges, error) {
+	if len(bytes.TrimSpace(output.Bytes())) == 0 {
+		return nil, nil
+	}
+	var changes PluginChanges
+	decoder := json.NewDecoder(output)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&changes)
+	if err != nil {
+		return nil, errors.Join(errors.New("wrote something that is not a valid change"), err)
+	}
+	return &changes, nil
+}
+
+// Sends an event to every plugin in order, except the disabled ones. For PLUGIN_PRE_LAUNCH the changes of all plugins
+// are collected, every plugin sees the changes of the ones before it. A plugin that fails stops the launch before the
+// game starts, after the game exited failures are only printed.
+func runPlugins(base string, event *PluginEvent, disabled []string) (*PluginChanges, error) {
+	plugins, err := listPlugins(base)
+	if err != nil {
+		return nil, err
+	}
+
+	collected := &PluginChanges{
+		Env: map[string]string{},
+	}
+	for i := range plugins {
+		if slices.Contains(disabled, filepath.Base(plugins[i])) {
+			continue
+		}
+		if event.Event == PLUGIN_PRE_LAUNCH {
+			event.Changes = collected
+		}
+
+		changes, err := runPlugin(plugins[i], event)
+		if err != nil {
+			err = errors.Join(errors.New("plugin "+plugins[i]+" failed at "+event.Event), err)
+			if event.Event == PLUGIN_POST_EXIT {
+				fmt.Printf("%s\n", err)
+				continue
+			}
+			return nil, err
+		}
+		if changes == nil || event.Event != PLUGIN_PRE_LAUNCH {
+			continue
+		}
+
+		for key := range changes.Env {
+			collected.Env[key] = changes.Env[key]
+		}
+		collected.JvmArgs = append(collected.JvmArgs, changes.JvmArgs...)
+		collected.GameArgs = append(collected.GameArgs, changes.GameArgs...)
+	}
+	event.Changes = nil
+	return collected, nil
+}
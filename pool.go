@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// Limits how many downloads run at once across the whole launcher. Jobs are submitted in batches so every caller can
+// wait for and collect the errors of its own jobs.
+type DownloadPool struct {
+	slots chan struct{}
+}
+
+// A group of jobs submitted to a pool together.
+type DownloadBatch struct {
+	pool      *DownloadPool
+	progress  *Progress
+	waitGroup sync.WaitGroup
+	lock      sync.Mutex
+	err       error
+}
+
+var downloadPool *DownloadPool
+
+func newDownloadPool(workers int) *DownloadPool {
+	return &DownloadPool{
+		slots: make(chan struct{}, workers),
+	}
+}
+
+// Starts a new batch, its progress is reported under the name.
+func (this *DownloadPool) batch(name string) *DownloadBatch {
+	return &DownloadBatch{
+		pool:     this,
+		progress: newProgress(name),
+	}
+}
+
+// Runs a job as soon as a worker is free, blocking until then so callers never queue more goroutines than there are
+// workers. Once the launcher is interrupted jobs are not started anymore.
+func (this *DownloadBatch) submit(job func() error) {
+	this.progress.totalFiles.Add(1)
+	select {
+	case this.pool.slots <- struct{}{}:
+	case <-launcherContext.Done():
+		{
+			this.progress.completedFiles.Add(1)
+			this.fail(errInterrupted)
+			return
+		}
+	}
+	this.waitGroup.Add(1)
+	go func() {
+		defer func() {
+			this.progress.completedFiles.Add(1)
+			<-this.pool.slots
+			this.waitGroup.Done()
+		}()
+
+		err := runRecovering(job)
+		if err != nil {
+			this.fail(err)
+		}
+	}()
+}
+
+// Records the error of a job. Interrupted jobs are only reported once, they all fail the same way.
+func (this *DownloadBatch) fail(err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if errors.Is(err, errInterrupted) && errors.Is(this.err, errInterrupted) {
+		return
+	}
+	this.err = errors.Join(this.err, err)
+}
+
+// Waits for every job of the batch to finish and returns all of their errors.
+func (this *DownloadBatch) wait() error {
+	this.waitGroup.Wait()
+	this.progress.finish()
+	downloadSummary.record(this.progress.summary())
+	return this.err
+}
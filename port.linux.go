@@ -0,0 +1,61 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Finds the process that has a local port open by looking up the socket in /proc. Returns an empty string when it
+// can not be found, sockets of processes of other users are hidden from us.
+func portOwner(port int, protocol string) string {
+	inodes := map[string]bool{}
+	tables := []string{"/proc/net/" + protocol, "/proc/net/" + protocol + "6"}
+	for i := range tables {
+		contents, err := os.ReadFile(tables[i])
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(contents), "\n")
+		for o := 1; o < len(lines); o++ {
+			fields := strings.Fields(lines[o])
+			if len(fields) < 10 {
+				continue
+			}
+			_, hexPort, ok := strings.Cut(fields[1], ":")
+			local, err := strconv.ParseInt(hexPort, 16, 32)
+			if ok && err == nil && int(local) == port && fields[9] != "0" {
+				inodes["socket:["+fields[9]+"]"] = true
+			}
+		}
+	}
+	if len(inodes) == 0 {
+		return ""
+	}
+
+	processes, err := os.ReadDir("/proc")
+	if err != nil {
+		return ""
+	}
+	for i := range processes {
+		pid := processes[i].Name()
+		_, err := strconv.Atoi(pid)
+		if err != nil {
+			continue
+		}
+		fds, err := os.ReadDir("/proc/" + pid + "/fd")
+		if err != nil {
+			continue
+		}
+		for o := range fds {
+			link, err := os.Readlink("/proc/" + pid + "/fd/" + fds[o].Name())
+			if err == nil && inodes[link] {
+				name, _ := os.ReadFile("/proc/" + pid + "/comm")
+				return strings.TrimSpace(string(name)) + " (pid " + pid + ")"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// Finding the process that has a port open needs APIs of the operating system that are only used on Linux.
+func portOwner(_ int, _ string) string {
+	return ""
+}
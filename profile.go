@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// A file a server profile needs in the game directory. The name defaults to the last part of the URL.
+type ProfileFile struct {
+	Url  string `json:"url"`
+	Sha1 string `json:"sha1,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func (this *ProfileFile) url() string {
+	return this.Url
+}
+
+func (this *ProfileFile) hash() *string {
+	if this.Sha1 == "" {
+		return nil
+	}
+	return &this.Sha1
+}
+
+func (this *ProfileFile) size() uint64 {
+	return 0
+}
+
+func (this *ProfileFile) fileName() string {
+	if this.Name != "" {
+		return this.Name
+	}
+	return path.Base(strings.SplitN(this.Url, "?", 2)[0])
+}
+
+// Pairs an instance with a server. Launching the profile installs the resource pack and mods the server wants into the
+// game directory of the instance, adds the server to the server list and joins it right away.
+type ServerProfile struct {
+	Name         string        `json:"name"`
+	Instance     string        `json:"instance"`
+	Address      string        `json:"address"`
+	ResourcePack *ProfileFile  `json:"resourcePack,omitempty"`
+	Mods         []ProfileFile `json:"mods,omitempty"`
+}
+
+func profilePath(base string, name string) string {
+	return base + "/profiles/" + name + ".json"
+}
+
+func loadProfile(base string, name string) (*ServerProfile, error) {
+	err := validateInstanceName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	path := profilePath(base, name)
+	if !fileExists(path) {
+		return nil, errors.New("profile " + name + " does not exist")
+	}
+
+	var profile ServerProfile
+	err = readJson(path, &profile)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to load profile "+name), err)
+	}
+	profile.Name = name
+	return &profile, nil
+}
+
+func saveProfile(base string, profile *ServerProfile) error {
+	err := createParents(base + "/profiles")
+	if err != nil {
+		return errors.Join(errors.New("failed to create profile directory"), err)
+	}
+
+	err = writeJson(profilePath(base, profile.Name), profile)
+	if err != nil {
+		return errors.Join(errors.New("failed to save profile "+profile.Name), err)
+	}
+	return nil
+}
+
+// Downloads the resource pack and mods of a profile into a game directory and enables the resource pack.
+func installProfileFiles(gameDir string, profile *ServerProfile) error {
+	batch := downloadPool.batch("Server")
+	if profile.ResourcePack != nil {
+		pack := profile.ResourcePack
+		batch.submit(func() error {
+			return downloadFile(gameDir+"/resourcepacks/"+pack.fileName(), pack, batch.progress)
+		})
+	}
+	for i := range profile.Mods {
+		mod := &profile.Mods[i]
+		batch.submit(func() error {
+			return downloadFile(gameDir+"/mods/"+mod.fileName(), mod, batch.progress)
+		})
+	}
+
+	err := batch.wait()
+	if err != nil {
+		return errors.Join(errors.New("failed to install the files of profile "+profile.Name), err)
+	}
+
+	if profile.ResourcePack != nil {
+		err = setGameOption(gameDir, "resourcePacks", "[\"vanilla\",\"file/"+profile.ResourcePack.fileName()+"\"]")
+		if err != nil {
+			return errors.Join(errors.New("failed to enable the resource pack of profile "+profile.Name), err)
+		}
+	}
+
+	err = addServerToList(gameDir, profile.Name, profile.Address)
+	if err != nil {
+		return errors.Join(errors.New("failed to add the server of profile "+profile.Name+" to the server list"), err)
+	}
+	return nil
+}
+
+// Checks if the game arguments of a manifest support joining a server with quick play, versions before 1.20 don't.
+func supportsQuickPlay(manifest *Manifest) bool {
+	arguments := manifest.gameArguments()
+	for i := range arguments {
+		argument := arguments[i]
+		for o := range argument.Value {
+			if strings.Contains(argument.Value[o], "${quickPlayMultiplayer}") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the arguments older versions use to join a server on startup.
+func legacyServerArguments(address string) []string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return []string{"--server", address}
+	}
+	return []string{"--server", host, "--port", port}
+}
+
+var profileCommands = []Command{
+	{
+		Name:        "create",
+		Usage:       "<name> --instance <instance> --address <host[:port]> [--resource-pack <url> [--resource-pack-sha1 <hash>]] [--mod <url>]...",
+		Description: "Creates a server profile",
+		Run:         profileCreateCommand,
+	},
+	{
+		Name:        "list",
+		Usage:       "",
+		Description: "Lists every server profile",
+		Run:         profileListCommand,
+	},
+	{
+		Name:        "launch",
+		Usage:       "<name> [--skip-ping] [-- <game arguments>]",
+		Description: "Installs what the server of a profile needs and launches its instance straight into the server",
+		Run:         profileLaunchCommand,
+	},
+}
+
+func profileCommand(base string, args []string) error {
+	return runCommand(profileCommands, base, args)
+}
+
+func profileCreateCommand(base string, args []string) error {
+	var profile ServerProfile
+	var pack ProfileFile
+	set := flag.NewFlagSet("profile create", flag.ContinueOnError)
+	set.StringVar(&profile.Instance, "instance", "", "the instance to launch")
+	set.StringVar(&profile.Address, "address", "", "the address of the server")
+	set.StringVar(&pack.Url, "resource-pack", "", "the URL of the resource pack the server requires")
+	set.StringVar(&pack.Sha1, "resource-pack-sha1", "", "the SHA-1 of the resource pack")
+	set.Func("mod", "the URL of a recommended mod, may be repeated", func(value string) error {
+		profile.Mods = append(profile.Mods, ProfileFile{
+			Url: value,
+		})
+		return nil
+	})
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one profile name")
+	}
+	if profile.Instance == "" || profile.Address == "" {
+		return errors.New("--instance and --address are required")
+	}
+
+	profile.Name = positional[0]
+	err = validateInstanceName(profile.Name)
+	if err != nil {
+		return err
+	}
+	if fileExists(profilePath(base, profile.Name)) {
+		return errors.New("profile " + profile.Name + " already exists")
+	}
+	_, err = loadInstance(base, profile.Instance)
+	if err != nil {
+		return err
+	}
+	if pack.Url != "" {
+		profile.ResourcePack = &pack
+	}
+
+	err = saveProfile(base, &profile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created profile %s\n", profile.Name)
+	return nil
+}
+
+func profileListCommand(base string, args []string) error {
+	if len(args) != 0 {
+		return errors.New("expected no arguments")
+	}
+
+	entries, err := os.ReadDir(base + "/profiles")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Join(errors.New("failed to list profiles"), err)
+	}
+
+	var names []string
+	for i := range entries {
+		name, ok := strings.CutSuffix(entries[i].Name(), ".json")
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for i := range names {
+		profile, err := loadProfile(base, names[i])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s on %s, %d mods\n", profile.Name, profile.Instance, profile.Address, len(profile.Mods))
+	}
+	return nil
+}
+
+func profileLaunchCommand(base string, args []string) error {
+	set := flag.NewFlagSet("launch", flag.ContinueOnError)
+	skipPing := set.Bool("skip-ping", false, "join the server without checking that it is up and runs the version of the instance")
+	args, gameArgs := splitPassThrough(args)
+	args, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("expected exactly one profile name")
+	}
+
+	profile, err := loadProfile(base, args[0])
+	if err != nil {
+		return err
+	}
+
+	instance, err := loadInstance(base, profile.Instance)
+	if err != nil {
+		return err
+	}
+
+	return exitWith(launchWithRestarts(base, instance, &LaunchOptions{
+		Profile:         profile,
+		QuickPlayServer: profile.Address,
+		SkipPing:        *skipPing,
+		GameArgs:        gameArgs,
+	}, false))
+}
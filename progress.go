@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The state of a group of downloads at one point in time.
+type ProgressSnapshot struct {
+	Name           string
+	CompletedFiles int64
+	TotalFiles     int64
+	Bytes          uint64
+	// Bytes per second since the previous snapshot.
+	Speed   float64
+	Elapsed time.Duration
+}
+
+// Something that shows the progress of downloads to the user. Report is called periodically while a batch is running,
+// finish once when it is done.
+type ProgressReporter interface {
+	report(snapshot ProgressSnapshot)
+	finish(snapshot ProgressSnapshot)
+}
+
+// The reporter used for every batch, nil when progress should not be shown.
+var progressReporter ProgressReporter
+
+// Shows progress as a single line that is redrawn in place.
+type ConsoleProgressReporter struct{}
+
+//goland:noinspection GoSnakeCaseUsage
+const PROGRESS_BAR_WIDTH int = 30
+
+func (this *ConsoleProgressReporter) report(snapshot ProgressSnapshot) {
+	fmt.Print("\r" + this.format(snapshot) + "\033[K")
+}
+
+func (this *ConsoleProgressReporter) finish(snapshot ProgressSnapshot) {
+	fmt.Println("\r" + this.format(snapshot) + "\033[K")
+}
+
+func (this *ConsoleProgressReporter) format(snapshot ProgressSnapshot) string {
+	filled := PROGRESS_BAR_WIDTH
+	if snapshot.TotalFiles > 0 {
+		filled = int(snapshot.CompletedFiles * int64(PROGRESS_BAR_WIDTH) / snapshot.TotalFiles)
+	}
+
+	return fmt.Sprintf(
+		"%-10s [%s%s] %d/%d files, %s, %s/s",
+		snapshot.Name,
+		strings.Repeat("#", filled),
+		strings.Repeat(" ", PROGRESS_BAR_WIDTH-filled),
+		snapshot.CompletedFiles,
+		snapshot.TotalFiles,
+		formatBytes(float64(snapshot.Bytes)),
+		formatBytes(snapshot.Speed),
+	)
+}
+
+// Formats a byte count with a binary unit, like "1.5 MiB".
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
+
+// Checks if stdout is a terminal, progress bars would only clutter logs and pipes.
+func isInteractive() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Tracks the progress of a single batch of downloads. The files and bytes are counted by the jobs of the batch that
+// downloaded them, batches that run at the same time do not count each other's downloads.
+type Progress struct {
+	name           string
+	completedFiles atomic.Int64
+	totalFiles     atomic.Int64
+	// The files that were actually downloaded, files that were already valid are not counted.
+	downloadedFiles  atomic.Int64
+	transferredBytes atomic.Uint64
+	started          time.Time
+	lastBytes        uint64
+	lastTime         time.Time
+}
+
+// The batches whose progress is being reported. Batches that run at the same time, like the phases of a launch when
+// they overlap, share a single line, see reportProgress.
+var progressDisplay struct {
+	lock    sync.Mutex
+	active  []*Progress
+	running bool
+}
+
+func newProgress(name string) *Progress {
+	now := time.Now()
+	progress := &Progress{
+		name:     name,
+		started:  now,
+		lastTime: now,
+	}
+
+	if progressReporter == nil {
+		return progress
+	}
+	progressDisplay.lock.Lock()
+	defer progressDisplay.lock.Unlock()
+	progressDisplay.active = append(progressDisplay.active, progress)
+	if !progressDisplay.running {
+		progressDisplay.running = true
+		go reportProgress()
+	}
+	return progress
+}
+
+// Periodically reports the batches that are running until none are left. Their snapshots are combined into one, so
+// batches that run at the same time do not draw over each other.
+func reportProgress() {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		progressDisplay.lock.Lock()
+		active := progressDisplay.active
+		if len(active) == 0 {
+			progressDisplay.running = false
+			progressDisplay.lock.Unlock()
+			return
+		}
+
+		var combined ProgressSnapshot
+		names := make([]string, len(active))
+		for i := range active {
+			snapshot := active[i].snapshot()
+			names[i] = snapshot.Name
+			combined.CompletedFiles += snapshot.CompletedFiles
+			combined.TotalFiles += snapshot.TotalFiles
+			combined.Bytes += snapshot.Bytes
+			combined.Speed += snapshot.Speed
+			combined.Elapsed = max(combined.Elapsed, snapshot.Elapsed)
+		}
+		combined.Name = strings.Join(names, "+")
+		progressReporter.report(combined)
+		progressDisplay.lock.Unlock()
+	}
+}
+
+// Counts a file a job of the batch downloaded. Does nothing for downloads outside of a batch, their progress is nil.
+func (this *Progress) countFile() {
+	if this != nil {
+		this.downloadedFiles.Add(1)
+	}
+}
+
+// Counts bytes a job of the batch received. Does nothing for downloads outside of a batch, their progress is nil.
+func (this *Progress) countBytes(bytes uint64) {
+	if this != nil {
+		this.transferredBytes.Add(bytes)
+	}
+}
+
+func (this *Progress) snapshot() ProgressSnapshot {
+	now := time.Now()
+	bytes := this.transferredBytes.Load()
+	speed := 0.0
+	elapsed := now.Sub(this.lastTime).Seconds()
+	if elapsed > 0 {
+		speed = float64(bytes-this.lastBytes) / elapsed
+	}
+	this.lastBytes = bytes
+	this.lastTime = now
+
+	return ProgressSnapshot{
+		Name:           this.name,
+		CompletedFiles: this.completedFiles.Load(),
+		TotalFiles:     this.totalFiles.Load(),
+		Bytes:          bytes,
+		Speed:          speed,
+		Elapsed:        now.Sub(this.started),
+	}
+}
+
+// Summarizes what the batch did for the download summary.
+func (this *Progress) summary() SummaryCategory {
+	return SummaryCategory{
+		Name:       this.name,
+		Checked:    this.totalFiles.Load(),
+		Downloaded: this.downloadedFiles.Load(),
+		Bytes:      this.transferredBytes.Load(),
+		Elapsed:    time.Since(this.started),
+	}
+}
+
+// Stops reporting the progress, the reporter gets a final snapshot of the batch on a line of its own.
+func (this *Progress) finish() {
+	progressDisplay.lock.Lock()
+	defer progressDisplay.lock.Unlock()
+	index := slices.Index(progressDisplay.active, this)
+	if index < 0 {
+		return
+	}
+	progressDisplay.active = slices.Delete(progressDisplay.active, index, index+1)
+	progressReporter.finish(this.snapshot())
+}
+
+// Counts the bytes read from a download in the progress of the batch it belongs to.
+type progressReader struct {
+	reader   io.Reader
+	progress *Progress
+}
+
+func (this *progressReader) Read(buffer []byte) (int, error) {
+	read, err := this.reader.Read(buffer)
+	this.progress.countBytes(uint64(read))
+	return read, err
+}
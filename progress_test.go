@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Batches that run at the same time, like the phases of a launch when they overlap, must only count their own
+// downloads.
+func TestOverlappingBatchesCountTheirOwnDownloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(strings.Repeat("x", len(request.URL.Path)*100)))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	setupNetwork()
+
+	pool := newDownloadPool(2)
+	client := pool.batch("Client")
+	assets := pool.batch("Assets")
+	client.submit(func() error {
+		return downloadFileRaw(dir+"/client", server.URL+"/c", nil, 0, client.progress)
+	})
+	assets.submit(func() error {
+		return downloadFileRaw(dir+"/asset", server.URL+"/assets", nil, 0, assets.progress)
+	})
+	assets.submit(func() error {
+		return downloadFileRaw(dir+"/index", server.URL+"/index", nil, 0, assets.progress)
+	})
+	err := client.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = assets.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := client.progress.summary()
+	if summary.Downloaded != 1 || summary.Bytes != 200 {
+		t.Errorf("expected the client batch to download 1 file with 200 bytes, got %d with %d", summary.Downloaded, summary.Bytes)
+	}
+	summary = assets.progress.summary()
+	if summary.Downloaded != 2 || summary.Bytes != 1300 {
+		t.Errorf("expected the assets batch to download 2 files with 1300 bytes, got %d with %d", summary.Downloaded, summary.Bytes)
+	}
+}
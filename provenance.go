@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where a downloaded file came from. The URL is the one the launcher asked for, the source the one that delivered it,
+// which differs when a mirror or an override was used.
+type ProvenanceEntry struct {
+	Url    string    `json:"url"`
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+	// The pack that was imported when the file was downloaded, if any.
+	Pack string `json:"pack,omitempty"`
+	Sha1 string `json:"sha1,omitempty"`
+}
+
+// Remembers where every file the launcher downloaded came from, stored in provenance.json in the base directory. Files
+// are keyed by their path relative to the base directory, the ones outside of it by their absolute path.
+type ProvenanceLog struct {
+	lock    sync.Mutex
+	base    string
+	entries map[string]ProvenanceEntry
+	dirty   bool
+	// The pack files are downloaded for right now, see ProvenanceEntry.Pack.
+	pack string
+}
+
+var provenance = &ProvenanceLog{
+	entries: map[string]ProvenanceEntry{},
+}
+
+func provenancePath(base string) string {
+	return base + "/provenance.json"
+}
+
+// Loads the provenance of a base directory. A broken log is started over, it only explains files and is not needed
+// for anything to work.
+func loadProvenance(base string) {
+	provenance.lock.Lock()
+	defer provenance.lock.Unlock()
+
+	provenance.base = base
+	provenance.entries = map[string]ProvenanceEntry{}
+	path := provenancePath(base)
+	if !fileExists(path) {
+		return
+	}
+	err := readJson(path, &provenance.entries)
+	if err != nil {
+		fmt.Printf("Warning: %s is corrupt, the sources of earlier downloads are forgotten\n", path)
+		provenance.entries = map[string]ProvenanceEntry{}
+		provenance.dirty = true
+	}
+	if provenance.entries == nil {
+		provenance.entries = map[string]ProvenanceEntry{}
+	}
+}
+
+func (this *ProvenanceLog) key(path string) string {
+	relative, ok := strings.CutPrefix(path, this.base+"/")
+	if ok {
+		return relative
+	}
+	return path
+}
+
+// Records where a file that was just downloaded or copied came from.
+func (this *ProvenanceLog) record(path string, url string, source string, hash *string) {
+	sha := ""
+	if hash != nil && len(*hash) == 40 {
+		sha = *hash
+	} else {
+		sha = hashCache.hashOf(path)
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.entries[this.key(path)] = ProvenanceEntry{
+		Url:    url,
+		Source: source,
+		Time:   time.Now().UTC().Truncate(time.Second),
+		Pack:   this.pack,
+		Sha1:   sha,
+	}
+	this.dirty = true
+}
+
+// Sets the pack the following downloads are for, an empty string when they are not for one.
+func (this *ProvenanceLog) setPack(pack string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.pack = pack
+}
+
+// Finds what is known about a file by its path or by its SHA-1 hash. Returns the key of the entry too.
+func (this *ProvenanceLog) find(query string) (string, *ProvenanceEntry) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	keys := []string{query, this.key(query)}
+	absolute, err := filepath.Abs(query)
+	if err == nil {
+		keys = append(keys, this.key(filepath.ToSlash(absolute)))
+	}
+	for i := range keys {
+		entry, ok := this.entries[keys[i]]
+		if ok {
+			return keys[i], &entry
+		}
+	}
+
+	hash := strings.ToLower(query)
+	var matches []string
+	for key := range this.entries {
+		if this.entries[key].Sha1 == hash {
+			matches = append(matches, key)
+		}
+	}
+	if len(matches) == 0 {
+		return "", nil
+	}
+	sort.Strings(matches)
+	entry := this.entries[matches[0]]
+	return matches[0], &entry
+}
+
+// Writes the log if anything was recorded since it was loaded.
+func (this *ProvenanceLog) save() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if !this.dirty || this.base == "" {
+		return nil
+	}
+
+	err := writeJson(provenancePath(this.base), this.entries)
+	if err != nil {
+		return errors.Join(errors.New("failed to save the provenance of downloads"), err)
+	}
+	this.dirty = false
+	return nil
+}
+
+func storeInfoCommand(base string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one path or SHA-1 hash")
+	}
+
+	key, entry := provenance.find(args[0])
+	if entry == nil {
+		return errors.New("nothing is known about where " + args[0] + " came from, it was not downloaded since the launcher started recording it")
+	}
+	fmt.Printf("File:       %s\n", key)
+	fmt.Printf("URL:        %s\n", entry.Url)
+	if entry.Source != entry.Url {
+		fmt.Printf("Source:     %s\n", entry.Source)
+	}
+	fmt.Printf("Downloaded: %s\n", entry.Time.Local().Format(time.RFC1123))
+	if entry.Pack != "" {
+		fmt.Printf("Pack:       %s\n", entry.Pack)
+	}
+	if entry.Sha1 != "" {
+		fmt.Printf("SHA-1:      %s\n", entry.Sha1)
+	}
+
+	path := key
+	if !filepath.IsAbs(path) {
+		path = base + "/" + key
+	}
+	if !fileExists(path) {
+		fmt.Println("The file does not exist anymore")
+	} else if entry.Sha1 != "" {
+		hash, err := sha1File(path)
+		if err != nil {
+			return errors.Join(errors.New("failed to hash "+path), err)
+		}
+		if hash != entry.Sha1 {
+			fmt.Printf("The file was changed since, its SHA-1 is %s now\n", hash)
+		}
+	}
+	return nil
+}
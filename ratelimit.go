@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A transfer rate in bytes per second, written like "5MB/s" or "512KiB/s" in JSON and on the command line. 0 means
+// unlimited.
+type Rate float64
+
+var rateUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"KIB": 1024,
+	"MIB": 1024 * 1024,
+	"GIB": 1024 * 1024 * 1024,
+}
+
+func parseRate(raw string) (Rate, error) {
+	raw = strings.TrimSuffix(strings.TrimSpace(raw), "/s")
+	end := 0
+	for end < len(raw) && (raw[end] == '.' || (raw[end] >= '0' && raw[end] <= '9')) {
+		end++
+	}
+
+	value, err := strconv.ParseFloat(raw[:end], 64)
+	if err != nil {
+		return 0, errors.New("invalid rate " + raw + ", expected something like 5MB/s")
+	}
+	unit, ok := rateUnits[strings.ToUpper(strings.TrimSpace(raw[end:]))]
+	if !ok {
+		return 0, errors.New("unknown unit in rate " + raw)
+	}
+	return Rate(value * unit), nil
+}
+
+func (this *Rate) UnmarshalJSON(bytes []byte) error {
+	var raw string
+	err := json.Unmarshal(bytes, &raw)
+	if err != nil {
+		return err
+	}
+
+	*this, err = parseRate(raw)
+	return err
+}
+
+func (this Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatFloat(float64(this), 'f', -1, 64) + "B/s")
+}
+
+// Hands out bytes at a fixed rate, allowing bursts of up to a tenth of a second worth of bytes.
+type TokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate Rate) *TokenBucket {
+	burst := max(float64(rate)/10, 1024)
+	return &TokenBucket{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Takes bytes out of the bucket, waiting until enough have accumulated. The bucket is allowed to go into debt so reads
+// larger than a burst work, later callers wait for the debt to be paid off.
+func (this *TokenBucket) take(bytes int) {
+	this.lock.Lock()
+	now := time.Now()
+	this.tokens = min(this.tokens+now.Sub(this.last).Seconds()*this.rate, this.burst)
+	this.last = now
+	this.tokens -= float64(bytes)
+	wait := time.Duration(0)
+	if this.tokens < 0 {
+		wait = time.Duration(-this.tokens / this.rate * float64(time.Second))
+	}
+	this.lock.Unlock()
+
+	time.Sleep(wait)
+}
+
+// The bucket shared by every download, nil when downloads are not limited.
+var downloadBucket *TokenBucket
+
+// Limits how fast a response body can be read using the shared bucket.
+type limitedReader struct {
+	reader io.ReadCloser
+	bucket *TokenBucket
+}
+
+func (this *limitedReader) Read(buffer []byte) (int, error) {
+	if len(buffer) > int(this.bucket.burst) {
+		buffer = buffer[:int(this.bucket.burst)]
+	}
+	read, err := this.reader.Read(buffer)
+	this.bucket.take(read)
+	return read, err
+}
+
+func (this *limitedReader) Close() error {
+	return this.reader.Close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Where the last remote config that was verified is kept, for when the server can not be reached.
+	REMOTE_CONFIG_CACHE string = "config.remote.json"
+	// Detached signatures are expected next to the config, at its URL with this appended.
+	REMOTE_CONFIG_SIGNATURE string = ".sig"
+
+	REMOTE_CONFIG_MAX_SIZE int64 = 1024 * 1024
+)
+
+// A config served by an admin for a whole fleet of machines. It has to be signed with the configured key, the config of
+// the machine is only used for what the remote config does not set.
+type RemoteConfig struct {
+	// The HTTPS URL of the config, signed with a detached signature at the URL with REMOTE_CONFIG_SIGNATURE appended.
+	Url string `json:"url"`
+	// A file with the public key the config is signed with.
+	Key string `json:"key"`
+	// The fingerprint the key has to have, the key is trusted as it is when empty.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Checks the remote config settings.
+func (this *RemoteConfig) validate() error {
+	if this.Url == "" {
+		return nil
+	}
+	parsed, err := url.Parse(this.Url)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return errors.New("remote.url must be an https URL")
+	}
+	if this.Key == "" {
+		return errors.New("remote.key is required, remote configs have to be signed")
+	}
+	return nil
+}
+
+// Checks the signature of a remote config.
+func verifyRemoteConfig(key *PgpKey, data []byte, signatureData []byte) error {
+	signature, err := readPgpSignature(signatureData)
+	if err != nil {
+		return errors.Join(errors.New("failed to read the signature of the remote config"), err)
+	}
+	err = verifyPgpSignature(key, signature, bytes.NewReader(data))
+	if err != nil {
+		return errors.Join(errors.New("the signature of the remote config is invalid"), err)
+	}
+	return nil
+}
+
+// Downloads and verifies the remote config, falling back to the cached copy when it can not be downloaded. A remote
+// config that is downloaded but fails verification is never used, neither is the cached copy then.
+func fetchRemoteConfig(base string, key *PgpKey) ([]byte, error) {
+	remote := &config.Remote
+	cache := base + "/" + REMOTE_CONFIG_CACHE
+
+	data, err := downloadBytes(remote.Url, REMOTE_CONFIG_MAX_SIZE)
+	var signatureData []byte
+	if err == nil {
+		signatureData, err = downloadBytes(remote.Url+REMOTE_CONFIG_SIGNATURE, PGP_MAX_SIGNATURE_SIZE)
+	}
+	if err == nil {
+		err = verifyRemoteConfig(key, data, signatureData)
+		if err != nil {
+			return nil, err
+		}
+		err = writeFile(cache, data)
+		if err == nil {
+			err = writeFile(cache+REMOTE_CONFIG_SIGNATURE, signatureData)
+		}
+		if err != nil {
+			fmt.Printf("Failed to cache the remote config: %s\n", err)
+		}
+		return data, nil
+	}
+
+	cached, cacheErr := os.ReadFile(cache)
+	if cacheErr != nil {
+		return nil, errors.Join(errors.New("failed to download the remote config and there is no cached copy"), err)
+	}
+	cachedSignature, cacheErr := os.ReadFile(cache + REMOTE_CONFIG_SIGNATURE)
+	if cacheErr == nil {
+		cacheErr = verifyRemoteConfig(key, cached, cachedSignature)
+	}
+	if cacheErr != nil {
+		return nil, errors.Join(errors.New("failed to download the remote config and the cached copy can not be used"), err, cacheErr)
+	}
+	fmt.Printf("Using the cached remote config, downloading it failed: %s\n", err)
+	return cached, nil
+}
+
+// Applies the remote config on top of the local one. The remote config can not point somewhere else.
+func loadRemoteConfig(base string) error {
+	remote := config.Remote
+	if remote.Url == "" {
+		return nil
+	}
+
+	key, err := loadPgpKey(remote.Key, remote.Fingerprint)
+	if err != nil {
+		return errors.Join(errors.New("failed to load the key of the remote config"), err)
+	}
+	data, err := fetchRemoteConfig(base, key)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, &config)
+	config.Remote = remote
+	if err != nil {
+		return errors.Join(errors.New("failed to parse the remote config"), err)
+	}
+	err = config.validate()
+	if err != nil {
+		return errors.Join(errors.New("invalid remote config "+remote.Url), err)
+	}
+	return nil
+}
+
+// Creates the instances of the config that don't exist yet. Instances that exist are left alone, they belong to the
+// user once they are created.
+func createConfigInstances(base string) error {
+	for i := range config.Instances {
+		instance := config.Instances[i]
+		if fileExists(instanceDir(base, instance.Name) + "/instance.json") {
+			continue
+		}
+		err := validateInstanceName(instance.Name)
+		if err != nil {
+			return err
+		}
+		err = commitInstance(base, &instance)
+		if err != nil {
+			return errors.Join(errors.New("failed to create instance "+instance.Name), err)
+		}
+		fmt.Printf("Created instance %s from the config\n", instance.Name)
+	}
+	return nil
+}
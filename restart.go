@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The longest time to wait before restarting a game that keeps crashing.
+//
+//goland:noinspection GoSnakeCaseUsage
+const RESTART_MAX_BACKOFF = 5 * time.Minute
+
+// Launches a game again when it crashed soon after it started, for kiosks and servers that should keep running without
+// someone watching them. Restarting is off while MaxRestarts is 0.
+type RestartPolicy struct {
+	// How often the game is restarted in a row before giving up.
+	MaxRestarts int `json:"maxRestarts"`
+	// Only crashes this soon after the game started are restarted, 0 restarts every crash.
+	Within Duration `json:"within"`
+	// How long to wait before the first restart, doubled for every further one up to RESTART_MAX_BACKOFF.
+	Backoff Duration `json:"backoff"`
+}
+
+func (this *RestartPolicy) validate() error {
+	var err error
+	if this.MaxRestarts < 0 {
+		err = errors.Join(err, errors.New("maxRestarts must not be negative"))
+	}
+	if this.Within < 0 {
+		err = errors.Join(err, errors.New("within must not be negative"))
+	}
+	if this.Backoff < 0 {
+		err = errors.Join(err, errors.New("backoff must not be negative"))
+	}
+	return err
+}
+
+// Returns the restart policy of an instance, the one of the config when the instance has none.
+func instanceRestartPolicy(instance *Instance) *RestartPolicy {
+	if instance.Restart != nil {
+		return instance.Restart
+	}
+	return &config.Restart
+}
+
+// Adds the flags that set the restart policy of an instance to a flag set, creating the policy of the instance once one
+// of them is used.
+func bindRestartFlags(set *flag.FlagSet, instance *Instance) {
+	policy := func() *RestartPolicy {
+		if instance.Restart == nil {
+			restart := config.Restart
+			instance.Restart = &restart
+		}
+		return instance.Restart
+	}
+
+	set.Func("max-restarts", "how often a game that crashed is restarted in a row, 0 to never restart it", func(value string) error {
+		restarts, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		policy().MaxRestarts = restarts
+		return policy().validate()
+	})
+	set.Func("restart-within", "only restart crashes this soon after the start, like 60s, 0 for every crash", func(value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		policy().Within = Duration(duration)
+		return policy().validate()
+	})
+	set.Func("restart-backoff", "how long to wait before the first restart, doubled for every further one", func(value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		policy().Backoff = Duration(duration)
+		return policy().validate()
+	})
+}
+
+// Launches an instance and launches it again as the restart policy of it says when the game crashes. Returns the exit
+// code of the last launch.
+func launchWithRestarts(base string, instance *Instance, options *LaunchOptions, noRestart bool) (int, error) {
+	policy := instanceRestartPolicy(instance)
+	restarts := 0
+	// Resolving, downloading and everything else before the game starts does not count towards how long it ran
+	var started time.Time
+	launched := *options
+	launched.Started = func() {
+		started = time.Now()
+	}
+	for {
+		exitCode, err := launch(base, instance, &launched)
+		if err != nil || exitCode == 0 || noRestart || options.PrintCommand || options.PrepareOnly {
+			return exitCode, err
+		}
+		if checkInterrupted() != nil {
+			return exitCode, nil
+		}
+
+		ran := time.Since(started)
+		if policy.Within > 0 && ran > time.Duration(policy.Within) {
+			return exitCode, nil
+		}
+		if restarts >= policy.MaxRestarts {
+			if policy.MaxRestarts > 0 {
+				fmt.Printf("The game crashed %d times in a row, giving up\n", restarts+1)
+			}
+			return exitCode, nil
+		}
+
+		delay := time.Duration(policy.Backoff)
+		for i := 0; i < restarts && delay < RESTART_MAX_BACKOFF; i++ {
+			delay *= 2
+		}
+		delay = min(delay, RESTART_MAX_BACKOFF)
+		restarts++
+		fmt.Printf("The game crashed after %s, restarting it in %s (%d of %d)\n", ran.Round(time.Second), delay, restarts, policy.MaxRestarts)
+		select {
+		case <-time.After(delay):
+		case <-launcherContext.Done():
+			{
+				return exitCode, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// How long "java -version" may take before the runtime is considered broken.
+	JAVA_VERSION_TIMEOUT time.Duration = 30 * time.Second
+	// Versions of the game that need at least this Java also run on newer ones, older versions need exactly theirs.
+	JAVA_FORWARD_COMPATIBLE uint32 = 16
+)
+
+var javaVersionPattern = regexp.MustCompile(`version "([^"]+)"`)
+
+// Returned by runtime providers that have no runtime for the requested version and platform.
+var errNoRuntime = errors.New("no runtime available")
+
+// A source of Java runtimes. Provide returns the home directory of a runtime of the requested major version. The
+// component is the runtime of Mojang the version asks for, like "java-runtime-gamma", empty for versions that don't say.
+type RuntimeProvider struct {
+	Name    string
+	Provide func(base string, version uint32, component string) (string, error)
+}
+
+var runtimeProviders = []RuntimeProvider{
+	{
+		Name: "adoptium",
+		Provide: func(base string, version uint32, _ string) (string, error) {
+			return downloadJdk(base, version)
+		},
+	},
+	{
+		Name:    "system",
+		Provide: findSystemJava,
+	},
+	{
+		Name:    "mojang",
+		Provide: provideMojangRuntime,
+	},
+	{
+		Name:    "jlink",
+		Provide: provideJlinkRuntime,
+	},
+}
+
+// The providers that are tried in order when the config does not specify a chain.
+var defaultRuntimeProviders = []string{
+	"adoptium",
+	"system",
+}
+
+func findRuntimeProvider(name string) *RuntimeProvider {
+	for i := range runtimeProviders {
+		if runtimeProviders[i].Name == name {
+			return &runtimeProviders[i]
+		}
+	}
+	return nil
+}
+
+// Tries every runtime provider of the configured chain in order until one of them provides a runtime of the requested
+// version. Prints which runtime was chosen and why the providers before it were skipped.
+func provideRuntime(base string, version uint32, component string) (string, error) {
+	chain := config.RuntimeProviders
+	if len(chain) == 0 {
+		chain = defaultRuntimeProviders
+	}
+
+	var failures error
+	for i := range chain {
+		provider := findRuntimeProvider(chain[i])
+		if provider == nil {
+			return "", errors.New("unknown runtime provider " + chain[i])
+		}
+
+		home, err := provider.Provide(base, version, component)
+		if err == nil {
+			err = checkJavaVersion(home, version)
+		}
+		if err == nil {
+			fmt.Printf("Using Java %d from %s: %s\n", version, provider.Name, home)
+			markJavaUsed(base, home)
+			return home, nil
+		}
+
+		var mismatch *JavaVersionError
+		if errors.As(err, &mismatch) {
+			fmt.Printf("%s, trying the next provider\n", err)
+		} else if errors.Is(err, errNoRuntime) {
+			fmt.Printf("%s has no Java %d for %s/%s, trying the next provider\n", provider.Name, version, runtime.GOOS, runtime.GOARCH)
+		} else {
+			fmt.Printf("%s failed to provide Java %d, trying the next provider: %s\n", provider.Name, version, err)
+		}
+		failures = errors.Join(failures, errors.New(provider.Name+" failed"), err)
+	}
+
+	var mismatch *JavaVersionError
+	if errors.As(failures, &mismatch) && !slices.Contains(chain, "adoptium") && isInteractive() {
+		confirmed, err := askYesNo(bufio.NewReader(os.Stdin), fmt.Sprintf("Download Java %d from Adoptium instead?", version))
+		if err != nil {
+			return "", err
+		}
+		if confirmed {
+			home, err := downloadJdk(base, version)
+			if err == nil {
+				markJavaUsed(base, home)
+				return home, nil
+			}
+			failures = errors.Join(failures, errors.New("adoptium failed"), err)
+		}
+	}
+	return "", errors.Join(errors.New(fmt.Sprintf("no runtime provider could provide Java %d", version)), failures)
+}
+
+// Returned when a runtime is not of the Java version a version of the game needs.
+type JavaVersionError struct {
+	Home     string
+	Major    uint32
+	Required uint32
+}
+
+func (this *JavaVersionError) Error() string {
+	return fmt.Sprintf("the Java at %s is Java %d, the game needs Java %d", this.Home, this.Major, this.Required)
+}
+
+// Runs "java -version" of a runtime and returns its major version.
+func runtimeMajorVersion(home string) (uint32, error) {
+	ctx, cancel := context.WithTimeout(launcherContext, JAVA_VERSION_TIMEOUT)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, javaExecutable(home), "-version").CombinedOutput()
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to run java -version of "+home), err)
+	}
+
+	match := javaVersionPattern.FindSubmatch(output)
+	major := uint32(0)
+	if match != nil {
+		major = javaMajorVersion(string(match[1]))
+	}
+	if major == 0 {
+		return 0, errors.New("failed to find the version in the output of java -version of " + home)
+	}
+	return major, nil
+}
+
+// Makes sure a runtime can run a version of the game that needs a major version of Java. Newer Java is fine for
+// versions that need at least JAVA_FORWARD_COMPATIBLE, older versions break on anything but their own.
+func checkJavaVersion(home string, required uint32) error {
+	major, err := runtimeMajorVersion(home)
+	if err != nil {
+		return err
+	}
+	if major == required || (required >= JAVA_FORWARD_COMPATIBLE && major > required) {
+		return nil
+	}
+	return &JavaVersionError{
+		Home:     home,
+		Major:    major,
+		Required: required,
+	}
+}
+
+// Finds the Java installed on the system, either from JAVA_HOME or from the PATH. The version is checked by
+// provideRuntime like the one of every other provider.
+func findSystemJava(_ string, _ uint32, _ string) (string, error) {
+	home := os.Getenv("JAVA_HOME")
+	if home != "" {
+		return home, nil
+	}
+
+	java, err := exec.LookPath("java")
+	if err != nil {
+		return "", errors.Join(errNoRuntime, errors.New("java is not on the PATH"))
+	}
+
+	// Distributions like to put a chain of links to the real binary on the PATH
+	java, err = filepath.EvalSymlinks(java)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to resolve "+java), err)
+	}
+	return filepath.ToSlash(filepath.Dir(filepath.Dir(java))), nil
+}
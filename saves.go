@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	SAVES_DIR          string = "saves"
+	SAVES_PARKED_DIR   string = "saves.release"
+	SNAPSHOT_SAVES_DIR string = "snapshot-saves"
+)
+
+// Returns the directory the worlds of a snapshot are kept in when snapshot saves are separated.
+func snapshotSavesDir(gameDir string, version string) string {
+	return gameDir + "/" + SNAPSHOT_SAVES_DIR + "/" + version
+}
+
+// Puts the regular saves directory back in place if a snapshot run swapped it out. This also recovers from a launcher
+// that was killed while a snapshot was running.
+func restoreSaves(gameDir string) error {
+	saves := gameDir + "/" + SAVES_DIR
+	info, err := os.Lstat(saves)
+	if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		err = os.Remove(saves)
+		if err != nil {
+			return errors.Join(errors.New("failed to remove snapshot saves link"), err)
+		}
+	}
+
+	parked := gameDir + "/" + SAVES_PARKED_DIR
+	if fileExists(parked) {
+		if fileExists(saves) {
+			return errors.New("both " + saves + " and " + parked + " exist, move the worlds of one into the other")
+		}
+		err = renameFile(parked, saves)
+		if err != nil {
+			return errors.Join(errors.New("failed to restore saves directory"), err)
+		}
+	}
+	return nil
+}
+
+// Makes the game use a saves directory of its own when an instance that separates snapshot saves runs a snapshot. The
+// regular saves directory is parked next to it and replaced by a link to the directory of the snapshot until
+// restoreSaves is called, so snapshot worlds never end up next to the stable ones.
+func prepareSaves(gameDir string, instance *Instance, manifest *Manifest) error {
+	err := restoreSaves(gameDir)
+	if err != nil {
+		return err
+	}
+	if !instance.SnapshotSaves || manifest.Type != "snapshot" {
+		return nil
+	}
+
+	err = createParents(snapshotSavesDir(gameDir, manifest.Id))
+	if err != nil {
+		return errors.Join(errors.New("failed to create snapshot saves directory"), err)
+	}
+
+	saves := gameDir + "/" + SAVES_DIR
+	if fileExists(saves) {
+		err = renameFile(saves, gameDir+"/"+SAVES_PARKED_DIR)
+		if err != nil {
+			return errors.Join(errors.New("failed to move saves directory out of the way"), err)
+		}
+	}
+
+	err = createLink(saves, SNAPSHOT_SAVES_DIR+"/"+manifest.Id)
+	if err != nil {
+		return errors.Join(errors.New("failed to link snapshot saves directory"), err, restoreSaves(gameDir))
+	}
+	fmt.Printf("Using the separate saves of snapshot %s\n", manifest.Id)
+	return nil
+}
+
+// Returns the data version a world was last saved with from its level.dat, 0 when it does not say. Versions from 1.9 on
+// write it.
+func worldDataVersion(world string) (int32, error) {
+	root, _, err := readNbtFile(world + "/level.dat")
+	if err != nil {
+		return 0, err
+	}
+	data := root.child("Data")
+	if data == nil {
+		return 0, nil
+	}
+	version := data.child("DataVersion")
+	if version == nil {
+		return 0, nil
+	}
+	value, ok := version.Value.(int32)
+	if !ok {
+		return 0, errors.New("the DataVersion of " + world + " is not an int")
+	}
+	return value, nil
+}
+
+// Finds the worlds of a game directory that were saved by a newer version than the one of a client jar. Opening them
+// with an older version can break them for good. Versions older than 1.14 do not know their world version, nothing is
+// found for them.
+func findNewerWorlds(gameDir string, jar string) ([]string, error) {
+	version := readClientVersionJson(jar)
+	if version == nil || version.WorldVersion == 0 {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(gameDir + "/" + SAVES_DIR)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Join(errors.New("failed to list worlds"), err)
+	}
+
+	var newer []string
+	for i := range entries {
+		world := gameDir + "/" + SAVES_DIR + "/" + entries[i].Name()
+		if !fileExists(world + "/level.dat") {
+			continue
+		}
+		data, err := worldDataVersion(world)
+		if err != nil {
+			fmt.Printf("Failed to read the version of world %s: %s\n", entries[i].Name(), err)
+			continue
+		}
+		if int(data) > version.WorldVersion {
+			newer = append(newer, entries[i].Name())
+		}
+	}
+	sort.Strings(newer)
+	return newer, nil
+}
+
+// Refuses to start a version that is older than the one some worlds were last saved with, unless the user agrees to it
+// when asked or turned the check off.
+func checkWorldVersions(gameDir string, jar string, manifest *Manifest) error {
+	newer, err := findNewerWorlds(gameDir, jar)
+	if err != nil || len(newer) == 0 {
+		return err
+	}
+
+	fmt.Printf("These worlds were saved by a version newer than %s, opening them may break them: %s\n", manifest.Id, strings.Join(newer, ", "))
+	if !isInteractive() {
+		return errors.New("refusing to start " + manifest.Id + " with worlds of newer versions, pass --ignore-world-versions to start it anyway")
+	}
+	confirmed, err := askYesNo(bufio.NewReader(os.Stdin), "Start the game anyway?")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return errors.New("the game was not started")
+	}
+	return nil
+}
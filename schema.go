@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Fields and rule features the launcher does not know are reported once and otherwise ignored, unknown features
+	// count as turned off. The default.
+	SCHEMA_LENIENT string = "lenient"
+	// Fields and rule features the launcher does not know stop the launch, for testing new versions of the manifests.
+	SCHEMA_STRICT string = "strict"
+)
+
+// Everything the launcher did not understand in the JSON of Mojang during this run.
+type SchemaReport struct {
+	lock sync.Mutex
+	// The paths of unknown fields, keyed by the file they were found in.
+	Fields map[string][]string `json:"fields"`
+	// The names of unknown features of rules.
+	Features []string `json:"features"`
+	// The names of placeholders in arguments the launcher has no value for.
+	Variables []string `json:"variables"`
+}
+
+var schemaReport = &SchemaReport{
+	Fields: map[string][]string{},
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Collects the paths of every field of a decoded JSON value that the type it is decoded into does not have, the way
+// encoding/json matches them. Types that decode themselves are not looked into.
+func findUnknownFields(value any, typ reflect.Type, path string, found map[string]bool) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if reflect.PointerTo(typ).Implements(jsonUnmarshalerType) {
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		{
+			object, ok := value.(map[string]any)
+			if !ok {
+				return
+			}
+			fields := map[string]reflect.Type{}
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if name == "-" || !field.IsExported() {
+					continue
+				}
+				if name == "" {
+					name = field.Name
+				}
+				fields[strings.ToLower(name)] = field.Type
+			}
+			for key := range object {
+				fieldType, ok := fields[strings.ToLower(key)]
+				if !ok {
+					found[path+"."+key] = true
+					continue
+				}
+				findUnknownFields(object[key], fieldType, path+"."+key, found)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		{
+			array, ok := value.([]any)
+			if !ok {
+				return
+			}
+			for i := range array {
+				findUnknownFields(array[i], typ.Elem(), path+"[]", found)
+			}
+		}
+	case reflect.Map:
+		{
+			object, ok := value.(map[string]any)
+			if !ok {
+				return
+			}
+			for key := range object {
+				findUnknownFields(object[key], typ.Elem(), path+"."+key, found)
+			}
+		}
+	default:
+		{
+		}
+	}
+}
+
+// Checks a JSON document of Mojang for fields the structure it was read into does not have. They are recorded and
+// warned about, in strict mode they are an error.
+func checkUnknownFields(source string, data []byte, structure any) error {
+	var value any
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	found := map[string]bool{}
+	findUnknownFields(value, reflect.TypeOf(structure), "", found)
+	if len(found) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(found))
+	for path := range found {
+		paths = append(paths, strings.TrimPrefix(path, "."))
+	}
+	sort.Strings(paths)
+
+	schemaReport.lock.Lock()
+	_, reported := schemaReport.Fields[source]
+	schemaReport.Fields[source] = paths
+	schemaReport.lock.Unlock()
+
+	message := source + " has fields the launcher does not know: " + strings.Join(shortList(paths, 5), ", ")
+	if config.Schema == SCHEMA_STRICT {
+		return errors.New(message)
+	}
+	if !reported {
+		fmt.Printf("Warning: %s\n", message)
+	}
+	return nil
+}
+
+// Checks the rules of a manifest for features the launcher does not know. They are recorded and warned about, in
+// strict mode they are an error. testRule treats them as turned off.
+func checkRuleFeatures(manifest *Manifest, features map[string]bool) error {
+	var rules []Rule
+	for i := range manifest.Libraries {
+		rules = append(rules, manifest.Libraries[i].Rules...)
+	}
+	arguments := append(manifest.jvmArguments(), manifest.gameArguments()...)
+	for i := range arguments {
+		rules = append(rules, arguments[i].Rules...)
+	}
+
+	unknown := map[string]bool{}
+	for i := range rules {
+		for feature := range rules[i].Features {
+			if _, ok := features[feature]; !ok {
+				unknown[feature] = true
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(unknown))
+	schemaReport.lock.Lock()
+	for name := range unknown {
+		names = append(names, name)
+		if !slices.Contains(schemaReport.Features, name) {
+			schemaReport.Features = append(schemaReport.Features, name)
+		}
+	}
+	sort.Strings(schemaReport.Features)
+	schemaReport.lock.Unlock()
+	sort.Strings(names)
+
+	message := "the rules of " + manifest.Id + " use features the launcher does not know: " + strings.Join(names, ", ")
+	if config.Schema == SCHEMA_STRICT {
+		return errors.New(message)
+	}
+	fmt.Printf("Warning: %s, they count as turned off\n", message)
+	return nil
+}
+
+// Records the placeholders in the arguments of a version the launcher has no value for and warns about them, in strict
+// mode they are an error. They are passed to the game as they are otherwise.
+func checkUnknownVariables(manifest *Manifest, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	schemaReport.lock.Lock()
+	for i := range names {
+		if !slices.Contains(schemaReport.Variables, names[i]) {
+			schemaReport.Variables = append(schemaReport.Variables, names[i])
+		}
+	}
+	sort.Strings(schemaReport.Variables)
+	schemaReport.lock.Unlock()
+
+	message := "the arguments of " + manifest.Id + " use placeholders the launcher does not know: ${" + strings.Join(names, "}, ${") + "}"
+	if config.Schema == SCHEMA_STRICT {
+		return errors.New(message)
+	}
+	fmt.Printf("Warning: %s, they are passed as they are\n", message)
+	return nil
+}
+
+// Returns the first entries of a list, with a note how many were left out.
+func shortList(list []string, length int) []string {
+	if len(list) <= length {
+		return list
+	}
+	return append(append([]string{}, list[:length]...), fmt.Sprintf("and %d more", len(list)-length))
+}
+
+// Writes everything that was not understood during this run to a file, see SchemaReport.
+func (this *SchemaReport) write(path string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	err := writeJson(path, this)
+	if err != nil {
+		return errors.Join(errors.New("failed to write the report of unknown fields to "+path), err)
+	}
+	return nil
+}
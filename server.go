@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Stops a required server once the game that started it exits.
+	SERVER_SHUTDOWN_STOP string = "stop"
+	// Leaves a required server running after the game exits.
+	SERVER_SHUTDOWN_KEEP string = "keep"
+
+	SERVER_DEFAULT_PORT  int           = 25565
+	SERVER_START_TIMEOUT time.Duration = 5 * time.Minute
+	SERVER_STOP_TIMEOUT  time.Duration = time.Minute
+)
+
+// Returns the path of the dedicated server jar of a version.
+func serverJarPath(base string, version string) string {
+	return base + "/server/" + version + ".jar"
+}
+
+// Reads a Java properties file like server.properties. Only the simple key=value form the game writes is understood.
+func readProperties(path string) (map[string]string, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	properties := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		properties[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return properties, scanner.Err()
+}
+
+// Returns the port the server in a game directory listens on, the default one unless server.properties says otherwise.
+func serverPort(gameDir string) int {
+	properties, err := readProperties(gameDir + "/server.properties")
+	if err != nil {
+		return SERVER_DEFAULT_PORT
+	}
+	port, err := strconv.Atoi(properties["server-port"])
+	if err != nil || port <= 0 || port > 65535 {
+		return SERVER_DEFAULT_PORT
+	}
+	return port
+}
+
+// Returns the address the game uses to join the server of a server instance running on this machine.
+func serverAddress(base string, server *Instance) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(serverPort(server.gameDir(base))))
+}
+
+// Checks if something accepts connections on a local port.
+func isServerRunning(address string) bool {
+	connection, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return false
+	}
+	_ = connection.Close()
+	return true
+}
+
+// Checks that the ports a server is configured to listen on are free, so a taken port is reported with the process
+// that has it instead of the server failing late with a bind error. Checks the RCON and query ports too when they are
+// enabled.
+func checkServerPorts(gameDir string) error {
+	properties, err := readProperties(gameDir + "/server.properties")
+	if err != nil {
+		properties = map[string]string{}
+	}
+
+	type Port struct {
+		name     string
+		protocol string
+		port     int
+	}
+	port := serverPort(gameDir)
+	ports := []Port{{"server", "tcp", port}}
+	if properties["enable-rcon"] == "true" {
+		rcon, err := strconv.Atoi(properties["rcon.port"])
+		if err != nil {
+			rcon = 25575
+		}
+		ports = append(ports, Port{"RCON", "tcp", rcon})
+	}
+	if properties["enable-query"] == "true" {
+		query, err := strconv.Atoi(properties["query.port"])
+		if err != nil {
+			query = port
+		}
+		ports = append(ports, Port{"query", "udp", query})
+	}
+
+	var problems error
+	for i := range ports {
+		address := net.JoinHostPort(properties["server-ip"], strconv.Itoa(ports[i].port))
+		var listenErr error
+		if ports[i].protocol == "udp" {
+			var connection net.PacketConn
+			connection, listenErr = net.ListenPacket("udp", address)
+			if listenErr == nil {
+				_ = connection.Close()
+			}
+		} else {
+			var listener net.Listener
+			listener, listenErr = net.Listen("tcp", address)
+			if listenErr == nil {
+				_ = listener.Close()
+			}
+		}
+		if listenErr == nil {
+			continue
+		}
+
+		owner := portOwner(ports[i].port, ports[i].protocol)
+		if owner == "" {
+			owner = "another process"
+		}
+		problems = errors.Join(problems, errors.New(fmt.Sprintf("the %s port %d is used by %s", ports[i].name, ports[i].port, owner)))
+	}
+	if problems != nil {
+		return errors.Join(errors.New("the server can not start, change the ports in "+gameDir+"/server.properties or stop what uses them"), problems)
+	}
+	return nil
+}
+
+// The server refuses to start until its EULA was accepted, that has to be done by the user and not the launcher.
+func checkEula(gameDir string) error {
+	properties, err := readProperties(gameDir + "/eula.txt")
+	if err != nil || properties["eula"] != "true" {
+		return errors.New("the Minecraft EULA (https://aka.ms/MinecraftEULA) has to be accepted first, set eula=true in " + gameDir + "/eula.txt")
+	}
+	return nil
+}
+
+// Downloads the runtime and server jar of a server instance. Returns the java executable and its arguments.
+func prepareServer(base string, instance *Instance, options *LaunchOptions) (string, []string, error) {
+	version, err := resolveManifest(base, instance)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var manifest Manifest
+	err = loadVersionJson(base, version, &manifest)
+	if err != nil {
+		return "", nil, err
+	}
+
+	server, ok := manifest.Downloads["server"]
+	if !ok {
+		return "", nil, errors.New("there is no dedicated server for " + manifest.Id)
+	}
+
+	javaPath, err := provideInstanceRuntime(base, instance, manifest.javaVersion(), manifest.JavaVersion.Component)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jar := serverJarPath(base, manifest.Id)
+	batch := downloadPool.batch("Server")
+	batch.submit(func() error {
+		return downloadFileRaw(jar, server.Url, &server.Sha1, server.Size, batch.progress)
+	})
+	err = batch.wait()
+	if err != nil {
+		return "", nil, errors.Join(errors.New("failed to download server"), err)
+	}
+	downloadSummary.print()
+
+	java := javaExecutable(javaPath)
+
+	userArguments, err := userJvmArguments(instance, options, manifest.javaVersion())
+	if err != nil {
+		return "", nil, err
+	}
+
+	var arguments []string
+	arguments = append(arguments, localeArguments(instance)...)
+	arguments = append(arguments, heapDumpArguments(base, instance)...)
+	arguments = append(arguments, userArguments...)
+	arguments = append(arguments, "-jar", jar, "nogui")
+	arguments = append(arguments, options.GameArgs...)
+	return java, arguments, nil
+}
+
+// Runs the dedicated server of a server instance in the foreground. Returns the exit code of the server.
+func launchServer(base string, instance *Instance, options *LaunchOptions) (int, error) {
+	java, arguments, err := prepareServer(base, instance, options)
+	if err != nil {
+		return 0, err
+	}
+	if options.PrepareOnly {
+		return 0, nil
+	}
+
+	gameDir := instance.gameDir(base)
+	err = createParents(gameDir)
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to create game directory"), err)
+	}
+	err = checkEula(gameDir)
+	if err != nil {
+		return 0, err
+	}
+	err = checkServerPorts(gameDir)
+	if err != nil {
+		return 0, err
+	}
+
+	releaseMemory()
+	process := executeWrapped(instance, java, arguments...)
+	process.Dir = gameDir
+	process.Stdin = os.Stdin
+	process.Stdout = os.Stdout
+	process.Stderr = os.Stderr
+	err = process.Start()
+	if err == nil {
+		if options.Started != nil {
+			options.Started()
+		}
+		err = process.Wait()
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to run server"), err)
+	}
+	return 0, nil
+}
+
+// A dedicated server started in the background for a game that requires it.
+type RunningServer struct {
+	name    string
+	process *exec.Cmd
+	console io.WriteCloser
+	done    chan error
+}
+
+// Loads the server instance a game requires, it has to be a different instance that runs a server.
+func loadRequiredServer(base string, instance *Instance) (*Instance, error) {
+	if instance.Requires == instance.Name {
+		return nil, errors.New("instance " + instance.Name + " can not require itself")
+	}
+	server, err := loadInstance(base, instance.Requires)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to load the server "+instance.Name+" requires"), err)
+	}
+	if !server.Server {
+		return nil, errors.New("instance " + instance.Requires + " that " + instance.Name + " requires is not a server")
+	}
+	return server, nil
+}
+
+// Makes sure the server instance a game requires is running, starting it if nothing listens on its port yet. Returns
+// nil when the server was already running, it is none of our business then.
+func startRequiredServer(base string, server *Instance, policy string) (*RunningServer, error) {
+	address := serverAddress(base, server)
+	if isServerRunning(address) {
+		fmt.Printf("Server %s is already running on %s\n", server.Name, address)
+		return nil, nil
+	}
+
+	java, arguments, err := prepareServer(base, server, &LaunchOptions{})
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to prepare server "+server.Name), err)
+	}
+	gameDir := server.gameDir(base)
+	err = createParents(gameDir)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to create game directory of "+server.Name), err)
+	}
+	err = checkEula(gameDir)
+	if err != nil {
+		return nil, err
+	}
+	err = checkServerPorts(gameDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The server writes its own logs, its console output is not needed
+	running := &RunningServer{
+		name:    server.Name,
+		process: executeWrapped(server, java, arguments...),
+		done:    make(chan error, 1),
+	}
+	running.process.Dir = gameDir
+	if policy != SERVER_SHUTDOWN_KEEP {
+		// A kept server outlives the launcher, it can not be tied to a pipe of it
+		running.console, err = running.process.StdinPipe()
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to start server "+server.Name), err)
+		}
+	}
+	err = running.process.Start()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to start server "+server.Name), err)
+	}
+	go func() {
+		running.done <- running.process.Wait()
+	}()
+
+	fmt.Printf("Starting server %s on %s\n", server.Name, address)
+	deadline := time.After(SERVER_START_TIMEOUT)
+	for !isServerRunning(address) {
+		select {
+		case err := <-running.done:
+			{
+				return nil, errors.Join(errors.New("server "+server.Name+" exited while starting, see its logs"), err)
+			}
+		case <-deadline:
+			{
+				running.stop()
+				return nil, errors.New(fmt.Sprintf("server %s did not start within %s", server.Name, SERVER_START_TIMEOUT))
+			}
+		case <-launcherContext.Done():
+			{
+				running.stop()
+				return nil, errInterrupted
+			}
+		case <-time.After(time.Second):
+		}
+	}
+	return running, nil
+}
+
+// Asks the server to save and shut down through its console, killing it when it takes too long or has no console.
+func (this *RunningServer) stop() {
+	fmt.Printf("Stopping server %s\n", this.name)
+	var err error
+	if this.console != nil {
+		_, err = io.WriteString(this.console, "stop\n")
+	}
+	if this.console != nil && err == nil {
+		select {
+		case <-this.done:
+			{
+				return
+			}
+		case <-time.After(SERVER_STOP_TIMEOUT):
+		}
+	}
+
+	fmt.Printf("Server %s did not stop, killing it\n", this.name)
+	_ = this.process.Process.Kill()
+	<-this.done
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// Every launch of a locked instance starts from a fresh copy of the template that is deleted when the game exits,
+	// the default.
+	SESSION_DISCARD string = "discard"
+	// Every user of a locked instance gets a copy of the template that is kept between launches.
+	SESSION_PERSIST string = "persist"
+)
+
+// Returns the directory the sessions of a locked instance are kept in.
+func sessionsDir(base string, instance *Instance) string {
+	return instanceDir(base, instance.Name) + "/sessions"
+}
+
+// Returns a name for the session of the current user that is safe to use as a directory name.
+func sessionName(policy string) string {
+	name := "user"
+	current, err := user.Current()
+	if err == nil && current.Username != "" {
+		name = sanitizeInstanceName(current.Username)
+	}
+	if policy != SESSION_PERSIST {
+		name += "-" + strconv.Itoa(os.Getpid())
+	}
+	return name
+}
+
+// Creates the game directory a locked instance is run in, a copy of the game directory of the instance that is used as
+// a template and never touched by the game. Returns the directory and a function that cleans up after the game exited.
+func prepareSession(base string, instance *Instance) (string, func(), error) {
+	template := instance.gameDir(base)
+	dir := sessionsDir(base, instance) + "/" + sessionName(instance.SessionPolicy)
+
+	if !fileExists(dir) {
+		err := copyTree(dir+".part", template)
+		if err == nil {
+			err = renameFile(dir+".part", dir)
+		}
+		if err != nil {
+			_ = removeAll(dir + ".part") // Don't care
+			return "", nil, errors.Join(errors.New("failed to create session of "+instance.Name), err)
+		}
+	}
+
+	cleanup := func() {}
+	if instance.SessionPolicy != SESSION_PERSIST {
+		cleanup = func() {
+			err := removeAll(dir)
+			if err != nil {
+				fmt.Printf("Failed to delete session %s: %s\n", dir, err)
+			}
+		}
+	}
+	fmt.Printf("Running locked instance %s in %s\n", instance.Name, dir)
+	return dir, cleanup, nil
+}
+
+// Creates the game directory an instance that shares the mods and config of another one is run in. It is a session like
+// the ones of locked instances with the game directory of the other instance as the template, but only the shared
+// directories are copied from it. Everything else is linked to the game directory of the instance so its worlds and
+// settings stay its own, files the game creates next to them are moved there when it exits.
+func prepareSharedSession(base string, instance *Instance) (string, func(), error) {
+	shared, err := loadInstance(base, instance.SharesWith)
+	if err != nil {
+		return "", nil, errors.Join(errors.New("failed to load "+instance.SharesWith+", the instance "+instance.Name+" shares the mods of"), err)
+	}
+	own, err := filepath.Abs(instance.gameDir(base))
+	if err != nil {
+		return "", nil, err
+	}
+	dir := sessionsDir(base, instance) + "/" + sessionName(SESSION_DISCARD)
+
+	err = createParents(dir)
+	for i := range sharedGameDirs {
+		template := shared.gameDir(base) + "/" + sharedGameDirs[i]
+		if err == nil && fileExists(template) {
+			err = copyTree(dir+"/"+sharedGameDirs[i], template)
+		}
+	}
+	var entries []os.DirEntry
+	if err == nil {
+		entries, err = os.ReadDir(own)
+	}
+	for i := range entries {
+		if err == nil && !slices.Contains(sharedGameDirs, entries[i].Name()) {
+			err = createLink(dir+"/"+entries[i].Name(), filepath.ToSlash(own+"/"+entries[i].Name()))
+		}
+	}
+	if err != nil {
+		_ = removeAll(dir) // Don't care
+		return "", nil, errors.Join(errors.New("failed to create session of "+instance.Name), err)
+	}
+
+	cleanup := func() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Printf("Failed to list session %s: %s\n", dir, err)
+			return
+		}
+		for i := range entries {
+			name := entries[i].Name()
+			if slices.Contains(sharedGameDirs, name) || entries[i].Type()&fs.ModeSymlink != 0 {
+				continue
+			}
+			if fileExists(own + "/" + name) {
+				fmt.Printf("Not moving %s of the session of %s, %s exists already\n", name, instance.Name, own+"/"+name)
+				continue
+			}
+			err = renameFile(dir+"/"+name, own+"/"+name)
+			if err != nil {
+				fmt.Printf("Failed to move %s of the session of %s: %s\n", name, instance.Name, err)
+			}
+		}
+		err = removeAll(dir)
+		if err != nil {
+			fmt.Printf("Failed to delete session %s: %s\n", dir, err)
+		}
+	}
+	fmt.Printf("Running %s with the mods and config of %s in %s\n", instance.Name, shared.Name, dir)
+	return dir, cleanup, nil
+}
+
+// Fails for locked instances, nothing but the edit command may change their template. Also fails for instances that
+// share the mods and config of another one, they have to be changed there.
+func checkUnlocked(instance *Instance) error {
+	if instance.Locked {
+		return errors.New("instance " + instance.Name + " is locked, unlock it with \"instance edit " + instance.Name + " --locked=false\" first")
+	}
+	if instance.SharesWith != "" {
+		return errors.New("instance " + instance.Name + " shares the mods and config of " + instance.SharesWith + ", change them there")
+	}
+	return nil
+}
+
+// Copies a directory and everything inside of it, symbolic links are copied as links.
+func copyTree(destination string, source string) error {
+	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relative)
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			{
+				link, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				return createLink(target, link)
+			}
+		case entry.IsDir():
+			{
+				return createParents(target)
+			}
+		default:
+			{
+				return copyFile(target, path)
+			}
+		}
+	})
+}
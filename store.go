@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The directories of the shared store, relative to the base directory. They are shared by every instance and only
+// cleaned up by "store gc" once no instance references a file anymore.
+var storeDirs = []string{
+	"library",
+	"assets/indexes",
+	"assets/objects",
+	"client",
+	"versions",
+}
+
+// Directories inside the store that are managed by something else and never collected.
+var storeExcludes = []string{
+	"library/net/java/jdk",
+}
+
+// Returns the directory libraries are stored in, the one of the official launcher in compatibility mode.
+func libraryDir(base string) string {
+	if config.VanillaDirectory != "" {
+		return config.VanillaDirectory + "/libraries"
+	}
+	return base + "/library"
+}
+
+// Returns the directory assets are stored in, the one of the official launcher in compatibility mode.
+func assetsDir(base string) string {
+	if config.VanillaDirectory != "" {
+		return config.VanillaDirectory + "/assets"
+	}
+	return base + "/assets"
+}
+
+// Returns the path of the JSON of a version, the one of the official launcher in compatibility mode.
+func versionJsonPath(base string, version string) string {
+	if config.VanillaDirectory != "" {
+		return config.VanillaDirectory + "/versions/" + version + "/" + version + ".json"
+	}
+	return base + "/versions/" + version + ".json"
+}
+
+// Returns the path of the client jar of a version, the one of the official launcher in compatibility mode.
+func clientJarPath(base string, version string) string {
+	if config.VanillaDirectory != "" {
+		return config.VanillaDirectory + "/versions/" + version + "/" + version + ".jar"
+	}
+	return base + "/client/" + version + ".jar"
+}
+
+// The files of the shared store used by an instance, relative to the base directory.
+type StoreReferences struct {
+	Files []string `json:"files"`
+}
+
+// Records the store files an instance used during its last launch. Files outside of the base directory, like
+// overrides, are not part of the store and are ignored.
+func saveReferences(base string, instance *Instance, paths []string) error {
+	var references StoreReferences
+	for i := range paths {
+		relative, ok := strings.CutPrefix(paths[i], base+"/")
+		if ok {
+			references.Files = append(references.Files, relative)
+		}
+	}
+	sort.Strings(references.Files)
+
+	err := writeJson(instanceDir(base, instance.Name)+"/references.json", &references)
+	if err != nil {
+		return errors.Join(errors.New("failed to save store references of "+instance.Name), err)
+	}
+	return nil
+}
+
+// Counts how many instances reference every file of the store, artifacts installed by hand count as one.
+func countReferences(base string) (map[string]int, error) {
+	counts := map[string]int{}
+	err := countInstalledLibraries(base, counts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(base + "/instances")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return counts, nil
+		}
+		return nil, errors.Join(errors.New("failed to list instances"), err)
+	}
+
+	for i := range entries {
+		entry := entries[i]
+		if !entry.IsDir() {
+			continue
+		}
+
+		path := instanceDir(base, entry.Name()) + "/references.json"
+		if !fileExists(path) {
+			continue
+		}
+
+		var references StoreReferences
+		err = readJson(path, &references)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to read store references of "+entry.Name()), err)
+		}
+		for o := range references.Files {
+			counts[references.Files[o]]++
+		}
+	}
+
+	return counts, nil
+}
+
+// Where the files of the shared store are kept. Paths are relative to the base directory and use slashes, so the
+// references of instances can be compared to them.
+type StoreBackend interface {
+	// Calls visit with the path and size of every file below a directory of the store. A missing directory has no
+	// files.
+	walk(dir string, visit func(path string, size int64) error) error
+	// Returns the size and modification time of a file, an error wrapping fs.ErrNotExist when it is missing.
+	stat(path string) (StoreFile, error)
+	open(path string) (io.ReadCloser, error)
+	// Downloads a file into the store unless it is there with the right hash, like downloadFileRaw.
+	download(path string, url string, hash *string, size uint64, progress *Progress) error
+	remove(path string) error
+	// Returns the path the game is given for a file of the store.
+	local(path string) string
+}
+
+// The store of this run, set up once the config is loaded.
+var storeBackend StoreBackend
+
+// The store in the base directory of the launcher, or in the .minecraft directory of the official launcher in
+// compatibility mode. Collecting it is only supported in the base directory.
+type FileStoreBackend struct {
+	base string
+}
+
+func newFileStoreBackend(base string) *FileStoreBackend {
+	return &FileStoreBackend{
+		base: base,
+	}
+}
+
+func (this *FileStoreBackend) walk(dir string, visit func(path string, size int64) error) error {
+	root := this.base + "/" + dir
+	if !fileExists(root) {
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relative, err := filepath.Rel(this.base, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return visit(filepath.ToSlash(relative), info.Size())
+	})
+}
+
+func (this *FileStoreBackend) stat(path string) (StoreFile, error) {
+	info, err := os.Stat(this.local(path))
+	if err != nil {
+		return StoreFile{}, err
+	}
+	return StoreFile{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (this *FileStoreBackend) open(path string) (io.ReadCloser, error) {
+	return openFile(this.local(path))
+}
+
+func (this *FileStoreBackend) download(path string, url string, hash *string, size uint64, progress *Progress) error {
+	return downloadFileRaw(this.local(path), url, hash, size, progress)
+}
+
+func (this *FileStoreBackend) remove(path string) error {
+	return os.Remove(this.local(path))
+}
+
+func (this *FileStoreBackend) local(path string) string {
+	if config.VanillaDirectory != "" {
+		dir, name, _ := strings.Cut(path, "/")
+		switch dir {
+		case "library":
+			{
+				return libraryDir(this.base) + "/" + name
+			}
+		case "assets":
+			{
+				return assetsDir(this.base) + "/" + name
+			}
+		case "client":
+			{
+				return clientJarPath(this.base, strings.TrimSuffix(name, ".jar"))
+			}
+		case "versions":
+			{
+				return versionJsonPath(this.base, strings.TrimSuffix(name, ".json"))
+			}
+		}
+	}
+	return this.base + "/" + path
+}
+
+// A store that only lives in memory, for tests of the code that manages the store. It has no files on disk, so the
+// game can not be launched from it.
+type MemoryStoreBackend struct {
+	lock  sync.Mutex
+	files map[string]*MemoryStoreFile
+}
+
+type MemoryStoreFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newMemoryStoreBackend() *MemoryStoreBackend {
+	return &MemoryStoreBackend{
+		files: map[string]*MemoryStoreFile{},
+	}
+}
+
+// Adds a file to the store as if it was downloaded.
+func (this *MemoryStoreBackend) put(path string, data []byte) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.files[path] = &MemoryStoreFile{
+		data:    data,
+		modTime: time.Now(),
+	}
+}
+
+func (this *MemoryStoreBackend) walk(dir string, visit func(path string, size int64) error) error {
+	this.lock.Lock()
+	var files []StoreFile
+	for path := range this.files {
+		if strings.HasPrefix(path, dir+"/") {
+			files = append(files, StoreFile{
+				Path: path,
+				Size: int64(len(this.files[path].data)),
+			})
+		}
+	}
+	this.lock.Unlock()
+
+	// The order of a walk of the file system
+	sort.Slice(files, func(a int, b int) bool {
+		return files[a].Path < files[b].Path
+	})
+	for i := range files {
+		err := visit(files[i].Path, files[i].Size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *MemoryStoreBackend) stat(path string) (StoreFile, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	file, ok := this.files[path]
+	if !ok {
+		return StoreFile{}, errors.Join(errors.New(path+" is not in the store"), fs.ErrNotExist)
+	}
+	return StoreFile{
+		Path:    path,
+		Size:    int64(len(file.data)),
+		ModTime: file.modTime,
+	}, nil
+}
+
+func (this *MemoryStoreBackend) open(path string) (io.ReadCloser, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	file, ok := this.files[path]
+	if !ok {
+		return nil, errors.Join(errors.New(path+" is not in the store"), fs.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(file.data)), nil
+}
+
+func (this *MemoryStoreBackend) download(path string, url string, hash *string, size uint64, progress *Progress) error {
+	if hash != nil {
+		reader, err := this.open(path)
+		if err == nil {
+			valid, err := hashReader(reader, *hash)
+			if err == nil && valid {
+				return nil
+			}
+		}
+	}
+
+	response, err := httpGet(url)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return errors.Join(errors.New("failed to download "+url), err)
+	}
+	if size != 0 && uint64(len(data)) != size {
+		return errors.New(fmt.Sprintf("%s has %d bytes instead of %d", url, len(data), size))
+	}
+	if hash != nil {
+		valid, err := hashReader(bytes.NewReader(data), *hash)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return errors.New("failed to verify hash of " + url)
+		}
+	}
+	this.put(path, data)
+	return nil
+}
+
+func (this *MemoryStoreBackend) remove(path string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, ok := this.files[path]; !ok {
+		return errors.Join(errors.New(path+" is not in the store"), fs.ErrNotExist)
+	}
+	delete(this.files, path)
+	return nil
+}
+
+func (this *MemoryStoreBackend) local(path string) string {
+	return path
+}
+
+// A file of the store, relative to the base directory.
+type StoreFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Reads a file of the store into memory.
+func readStoreFile(path string) ([]byte, error) {
+	reader, err := storeBackend.open(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to open "+path), err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	return io.ReadAll(reader)
+}
+
+// Finds every file in the store that is referenced by nothing, see countReferences for the counts.
+func findUnreferenced(store StoreBackend, counts map[string]int) ([]StoreFile, error) {
+	var unreferenced []StoreFile
+	for i := range storeDirs {
+		err := store.walk(storeDirs[i], func(path string, size int64) error {
+			for o := range storeExcludes {
+				if strings.HasPrefix(path, storeExcludes[o]+"/") {
+					return nil
+				}
+			}
+			if counts[path] == 0 {
+				unreferenced = append(unreferenced, StoreFile{
+					Path: path,
+					Size: size,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to walk "+storeDirs[i]), err)
+		}
+	}
+
+	return unreferenced, nil
+}
+
+var storeCommands = []Command{
+	{
+		Name:        "gc",
+		Usage:       "[--dry-run]",
+		Description: "Deletes every file of the shared library and asset store that no instance uses",
+		Run:         storeGcCommand,
+	},
+	{
+		Name:        "check-index",
+		Usage:       "[--sample <n>]",
+		Description: "Checks the hash cache against the files it describes and drops entries that are out of date",
+		Run:         storeCheckIndexCommand,
+	},
+	{
+		Name:        "info",
+		Usage:       "<path|sha1>",
+		Description: "Shows where a downloaded file came from: its URL, the mirror that delivered it, when and for which pack",
+		Run:         storeInfoCommand,
+	},
+}
+
+func storeCommand(base string, args []string) error {
+	return runCommand(storeCommands, base, args)
+}
+
+func storeGcCommand(base string, args []string) error {
+	set := flag.NewFlagSet("store gc", flag.ContinueOnError)
+	dryRun := set.Bool("dry-run", false, "only list the files that would be deleted")
+	_, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if config.VanillaDirectory != "" {
+		return errors.New("the store is shared with the official launcher, it can not be collected")
+	}
+
+	counts, err := countReferences(base)
+	if err != nil {
+		return err
+	}
+	unreferenced, err := findUnreferenced(storeBackend, counts)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for i := range unreferenced {
+		size += unreferenced[i].Size
+		if *dryRun {
+			fmt.Println(unreferenced[i].Path)
+			continue
+		}
+
+		err = storeBackend.remove(unreferenced[i].Path)
+		if err != nil {
+			return errors.Join(errors.New("failed to delete "+unreferenced[i].Path), err)
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("Would delete %d files (%d bytes)\n", len(unreferenced), size)
+	} else {
+		fmt.Printf("Deleted %d files (%d bytes)\n", len(unreferenced), size)
+	}
+	return nil
+}
+
+func storeCheckIndexCommand(base string, args []string) error {
+	set := flag.NewFlagSet("store check-index", flag.ContinueOnError)
+	sample := set.Int("sample", 100, "how many of the entries to hash again, chosen at random")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errors.New("expected no arguments")
+	}
+	if *sample < 0 {
+		return errors.New("--sample must not be negative")
+	}
+
+	if hashCache.corruption != nil {
+		fmt.Printf("The hash cache was corrupt and was started over: %s\n", hashCache.corruption)
+	}
+
+	report, err := hashCache.check(storeBackend, *sample)
+	if err != nil {
+		return err
+	}
+	err = hashCache.save()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Checked %d entries, hashed %d again\n", report.Checked, min(*sample, report.Checked-report.Missing-report.Changed))
+	fmt.Printf("Dropped %d of missing files, %d of changed files and %d with the wrong hash\n", report.Missing, report.Changed, report.Mismatched)
+	if report.Mismatched > 0 {
+		fmt.Println("Entries with the wrong hash mean the cache can not be trusted, launch with --full-verify to hash every file")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"slices"
+	"testing"
+)
+
+// Sets up a memory store for a test and puts the file store of the run back afterwards.
+func useMemoryStore(t *testing.T) *MemoryStoreBackend {
+	previous := storeBackend
+	store := newMemoryStoreBackend()
+	storeBackend = store
+	t.Cleanup(func() {
+		storeBackend = previous
+	})
+	return store
+}
+
+func TestStoreGc(t *testing.T) {
+	base := t.TempDir()
+	store := useMemoryStore(t)
+	store.put("library/org/example/used/1.0/used-1.0.jar", []byte("used"))
+	store.put("library/org/example/unused/1.0/unused-1.0.jar", []byte("unused"))
+	store.put("library/net/java/jdk/17/java", []byte("jdk"))
+	store.put("assets/objects/ab/abcdef", []byte("sound"))
+	store.put("client/1.20.4.jar", []byte("client"))
+	store.put("instances/a/instance.json", []byte("{}"))
+
+	instance := &Instance{
+		Name: "a",
+	}
+	err := os.MkdirAll(instanceDir(base, instance.Name), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = saveReferences(base, instance, []string{
+		base + "/library/org/example/used/1.0/used-1.0.jar",
+		base + "/client/1.20.4.jar",
+		"/somewhere/else/override.jar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := countReferences(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreferenced, err := findUnreferenced(store, counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for i := range unreferenced {
+		paths = append(paths, unreferenced[i].Path)
+	}
+	expected := []string{
+		"library/org/example/unused/1.0/unused-1.0.jar",
+		"assets/objects/ab/abcdef",
+	}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected %v to be unreferenced, got %v", expected, paths)
+	}
+
+	err = storeGcCommand(base, []string{"--dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.files) != 6 {
+		t.Fatalf("expected a dry run to keep every file, %d are left", len(store.files))
+	}
+	err = storeGcCommand(base, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range expected {
+		if _, ok := store.files[expected[i]]; ok {
+			t.Errorf("expected %s to be deleted", expected[i])
+		}
+	}
+	if len(store.files) != 4 {
+		t.Fatalf("expected 4 files to be left, %d are", len(store.files))
+	}
+}
+
+// The entries of the hash cache for files of the store are checked against the store, not the disk.
+func TestHashCacheCheckUsesStore(t *testing.T) {
+	base := t.TempDir()
+	store := useMemoryStore(t)
+	data := []byte("library")
+	store.put("library/a.jar", data)
+	store.put("library/b.jar", []byte("changed"))
+	digest := sha1.Sum(data)
+	hash := hex.EncodeToString(digest[:])
+
+	cache := &HashCache{
+		base:    base,
+		entries: map[string]HashCacheEntry{},
+	}
+	file, err := store.stat("library/a.jar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.entries[base+"/library/a.jar"] = HashCacheEntry{
+		Hash:    hash,
+		Size:    file.Size,
+		ModTime: file.ModTime.UnixNano(),
+	}
+	file, err = store.stat("library/b.jar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.entries[base+"/library/b.jar"] = HashCacheEntry{
+		Hash:    hash,
+		Size:    file.Size,
+		ModTime: file.ModTime.UnixNano(),
+	}
+	cache.entries[base+"/library/missing.jar"] = HashCacheEntry{
+		Hash: hash,
+	}
+
+	report, err := cache.check(store, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 3 || report.Missing != 1 || report.Mismatched != 1 {
+		t.Fatalf("expected 3 checked, 1 missing and 1 mismatched entry, got %+v", report)
+	}
+	if _, ok := cache.entries[base+"/library/a.jar"]; !ok {
+		t.Fatal("expected the intact entry to be kept")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// What happened to the downloads of one category, like libraries or assets.
+type SummaryCategory struct {
+	Name       string
+	Checked    int64
+	Downloaded int64
+	Bytes      uint64
+	Elapsed    time.Duration
+}
+
+// Collects what every batch did since the summary was last printed.
+type DownloadSummary struct {
+	lock       sync.Mutex
+	started    time.Time
+	categories []SummaryCategory
+}
+
+var downloadSummary = &DownloadSummary{
+	started: time.Now(),
+}
+
+// Adds the result of a batch, batches with the same name are merged.
+func (this *DownloadSummary) record(category SummaryCategory) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for i := range this.categories {
+		existing := &this.categories[i]
+		if existing.Name == category.Name {
+			existing.Checked += category.Checked
+			existing.Downloaded += category.Downloaded
+			existing.Bytes += category.Bytes
+			existing.Elapsed += category.Elapsed
+			return
+		}
+	}
+	this.categories = append(this.categories, category)
+}
+
+// Prints the totals and every category, then starts over so the next launch gets a summary of its own.
+func (this *DownloadSummary) print() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	var total SummaryCategory
+	for i := range this.categories {
+		category := this.categories[i]
+		total.Checked += category.Checked
+		total.Downloaded += category.Downloaded
+		total.Bytes += category.Bytes
+	}
+
+	fmt.Printf(
+		"Prepared in %s: %d files checked, %d downloaded, %d up to date, %s transferred\n",
+		time.Since(this.started).Round(time.Millisecond),
+		total.Checked,
+		total.Downloaded,
+		total.Checked-total.Downloaded,
+		formatBytes(float64(total.Bytes)),
+	)
+	for i := range this.categories {
+		category := this.categories[i]
+		fmt.Printf(
+			"  %-10s %6d checked %6d downloaded %10s in %s\n",
+			category.Name,
+			category.Checked,
+			category.Downloaded,
+			formatBytes(float64(category.Bytes)),
+			category.Elapsed.Round(time.Millisecond),
+		)
+	}
+
+	this.categories = nil
+	this.started = time.Now()
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// What happened the last time an instance was launched, kept for bug reports.
+type LaunchRecord struct {
+	Time      time.Time `json:"time"`
+	Version   string    `json:"version"`
+	Java      string    `json:"java"`
+	Arguments []string  `json:"arguments"`
+	ExitCode  int       `json:"exitCode"`
+	// How the game exited, one of the GAME_EXIT_ kinds.
+	Exit     string   `json:"exit"`
+	Duration Duration `json:"duration"`
+}
+
+func launchRecordPath(base string, instance *Instance) string {
+	return instanceDir(base, instance.Name) + "/last-launch.json"
+}
+
+// Saves the record of a launch, failing to do so is not worth failing the launch for.
+func saveLaunchRecord(base string, instance *Instance, record *LaunchRecord) {
+	err := writeJson(launchRecordPath(base, instance), record)
+	if err != nil {
+		fmt.Printf("Failed to save the launch record of %s: %s\n", instance.Name, err)
+	}
+}
+
+// Patterns of secrets that may show up in configs, command lines and logs.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(--accessToken["\s,]+)[^"\s,]+`),
+	regexp.MustCompile(`(?i)((?:token|password|secret|api[-_]?key|session)["']?\s*[:=]\s*["']?)[^"'\s,]+`),
+	regexp.MustCompile(`(://)[^/@\s]+(@)`),
+}
+
+// Removes secrets and the home directory of the user from text that is about to be shared.
+func redact(text string) string {
+	for i := range secretPatterns {
+		text = secretPatterns[i].ReplaceAllString(text, "${1}<redacted>${2}")
+	}
+	home, err := os.UserHomeDir()
+	if err == nil && len(home) > 1 {
+		text = strings.ReplaceAll(text, home, "~")
+	}
+	return text
+}
+
+// Returns the config as JSON with every header value removed, headers usually carry API keys.
+func redactedConfig() ([]byte, error) {
+	copied := config
+	copied.Network.Headers = map[string]map[string]string{}
+	for host := range config.Network.Headers {
+		copied.Network.Headers[host] = map[string]string{}
+		for name := range config.Network.Headers[host] {
+			copied.Network.Headers[host][name] = "<redacted>"
+		}
+	}
+	return json.MarshalIndent(&copied, "", "  ")
+}
+
+// Returns the newest files of a directory that match a filter, newest first.
+func newestFiles(dir string, count int, filter func(name string) bool) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []os.FileInfo
+	for i := range entries {
+		if entries[i].IsDir() || !filter(entries[i].Name()) {
+			continue
+		}
+		info, err := entries[i].Info()
+		if err == nil {
+			files = append(files, info)
+		}
+	}
+	sort.Slice(files, func(a int, b int) bool {
+		return files[a].ModTime().After(files[b].ModTime())
+	})
+
+	var paths []string
+	for i := 0; i < len(files) && i < count; i++ {
+		paths = append(paths, dir+"/"+files[i].Name())
+	}
+	return paths
+}
+
+// Adds a file to a zip with its secrets redacted.
+func addBundleFile(writer *zip.Writer, name string, contents []byte) error {
+	out, err := writer.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write([]byte(redact(string(contents))))
+	return err
+}
+
+var supportCommands = []Command{
+	{
+		Name:        "bundle",
+		Usage:       "<instance> [--yes] [--output <file>]",
+		Description: "Collects everything needed to debug a failed launch into a zip, with secrets removed",
+		Run:         supportBundleCommand,
+	},
+}
+
+func supportCommand(base string, args []string) error {
+	return runCommand(supportCommands, base, args)
+}
+
+func supportBundleCommand(base string, args []string) error {
+	set := flag.NewFlagSet("support bundle", flag.ContinueOnError)
+	yes := set.Bool("yes", false, "don't ask before collecting")
+	output := set.String("output", "", "where to write the bundle, defaults to support-<instance>-<time>.zip")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one instance name")
+	}
+
+	instance, err := loadInstance(base, positional[0])
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = base + "/support-" + instance.Name + "-" + time.Now().Format("20060102-150405") + ".zip"
+	}
+
+	fmt.Println("The bundle contains the launcher config, the instance settings, the last launch, recent logs and crash")
+	fmt.Println("reports and a system check. Tokens, passwords, API keys and your home directory are removed, but logs can")
+	fmt.Println("still contain things like your player name and server addresses. Look through it before sharing it.")
+	if !*yes {
+		agreed, err := askYesNo(bufio.NewReader(os.Stdin), "Create the bundle?")
+		if err != nil {
+			return err
+		}
+		if !agreed {
+			return nil
+		}
+	}
+
+	file, err := createFile(*output)
+	if err != nil {
+		return errors.Join(errors.New("failed to create "+*output), err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	writer := zip.NewWriter(file)
+
+	contents, err := redactedConfig()
+	if err != nil {
+		return errors.Join(errors.New("failed to serialize config"), err)
+	}
+	err = addBundleFile(writer, "config.json", contents)
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+*output), err)
+	}
+
+	contents, err = json.MarshalIndent(instance, "", "  ")
+	if err != nil {
+		return errors.Join(errors.New("failed to serialize instance"), err)
+	}
+	err = addBundleFile(writer, "instance.json", contents)
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+*output), err)
+	}
+
+	err = addBundleFile(writer, "doctor.txt", []byte(strings.Join(runDoctor(base), "\n")+"\n"))
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+*output), err)
+	}
+
+	gameDir := instance.gameDir(base)
+	files := map[string]string{
+		"last-launch.json": launchRecordPath(base, instance),
+		"audit.json":       base + "/audit.json",
+	}
+	logs := newestFiles(logsDir(gameDir), 5, func(name string) bool {
+		return strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".log.gz")
+	})
+	for i := range logs {
+		files["logs/"+logs[i][strings.LastIndex(logs[i], "/")+1:]] = logs[i]
+	}
+	reports := newestFiles(gameDir+"/crash-reports", 3, func(name string) bool {
+		return strings.HasSuffix(name, ".txt")
+	})
+	for i := range reports {
+		files["crash-reports/"+reports[i][strings.LastIndex(reports[i], "/")+1:]] = reports[i]
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i := range names {
+		path := files[names[i]]
+		if !fileExists(path) {
+			continue
+		}
+		contents, err = readSupportFile(path)
+		if err != nil {
+			return err
+		}
+
+		// Compressed logs hold the same secrets as the others, they are added uncompressed so they can be redacted
+		err = addBundleFile(writer, strings.TrimSuffix(names[i], ".gz"), contents)
+		if err != nil {
+			return errors.Join(errors.New("failed to write "+*output), err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return errors.Join(errors.New("failed to write "+*output), err)
+	}
+	fmt.Printf("Wrote %s\n", *output)
+	return nil
+}
+
+// Reads a file for the support bundle, decompressing it when it is compressed with gzip.
+func readSupportFile(path string) ([]byte, error) {
+	in, err := openFile(path)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to open "+path), err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	var reader io.Reader = in
+	if strings.HasSuffix(path, ".gz") {
+		stream, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to decompress "+path), err)
+		}
+		reader = stream
+	}
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read "+path), err)
+	}
+	return contents, nil
+}
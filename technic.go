@@ -0,0 +1,265 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	TECHNIC_API string = "https://api.technicpack.net"
+	// The platform API only answers launchers that say which build they are, any recent one works.
+	TECHNIC_LAUNCHER_BUILD string = "999"
+)
+
+// The id the site appends to the slug in the links to packs, like tekkit-legends.736482.
+var technicLinkId = regexp.MustCompile(`\.\d+$`)
+
+// A pack on the Technic platform. Packs with a Solder server list their files there, the others are a single zip.
+type TechnicPack struct {
+	Name        string  `json:"name"`
+	DisplayName string  `json:"displayName"`
+	Url         *string `json:"url"`
+	Solder      *string `json:"solder"`
+	Minecraft   string  `json:"minecraft"`
+	Version     string  `json:"version"`
+	Error       string  `json:"error"`
+}
+
+// A pack on a Solder server.
+type SolderPack struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Recommended string   `json:"recommended"`
+	Latest      string   `json:"latest"`
+	Builds      []string `json:"builds"`
+	Error       string   `json:"error"`
+}
+
+// A build of a pack on a Solder server, every mod is a zip that is extracted into the game directory.
+type SolderBuild struct {
+	Minecraft string      `json:"minecraft"`
+	Forge     *string     `json:"forge"`
+	Mods      []SolderMod `json:"mods"`
+	Error     string      `json:"error"`
+}
+
+type SolderMod struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Md5      string `json:"md5"`
+	Url      string `json:"url"`
+	Filesize uint64 `json:"filesize"`
+}
+
+func (this *SolderMod) url() string {
+	return this.Url
+}
+
+func (this *SolderMod) hash() *string {
+	if this.Md5 == "" {
+		return nil
+	}
+	return md5Hash(this.Md5)
+}
+
+func (this *SolderMod) size() uint64 {
+	return this.Filesize
+}
+
+// Where the zips of Technic packs are kept, so updating a pack only downloads what changed.
+func technicDir(base string) string {
+	return base + "/packs/technic"
+}
+
+// Returns the slug of a pack from either the slug itself or a link to the pack on the Technic site.
+func technicSlug(pack string) string {
+	parsed, err := url.Parse(pack)
+	if err == nil && parsed.Host != "" {
+		pack = path.Base(strings.TrimSuffix(parsed.Path, "/"))
+	}
+	return technicLinkId.ReplaceAllString(pack, "")
+}
+
+// Creates an instance from a pack of the Technic platform, from its Solder server or the zip the platform links.
+func installTechnicPack(base string, slug string, build string, name string) error {
+	var pack TechnicPack
+	err := downloadJsonRaw(TECHNIC_API+"/modpack/"+url.PathEscape(slug)+"?build="+TECHNIC_LAUNCHER_BUILD, nil, &pack)
+	if err != nil {
+		return errors.Join(errors.New("failed to look up Technic pack "+slug), err)
+	}
+	if pack.Error != "" {
+		return errors.New("failed to look up Technic pack " + slug + ": " + pack.Error)
+	}
+
+	if pack.DisplayName == "" {
+		pack.DisplayName = slug
+	}
+	if name == "" {
+		name = sanitizeInstanceName(pack.DisplayName)
+	}
+	err = validateInstanceName(name)
+	if err != nil {
+		return err
+	}
+	if fileExists(instanceDir(base, name) + "/instance.json") {
+		return errors.New("instance " + name + " already exists")
+	}
+
+	instance := &Instance{
+		Name:       name,
+		Version:    pack.Minecraft,
+		PackSource: "https://www.technicpack.net/modpack/" + slug,
+	}
+	gameDir := instance.gameDir(base)
+	cache := technicDir(base) + "/" + slug
+
+	provenance.setPack(pack.DisplayName)
+	defer provenance.setPack("")
+	var archives []string
+	if pack.Solder != nil && *pack.Solder != "" {
+		build, archives, err = downloadSolderPack(strings.TrimSuffix(*pack.Solder, "/"), slug, build, cache, instance)
+		if err != nil {
+			return err
+		}
+	} else {
+		if pack.Url == nil || *pack.Url == "" {
+			return errors.New("Technic pack " + slug + " has neither a Solder server nor a zip")
+		}
+		if build != "" && build != pack.Version {
+			return errors.New("Technic pack " + slug + " is a single zip, only its version " + pack.Version + " can be installed")
+		}
+		build = pack.Version
+		archive := cache + "/" + slug + "-" + sanitizeInstanceName(build) + ".zip"
+		err = downloadFileRaw(archive, *pack.Url, nil, 0, nil)
+		if err != nil {
+			return errors.Join(errors.New("failed to download Technic pack "+slug), err)
+		}
+		archives = append(archives, archive)
+	}
+
+	for i := range archives {
+		err = extractTechnicArchive(archives[i], gameDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Newer packs ship the version JSON of their loader, it knows the loader better than the platform does
+	if fileExists(gameDir + "/bin/version.json") {
+		var manifest TechnicVersion
+		err = readJson(gameDir+"/bin/version.json", &manifest)
+		if err != nil {
+			return errors.Join(errors.New("failed to read the version.json of "+slug), err)
+		}
+		version, loader := technicVersion(&manifest)
+		if version != "" {
+			instance.Version = version
+		}
+		if loader != nil {
+			instance.Loader = loader
+		}
+	} else if instance.Loader == nil && fileExists(gameDir+"/bin/modpack.jar") {
+		fmt.Println("Warning: the pack ships its mod loader as bin/modpack.jar, which the launcher does not run, the game starts without mods")
+	}
+	if instance.Version == "" {
+		return errors.New("Technic pack " + slug + " does not say which version of the game it needs")
+	}
+
+	err = commitInstance(base, instance)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s %s as instance %s (%s)\n", pack.DisplayName, build, name, instance.Version)
+	warnLoaderNotInstalled(instance)
+	return nil
+}
+
+// Downloads the mods of a build of a pack on a Solder server, the recommended build when none is given. Sets the
+// version and loader of the instance from the build. Returns the build and the zips in the order they are extracted.
+func downloadSolderPack(solder string, slug string, build string, cache string, instance *Instance) (string, []string, error) {
+	var pack SolderPack
+	err := downloadJsonRaw(solder+"/modpack/"+url.PathEscape(slug), nil, &pack)
+	if err != nil {
+		return "", nil, errors.Join(errors.New("failed to look up "+slug+" on "+solder), err)
+	}
+	if pack.Error != "" {
+		return "", nil, errors.New("failed to look up " + slug + " on " + solder + ": " + pack.Error)
+	}
+	if build == "" {
+		build = pack.Recommended
+	} else if build == "latest" {
+		build = pack.Latest
+	}
+	if build == "" {
+		return "", nil, errors.New(slug + " has no recommended build, select one with --build")
+	}
+
+	var details SolderBuild
+	err = downloadJsonRaw(solder+"/modpack/"+url.PathEscape(slug)+"/"+url.PathEscape(build), nil, &details)
+	if err != nil {
+		return "", nil, errors.Join(errors.New("failed to look up build "+build+" of "+slug), err)
+	}
+	if details.Error != "" {
+		return "", nil, errors.New("failed to look up build " + build + " of " + slug + ": " + details.Error + ", the builds are " + strings.Join(pack.Builds, ", "))
+	}
+	if details.Minecraft != "" {
+		instance.Version = details.Minecraft
+	}
+	if details.Forge != nil && *details.Forge != "" {
+		instance.Loader = &InstanceLoader{
+			Name:    "forge",
+			Version: *details.Forge,
+		}
+	}
+
+	archives := make([]string, len(details.Mods))
+	batch := downloadPool.batch("Technic")
+	for i := range details.Mods {
+		mod := &details.Mods[i]
+		archives[i] = cache + "/" + sanitizeInstanceName(mod.Name) + "-" + sanitizeInstanceName(mod.Version) + ".zip"
+		target := archives[i]
+		batch.submit(func() error {
+			return downloadFile(target, mod, batch.progress)
+		})
+	}
+	err = batch.wait()
+	if err != nil {
+		return "", nil, errors.Join(errors.New("failed to download the mods of "+slug), err)
+	}
+	return build, archives, nil
+}
+
+// Extracts a zip of a Technic pack into the game directory, they contain the directories of the game like mods and
+// config.
+func extractTechnicArchive(file string, gameDir string) error {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return errors.Join(errors.New("failed to open "+filepath.Base(file)), err)
+	}
+	defer func() {
+		_ = archive.Close()
+	}()
+	return extractPackOverrides(&archive.Reader, "", gameDir)
+}
+
+func packTechnicCommand(base string, args []string) error {
+	set := flag.NewFlagSet("pack technic", flag.ContinueOnError)
+	name := set.String("name", "", "the name of the new instance, defaults to the name of the pack")
+	build := set.String("build", "", "the build of the pack, defaults to the recommended one, \"latest\" for the newest")
+	positional, err := parseFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one pack")
+	}
+	return installTechnicPack(base, technicSlug(positional[0]), *build, *name)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Replaces the ${name} placeholders of a template with their variables, like Mojang uses in the arguments of versions.
+// "$${" is an escaped "${" that is kept as "${" without being replaced. Values are inserted as they are, placeholders
+// in them are not replaced again. Placeholders without a variable and a "${" that is never closed are kept as they
+// are, the names of the unknown ones are returned sorted and without duplicates.
+func formatTemplate(template string, variables map[string]string) (string, []string) {
+	var builder strings.Builder
+	unknown := map[string]bool{}
+	rest := template
+	for {
+		start := strings.Index(rest, "${")
+		if start == -1 {
+			builder.WriteString(rest)
+			break
+		}
+		if start > 0 && rest[start-1] == '$' {
+			builder.WriteString(rest[:start-1])
+			builder.WriteString("${")
+			rest = rest[start+2:]
+			continue
+		}
+
+		builder.WriteString(rest[:start])
+		end := strings.IndexByte(rest[start+2:], '}')
+		if end == -1 {
+			builder.WriteString(rest[start:])
+			break
+		}
+		name := rest[start+2 : start+2+end]
+		value, ok := variables[name]
+		if ok {
+			builder.WriteString(value)
+		} else {
+			unknown[name] = true
+			builder.WriteString(rest[start : start+3+end])
+		}
+		rest = rest[start+3+end:]
+	}
+
+	var names []string
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return builder.String(), names
+}
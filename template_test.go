@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFormatTemplate(t *testing.T) {
+	variables := map[string]string{
+		"a":     "1",
+		"b":     "2",
+		"value": "${a}",
+	}
+	tests := []struct {
+		template string
+		expected string
+		unknown  []string
+	}{
+		{template: "${a}${b}", expected: "12"},
+		{template: "}${a}", expected: "}1"},
+		{template: "x}y${a}z}${b}", expected: "x}y1z}2"},
+		{template: "$${a}", expected: "${a}"},
+		{template: "$$${a}", expected: "$${a}"},
+		{template: "${value}", expected: "${a}"},
+		{template: "${a", expected: "${a"},
+		{template: "${c}${a}${c}${d}", expected: "${c}1${c}${d}", unknown: []string{"c", "d"}},
+		{template: "${}", expected: "${}", unknown: []string{""}},
+	}
+	for i := range tests {
+		test := tests[i]
+		formatted, unknown := formatTemplate(test.template, variables)
+		if formatted != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.template, test.expected, formatted)
+		}
+		if !slices.Equal(unknown, test.unknown) {
+			t.Errorf("%q: expected the unknown variables %v, got %v", test.template, test.unknown, unknown)
+		}
+	}
+}
+
+// Every placeholder the versions in testdata/manifests use has to be known to the launcher. The manifests only have the
+// arguments and logging of the real ones, the libraries and downloads are left out.
+func TestFormatTemplateManifests(t *testing.T) {
+	// The variables launch fills in
+	names := []string{
+		"natives_directory", "launcher_name", "launcher_version", "classpath", "library_directory",
+		"classpath_separator", "auth_player_name", "version_name", "game_directory", "assets_root",
+		"assets_index_name", "auth_uuid", "clientid", "auth_xuid", "auth_access_token", "user_type", "version_type",
+		"resolution_width", "resolution_height", "quickPlayPath", "quickPlaySingleplayer", "quickPlayMultiplayer",
+		"quickPlayRealms", "auth_session", "user_properties", "game_assets",
+	}
+	variables := map[string]string{}
+	for i := range names {
+		variables[names[i]] = "<" + names[i] + ">"
+	}
+
+	paths, err := filepath.Glob("testdata/manifests/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no manifests in testdata/manifests")
+	}
+	for i := range paths {
+		data, err := os.ReadFile(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest Manifest
+		err = json.Unmarshal(data, &manifest)
+		if err != nil {
+			t.Fatalf("%s: %s", paths[i], err)
+		}
+
+		arguments := append(manifest.jvmArguments(), manifest.gameArguments()...)
+		for o := range arguments {
+			for p := range arguments[o].Value {
+				formatted, unknown := formatTemplate(arguments[o].Value[p], variables)
+				if len(unknown) > 0 {
+					t.Errorf("%s: %q uses unknown variables %v", manifest.Id, arguments[o].Value[p], unknown)
+				}
+				if strings.Contains(formatted, "${") {
+					t.Errorf("%s: %q was formatted to %q", manifest.Id, arguments[o].Value[p], formatted)
+				}
+			}
+		}
+		if logging, ok := manifest.Logging["client"]; ok {
+			formatted, unknown := formatTemplate(logging.Argument, map[string]string{
+				"path": "client.xml",
+			})
+			if len(unknown) > 0 || formatted != "-Dlog4j.configurationFile=client.xml" {
+				t.Errorf("%s: the logging argument was formatted to %q", manifest.Id, formatted)
+			}
+		}
+	}
+}
+
+func TestFormatTemplateGameArguments(t *testing.T) {
+	data, err := os.ReadFile("testdata/manifests/1.12.2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := map[string]string{
+		"auth_player_name":  "Steve",
+		"version_name":      "1.12.2",
+		"game_directory":    "/game",
+		"assets_root":       "/assets",
+		"assets_index_name": "1.12",
+		"auth_uuid":         "00000000-0000-0000-0000-000000000000",
+		"auth_access_token": "0",
+		"user_type":         "msa",
+		"version_type":      "release",
+	}
+	var formatted []string
+	arguments := manifest.gameArguments()[0].Value
+	for i := range arguments {
+		argument, _ := formatTemplate(arguments[i], variables)
+		formatted = append(formatted, argument)
+	}
+	expected := []string{
+		"--username", "Steve", "--version", "1.12.2", "--gameDir", "/game", "--assetsDir", "/assets",
+		"--assetIndex", "1.12", "--uuid", "00000000-0000-0000-0000-000000000000", "--accessToken", "0",
+		"--userType", "msa", "--versionType", "release",
+	}
+	if !slices.Equal(formatted, expected) {
+		t.Fatalf("expected %v, got %v", expected, formatted)
+	}
+}
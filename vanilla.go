@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	VANILLA_PROFILE_PREFIX string = "go-launcher_"
+	VANILLA_TIME_FORMAT    string = "2006-01-02T15:04:05.000Z"
+)
+
+// The launcher_profiles.json of the official launcher. Everything is kept as raw JSON so fields this launcher does not
+// know about survive a round trip.
+type VanillaProfiles struct {
+	raw      map[string]json.RawMessage
+	Profiles map[string]map[string]any
+}
+
+func vanillaProfilesPath() string {
+	return config.VanillaDirectory + "/launcher_profiles.json"
+}
+
+func readVanillaProfiles() (*VanillaProfiles, error) {
+	profiles := VanillaProfiles{
+		raw:      map[string]json.RawMessage{},
+		Profiles: map[string]map[string]any{},
+	}
+
+	path := vanillaProfilesPath()
+	if !fileExists(path) {
+		return &profiles, nil
+	}
+
+	err := readJson(path, &profiles.raw)
+	if err != nil {
+		return nil, err
+	}
+	// A file that is only "null" leaves the maps nil
+	if profiles.raw == nil {
+		profiles.raw = map[string]json.RawMessage{}
+	}
+
+	rawProfiles, ok := profiles.raw["profiles"]
+	if ok {
+		err = json.Unmarshal(rawProfiles, &profiles.Profiles)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to parse profiles of "+path), err)
+		}
+		if profiles.Profiles == nil {
+			profiles.Profiles = map[string]map[string]any{}
+		}
+	}
+	return &profiles, nil
+}
+
+func writeVanillaProfiles(profiles *VanillaProfiles) error {
+	rawProfiles, err := json.Marshal(profiles.Profiles)
+	if err != nil {
+		return errors.Join(errors.New("failed to serialize launcher profiles"), err)
+	}
+	profiles.raw["profiles"] = rawProfiles
+	if _, ok := profiles.raw["version"]; !ok {
+		profiles.raw["version"] = json.RawMessage("3")
+	}
+
+	return writeJson(vanillaProfilesPath(), profiles.raw)
+}
+
+// Adds or updates the profile of an instance in the launcher_profiles.json of the official launcher, optionally marking
+// it as just used.
+func updateVanillaProfile(base string, instance *Instance, used bool) error {
+	profiles, err := readVanillaProfiles()
+	if err != nil {
+		return errors.Join(errors.New("failed to read launcher profiles"), err)
+	}
+
+	now := time.Now().UTC().Format(VANILLA_TIME_FORMAT)
+	key := VANILLA_PROFILE_PREFIX + instance.Name
+	profile, ok := profiles.Profiles[key]
+	if !ok || profile == nil {
+		profile = map[string]any{
+			"created": now,
+			"icon":    "Grass",
+		}
+		profiles.Profiles[key] = profile
+	}
+
+	profile["name"] = instance.Name
+	profile["gameDir"] = instance.gameDir(base)
+	switch instance.Version {
+	case VERSION_LATEST_RELEASE, VERSION_LATEST_SNAPSHOT:
+		{
+			profile["type"] = instance.Version
+		}
+	default:
+		{
+			profile["type"] = "custom"
+		}
+	}
+	profile["lastVersionId"] = instance.Version
+	if used {
+		profile["lastUsed"] = now
+	}
+
+	err = writeVanillaProfiles(profiles)
+	if err != nil {
+		return errors.Join(errors.New("failed to write launcher profiles"), err)
+	}
+	return nil
+}
+
+func instanceImportVanillaCommand(base string, args []string) error {
+	if len(args) != 0 {
+		return errors.New("expected no arguments")
+	}
+	if config.VanillaDirectory == "" {
+		return errors.New("vanillaDirectory is not configured")
+	}
+
+	profiles, err := readVanillaProfiles()
+	if err != nil {
+		return errors.Join(errors.New("failed to read launcher profiles"), err)
+	}
+
+	for key := range profiles.Profiles {
+		// Profiles of our own instances
+		if strings.HasPrefix(key, VANILLA_PROFILE_PREFIX) {
+			continue
+		}
+
+		profile := profiles.Profiles[key]
+		name, _ := profile["name"].(string)
+		version, _ := profile["lastVersionId"].(string)
+		gameDir, _ := profile["gameDir"].(string)
+		if name == "" {
+			// The built in profiles have no name
+			name, _ = profile["type"].(string)
+		}
+		if gameDir == "" {
+			gameDir = config.VanillaDirectory
+		}
+
+		name = sanitizeInstanceName(name)
+		if validateInstanceName(name) != nil {
+			fmt.Printf("Skipping profile %s, it has no usable name\n", key)
+			continue
+		}
+		if fileExists(instanceDir(base, name) + "/instance.json") {
+			fmt.Printf("Skipping profile %s, there already is an instance named %s\n", key, name)
+			continue
+		}
+
+		instance := Instance{
+			Name:    name,
+			Version: version,
+			GameDir: gameDir,
+		}
+		err = saveInstance(base, &instance)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported profile %s as %s (%s)\n", key, name, version)
+	}
+
+	return nil
+}
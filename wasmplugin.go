@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// The module WebAssembly plugins import the host API from, see wasmHostModule.
+	WASM_HOST_MODULE string = "launcher"
+
+	// Returned by the host functions when the request was refused or failed, the reason is printed by the launcher.
+	WASM_HOST_ERROR int32 = -1
+)
+
+// Runs a WebAssembly plugin for an event. It is told about the event and answers with its changes like an executable
+// plugin, on its standard input and output, but runs sandboxed: it has no file system, network, environment or clock
+// beyond what WASI provides without them. The game directory of the event is its pack, the host API lets it read files
+// from it and download files into it, see wasmHostModule.
+func runWasmPlugin(plugin string, event *PluginEvent) (*PluginChanges, error) {
+	input, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	code, err := readFile(plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(launcherContext, PLUGIN_TIMEOUT)
+	defer cancel()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	defer func() {
+		_ = runtime.Close(context.Background())
+	}()
+
+	_, err = wasi_snapshot_preview1.Instantiate(ctx, runtime)
+	if err != nil {
+		return nil, err
+	}
+	_, err = wasmHostModule(runtime, event.GameDir).Instantiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	module := wazero.NewModuleConfig().
+		WithName(filepath.Base(plugin)).
+		WithArgs(filepath.Base(plugin)).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(&output).
+		WithStderr(os.Stderr)
+	_, err = runtime.InstantiateWithConfig(ctx, code, module)
+	if err != nil {
+		var exit *sys.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() != 0 {
+			if ctx.Err() != nil {
+				return nil, errors.New(fmt.Sprintf("did not finish within %s", PLUGIN_TIMEOUT))
+			}
+			return nil, err
+		}
+	}
+	return parsePluginChanges(&output)
+}
+
+// Builds the host API of WebAssembly plugins. Strings are passed as a pointer and a length into the memory of the
+// plugin, paths are relative to the pack and use forward slashes.
+//
+//	read_file(path, path_len, buffer, buffer_len) i64
+//	    Reads a file of the pack into the buffer. Returns the size of the file, when it is larger than the buffer
+//	    only the start of it was read.
+//	download(url, url_len, path, path_len, hash, hash_len) i32
+//	    Downloads a file into the pack through the same pipeline as every other download. The hash is a hexadecimal
+//	    SHA-1 or SHA-256, files without one are refused. Returns 0 once the file is there and its hash matches.
+//
+// Both return WASM_HOST_ERROR on failure, and for paths that leave the pack or when the event has no game directory.
+func wasmHostModule(runtime wazero.Runtime, pack string) wazero.HostModuleBuilder {
+	return runtime.NewHostModuleBuilder(WASM_HOST_MODULE).
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, module api.Module, path uint32, pathLength uint32, buffer uint32, bufferLength uint32) int64 {
+			name, ok := module.Memory().Read(path, pathLength)
+			if !ok {
+				return int64(WASM_HOST_ERROR)
+			}
+			file, err := wasmPackPath(pack, string(name))
+			if err != nil {
+				fmt.Printf("Plugin %s can not read %s: %s\n", module.Name(), name, err)
+				return int64(WASM_HOST_ERROR)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Printf("Plugin %s can not read %s: %s\n", module.Name(), name, err)
+				return int64(WASM_HOST_ERROR)
+			}
+			if uint32(len(data)) > bufferLength {
+				data = data[:bufferLength]
+			}
+			if !module.Memory().Write(buffer, data) {
+				return int64(WASM_HOST_ERROR)
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				return int64(WASM_HOST_ERROR)
+			}
+			return info.Size()
+		}).
+		Export("read_file").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, module api.Module, url uint32, urlLength uint32, path uint32, pathLength uint32, hash uint32, hashLength uint32) int32 {
+			memory := module.Memory()
+			rawUrl, okUrl := memory.Read(url, urlLength)
+			rawName, okName := memory.Read(path, pathLength)
+			rawHash, okHash := memory.Read(hash, hashLength)
+			if !okUrl || !okName || !okHash {
+				return WASM_HOST_ERROR
+			}
+			source := string(rawUrl)
+			name := string(rawName)
+			sha := strings.ToLower(string(rawHash))
+			if len(sha) != 40 && len(sha) != 64 {
+				fmt.Printf("Plugin %s can not download %s: a SHA-1 or SHA-256 hash is required\n", module.Name(), source)
+				return WASM_HOST_ERROR
+			}
+			file, err := wasmPackPath(pack, name)
+			if err != nil {
+				fmt.Printf("Plugin %s can not download to %s: %s\n", module.Name(), name, err)
+				return WASM_HOST_ERROR
+			}
+			err = downloadFileRaw(file, source, &sha, 0, nil)
+			if err != nil {
+				fmt.Printf("Plugin %s failed to download %s: %s\n", module.Name(), source, err)
+				return WASM_HOST_ERROR
+			}
+			return 0
+		}).
+		Export("download")
+}
+
+// Turns a path a plugin gave into one inside of the pack. Paths that are absolute, climb out of the pack or lead out
+// of it through a link are refused.
+func wasmPackPath(pack string, name string) (string, error) {
+	if pack == "" {
+		return "", errors.New("the event has no pack")
+	}
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		return "", errors.New("the path is not inside of the pack")
+	}
+	root, err := filepath.EvalSymlinks(pack)
+	if err != nil {
+		return "", err
+	}
+
+	// The file may not exist yet, the part of the path that does is what could lead out of the pack
+	path := filepath.Join(root, name)
+	existing := path
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+				return "", errors.New("the path is not inside of the pack")
+			}
+			return path, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		existing = filepath.Dir(existing)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Kills the game when it goes longer than the timeout without writing anything before it finished starting, a game
+// stuck loading natives or opening the audio device would otherwise keep the launcher waiting forever. The game is
+// started when it logs one of the startupMarkers, from then on it may stay quiet as long as it wants. Returns a
+// function that stops watching, it has to be called once the game exited.
+func watchStartup(process *exec.Cmd, watcher *LogWatcher, timeout time.Duration) func() {
+	if timeout <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	launched := time.Now()
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				{
+					return
+				}
+			case <-ticker.C:
+				{
+					watcher.lock.Lock()
+					started := watcher.started
+					quiet := time.Since(launched)
+					if !watcher.lastOutput.IsZero() {
+						quiet = time.Since(watcher.lastOutput)
+					}
+					if !started && quiet >= timeout {
+						watcher.hung = true
+					}
+					hung := watcher.hung
+					watcher.lock.Unlock()
+
+					if started {
+						return
+					}
+					if hung {
+						fmt.Printf("The game logged nothing for %s while starting, stopping it\n", timeout)
+						_ = process.Process.Kill()
+						return
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
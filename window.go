@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+)
+
+// The size of the game window and if it starts fullscreen. The game picks the size when both are 0, setting only one
+// of them is an error.
+type WindowConfig struct {
+	Width      uint32 `json:"width"`
+	Height     uint32 `json:"height"`
+	Fullscreen bool   `json:"fullscreen"`
+}
+
+func (this *WindowConfig) validate() error {
+	if (this.Width == 0) != (this.Height == 0) {
+		return errors.New("the width and height of the window have to be set together")
+	}
+	return nil
+}
+
+// Returns the window a launch uses, the options of the launch override the config field by field.
+func launchWindow(options *LaunchOptions) (WindowConfig, error) {
+	window := config.Window
+	if options.Width != 0 {
+		window.Width = options.Width
+	}
+	if options.Height != 0 {
+		window.Height = options.Height
+	}
+	if options.Fullscreen {
+		window.Fullscreen = true
+	}
+	return window, window.validate()
+}
+
+// Registers the flags that change the window of a launch.
+func bindWindowFlags(set *flag.FlagSet, options *LaunchOptions) {
+	size := func(target *uint32) func(string) error {
+		return func(value string) error {
+			parsed, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || parsed == 0 {
+				return errors.New("invalid window size " + value)
+			}
+			*target = uint32(parsed)
+			return nil
+		}
+	}
+	set.Func("width", "the width of the game window, overrides window.width of the config", size(&options.Width))
+	set.Func("height", "the height of the game window, overrides window.height of the config", size(&options.Height))
+	set.BoolVar(&options.Fullscreen, "fullscreen", false, "start the game fullscreen")
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os/exec"
+)
+
+// Returns the command the java of an instance is run through, like "gamemoderun" or "nice -n 10". The one of the
+// instance wins over the one of the config.
+func instanceWrapper(instance *Instance) []string {
+	if len(instance.Wrapper) > 0 {
+		return instance.Wrapper
+	}
+	return config.Wrapper
+}
+
+// Puts the wrapper of an instance in front of a command line. Returns the command line unchanged when there is none.
+func wrapCommand(instance *Instance, executable string, args []string) (string, []string) {
+	wrapper := instanceWrapper(instance)
+	if len(wrapper) == 0 {
+		return executable, args
+	}
+	return wrapper[0], append(append(append([]string{}, wrapper[1:]...), executable), args...)
+}
+
+// Creates the process of java for an instance, run through its wrapper.
+func executeWrapped(instance *Instance, executable string, args ...string) *exec.Cmd {
+	executable, args = wrapCommand(instance, executable, args)
+	return execute(executable, args...)
+}